@@ -0,0 +1,124 @@
+package configarr
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// procDir is the mount point of the proc filesystem used to look up running processes.
+var procDir = "/proc"
+
+// appCheckTimeout is how long to wait for a TCP connection when probing a port.
+const appCheckTimeout = time.Second
+
+// checkAppStopped verifies that the application described by each check is not running.
+// A check has the form "process:<name>", "pidfile:<path>" or "port:[<host>:]<port>".
+func checkAppStopped(checks []string) error {
+	for _, check := range checks {
+		kind, target, found := strings.Cut(check, ":")
+		if !found || target == "" {
+			return fmt.Errorf("invalid app check %q: expected process:<name>, pidfile:<path> or port:[<host>:]<port>", check)
+		}
+
+		var running bool
+		var err error
+		switch kind {
+		case "process":
+			running, err = isProcessRunning(procDir, target)
+		case "pidfile":
+			running, err = isPidfileRunning(target)
+		case "port":
+			running = isPortOpen(target)
+		default:
+			return fmt.Errorf("invalid app check %q: unknown kind %q", check, kind)
+		}
+		if err != nil {
+			return fmt.Errorf("error checking %q: %w", check, err)
+		}
+		if running {
+			return fmt.Errorf("application is running (%s)", check)
+		}
+	}
+	return nil
+}
+
+// isProcessRunning reports whether a process other than ourselves has the given
+// name as its command name or as the base name of one of its arguments.
+func isProcessRunning(procDir string, name string) (bool, error) {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return false, err
+	}
+
+	self := os.Getpid()
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue // Not a process directory
+		}
+
+		if comm, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "comm")); err == nil {
+			if strings.TrimSpace(string(comm)) == name {
+				return true, nil
+			}
+		}
+
+		cmdline, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "cmdline"))
+		if err != nil {
+			continue // Process exited in the meantime
+		}
+		for _, arg := range strings.Split(string(cmdline), "\x00") {
+			base := filepath.Base(arg)
+			if base == name || base == name+".exe" {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// isPidfileRunning reports whether the process referenced by the pidfile is alive.
+// A missing pidfile means the application is stopped.
+func isPidfileRunning(pidfile string) (bool, error) {
+	content, err := os.ReadFile(pidfile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return false, fmt.Errorf("invalid pid in %s", pidfile)
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false, nil
+	}
+	// Signal 0 performs error checking only; EPERM still means the process exists
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM, nil
+}
+
+// isPortOpen reports whether something accepts TCP connections on the address.
+// A bare port number is probed on localhost.
+func isPortOpen(address string) bool {
+	if !strings.Contains(address, ":") {
+		address = net.JoinHostPort("localhost", address)
+	}
+
+	conn, err := net.DialTimeout("tcp", address, appCheckTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
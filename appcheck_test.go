@@ -0,0 +1,98 @@
+package configarr
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// TestCheckAppStopped tests detecting running applications before modifying their config.
+func TestCheckAppStopped(t *testing.T) {
+	t.Run("No checks", func(t *testing.T) {
+		if err := checkAppStopped(nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Invalid check", func(t *testing.T) {
+		if err := checkAppStopped([]string{"service:sonarr"}); err == nil {
+			t.Fatal("Expected error for unknown check kind, but got none")
+		}
+
+		if err := checkAppStopped([]string{"port"}); err == nil {
+			t.Fatal("Expected error for check without target, but got none")
+		}
+	})
+
+	t.Run("Port in use", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Unexpected error listening: %v", err)
+		}
+		defer listener.Close()
+
+		if err := checkAppStopped([]string{"port:" + listener.Addr().String()}); err == nil {
+			t.Fatal("Expected error for open port, but got none")
+		}
+	})
+
+	t.Run("Pidfile of running process", func(t *testing.T) {
+		pidfile := filepath.Join(t.TempDir(), "app.pid")
+		if err := os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing pidfile: %v", err)
+		}
+
+		if err := checkAppStopped([]string{"pidfile:" + pidfile}); err == nil {
+			t.Fatal("Expected error for running process, but got none")
+		}
+	})
+
+	t.Run("Missing pidfile", func(t *testing.T) {
+		if err := checkAppStopped([]string{"pidfile:" + filepath.Join(t.TempDir(), "app.pid")}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+}
+
+// TestIsProcessRunning tests looking up processes by name in a fake proc filesystem.
+func TestIsProcessRunning(t *testing.T) {
+	dir := t.TempDir()
+	writeProc := func(pid, comm, cmdline string) {
+		if err := os.MkdirAll(filepath.Join(dir, pid), 0755); err != nil {
+			t.Fatalf("Unexpected error creating proc dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, pid, "comm"), []byte(comm+"\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing comm: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, pid, "cmdline"), []byte(cmdline), 0644); err != nil {
+			t.Fatalf("Unexpected error writing cmdline: %v", err)
+		}
+	}
+	writeProc("100", "Sonarr", "/app/sonarr/bin/Sonarr\x00-nobrowser\x00")
+	writeProc("200", "mono", "mono\x00/opt/Lidarr/Lidarr.exe\x00")
+	if err := os.MkdirAll(filepath.Join(dir, "self"), 0755); err != nil {
+		t.Fatalf("Unexpected error creating proc dir: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		running bool
+	}{
+		{"Sonarr", true},
+		{"Lidarr", true},
+		{"Radarr", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			running, err := isProcessRunning(dir, tt.name)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if running != tt.running {
+				t.Fatalf("Expected running=%v, got %v", tt.running, running)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package configarr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultBackups is the number of backups kept when backups are enabled without a count.
+const DefaultBackups = 5
+
+// backupSuffix separates the name of the configuration file from the time of a backup,
+// as in config.xml.bak.20240131T142501.123Z.
+const backupSuffix = ".bak."
+
+// backupTimeFormat is the UTC time in the names of backups, which sort chronologically.
+const backupTimeFormat = "20060102T150405.000Z"
+
+// RemoveFS is implemented by filesystems that can list and remove files, so old backups
+// can be pruned. Without it, backups are written but never removed.
+type RemoveFS interface {
+	fs.ReadDirFS
+	Remove(name string) error
+}
+
+// removeFile removes the named file, failing with errors.ErrUnsupported when the
+// filesystem doesn't implement RemoveFS.
+func removeFile(fsys FS, name string) error {
+	if remover, ok := fsys.(RemoveFS); ok {
+		return remover.Remove(name)
+	}
+	return errors.ErrUnsupported
+}
+
+// backupConfig writes the content the configuration file had before the run to a copy
+// named after the time next to it, with the mode of the file, and removes all but the
+// newest keep backups. It returns the name of the backup.
+func backupConfig(fsys FS, name string, content []byte, now time.Time, keep int, logger *slog.Logger) (string, error) {
+	perm := fs.FileMode(0600)
+	if info, err := fsys.Stat(name); err == nil {
+		perm = info.Mode().Perm()
+	}
+	backup := name + backupSuffix + now.UTC().Format(backupTimeFormat)
+	if err := fsys.WriteFile(backup, content, perm); err != nil {
+		return "", fmt.Errorf("error writing backup %s: %w", backup, err)
+	}
+
+	backups, err := listBackups(fsys, name)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Error listing backups of %s: %s", name, err), warningAttr(WarningBackup, ""))
+		return backup, nil
+	}
+	for _, old := range backups[:max(len(backups)-keep, 0)] {
+		if err := removeFile(fsys, old); errors.Is(err, errors.ErrUnsupported) {
+			logger.Debug(fmt.Sprintf("Not pruning backups of %s: the filesystem can't remove files", name))
+			break
+		} else if err != nil {
+			logger.Warn(fmt.Sprintf("Error removing old backup %s: %s", old, err), warningAttr(WarningBackup, ""))
+		}
+	}
+	return backup, nil
+}
+
+// listBackups returns the backups of the named file, oldest first.
+func listBackups(fsys fs.FS, name string) ([]string, error) {
+	dir, base := filepath.Dir(name), filepath.Base(name)
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		stamp, found := strings.CutPrefix(entry.Name(), base+backupSuffix)
+		if !found || !entry.Type().IsRegular() {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue // Not one of ours, e.g. config.xml.bak.old
+		}
+		backups = append(backups, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Restore rolls back a run that wrote the configuration file, e.g. because another file
+// of the same change failed: it copies the backup of the run over the file, or writes
+// the content the file had before the run when it wasn't backed up. The options select
+// the filesystem, which must be the one of the run. Runs that didn't write are left
+// alone. It returns the name of the backup restored, if any.
+func Restore(result Result, opts ...Option) (string, error) {
+	if !result.Written {
+		return "", nil
+	}
+	o, err := newOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	content := result.Original
+	if result.Backup != "" {
+		if content, err = fs.ReadFile(o.fs, result.Backup); err != nil {
+			return "", categorize(ErrWrite, fmt.Errorf("error restoring %s: %w", result.ConfigPath, err))
+		}
+	}
+	if err := writeOutputToFile(o.fs, content, result.ConfigPath); err != nil {
+		return "", categorize(ErrWrite, fmt.Errorf("error restoring %s: %w", result.ConfigPath, err))
+	}
+	return result.Backup, nil
+}
@@ -0,0 +1,119 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestRun_Backups tests that the original content is backed up before changes are
+// written and that only the newest backups are kept.
+func TestRun_Backups(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.xml")
+	if err := os.WriteFile(file, []byte("<Config><Port>1</Port></Config>"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Not one of the backups, so it is never removed
+	if err := os.WriteFile(file+".bak.old", nil, 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	now := time.Date(2024, 1, 31, 14, 25, 1, 0, time.UTC)
+	clock := ClockFunc(func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+	var results []Result
+	for _, port := range []string{"2", "3", "4", "4"} {
+		result, err := Run(context.Background(),
+			WithConfigPath(file),
+			WithBackups(2),
+			WithClock(clock),
+			WithSources(StaticSource(Override{Key: "Port", Value: port})),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	backups, err := listBackups(OSFS(), file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(backups) != 2 || backups[0] != results[1].Backup || backups[1] != results[2].Backup {
+		t.Fatalf("Expected the backups of the second and third run, got %v", backups)
+	}
+	if results[3].Backup != "" {
+		t.Fatalf("Expected no backup for a run without changes, got %s", results[3].Backup)
+	}
+	if !strings.HasPrefix(backups[1], file+".bak.20240131T1425") || !strings.HasSuffix(backups[1], ".000Z") {
+		t.Fatalf("Expected the backup to be named after the time, got %s", backups[1])
+	}
+	data, err := os.ReadFile(backups[1])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), "<Port>3</Port>") {
+		t.Fatalf("Expected the content before the third run, got %s", data)
+	}
+	if info, err := os.Stat(backups[1]); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the backup to keep the mode of the file, got %v, %v", info, err)
+	}
+	if _, err := os.Stat(file + ".bak.old"); err != nil {
+		t.Fatalf("Expected other files to be kept, got %v", err)
+	}
+
+	t.Run("Without RemoveFS", func(t *testing.T) {
+		fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte("<Config><Port>1</Port></Config>")}}}
+		for _, port := range []string{"2", "3"} {
+			if _, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithBackups(1), WithClock(clock),
+				WithSources(StaticSource(Override{Key: "Port", Value: port}))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if backups, _ := listBackups(fsys, "config.xml"); len(backups) != 2 {
+			t.Fatalf("Expected backups to be kept without a way to remove them, got %v", backups)
+		}
+	})
+}
+
+// TestRestore tests rolling back a run from its backup or its original content.
+func TestRestore(t *testing.T) {
+	for _, backups := range []int{0, 1} {
+		t.Run(fmt.Sprintf("Backups %d", backups), func(t *testing.T) {
+			original := []byte("<Config><Port>1</Port></Config>")
+			fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: original}}}
+			result, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithBackups(backups),
+				WithSources(StaticSource(Override{Key: "Port", Value: "2"})))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			backup, err := Restore(result, WithFS(fsys))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if backup != result.Backup || (backups > 0) != (backup != "") {
+				t.Fatalf("Expected the backup %q to be restored, got %q", result.Backup, backup)
+			}
+			if data := fsys.MapFS["config.xml"].Data; !bytes.Equal(data, original) {
+				t.Fatalf("Expected the original content, got %s", data)
+			}
+		})
+	}
+
+	t.Run("Not written", func(t *testing.T) {
+		if backup, err := Restore(Result{ConfigPath: "config.xml"}, WithFS(mapFS{fstest.MapFS{}})); err != nil || backup != "" {
+			t.Fatalf("Expected nothing to restore, got %q, %v", backup, err)
+		}
+	})
+}
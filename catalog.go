@@ -0,0 +1,177 @@
+package configarr
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+//go:embed catalog.json
+var embeddedCatalog []byte
+
+// catalogFetchTimeout bounds the time spent downloading a catalog from --catalog-url.
+const catalogFetchTimeout = 10 * time.Second
+
+// Catalog describes the configuration keys known for each application.
+type Catalog struct {
+	Apps map[string]CatalogApp `json:"apps"`
+}
+
+// CatalogApp lists the configuration keys of a single application.
+type CatalogApp struct {
+	DefaultPort int          `json:"defaultPort,omitempty"` // Port the app listens on out of the box, used to detect it
+	Keys        []CatalogKey `json:"keys"`
+}
+
+// CatalogKey describes a single configuration key.
+type CatalogKey struct {
+	Name    string `json:"name"`
+	Restart bool   `json:"restart,omitempty"` // Changing the key only takes effect after an app restart
+}
+
+// parseCatalog decodes a catalog document.
+func parseCatalog(data []byte) (*Catalog, error) {
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("error parsing catalog: %w", err)
+	}
+	return &catalog, nil
+}
+
+// LoadCatalog returns the embedded catalog, with apps from the catalog file and URL
+// replacing the embedded definitions of the same name.
+func LoadCatalog(catalogFile, catalogURL string) (*Catalog, error) {
+	catalog, err := parseCatalog(embeddedCatalog)
+	if err != nil {
+		return nil, fmt.Errorf("embedded catalog: %w", err)
+	}
+
+	if catalogFile != "" {
+		data, err := os.ReadFile(catalogFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading catalog file %s: %w", catalogFile, err)
+		}
+		if err := catalog.merge(data); err != nil {
+			return nil, fmt.Errorf("catalog file %s: %w", catalogFile, err)
+		}
+	}
+
+	if catalogURL != "" {
+		data, err := fetchCatalog(catalogURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := catalog.merge(data); err != nil {
+			return nil, fmt.Errorf("catalog %s: %w", catalogURL, err)
+		}
+	}
+
+	return catalog, nil
+}
+
+// merge decodes data as a catalog and replaces or adds its apps.
+func (c *Catalog) merge(data []byte) error {
+	override, err := parseCatalog(data)
+	if err != nil {
+		return err
+	}
+	if c.Apps == nil {
+		c.Apps = make(map[string]CatalogApp)
+	}
+	for name, app := range override.Apps {
+		c.Apps[name] = app
+	}
+	return nil
+}
+
+// fetchCatalog downloads a catalog document.
+func fetchCatalog(catalogURL string) ([]byte, error) {
+	client := &http.Client{Timeout: catalogFetchTimeout}
+	resp, err := client.Get(catalogURL)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching catalog %s: %w", catalogURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching catalog %s: unexpected status %s", catalogURL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog %s: %w", catalogURL, err)
+	}
+	return data, nil
+}
+
+// IsKnownKey reports whether any application in the catalog defines the key.
+// A nil catalog knows no keys.
+func (c *Catalog) IsKnownKey(key string) bool {
+	if c == nil {
+		return false
+	}
+	for _, app := range c.Apps {
+		for _, k := range app.Keys {
+			if k.Name == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keyIndex returns the lowest position of the key in the key lists of the catalog's
+// applications, or -1 when no application defines it.
+func (c *Catalog) keyIndex(key string) int {
+	index := -1
+	if c == nil {
+		return index
+	}
+	for _, app := range c.Apps {
+		for i, k := range app.Keys {
+			if k.Name == key && (index < 0 || i < index) {
+				index = i
+			}
+		}
+	}
+	return index
+}
+
+// RequiresRestart reports whether any application in the catalog marks the key as
+// requiring a restart. A nil catalog marks no keys.
+func (c *Catalog) RequiresRestart(key string) bool {
+	if c == nil {
+		return false
+	}
+	for _, app := range c.Apps {
+		for _, k := range app.Keys {
+			if k.Name == key && k.Restart {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reportUnmatchedOverrides logs overrides for properties missing from the configuration
+// file: known keys at debug level, unknown keys (likely typos) as warnings.
+func reportUnmatchedOverrides(overrides []Override, config *Config, catalog *Catalog, logger *slog.Logger) {
+	reported := make(map[string]bool)
+	for _, override := range overrides {
+		if _, exists := config.Properties[override.Key]; exists || override.Delete || reported[override.Key] {
+			continue
+		}
+		reported[override.Key] = true
+
+		if catalog.IsKnownKey(override.Key) {
+			logger.Debug(fmt.Sprintf("Skipping '%s': key is not present in the configuration file", override.Key))
+			continue
+		}
+		logger.Warn(fmt.Sprintf("Skipping '%s': unknown key, not present in the configuration file or catalog", override.Key), warningAttr(WarningUnknownKey, override.Key))
+	}
+}
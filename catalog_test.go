@@ -0,0 +1,122 @@
+package configarr
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadCatalog tests loading the embedded catalog and its runtime overrides.
+func TestLoadCatalog(t *testing.T) {
+	t.Run("Embedded catalog", func(t *testing.T) {
+		catalog, err := LoadCatalog("", "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, app := range []string{"lidarr", "plex", "prowlarr", "radarr", "readarr", "sonarr", "whisparr"} {
+			if _, found := catalog.Apps[app]; !found {
+				t.Fatalf("Expected app %s in embedded catalog", app)
+			}
+		}
+
+		if !catalog.IsKnownKey("ApiKey") || catalog.IsKnownKey("ApiKye") {
+			t.Fatal("Expected ApiKey to be known and ApiKye to be unknown")
+		}
+	})
+
+	t.Run("Catalog file replaces apps", func(t *testing.T) {
+		catalogFile := filepath.Join(t.TempDir(), "catalog.json")
+		content := `{"apps":{"sonarr":{"keys":[{"name":"NewKey"}]},"bazarr":{"keys":[{"name":"Other"}]}}}`
+		if err := os.WriteFile(catalogFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing catalog: %v", err)
+		}
+
+		catalog, err := LoadCatalog(catalogFile, "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(catalog.Apps["sonarr"].Keys) != 1 || !catalog.IsKnownKey("NewKey") || !catalog.IsKnownKey("Other") {
+			t.Fatalf("Expected catalog file to replace sonarr and add bazarr, got %+v", catalog.Apps)
+		}
+
+		if _, found := catalog.Apps["radarr"]; !found {
+			t.Fatal("Expected embedded radarr definition to be kept")
+		}
+	})
+
+	t.Run("Catalog URL", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"apps":{"sonarr":{"keys":[{"name":"RemoteKey"}]}}}`))
+		}))
+		defer server.Close()
+
+		catalog, err := LoadCatalog("", server.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !catalog.IsKnownKey("RemoteKey") {
+			t.Fatal("Expected RemoteKey from catalog URL to be known")
+		}
+	})
+
+	t.Run("Catalog URL error status", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		defer server.Close()
+
+		if _, err := LoadCatalog("", server.URL); err == nil {
+			t.Fatal("Expected error for missing catalog, but got none")
+		}
+	})
+
+	t.Run("Invalid catalog file", func(t *testing.T) {
+		catalogFile := filepath.Join(t.TempDir(), "catalog.json")
+		if err := os.WriteFile(catalogFile, []byte(`{"apps":`), 0644); err != nil {
+			t.Fatalf("Unexpected error writing catalog: %v", err)
+		}
+
+		if _, err := LoadCatalog(catalogFile, ""); err == nil {
+			t.Fatal("Expected error for invalid catalog, but got none")
+		}
+	})
+}
+
+// TestReportUnmatchedOverrides tests logging overrides for properties missing from the file.
+func TestReportUnmatchedOverrides(t *testing.T) {
+	catalog, err := LoadCatalog("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	config := &Config{
+		Properties: map[string]string{"LogLevel": "info"},
+		Keys:       []string{"LogLevel"},
+	}
+	overrides := []Override{
+		{Key: "LogLevel", Value: "debug"},
+		{Key: "UrlBase", Value: "/sonarr"},
+		{Key: "LogLevle", Value: "debug"},
+	}
+
+	var stdOut strings.Builder
+	logger := slog.New(slog.NewTextHandler(&stdOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	reportUnmatchedOverrides(overrides, config, catalog, logger)
+
+	if !strings.Contains(stdOut.String(), "level=DEBUG msg=\"Skipping 'UrlBase'") {
+		t.Fatalf("Expected debug entry for known key, got: %s", stdOut.String())
+	}
+
+	if !strings.Contains(stdOut.String(), "level=WARN msg=\"Skipping 'LogLevle': unknown key") {
+		t.Fatalf("Expected warning for unknown key, got: %s", stdOut.String())
+	}
+
+	if strings.Contains(stdOut.String(), "'LogLevel'") {
+		t.Fatalf("Expected no entry for present key, got: %s", stdOut.String())
+	}
+}
@@ -0,0 +1,63 @@
+package configarr
+
+import (
+	"crypto/rand"
+	"io"
+	"time"
+)
+
+// Clock tells the time. Embedders and tests can pass their own with WithClock to make
+// timestamps, e.g. of events, backups and the state file, and durations deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+// Now calls f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock returns the clock of the operating system.
+func SystemClock() Clock {
+	return ClockFunc(time.Now)
+}
+
+// FixedClock returns a clock that is always at t, e.g. for golden tests.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// SystemRandom returns the cryptographically secure random source of the operating
+// system, which e.g. the nonces of encrypted files are read from by default.
+func SystemRandom() io.Reader {
+	return rand.Reader
+}
+
+// FixedRandom returns a random source repeating the seed over and over, so e.g. encrypted
+// files are the same on every run of a golden test. It is not random at all, so never use
+// it outside of tests.
+func FixedRandom(seed []byte) io.Reader {
+	return &repeatReader{seed: seed}
+}
+
+// repeatReader reads its seed over and over, or zeros for an empty seed.
+type repeatReader struct {
+	seed []byte
+	next int
+}
+
+// Read fills p with the seed, continuing where the last read stopped.
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		if len(r.seed) == 0 {
+			p[i] = 0
+			continue
+		}
+		p[i] = r.seed[r.next]
+		r.next = (r.next + 1) % len(r.seed)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,77 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWithClock tests that runs take their timestamps and durations from the clock.
+func TestWithClock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.xml")
+	stateFile := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(path, []byte("<Config><Port>8989</Port></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var events strings.Builder
+	w, err := NewEventWriter("ndjson", &events)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result, err := Run(context.Background(),
+		WithConfigPath(path),
+		WithSources(StaticSource(Override{Key: "Port", Value: "9000"})),
+		WithEvents(w),
+		WithStateFile(stateFile),
+		WithClock(FixedClock(at)),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Summary.Duration != 0 {
+		t.Fatalf("Expected no duration with a fixed clock, got %s", result.Summary.Duration)
+	}
+	if !strings.Contains(events.String(), `"time":"2024-05-01T12:00:00Z"`) {
+		t.Fatalf("Expected event timestamp from the clock, got %s", events.String())
+	}
+
+	provenance, err := LoadProvenance(stateFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entry := provenance.Files[path]["Port"]; !entry.Time.Equal(at) {
+		t.Fatalf("Expected provenance time %s, got %s", at, entry.Time)
+	}
+}
+
+// TestFixedRandom tests that a fixed random source makes encrypted files reproducible.
+func TestFixedRandom(t *testing.T) {
+	encrypt := func() []byte {
+		codec, err := NewAESGCMCodecWith(bytes.Repeat([]byte{1}, 32), FixedRandom([]byte{7, 8, 9}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		stored, err := codec.Encode([]byte("<Config><Port>8989</Port></Config>"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return stored
+	}
+
+	first, second := encrypt(), encrypt()
+	if !bytes.Equal(first, second) {
+		t.Fatal("Expected the same ciphertext from the same random source")
+	}
+	if !bytes.HasPrefix(first, []byte{7, 8, 9, 7, 8, 9}) {
+		t.Fatalf("Expected the nonce to be read from the random source, got %x", first[:12])
+	}
+}
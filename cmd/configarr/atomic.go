@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"configarr"
+)
+
+// stagedTarget is a configuration file planned by applyAtomically, waiting to be written.
+type stagedTarget struct {
+	plan *configarr.Plan
+	opts []configarr.Option
+}
+
+// applyAtomically applies the overrides to all targets or to none, so a media stack never
+// ends up half-provisioned. Every file is planned and dry-run first, so invalid overrides
+// and unparsable files are found before any file is written. When writing a file fails,
+// the files written before are restored from their backups, see configarr.Restore.
+func applyAtomically(ctx context.Context, environ []string, flags Flags, targets []PrefixTarget, documentOverrides []configarr.Override, catalog *configarr.Catalog, opts []configarr.Option, logger *slog.Logger) (bool, error) {
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil)) // The write logs the same again
+
+	var staged []stagedTarget
+	var errs []error
+	for _, target := range targets {
+		fileFlags := flags
+		fileFlags.ConfigFilePath, fileFlags.Prefix = target.Path, target.Prefix
+		sources, err := configSources(environ, fileFlags, documentOverrides, catalog, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Path, err))
+			continue
+		}
+		fileOpts := append(append([]configarr.Option{}, opts...), configarr.WithConfigPath(target.Path), configarr.WithSources(sources...))
+		plan, err := configarr.NewPlan(ctx, fileOpts...)
+		if err == nil {
+			_, err = configarr.ApplyPlan(ctx, plan, append(fileOpts, configarr.WithDryRun(), configarr.WithEvents(nil), configarr.WithLogger(quiet))...)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Path, err))
+			continue
+		}
+		staged = append(staged, stagedTarget{plan: plan, opts: fileOpts})
+	}
+	if len(errs) > 0 {
+		logger.Error("Not writing any configuration file: planning failed.")
+		return false, errors.Join(errs...)
+	}
+
+	changed := false
+	var written []configarr.Result
+	for i, target := range staged {
+		result, err := configarr.ApplyPlan(ctx, target.plan, target.opts...)
+		if result.Written {
+			written = append(written, result)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", targets[i].Path, err)
+			return false, errors.Join(err, rollback(written, opts, logger))
+		}
+		changed = changed || len(result.Changed) > 0
+	}
+	return changed, nil
+}
+
+// rollback restores the files written by an atomic apply, newest first, and returns the
+// errors of the files that couldn't be restored.
+func rollback(written []configarr.Result, opts []configarr.Option, logger *slog.Logger) error {
+	var errs []error
+	for i := len(written) - 1; i >= 0; i-- {
+		result := written[i]
+		backup, err := configarr.Restore(result, opts...)
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case backup != "":
+			logger.Info(fmt.Sprintf("Rolled back %s from %s", result.ConfigPath, backup))
+		default:
+			logger.Info(fmt.Sprintf("Rolled back %s", result.ConfigPath))
+		}
+	}
+	return errors.Join(errs...)
+}
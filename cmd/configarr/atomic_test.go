@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// failingFS is a filesystem failing to write one file.
+type failingFS struct {
+	configarr.FS
+	name string
+}
+
+// WriteFile fails for the failing file and writes the others.
+func (f failingFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if name == f.name {
+		return errors.New("disk full")
+	}
+	return f.FS.WriteFile(name, data, perm)
+}
+
+// TestApplyAtomically tests that the files written before a failing one are rolled back.
+func TestApplyAtomically(t *testing.T) {
+	dir := t.TempDir()
+	sonarr, radarr := filepath.Join(dir, "sonarr.xml"), filepath.Join(dir, "radarr.xml")
+	original := "<Config>\n  <Port>8989</Port>\n</Config>\n"
+	for _, file := range []string{sonarr, radarr} {
+		if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+	}
+	catalog, err := configarr.LoadCatalog("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	flags, err := parseFlags([]string{"--config", sonarr, "--config", radarr, "--atomic", "--backup"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	targets := []PrefixTarget{{Prefix: flags.Prefix, Path: sonarr}, {Prefix: flags.Prefix, Path: radarr}}
+	environ := []string{"CONFIGARR__PORT=Port=9000"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("Second target fails", func(t *testing.T) {
+		opts := []configarr.Option{configarr.WithFS(failingFS{FS: configarr.OSFS(), name: radarr}), configarr.WithCatalog(catalog), configarr.WithBackups(flags.Backups), configarr.WithLogger(logger)}
+		changed, err := applyAtomically(context.Background(), environ, flags, targets, nil, catalog, opts, logger)
+		if err == nil || !strings.Contains(err.Error(), "disk full") || changed {
+			t.Fatalf("Expected the write error, got %v (changed %t)", err, changed)
+		}
+		for _, file := range []string{sonarr, radarr} {
+			if data, _ := os.ReadFile(file); string(data) != original {
+				t.Fatalf("Expected %s to be rolled back, got:\n%s", file, data)
+			}
+		}
+	})
+
+	t.Run("Planning fails", func(t *testing.T) {
+		if err := os.WriteFile(radarr, []byte("<Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		defer os.WriteFile(radarr, []byte(original), 0644)
+
+		opts := []configarr.Option{configarr.WithCatalog(catalog), configarr.WithLogger(logger)}
+		if _, err := applyAtomically(context.Background(), environ, flags, targets, nil, catalog, opts, logger); err == nil {
+			t.Fatal("Expected error for an unparsable file, but got none")
+		}
+		if data, _ := os.ReadFile(sonarr); string(data) != original {
+			t.Fatalf("Expected no file to be written, got:\n%s", data)
+		}
+	})
+
+	t.Run("All targets written", func(t *testing.T) {
+		opts := []configarr.Option{configarr.WithCatalog(catalog), configarr.WithLogger(logger)}
+		changed, err := applyAtomically(context.Background(), environ, flags, targets, nil, catalog, opts, logger)
+		if err != nil || !changed {
+			t.Fatalf("Expected both files to change, got %v (changed %t)", err, changed)
+		}
+		for _, file := range []string{sonarr, radarr} {
+			if data, _ := os.ReadFile(file); !strings.Contains(string(data), "<Port>9000</Port>") {
+				t.Fatalf("Expected %s to be updated, got:\n%s", file, data)
+			}
+		}
+	})
+}
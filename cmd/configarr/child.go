@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+
+	"configarr"
+)
+
+// runExec applies the overrides like a plain run, then replaces configarr with the
+// command given after "--", which is required. It only returns when the configuration
+// can't be applied or the command can't be started.
+func runExec(environ []string, args []string, stdin io.Reader, output io.Writer) error {
+	flags, err := parseFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+	if len(flags.Command) == 0 {
+		return invalidInput(errors.New("missing command after --, e.g. configarr exec -- /app/sonarr/bin/Sonarr"))
+	}
+	if flags.DryRun {
+		return invalidInput(errors.New("--dry-run can't be combined with exec"))
+	}
+	_, err = apply(environ, flags, stdin, output)
+	return err
+}
+
+// execChild replaces configarr with the command given after "--", so configarr can run
+// as the init process of the app's container. Nothing happens without a command.
+func execChild(flags Flags, environ []string) error {
+	if len(flags.Command) == 0 {
+		return nil
+	}
+
+	path, err := exec.LookPath(flags.Command[0])
+	if err != nil {
+		return fmt.Errorf("error looking up %s: %w", flags.Command[0], err)
+	}
+	env := environ
+	for _, target := range flags.PrefixTargets {
+		env = childEnviron(env, target.Prefix, flags.AllowKeys, flags.StripEnv, nil)
+	}
+	env = childEnviron(env, flags.Prefix, flags.AllowKeys, flags.StripEnv, flags.ChildEnv)
+	if err := execve(path, flags.Command, env); err != nil {
+		return fmt.Errorf("error executing %s: %w", flags.Command[0], err)
+	}
+	return nil
+}
+
+// childEnviron returns the environment of the child: configarr's own, without the
+// variables matching the prefix or its unset prefix in any case, and any of the allowed
+// patterns if set, when strip is set, with the extra KEY=VALUE pairs replacing or adding
+// variables.
+func childEnviron(environ []string, prefix string, allow []string, strip bool, extra []string) []string {
+	override := make(map[string]bool, len(extra))
+	for _, pair := range extra {
+		name, _, _ := strings.Cut(pair, "=")
+		override[name] = true
+	}
+
+	var env []string
+	for _, pair := range environ {
+		name, _, _ := strings.Cut(pair, "=")
+		stripped := configarr.MatchPrefix(name, prefix) || configarr.MatchPrefix(name, configarr.UnsetPrefix(prefix))
+		if len(allow) > 0 {
+			stripped = stripped && slices.ContainsFunc(allow, func(pattern string) bool {
+				matched, _ := path.Match(strings.ToUpper(pattern), strings.ToUpper(name))
+				return matched
+			})
+		}
+		if override[name] || (strip && stripped) {
+			continue
+		}
+		env = append(env, pair)
+	}
+	return append(env, extra...)
+}
@@ -0,0 +1,42 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// execve runs the command as a child process, forwarding the signals configarr receives,
+// and exits with its exit code, since the current process can't be replaced on this platform.
+var execve = func(path string, args []string, env []string) error {
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		for sig := range signals {
+			_ = cmd.Process.Signal(sig) // Not every signal can be delivered on every platform
+		}
+	}()
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestChildEnviron tests building the environment of the command run after configarr.
+func TestChildEnviron(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "CONFIGARR__APIKEY=secret", "CONFIGARR_UNSET__SSL=SslCertPath", "TZ=UTC"}
+
+	t.Run("Keep environment without strip", func(t *testing.T) {
+		env := childEnviron(environ, "CONFIGARR__", nil, false, nil)
+		if !reflect.DeepEqual(env, environ) {
+			t.Fatalf("Expected environment %v, got %v", environ, env)
+		}
+	})
+
+	t.Run("Strip prefixed variables", func(t *testing.T) {
+		env := childEnviron(environ, "configarr__", nil, true, nil)
+		expected := []string{"PATH=/usr/bin", "TZ=UTC"}
+		if !reflect.DeepEqual(env, expected) {
+			t.Fatalf("Expected environment %v, got %v", expected, env)
+		}
+	})
+
+	t.Run("Keep look-alike prefixes", func(t *testing.T) {
+		lookalikes := []string{"CONFIGARRX_PORT=Port=8989", "configarr__port=Port=9000", "CONFIGARRX_UNSET__SSL=SslCertPath"}
+		env := childEnviron(lookalikes, "CONFIGARR", nil, true, nil)
+		expected := []string{"CONFIGARRX_PORT=Port=8989", "CONFIGARRX_UNSET__SSL=SslCertPath"}
+		if !reflect.DeepEqual(env, expected) {
+			t.Fatalf("Expected environment %v, got %v", expected, env)
+		}
+	})
+
+	t.Run("Strip allowed variables only", func(t *testing.T) {
+		env := childEnviron([]string{"PATH=/usr/bin", "SONARR_PORT=Port=8989"}, "", []string{"sonarr_*"}, true, nil)
+		expected := []string{"PATH=/usr/bin"}
+		if !reflect.DeepEqual(env, expected) {
+			t.Fatalf("Expected environment %v, got %v", expected, env)
+		}
+	})
+
+	t.Run("Extra variables replace existing ones", func(t *testing.T) {
+		env := childEnviron(environ, "CONFIGARR__", nil, true, []string{"TZ=Europe/Zurich", "CONFIGARR__KEEP=1"})
+		expected := []string{"PATH=/usr/bin", "TZ=Europe/Zurich", "CONFIGARR__KEEP=1"}
+		if !reflect.DeepEqual(env, expected) {
+			t.Fatalf("Expected environment %v, got %v", expected, env)
+		}
+	})
+}
+
+// TestRunExec tests applying the overrides before replacing configarr with a command.
+func TestRunExec(t *testing.T) {
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var executed []string
+	defer func(original func(string, []string, []string) error) { execve = original }(execve)
+	execve = func(path string, args []string, env []string) error {
+		executed = args
+		return nil
+	}
+
+	t.Run("Apply and exec", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.xml")
+		if err := os.WriteFile(path, []byte("<Config><Port>8990</Port></Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		environ := []string{"CONFIGARR__PORT=Port=8989"}
+		args := []string{"configarr", "exec", "--config", path, "--", binary, "--serve"}
+		if _, err := run(environ, args, nil, io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(executed, []string{binary, "--serve"}) {
+			t.Fatalf("Expected command to be executed, got %v", executed)
+		}
+		if data, _ := os.ReadFile(path); !strings.Contains(string(data), "<Port>8989</Port>") {
+			t.Fatalf("Expected overrides to be applied before exec, got:\n%s", data)
+		}
+	})
+
+	t.Run("Missing command", func(t *testing.T) {
+		code, err := run(nil, []string{"configarr", "exec", "--config", "config.xml"}, nil, io.Discard)
+		if err == nil || code != exitInvalid {
+			t.Fatalf("Expected exit code %d with an error, got %d: %v", exitInvalid, code, err)
+		}
+	})
+}
@@ -0,0 +1,8 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// execve replaces the current process, keeping its PID.
+var execve = syscall.Exec
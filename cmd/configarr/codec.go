@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"configarr"
+)
+
+// newCodec returns the codec selected by the flags, or nil when the configuration file
+// is stored in plain text.
+func newCodec(flags Flags) (configarr.Codec, error) {
+	switch {
+	case flags.EncryptionKeyFile != "":
+		key, err := readEncryptionKey(flags.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return configarr.NewAESGCMCodec(key)
+	case flags.DecryptCommand != "":
+		decode, err := splitCommand(flags.DecryptCommand)
+		if err != nil {
+			return nil, invalidInput(fmt.Errorf("invalid --decrypt-command: %w", err))
+		}
+		encode, err := splitCommand(flags.EncryptCommand)
+		if err != nil {
+			return nil, invalidInput(fmt.Errorf("invalid --encrypt-command: %w", err))
+		}
+		return commandCodec{decode: decode, encode: encode}, nil
+	}
+	return nil, nil
+}
+
+// readEncryptionKey reads a hex or base64 encoded key, e.g. created with `openssl rand -hex 32`.
+func readEncryptionKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading encryption key: %w", err)
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("invalid encryption key in %s: expected hex or base64", path)
+}
+
+// commandCodec pipes files through external commands, e.g. age, which read the input
+// on stdin and write the result to stdout.
+type commandCodec struct {
+	decode []string
+	encode []string
+}
+
+// Decode runs the decrypt command.
+func (c commandCodec) Decode(stored []byte) ([]byte, error) {
+	return pipe(context.Background(), c.decode, stored)
+}
+
+// Encode runs the encrypt command.
+func (c commandCodec) Encode(plain []byte) ([]byte, error) {
+	return pipe(context.Background(), c.encode, plain)
+}
+
+// commandDecrypter decrypts override values by piping the ciphertext through a command,
+// e.g. age or the CLI of a KMS, that writes the plaintext to stdout.
+type commandDecrypter []string
+
+// Decrypt runs the command with the ciphertext on stdin. A trailing line break of the
+// output is removed.
+func (c commandDecrypter) Decrypt(ctx context.Context, ciphertext string) (string, error) {
+	output, err := pipe(ctx, c, []byte(ciphertext))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(output), "\n"), "\r"), nil
+}
+
+// pipe runs the command with input on stdin and returns its stdout. The command is killed
+// when the context is done.
+func pipe(ctx context.Context, command []string, input []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%s failed: %w: %s", command[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("error running %s: %w", command[0], err)
+	}
+	return output, nil
+}
+
+// splitCommand splits a command line into its arguments the way a POSIX shell does, but
+// without expanding anything: whitespace separates arguments, single quotes keep
+// everything up to the next one, double quotes keep everything but backslash escapes of
+// ", \, $ and `, and a backslash outside of quotes keeps the next character.
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false // Whether an argument started, so '' is kept as an empty argument
+	for i := 0; i < len(command); i++ {
+		switch c := command[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case c == '\\':
+			if i+1 == len(command) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			arg.WriteByte(command[i])
+			inArg = true
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			arg.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '"':
+			closed := false
+			for i++; i < len(command); i++ {
+				if command[i] == '"' {
+					closed = true
+					break
+				}
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`", command[i+1]) >= 0 {
+					i++
+				}
+				arg.WriteByte(command[i])
+			}
+			if !closed {
+				return nil, errors.New("unterminated double quote")
+			}
+			inArg = true
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"configarr"
+)
+
+// TestNewCodec tests selecting the codec of the configuration file from the flags.
+func TestNewCodec(t *testing.T) {
+	t.Run("Plain text", func(t *testing.T) {
+		codec, err := newCodec(Flags{})
+		if err != nil || codec != nil {
+			t.Fatalf("Expected no codec, got %v, %v", codec, err)
+		}
+	})
+
+	t.Run("Encryption key", func(t *testing.T) {
+		dir := t.TempDir()
+		keyFile := filepath.Join(dir, "key")
+		if err := os.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)+"\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		codec, err := newCodec(Flags{EncryptionKeyFile: keyFile})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		configFile := filepath.Join(dir, "config.xml")
+		encrypted, err := codec.Encode([]byte("<Config><LogLevel>info</LogLevel></Config>"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := os.WriteFile(configFile, encrypted, 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		var output bytes.Buffer
+		args := []string{"cmd", "--config", configFile, "--encryption-key-file", keyFile}
+		if _, err := run([]string{"CONFIGARR__LOGLEVEL=LogLevel=debug"}, args, nil, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		config, err := configarr.ReadConfigFS(configarr.CodecFS(configarr.OSFS(), codec), configFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Properties["LogLevel"] != "debug" {
+			t.Fatalf("Expected LogLevel to be 'debug', got '%s'", config.Properties["LogLevel"])
+		}
+	})
+
+	t.Run("Commands", func(t *testing.T) {
+		codec, err := newCodec(Flags{DecryptCommand: "base64 -d", EncryptCommand: "base64"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		encoded, err := codec.Encode([]byte("<Config/>"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		decoded, err := codec.Decode(encoded)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(decoded) != "<Config/>" {
+			t.Fatalf("Expected round trip, got %q", decoded)
+		}
+	})
+
+	t.Run("Invalid key", func(t *testing.T) {
+		keyFile := filepath.Join(t.TempDir(), "key")
+		if err := os.WriteFile(keyFile, []byte("not a key!"), 0600); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		if _, err := newCodec(Flags{EncryptionKeyFile: keyFile}); err == nil {
+			t.Fatal("Expected error for invalid key, but got none")
+		}
+	})
+}
+
+// TestCommandDecrypter tests decrypting override values with a command given by --decrypter.
+func TestCommandDecrypter(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(configFile, []byte("<Config><ApiKey>old</ApiKey></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	var output bytes.Buffer
+	args := []string{"cmd", "--config", configFile, "--decrypter", "b64=sh -c 'base64 -d'"}
+	if _, err := run([]string{"CONFIGARR__KEY=ApiKey=enc:b64:c2VjcmV0Cg=="}, args, nil, &output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	config, err := configarr.ReadConfigFile(configFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Properties["ApiKey"] != "secret" {
+		t.Fatalf("Expected ApiKey to be 'secret', got '%s'", config.Properties["ApiKey"])
+	}
+
+	if _, err := parseFlags([]string{"--decrypter", "b64"}); err == nil {
+		t.Fatal("Expected error for --decrypter without a command, but got none")
+	}
+}
+
+// TestPipe tests that commands are killed when the context is done.
+func TestPipe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sleep is not available on Windows")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := pipe(ctx, []string{"sleep", "10"}, nil); err == nil {
+		t.Fatal("Expected error for a killed command, but got none")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the command to be killed, but it ran for %s", elapsed)
+	}
+}
+
+// TestSplitCommand tests splitting command lines into arguments like a shell.
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected []string
+	}{
+		{name: "Whitespace", command: " age  -d\t-i key.txt ", expected: []string{"age", "-d", "-i", "key.txt"}},
+		{name: "Single quotes", command: `sh -c 'base64 -d | tr -d "\n"'`, expected: []string{"sh", "-c", `base64 -d | tr -d "\n"`}},
+		{name: "Double quotes", command: `op read "op://Media Vault/sonarr/\"key\"" \$HOME`, expected: []string{"op", "read", `op://Media Vault/sonarr/"key"`, "$HOME"}},
+		{name: "Joined and empty", command: `age -i '/keys/my key'.txt ""`, expected: []string{"age", "-i", "/keys/my key.txt", ""}},
+		{name: "Empty", command: "  ", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := splitCommand(tt.command)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Fatalf("Expected %q, got %q", tt.expected, args)
+			}
+		})
+	}
+
+	for _, command := range []string{`age -i 'key.txt`, `echo "unterminated`, `echo trailing\`} {
+		if _, err := splitCommand(command); err == nil {
+			t.Fatalf("Expected error for %q, but got none", command)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+
+	"configarr"
+)
+
+// Exit codes of configarr, so wrapper scripts can branch on the outcome of a run. Runs
+// only exit with exitChanged and exitDrift with --exit-code detailed.
+const (
+	exitOK      = 0 // The run or the subcommand succeeded
+	exitFailure = 1 // Any error not covered below, e.g. a missing configuration file
+	exitChanged = 2 // Properties changed
+	exitDrift   = 3 // A dry run would change properties, or verify found hosts that drifted
+	exitInvalid = 4 // Invalid flags or input refused by validation
+	exitParse   = 5 // A configuration file or override document could not be parsed
+	exitWrite   = 6 // Writing or verifying a configuration file failed
+)
+
+// Modes of --exit-code telling runs that changed properties apart from the others.
+const (
+	exitCodesDiff     = "diff"     // Exit like diff, see exitDiffChanged
+	exitCodesDetailed = "detailed" // Exit with exitChanged or exitDrift
+)
+
+// Exit codes of runs with --exit-code diff, following diff; errors keep their code above,
+// except exitFailure, which becomes exitDiffFailure.
+const (
+	exitDiffChanged = 1 // Properties changed, or would change in a dry run
+	exitDiffFailure = 2 // Any error not covered by the codes above
+)
+
+// exitError assigns an exit code to an error of the command line, e.g. for a document
+// that could not be parsed.
+type exitError struct {
+	code int
+	err  error
+}
+
+// Error returns the message of the wrapped error.
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// invalidInput marks err as invalid input.
+func invalidInput(err error) error {
+	return &exitError{code: exitInvalid, err: err}
+}
+
+// parseFailure marks err as a parse error.
+func parseFailure(err error) error {
+	return &exitError{code: exitParse, err: err}
+}
+
+// exitCode returns the exit code for the error of a run, passing the error through.
+func exitCode(err error) (int, error) {
+	var exitErr *exitError
+	switch {
+	case err == nil:
+		return exitOK, nil
+	case errors.As(err, &exitErr):
+		return exitErr.code, err
+	case errors.Is(err, errDrift):
+		return exitDrift, err
+	case errors.Is(err, configarr.ErrInvalid):
+		return exitInvalid, err
+	case errors.Is(err, configarr.ErrParse):
+		return exitParse, err
+	case errors.Is(err, configarr.ErrWrite):
+		return exitWrite, err
+	}
+	return exitFailure, err
+}
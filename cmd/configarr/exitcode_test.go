@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExitCode tests the exit codes of runs, so wrapper scripts can rely on them.
+func TestExitCode(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig := func(t *testing.T, content string) string {
+		file := filepath.Join(dir, t.Name(), "config.xml")
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Unexpected error creating directory: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		return file
+	}
+	env := []string{"CONFIGARR__PORT=Port=9000"}
+
+	tests := []struct {
+		name     string
+		content  string
+		env      []string
+		args     []string
+		expected int
+		failed   bool
+	}{
+		{"No change", "<Config><Port>9000</Port></Config>", env, nil, exitOK, false},
+		{"Changed", "<Config><Port>8989</Port></Config>", env, nil, exitOK, false},
+		{"Dry run", "<Config><Port>8989</Port></Config>", env, []string{"--dry-run"}, exitOK, false},
+		{"Changed with detailed exit codes", "<Config><Port>8989</Port></Config>", env, []string{"--exit-code=detailed"}, exitChanged, false},
+		{"Dry run with detailed exit codes", "<Config><Port>8989</Port></Config>", env, []string{"--exit-code=detailed", "--dry-run"}, exitDrift, false},
+		{"No change with detailed exit codes", "<Config><Port>9000</Port></Config>", env, []string{"--exit-code=detailed"}, exitOK, false},
+		{"Failure with detailed exit codes", "<Config><Port>8989</Port></Config>", env, []string{"--exit-code=detailed", "--config", filepath.Join(dir, "missing.xml")}, exitFailure, true},
+		{"Invalid flags", "<Config></Config>", env, []string{"--final-newline", "sometimes"}, exitInvalid, true},
+		{"Invalid value", "<Config><Port>8989</Port></Config>", []string{"CONFIGARR__PORT=Port=9000\x01"}, nil, exitInvalid, true},
+		{"Parse error", "<Config><Port>8989</Config>", env, nil, exitParse, true},
+		{"No change with exit code", "<Config><Port>9000</Port></Config>", env, []string{"--exit-code"}, exitOK, false},
+		{"Changed with exit code", "<Config><Port>8989</Port></Config>", env, []string{"--exit-code"}, exitDiffChanged, false},
+		{"Changed with diff exit codes", "<Config><Port>8989</Port></Config>", env, []string{"--exit-code=diff"}, exitDiffChanged, false},
+		{"Dry run with exit code", "<Config><Port>8989</Port></Config>", env, []string{"--exit-code", "--dry-run"}, exitDiffChanged, false},
+		{"Failure with exit code", "<Config><Port>8989</Port></Config>", env, []string{"--exit-code", "--config", filepath.Join(dir, "missing.xml")}, exitDiffFailure, true},
+		{"Unknown exit codes", "<Config></Config>", env, []string{"--exit-code=always"}, exitInvalid, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := writeConfig(t, tt.content)
+			args := append([]string{"cmd", "--config", configFile, "--state-file", ""}, tt.args...)
+
+			var output strings.Builder
+			code, err := run(tt.env, args, nil, &output)
+			if code != tt.expected {
+				t.Fatalf("Expected exit code %d, got %d (error: %v)", tt.expected, code, err)
+			}
+			if (err != nil) != tt.failed {
+				t.Fatalf("Unexpected error for exit code %d: %v", code, err)
+			}
+		})
+	}
+
+	t.Run("Categories of wrapped errors", func(t *testing.T) {
+		if code, _ := exitCode(fmt.Errorf("host: %w", errDrift)); code != exitDrift {
+			t.Fatalf("Expected exit code %d, got %d", exitDrift, code)
+		}
+		if code, _ := exitCode(fmt.Errorf("sonarr: %w", parseFailure(errors.New("bad YAML")))); code != exitParse {
+			t.Fatalf("Expected exit code %d, got %d", exitParse, code)
+		}
+		if code, _ := exitCode(errors.New("other")); code != exitFailure {
+			t.Fatalf("Expected exit code %d, got %d", exitFailure, code)
+		}
+	})
+}
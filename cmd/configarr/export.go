@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"text/template"
+
+	"configarr"
+
+	"github.com/spf13/pflag"
+)
+
+// ExportFlags represents the command-line flags of the export subcommand.
+type ExportFlags struct {
+	Format      string
+	Template    string
+	ShowSecrets bool
+	ConfigFiles []string
+}
+
+// parseExportFlags parses the flags of the export subcommand. Positional arguments are
+// the configuration files to export and default to DefaultConfigPath.
+func parseExportFlags(flags []string) (ExportFlags, error) {
+	flagSet := pflag.NewFlagSet("export", pflag.ContinueOnError)
+
+	format := flagSet.String("format", "csv", "Output format (csv or tsv)")
+	tmpl := flagSet.String("template", "", "Render each file with a Go template over its properties, e.g. '{{ .Port }}'")
+	showSecrets := flagSet.Bool("show-secrets", false, "Do not mask the values of secret properties")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return ExportFlags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if *format != "csv" && *format != "tsv" {
+		return ExportFlags{}, fmt.Errorf("unsupported export format %q", *format)
+	}
+
+	configFiles := flagSet.Args()
+	if len(configFiles) == 0 {
+		configFiles = []string{configarr.DefaultConfigPath}
+	}
+
+	return ExportFlags{
+		Format:      *format,
+		Template:    *tmpl,
+		ShowSecrets: *showSecrets,
+		ConfigFiles: configFiles,
+	}, nil
+}
+
+// runExport writes file,key,value rows for every property of the given configuration files.
+func runExport(args []string, output io.Writer) error {
+	flags, err := parseExportFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	if flags.Template != "" {
+		return exportTemplate(flags, output)
+	}
+
+	w := csv.NewWriter(output)
+	if flags.Format == "tsv" {
+		w.Comma = '\t'
+	}
+
+	if err := w.Write([]string{"file", "key", "value"}); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+
+	for _, configFile := range flags.ConfigFiles {
+		config, err := configarr.ReadConfigFile(configFile)
+		if err != nil {
+			return fmt.Errorf("error reading configuration file: %w", err)
+		}
+
+		for _, key := range config.Keys {
+			value := exportValue(key, config.Properties[key], flags.ShowSecrets)
+			if err := w.Write([]string{configFile, key, value}); err != nil {
+				return fmt.Errorf("error writing export: %w", err)
+			}
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+	return nil
+}
+
+// exportTemplate renders the template once per configuration file, see renderTemplate.
+func exportTemplate(flags ExportFlags, output io.Writer) error {
+	tmpl, err := parseTemplate("export", flags.Template)
+	if err != nil {
+		return err
+	}
+
+	for _, configFile := range flags.ConfigFiles {
+		config, err := configarr.ReadConfigFile(configFile)
+		if err != nil {
+			return fmt.Errorf("error reading configuration file: %w", err)
+		}
+		if err := renderTemplate(tmpl, configFile, config, flags.ShowSecrets, output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTemplate parses the Go template of a --template flag. Referring to a property that
+// doesn't exist fails the rendering.
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, invalidInput(fmt.Errorf("error parsing template: %w", err))
+	}
+	return tmpl, nil
+}
+
+// renderTemplate renders the template with the properties of the configuration file as
+// data, followed by a newline. Values of secret properties are masked unless shown.
+func renderTemplate(tmpl *template.Template, configFile string, config *configarr.Config, showSecrets bool, output io.Writer) error {
+	data := make(map[string]string, len(config.Properties))
+	for key, value := range config.Properties {
+		data[key] = exportValue(key, value, showSecrets)
+	}
+
+	if err := tmpl.Execute(output, data); err != nil {
+		return fmt.Errorf("error rendering template for %s: %w", configFile, err)
+	}
+	if _, err := io.WriteString(output, "\n"); err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	return nil
+}
+
+// exportValue returns the value to export for a property, masking secrets unless shown.
+func exportValue(key, value string, showSecrets bool) string {
+	if showSecrets {
+		return value
+	}
+	return configarr.MaskSecretValue(key, value)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// TestParseExportFlags tests parsing the flags of the export subcommand.
+func TestParseExportFlags(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		flags, err := parseExportFlags(nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if flags.Format != "csv" || flags.ShowSecrets || len(flags.ConfigFiles) != 1 || flags.ConfigFiles[0] != configarr.DefaultConfigPath {
+			t.Fatalf("Unexpected default flags: %+v", flags)
+		}
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		if _, err := parseExportFlags([]string{"--format", "xlsx"}); err == nil {
+			t.Fatal("Expected error for unsupported format, but got none")
+		}
+	})
+}
+
+// TestRunExport tests exporting configuration files as CSV and TSV.
+func TestRunExport(t *testing.T) {
+	dir := t.TempDir()
+	sonarr := filepath.Join(dir, "sonarr.xml")
+	radarr := filepath.Join(dir, "radarr.xml")
+	if err := os.WriteFile(sonarr, []byte("<Config><Port>8989</Port><ApiKey>abc</ApiKey></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	if err := os.WriteFile(radarr, []byte("<Config><UrlBase>/a,b</UrlBase></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	t.Run("CSV across files with masked secrets", func(t *testing.T) {
+		var output strings.Builder
+		if _, err := run(nil, []string{"cmd", "export", sonarr, radarr}, nil, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := "file,key,value\n" +
+			sonarr + ",Port,8989\n" +
+			sonarr + ",ApiKey,********\n" +
+			radarr + ",UrlBase,\"/a,b\"\n"
+		if output.String() != expected {
+			t.Fatalf("Expected export %q, got %q", expected, output.String())
+		}
+	})
+
+	t.Run("TSV with secrets shown", func(t *testing.T) {
+		var output strings.Builder
+		if _, err := run(nil, []string{"cmd", "export", "--format", "tsv", "--show-secrets", sonarr}, nil, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !strings.Contains(output.String(), sonarr+"\tApiKey\tabc\n") {
+			t.Fatalf("Expected unmasked ApiKey row, got %q", output.String())
+		}
+	})
+
+	t.Run("Template per file", func(t *testing.T) {
+		var output strings.Builder
+		if _, err := run(nil, []string{"cmd", "export", "--template", "{{ .Port }} {{ .ApiKey }}", "--show-secrets", sonarr}, nil, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if output.String() != "8989 abc\n" {
+			t.Fatalf("Expected rendered template, got %q", output.String())
+		}
+	})
+
+	t.Run("Template masks secrets", func(t *testing.T) {
+		var output strings.Builder
+		if _, err := run(nil, []string{"cmd", "export", "--template", "{{ .ApiKey }}", sonarr}, nil, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if output.String() != configarr.SecretMask+"\n" {
+			t.Fatalf("Expected masked ApiKey, got %q", output.String())
+		}
+	})
+
+	t.Run("Template with unknown key", func(t *testing.T) {
+		var output strings.Builder
+		if _, err := run(nil, []string{"cmd", "export", "--template", "{{ .Missing }}", radarr}, nil, &output); err == nil {
+			t.Fatal("Expected error for unknown key, but got none")
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		var output strings.Builder
+		if _, err := run(nil, []string{"cmd", "export", filepath.Join(dir, "missing.xml")}, nil, &output); err == nil {
+			t.Fatal("Expected error for missing file, but got none")
+		}
+	})
+}
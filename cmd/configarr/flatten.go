@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"configarr"
+
+	"github.com/spf13/pflag"
+)
+
+// FlattenFlags represents the command-line flags of the flatten subcommand.
+type FlattenFlags struct {
+	Prefix string
+	Format string
+	File   string
+}
+
+// parseFlattenFlags parses the flags of the flatten subcommand. The positional argument
+// is the values file and defaults to stdin.
+func parseFlattenFlags(flags []string) (FlattenFlags, error) {
+	flagSet := pflag.NewFlagSet("flatten", pflag.ContinueOnError)
+
+	prefix := flagSet.String("prefix", configarr.DefaultPrefix, "Prefix for environment variables")
+	format := flagSet.String("format", "env", "Output format (env for NAME=VALUE lines, k8s for a container env list)")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return FlattenFlags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if *format != "env" && *format != "k8s" {
+		return FlattenFlags{}, fmt.Errorf("unsupported flatten format %q", *format)
+	}
+
+	file := "-"
+	switch flagSet.NArg() {
+	case 0:
+	case 1:
+		file = flagSet.Arg(0)
+	default:
+		return FlattenFlags{}, fmt.Errorf("expected at most one values file, got %d", flagSet.NArg())
+	}
+
+	return FlattenFlags{
+		Prefix: *prefix,
+		Format: *format,
+		File:   file,
+	}, nil
+}
+
+// runFlatten converts a nested YAML values file into the environment variables configarr expects.
+func runFlatten(args []string, stdin io.Reader, output io.Writer) error {
+	flags, err := parseFlattenFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	data, err := readDocument(flags.File, stdin)
+	if err != nil {
+		return err
+	}
+
+	vars, err := configarr.FlattenYAML(data, flags.Prefix)
+	if err != nil {
+		return fmt.Errorf("error flattening values from %s: %w", flags.File, err)
+	}
+
+	for _, v := range vars {
+		var line string
+		if flags.Format == "k8s" {
+			line = fmt.Sprintf("- name: %s\n  value: %s\n", v.Name, strconv.Quote(v.Value))
+		} else {
+			line = fmt.Sprintf("%s=%s\n", v.Name, v.Value)
+		}
+		if _, err := io.WriteString(output, line); err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseFlattenFlags tests parsing the flags of the flatten subcommand.
+func TestParseFlattenFlags(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		flags, err := parseFlattenFlags(nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if flags.Format != "env" || flags.File != "-" || flags.Prefix != "CONFIGARR__" {
+			t.Fatalf("Unexpected default flags: %+v", flags)
+		}
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		if _, err := parseFlattenFlags([]string{"--format", "json"}); err == nil {
+			t.Fatal("Expected error for unsupported format, but got none")
+		}
+	})
+
+	t.Run("Too many files", func(t *testing.T) {
+		if _, err := parseFlattenFlags([]string{"a.yaml", "b.yaml"}); err == nil {
+			t.Fatal("Expected error for several files, but got none")
+		}
+	})
+}
+
+// TestRunFlatten tests flattening values into env lines and Kubernetes env lists.
+func TestRunFlatten(t *testing.T) {
+	values := "sonarr:\n  Port: 8989\n  UrlBase: /sonarr\n"
+
+	t.Run("Env lines", func(t *testing.T) {
+		var output strings.Builder
+		if err := runFlatten([]string{"--prefix", "ARR__"}, strings.NewReader(values), &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := "ARR__SONARR_PORT=Port=8989\nARR__SONARR_URLBASE=UrlBase=/sonarr\n"
+		if output.String() != expected {
+			t.Fatalf("Expected %q, got %q", expected, output.String())
+		}
+	})
+
+	t.Run("Kubernetes env list", func(t *testing.T) {
+		var output strings.Builder
+		if err := runFlatten([]string{"--format", "k8s"}, strings.NewReader(values), &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := "- name: CONFIGARR__SONARR_PORT\n  value: \"Port=8989\"\n- name: CONFIGARR__SONARR_URLBASE\n  value: \"UrlBase=/sonarr\"\n"
+		if output.String() != expected {
+			t.Fatalf("Expected %q, got %q", expected, output.String())
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"configarr"
+
+	"github.com/spf13/pflag"
+)
+
+// Output formats of the generate subcommand.
+const (
+	generateCompose = "compose"
+	generateHelm    = "helm"
+)
+
+// GenerateFlags represents the command-line flags of the generate subcommand.
+type GenerateFlags struct {
+	Format    string // generateCompose or generateHelm
+	File      string // Desired state file, - for stdin
+	Prefix    string
+	Delimiter string
+}
+
+// parseGenerateFlags parses the flags of the generate subcommand. The positional argument
+// is the output format.
+func parseGenerateFlags(flags []string) (GenerateFlags, error) {
+	flagSet := pflag.NewFlagSet("generate", pflag.ContinueOnError)
+
+	file := flagSet.StringP("file", "f", "-", "Desired state file mapping apps to their properties (- for stdin)")
+	prefix := flagSet.String("prefix", configarr.DefaultPrefix, "Prefix for environment variables")
+	delimiter := flagSet.String("kv-delimiter", configarr.DefaultDelimiter, "Separator between the property and the value in environment variables")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return GenerateFlags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if flagSet.NArg() != 1 {
+		return GenerateFlags{}, fmt.Errorf("expected the output format, %s or %s", generateCompose, generateHelm)
+	}
+	format := flagSet.Arg(0)
+	if format != generateCompose && format != generateHelm {
+		return GenerateFlags{}, fmt.Errorf("unsupported output format %q, expected %s or %s", format, generateCompose, generateHelm)
+	}
+	if *delimiter == "" {
+		return GenerateFlags{}, errors.New("--kv-delimiter can't be empty")
+	}
+
+	return GenerateFlags{
+		Format:    format,
+		File:      *file,
+		Prefix:    *prefix,
+		Delimiter: *delimiter,
+	}, nil
+}
+
+// runGenerate prints the environment variables encoding the properties of each app in a
+// desired state file, as the environment of a docker-compose service or as the env list
+// of a Helm values file.
+func runGenerate(args []string, stdin io.Reader, output io.Writer) error {
+	flags, err := parseGenerateFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	data, err := readDocument(flags.File, stdin)
+	if err != nil {
+		return err
+	}
+	states, err := configarr.ParseDesiredState(data)
+	if err != nil {
+		return parseFailure(fmt.Errorf("error parsing desired state from %s: %w", flags.File, err))
+	}
+
+	var out strings.Builder
+	if flags.Format == generateCompose {
+		out.WriteString("services:\n")
+	}
+	for _, state := range states {
+		vars, err := configarr.OverrideEnvVars(state.Overrides, flags.Prefix, flags.Delimiter)
+		if err != nil {
+			return invalidInput(fmt.Errorf("application %s: %w", state.App, err))
+		}
+		if flags.Format == generateCompose {
+			writeComposeService(&out, state.App, vars)
+		} else {
+			writeHelmValues(&out, state.App, vars)
+		}
+	}
+
+	if _, err := io.WriteString(output, out.String()); err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	return nil
+}
+
+// writeComposeService writes a service with the variables as its environment. Dollar
+// signs are doubled, since compose would interpolate them.
+func writeComposeService(out *strings.Builder, app string, vars []configarr.EnvVar) {
+	fmt.Fprintf(out, "  %s:\n    environment:\n", app)
+	for _, v := range vars {
+		fmt.Fprintf(out, "      %s: %s\n", v.Name, strconv.Quote(strings.ReplaceAll(v.Value, "$", "$$")))
+	}
+}
+
+// writeHelmValues writes the variables as the env list of the app in a values file.
+func writeHelmValues(out *strings.Builder, app string, vars []configarr.EnvVar) {
+	fmt.Fprintf(out, "%s:\n  env:\n", app)
+	for _, v := range vars {
+		fmt.Fprintf(out, "    - name: %s\n      value: %s\n", v.Name, strconv.Quote(v.Value))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseGenerateFlags tests parsing the flags of the generate subcommand.
+func TestParseGenerateFlags(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		flags, err := parseGenerateFlags([]string{"compose"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if flags.Format != "compose" || flags.File != "-" || flags.Prefix != "CONFIGARR__" || flags.Delimiter != "=" {
+			t.Fatalf("Unexpected default flags: %+v", flags)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, args := range [][]string{nil, {"kustomize"}, {"compose", "helm"}, {"compose", "--kv-delimiter", ""}} {
+			if _, err := parseGenerateFlags(args); err == nil {
+				t.Fatalf("Expected error for %v, but got none", args)
+			}
+		}
+	})
+}
+
+// TestRunGenerate tests generating compose environments and Helm env lists.
+func TestRunGenerate(t *testing.T) {
+	state := "sonarr:\n  LogLevel: debug\n  ApiKey: a$b\"c\nradarr:\n  Port: 7878\n"
+
+	t.Run("Compose", func(t *testing.T) {
+		var output strings.Builder
+		if err := runGenerate([]string{"compose", "-f", "-"}, strings.NewReader(state), &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := "services:\n" +
+			"  sonarr:\n    environment:\n      CONFIGARR__LOGLEVEL: \"LogLevel=debug\"\n      CONFIGARR__APIKEY: \"ApiKey=a$$b\\\"c\"\n" +
+			"  radarr:\n    environment:\n      CONFIGARR__PORT: \"Port=7878\"\n"
+		if output.String() != expected {
+			t.Fatalf("Expected %q, got %q", expected, output.String())
+		}
+	})
+
+	t.Run("Helm", func(t *testing.T) {
+		var output strings.Builder
+		if err := runGenerate([]string{"helm", "--prefix", "SONARR__", "--kv-delimiter", ":="}, strings.NewReader("sonarr:\n  Url=Base: /tv\n"), &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := "sonarr:\n  env:\n    - name: SONARR__URL_BASE\n      value: \"Url=Base:=/tv\"\n"
+		if output.String() != expected {
+			t.Fatalf("Expected %q, got %q", expected, output.String())
+		}
+	})
+
+	t.Run("Keys that can't be encoded", func(t *testing.T) {
+		for name, state := range map[string]string{
+			"Delimiter in key": "sonarr:\n  Url=Base: /tv\n",
+			"Condition":        "sonarr:\n  Port: {value: 8989, if: 'Port == 1'}\n",
+			"Same variable":    "sonarr:\n  Url.Base: /tv\n  Url_Base: /tv\n",
+		} {
+			var output strings.Builder
+			if err := runGenerate([]string{"compose"}, strings.NewReader(state), &output); err == nil {
+				t.Fatalf("Expected error for %s, but got none", strings.ToLower(name))
+			}
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+
+	"github.com/spf13/pflag"
+
+	"configarr"
+)
+
+// GetFlags represents the command-line flags of the get subcommand.
+type GetFlags struct {
+	ConfigFile string   // Configuration file to read
+	Format     string   // Format of the file; empty detects it from the extension
+	Template   string   // Go template rendered over the properties instead of printing Keys
+	Keys       []string // Properties to print
+}
+
+// parseGetFlags parses the flags of the get subcommand. Positional arguments are the
+// properties to print.
+func parseGetFlags(flags []string) (GetFlags, error) {
+	flagSet := pflag.NewFlagSet("get", pflag.ContinueOnError)
+
+	configFile := flagSet.String("config", configarr.DefaultConfigPath, "Configuration file to read")
+	format := flagSet.String("format", "", "Format of the configuration file (xml, json, yaml, ini or xmlattr; default: detected from the extension)")
+	tmpl := flagSet.String("template", "", "Render a Go template over the properties instead, e.g. 'http://localhost:{{ .Port }}{{ .UrlBase }}'")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return GetFlags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+	switch {
+	case flagSet.NArg() == 0 && *tmpl == "":
+		return GetFlags{}, errors.New("expected the property to print, e.g. configarr get ApiKey")
+	case flagSet.NArg() > 0 && *tmpl != "":
+		return GetFlags{}, errors.New("--template can't be combined with properties to print")
+	}
+	if _, err := configarr.LookupFormat(*format, *configFile); err != nil {
+		return GetFlags{}, err
+	}
+
+	return GetFlags{
+		ConfigFile: *configFile,
+		Format:     *format,
+		Template:   *tmpl,
+		Keys:       flagSet.Args(),
+	}, nil
+}
+
+// runGet prints the values of the properties, one per line, or renders the template over
+// them, so scripts can read them without parsing the file. Values of secret properties
+// are printed as they are, since they were asked for by name. A missing property is an
+// error.
+func runGet(args []string, output io.Writer) error {
+	flags, err := parseGetFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+	var tmpl *template.Template
+	if flags.Template != "" {
+		if tmpl, err = parseTemplate("get", flags.Template); err != nil {
+			return err
+		}
+	}
+
+	format, _ := configarr.LookupFormat(flags.Format, flags.ConfigFile) // Validated by parseGetFlags
+	data, err := os.ReadFile(flags.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("error reading file %s: %w", flags.ConfigFile, err)
+	}
+	config, err := format.Parse(data)
+	if err != nil {
+		return parseFailure(fmt.Errorf("error parsing %s: %w", flags.ConfigFile, err))
+	}
+	if tmpl != nil {
+		return renderTemplate(tmpl, flags.ConfigFile, config, true, output)
+	}
+
+	for _, key := range flags.Keys {
+		value, exists := config.Properties[key]
+		if !exists {
+			return fmt.Errorf("property %s not found in %s", key, flags.ConfigFile)
+		}
+		if _, err := fmt.Fprintln(output, value); err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunGet tests printing the values of properties.
+func TestRunGet(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(configFile, []byte("<Config><Port>8989</Port><ApiKey>abc</ApiKey><UrlBase></UrlBase></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	var output strings.Builder
+	code, err := run(nil, []string{"configarr", "get", "ApiKey", "UrlBase", "Port", "--config", configFile}, nil, &output)
+	if err != nil || code != exitOK {
+		t.Fatalf("Unexpected error: %v (exit code %d)", err, code)
+	}
+	if expected := "abc\n\n8989\n"; output.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, output.String())
+	}
+
+	t.Run("Template", func(t *testing.T) {
+		var output strings.Builder
+		if err := runGet([]string{"--config", configFile, "--template", "http://localhost:{{ .Port }}{{ .UrlBase }}?apikey={{ .ApiKey }}"}, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := "http://localhost:8989?apikey=abc\n"; output.String() != expected {
+			t.Fatalf("Expected %q, got %q", expected, output.String())
+		}
+	})
+
+	for name, args := range map[string][]string{
+		"Missing property":          {"LogLevel", "--config", configFile},
+		"No property":               {"--config", configFile},
+		"Unknown format":            {"Port", "--config", configFile, "--format", "toml"},
+		"Template with a property":  {"Port", "--config", configFile, "--template", "{{ .Port }}"},
+		"Template missing property": {"--config", configFile, "--template", "{{ .LogLevel }}"},
+		"Invalid template":          {"--config", configFile, "--template", "{{ .Port"},
+	} {
+		if err := runGet(args, &strings.Builder{}); err == nil {
+			t.Fatalf("Expected error for %s, but got none", strings.ToLower(name))
+		}
+	}
+}
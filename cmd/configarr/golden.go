@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"configarr"
+)
+
+// reportGolden prints the drift of the configuration files of a dry run from the golden
+// reference of --golden, if any, and reports whether there was any.
+func reportGolden(output io.Writer, flags Flags, results []configarr.Result) (bool, error) {
+	if flags.GoldenFile == "" {
+		return false, nil
+	}
+	golden, err := readGolden(flags)
+	if err != nil {
+		return false, err
+	}
+	return printGoldenDrift(output, flags, golden, results)
+}
+
+// readGolden reads the properties of the golden reference file of --golden as overrides
+// creating missing keys, so diffing a configuration with them shows its drift.
+func readGolden(flags Flags) ([]configarr.Override, error) {
+	data, err := os.ReadFile(flags.GoldenFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading golden file: %w", err)
+	}
+	format, err := configarr.LookupFormat(flags.Format, flags.GoldenFile)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+	golden, err := format.Parse(data)
+	if err != nil {
+		return nil, parseFailure(fmt.Errorf("error parsing golden file %s: %w", flags.GoldenFile, err))
+	}
+
+	overrides := make([]configarr.Override, 0, len(golden.Keys))
+	for _, key := range golden.Keys {
+		overrides = append(overrides, configarr.Override{Key: key, Value: golden.Properties[key], Source: "golden:" + flags.GoldenFile, Create: true})
+	}
+	return overrides, nil
+}
+
+// printGoldenDrift prints a row per property of the golden reference that differs from
+// the configuration files before the run, or is missing from them, and reports whether
+// there was any. Secret properties are left out, since they differ per host, and so are
+// the keys excluded by --only-keys and --skip-keys. Missing files are not compared.
+func printGoldenDrift(output io.Writer, flags Flags, golden []configarr.Override, results []configarr.Result) (bool, error) {
+	differ := configarr.Differ{OnlyKeys: flags.OnlyKeys, SkipKeys: flags.SkipKeys}
+	w := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTATUS\tKEY\tCURRENT\tGOLDEN")
+
+	drift := false
+	for _, result := range results {
+		if result.Original == nil {
+			continue
+		}
+		format, err := configarr.LookupFormat(flags.Format, result.ConfigPath)
+		if err != nil {
+			return false, invalidInput(err)
+		}
+		config, err := format.Parse(result.Original)
+		if err != nil {
+			return false, parseFailure(fmt.Errorf("error parsing %s: %w", result.ConfigPath, err))
+		}
+
+		fileDrift := false
+		for _, action := range differ.Diff(config, golden) {
+			if configarr.IsSecretKey(action.Key) {
+				continue
+			}
+			switch action.Type {
+			case configarr.ActionChange:
+				fmt.Fprintf(w, "%s\tdrift\t%s\t%s\t%s\n", result.ConfigPath, action.Key, action.Current, action.Value)
+			case configarr.ActionCreate:
+				fmt.Fprintf(w, "%s\tmissing\t%s\t-\t%s\n", result.ConfigPath, action.Key, action.Value)
+			default:
+				continue
+			}
+			fileDrift = true
+		}
+		if !fileDrift {
+			fmt.Fprintf(w, "%s\tok\t-\t-\t-\n", result.ConfigPath)
+		}
+		drift = drift || fileDrift
+	}
+
+	if err := w.Flush(); err != nil {
+		return false, fmt.Errorf("error writing golden drift report: %w", err)
+	}
+	return drift, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"configarr"
+
+	"github.com/spf13/pflag"
+)
+
+// configFileName is the name of the configuration files inventory looks for.
+const configFileName = "config.xml"
+
+// InventoryFlags represents the command-line flags of the inventory subcommand.
+type InventoryFlags struct {
+	ScanDir     string
+	Output      string
+	CatalogFile string
+}
+
+// parseInventoryFlags parses the flags of the inventory subcommand.
+func parseInventoryFlags(flags []string) (InventoryFlags, error) {
+	flagSet := pflag.NewFlagSet("inventory", pflag.ContinueOnError)
+
+	scanDir := flagSet.String("scan-dir", ".", "Directory searched recursively for config.xml files")
+	output := flagSet.StringP("output", "o", "table", "Output format (table or json)")
+	catalogFile := flagSet.String("catalog-file", "", "Load additional or replacement app definitions for detecting apps from a file")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return InventoryFlags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if *output != "table" && *output != "json" {
+		return InventoryFlags{}, fmt.Errorf("unsupported output format %q", *output)
+	}
+
+	return InventoryFlags{
+		ScanDir:     *scanDir,
+		Output:      *output,
+		CatalogFile: *catalogFile,
+	}, nil
+}
+
+// runInventory summarizes every configuration file below the scan directory and reports
+// inconsistencies across the apps, e.g. duplicate ports.
+func runInventory(args []string, output io.Writer) error {
+	flags, err := parseInventoryFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	catalog, err := configarr.LoadCatalog(flags.CatalogFile, "")
+	if err != nil {
+		return err
+	}
+
+	configs := make(map[string]*configarr.Config)
+	err = filepath.WalkDir(flags.ScanDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name() != configFileName {
+			return nil
+		}
+		config, err := configarr.ReadConfigFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading configuration file: %w", err)
+		}
+		configs[path] = config
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error scanning %s: %w", flags.ScanDir, err)
+	}
+
+	inventory := configarr.NewInventory(configs, catalog)
+	if flags.Output == "json" {
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(inventory); err != nil {
+			return fmt.Errorf("error writing inventory: %w", err)
+		}
+		return nil
+	}
+	return writeInventoryTable(output, inventory)
+}
+
+// writeInventoryTable prints a row per app, followed by the issues, if any.
+func writeInventoryTable(output io.Writer, inventory configarr.Inventory) error {
+	w := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tAPP\tPORT\tSSLPORT\tURLBASE\tAUTH\tHINTS")
+	for _, app := range inventory.Apps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", app.File, orDash(app.App), orDash(app.Port), orDash(app.SslPort),
+			orDash(app.UrlBase), orDash(app.AuthenticationMethod), orDash(strings.Join(app.Hints, ", ")))
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing inventory: %w", err)
+	}
+
+	if len(inventory.Issues) > 0 {
+		fmt.Fprintln(output)
+	}
+	for _, issue := range inventory.Issues {
+		fmt.Fprintf(output, "WARNING: %s: %s\n", issue.Message, strings.Join(issue.Files, ", "))
+	}
+	return nil
+}
+
+// orDash returns the value, or "-" when it is empty, so table columns stay aligned.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// TestParseInventoryFlags tests parsing the flags of the inventory subcommand.
+func TestParseInventoryFlags(t *testing.T) {
+	flags, err := parseInventoryFlags([]string{"--scan-dir", "/configs", "-o", "json"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if flags.ScanDir != "/configs" || flags.Output != "json" {
+		t.Fatalf("Unexpected flags: %+v", flags)
+	}
+
+	if _, err := parseInventoryFlags([]string{"--output", "yaml"}); err == nil {
+		t.Fatal("Expected error for unsupported output format, but got none")
+	}
+}
+
+// TestRunInventory tests summarizing the configuration files below a directory.
+func TestRunInventory(t *testing.T) {
+	dir := t.TempDir()
+	for app, content := range map[string]string{
+		"sonarr": "<Config><Port>8989</Port><UrlBase>/sonarr</UrlBase></Config>",
+		"radarr": "<Config><Port>8989</Port></Config>",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, app), 0755); err != nil {
+			t.Fatalf("Unexpected error creating directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, app, "config.xml"), []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+	}
+
+	t.Run("Table", func(t *testing.T) {
+		var output strings.Builder
+		if _, err := run(nil, []string{"cmd", "inventory", "--scan-dir", dir}, nil, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		fields := strings.Join(strings.Fields(output.String()), " ")
+		for _, row := range []string{
+			filepath.Join(dir, "radarr", "config.xml") + " radarr 8989 - - - -",
+			filepath.Join(dir, "sonarr", "config.xml") + " sonarr 8989 - /sonarr - -",
+			"WARNING: port 8989 is used by 2 apps",
+		} {
+			if !strings.Contains(fields, row) {
+				t.Fatalf("Expected %q in output:\n%s", row, output.String())
+			}
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var output strings.Builder
+		if _, err := run(nil, []string{"cmd", "inventory", "--scan-dir", dir, "--output", "json"}, nil, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var inventory configarr.Inventory
+		if err := json.Unmarshal([]byte(output.String()), &inventory); err != nil {
+			t.Fatalf("Unexpected error decoding output: %v", err)
+		}
+		if len(inventory.Apps) != 2 || len(inventory.Issues) != 1 || inventory.Issues[0].Kind != configarr.IssueDuplicatePort {
+			t.Fatalf("Unexpected inventory: %+v", inventory)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"configarr"
+
+	"github.com/spf13/pflag"
+)
+
+// ListFlags represents the command-line flags of the list subcommand.
+type ListFlags struct {
+	WithSource  bool
+	StateFile   string
+	Template    string
+	ShowSecrets bool
+	ConfigFiles []string
+}
+
+// parseListFlags parses the flags of the list subcommand. Positional arguments are
+// the configuration files to list and default to DefaultConfigPath.
+func parseListFlags(flags []string) (ListFlags, error) {
+	flagSet := pflag.NewFlagSet("list", pflag.ContinueOnError)
+
+	withSource := flagSet.Bool("with-source", false, "Show where each value came from, based on the state file")
+	stateFile := flagSet.String("state-file", "", "State file written with --state-file (default: the default of --state-file)")
+	tmpl := flagSet.String("template", "", "Render each file with a Go template over its properties instead of the table, e.g. '{{ .Port }}'")
+	showSecrets := flagSet.Bool("show-secrets", false, "Do not mask the values of secret properties")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return ListFlags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+	if *withSource && *tmpl != "" {
+		return ListFlags{}, errors.New("--with-source can't be combined with --template")
+	}
+
+	configFiles := flagSet.Args()
+	if len(configFiles) == 0 {
+		configFiles = []string{configarr.DefaultConfigPath}
+	}
+
+	if !flagSet.Changed("state-file") {
+		*stateFile = configarr.DefaultStateFile(runningInContainer(), os.Getenv)
+	}
+	if *withSource && *stateFile == "" {
+		return ListFlags{}, errors.New("--with-source requires --state-file")
+	}
+
+	return ListFlags{
+		WithSource:  *withSource,
+		StateFile:   *stateFile,
+		Template:    *tmpl,
+		ShowSecrets: *showSecrets,
+		ConfigFiles: configFiles,
+	}, nil
+}
+
+// runList prints the properties of the configuration files as a table.
+func runList(args []string, output io.Writer) error {
+	flags, err := parseListFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	if flags.Template != "" {
+		return listTemplate(flags, output)
+	}
+
+	var provenance *configarr.Provenance
+	if flags.WithSource {
+		if provenance, err = configarr.LoadProvenance(flags.StateFile); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	header := "FILE\tKEY\tVALUE"
+	if flags.WithSource {
+		header += "\tSOURCE"
+	}
+	fmt.Fprintln(w, header)
+
+	for _, configFile := range flags.ConfigFiles {
+		config, err := configarr.ReadConfigFile(configFile)
+		if err != nil {
+			return fmt.Errorf("error reading configuration file: %w", err)
+		}
+
+		for _, key := range config.Keys {
+			value := config.Properties[key]
+			row := fmt.Sprintf("%s\t%s\t%s", configFile, key, exportValue(key, value, flags.ShowSecrets))
+			if flags.WithSource {
+				row += "\t" + provenance.SourceOf(configFile, key, value)
+			}
+			fmt.Fprintln(w, row)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing list: %w", err)
+	}
+	return nil
+}
+
+// listTemplate renders the template once per configuration file, see renderTemplate.
+func listTemplate(flags ListFlags, output io.Writer) error {
+	tmpl, err := parseTemplate("list", flags.Template)
+	if err != nil {
+		return err
+	}
+
+	for _, configFile := range flags.ConfigFiles {
+		config, err := configarr.ReadConfigFile(configFile)
+		if err != nil {
+			return fmt.Errorf("error reading configuration file: %w", err)
+		}
+		if err := renderTemplate(tmpl, configFile, config, flags.ShowSecrets, output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
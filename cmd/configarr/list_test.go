@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// TestParseListFlags tests parsing the flags of the list subcommand.
+func TestParseListFlags(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		flags, err := parseListFlags(nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if flags.WithSource || len(flags.ConfigFiles) != 1 || flags.ConfigFiles[0] != configarr.DefaultConfigPath {
+			t.Fatalf("Unexpected default flags: %+v", flags)
+		}
+	})
+
+	t.Run("Source with default state file", func(t *testing.T) {
+		flags, err := parseListFlags([]string{"--with-source", "/data/config.xml"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := configarr.DefaultStateFile(runningInContainer(), os.Getenv); flags.StateFile != expected {
+			t.Fatalf("Expected state file %s, got %s", expected, flags.StateFile)
+		}
+	})
+
+	t.Run("Source without state file", func(t *testing.T) {
+		if _, err := parseListFlags([]string{"--with-source", "--state-file", ""}); err == nil {
+			t.Fatal("Expected error for --with-source without --state-file, but got none")
+		}
+	})
+
+	t.Run("Source with template", func(t *testing.T) {
+		if _, err := parseListFlags([]string{"--with-source", "--template", "{{ .Port }}"}); err == nil {
+			t.Fatal("Expected error for --with-source with --template, but got none")
+		}
+	})
+}
+
+// TestRunList tests listing properties with their sources.
+func TestRunList(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.xml")
+	stateFile := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(configFile, []byte("<Config><Port>8989</Port><ApiKey>abc</ApiKey></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	var output strings.Builder
+	args := []string{"configarr", "--config", configFile, "--state-file", stateFile}
+	if _, err := run([]string{"CONFIGARR__PORT=Port=9000"}, args, nil, &output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output.Reset()
+	if err := runList([]string{"--with-source", "--state-file", stateFile, configFile}, &output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %q", output.String())
+	}
+	if fields := strings.Fields(lines[1]); len(fields) != 4 || fields[1] != "Port" || fields[2] != "9000" || fields[3] != "env:CONFIGARR__PORT" {
+		t.Fatalf("Unexpected row for Port: %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); len(fields) != 4 || fields[2] != configarr.SecretMask || fields[3] != configarr.SourceFile {
+		t.Fatalf("Unexpected row for ApiKey: %q", lines[2])
+	}
+
+	t.Run("Template", func(t *testing.T) {
+		var output strings.Builder
+		if err := runList([]string{"--template", "{{ .Port }} {{ .ApiKey }}", configFile, configFile}, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := "9000 " + configarr.SecretMask + "\n9000 " + configarr.SecretMask + "\n"; output.String() != expected {
+			t.Fatalf("Expected %q, got %q", expected, output.String())
+		}
+
+		if err := runList([]string{"--template", "{{ .Missing }}", configFile}, &strings.Builder{}); err == nil {
+			t.Fatal("Expected error for a missing property, but got none")
+		}
+	})
+}
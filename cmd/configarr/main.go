@@ -1,222 +1,1170 @@
 package main
 
 import (
-	"encoding/xml"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"configarr"
 	"github.com/spf13/pflag"
 )
 
-// Constants for default configuration
-const (
-	DefaultConfigPath = "/config/config.xml"
-	DefaultPrefix     = "CONFIGARR__"
-)
-
-// Config represents the XML structure with properties as a map and key order tracking.
-type Config struct {
-	XMLName    xml.Name          `xml:"Config"`
-	Properties map[string]string `xml:"-"`
-	Keys       []string          `xml:"-"`
-}
-
 // Flags represents the command-line flags used by the application.
 type Flags struct {
 	ConfigFilePath      string
+	ConfigFiles         []string // All configuration files when --config matches several, the first being ConfigFilePath
+	Format              string
 	IgnoreMissingConfig bool
+	SkipUnwritable      bool
+	RecoverEmpty        bool
+	RecoverTemplate     string
 	Prefix              string
+	PrefixIgnoreCase    bool
+	AllowKeys           []string
+	Delimiter           string
 	Debug               bool
+	Fidelity            bool
+	Patch               bool
+	ConflictRetries     int
+	ReadRetries         int
+	ReadRetryDelay      time.Duration
+	SettleDelay         time.Duration
+	Watch               bool
+	WatchInterval       time.Duration
+	WatchDebounce       time.Duration
+	WriteRetryDelay     time.Duration
+	MaxWriteRetryDelay  time.Duration
+	MetricsFile         string
+	SettleTimeout       time.Duration
+	RequireAppStopped   []string
+	Verify              bool
+	Backups             int
+	FileMode            os.FileMode          // Mode the configuration file is written with; zero keeps its mode
+	Owner               *configarr.FileOwner // Owner the configuration file is written with; nil keeps its owner
+	FromJSON            string
+	FromYAML            string
+	StdinKV             bool
+	DownwardDir         string
+	SecretsDir          string
+	SecretsPattern      string
+	SecretsCase         string
+	Compact             bool
+	Indent              string
+	Reformat            bool
+	CDATA               bool
+	PostProcess         []string
+	ManagedHeader       bool
+	FinalNewline        string
+	CreateKeys          string
+	KeyGroups           [][]string
+	RulesFile           string
+	EncryptionKeyFile   string
+	DecryptCommand      string
+	SourceCommands      []string
+	Set                 []string
+	EncryptCommand      string
+	Decrypters          map[string]string
+	Command             []string
+	ChildEnv            []string
+	StripEnv            bool
+	ExitCode            string
+	StrictSecrets       bool
+	DryRun              bool
+	GoldenFile          string
+	Presets             []string
+	CatalogFile         string
+	CatalogURL          string
+	EventsFormat        string
+	Progress            string
+	Notify              []string
+	OnlyKeys            []string
+	SkipKeys            []string
+	Unmanaged           []string
+	UnmanagedFile       string
+	PublishSecrets      []string
+	Links               []string
+	DesiredState        string
+	Targets             map[string]string
+	Serve               string
+	ServeTokens         map[string]string
+	PrefixTargets       []PrefixTarget
+	TargetTimeout       time.Duration
+	Atomic              bool
+	StateFile           string
+	App                 string
+	MaxValueSize        int64
+	MaxFileSize         int64
+	ValidationMode      string
+	Record              string
+	Faults              configarr.Faults
+
+	overrides    []configarr.Override // Overrides replacing all sources, e.g. of a recorded run (see runReplay) or of configarr set
+	validateOnly bool                 // Dry run without printing the diff, see runValidate
 }
 
-// UnmarshalXML customizes the unmarshalling of the XML into the Config struct.
-// This function reads XML elements and stores them in the Properties map and tracks key order.
-func (c *Config) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	c.Properties = make(map[string]string)
-	c.Keys = []string{}
-	for {
-		token, err := d.Token()
-		if err != nil {
-			if err == io.EOF {
-				break // End of XML document
+// PrefixTarget binds the environment variables with the prefix to a configuration file,
+// given as --target <prefix>=<path>, e.g. --target SONARR__=/sonarr/config.xml.
+type PrefixTarget struct {
+	Prefix string
+	Path   string
+}
+
+// parseFlags parses the provided command-line flags and returns a Flags struct.
+func parseFlags(flags []string) (Flags, error) {
+	flagSet := pflag.NewFlagSet("configFlags", pflag.ContinueOnError) // Create a new flag set to avoid affecting the global command line flags
+
+	configFiles := flagSet.StringArray("config", []string{configarr.DefaultConfigPath}, "Path or glob pattern of the configuration file; can be repeated to update several files")
+	format := flagSet.String("format", "", "Format of the configuration file (xml, json, yaml, ini or xmlattr, default: detected from the file extension)")
+	maxValueSize := flagSet.Int64("max-value-size", configarr.DefaultMaxValueSize, "Refuse values larger than this many bytes (0 disables the limit)")
+	maxFileSize := flagSet.Int64("max-file-size", configarr.DefaultMaxFileSize, "Refuse to parse configuration files larger than this many bytes (0 disables the limit)")
+	validationMode := flagSet.String("validation-mode", configarr.ValidationModeError, "Whether values and files exceeding the size limits are refused (error) or only logged (warn)")
+	force := flagSet.Bool("force", false, "Disable the value and file size limits")
+	app := flagSet.String("app", "", "App from the catalog whose default configuration file for this OS is used when --config is not set")
+	prefix := flagSet.String("prefix", configarr.DefaultPrefix, "Prefix for environment variables")
+	prefixIgnoreCase := flagSet.Bool("prefix-ignore-case", false, "Match the prefix of environment variables regardless of case")
+	allowKeys := flagSet.StringArray("allow-key", nil, "Only read environment variables whose name matches this glob pattern, e.g. SONARR_*; required with an empty --prefix (repeatable)")
+	delimiter := flagSet.String("kv-delimiter", configarr.DefaultDelimiter, "Separator between the property and the value in environment variables")
+	debug := flagSet.Bool("debug", false, "Enable debug logging")
+	ignoreMissingConfig := flagSet.Bool("ignore-missing-config", false, "Ignore missing configuration file")
+	skipUnwritable := flagSet.Bool("skip-unwritable", false, "Skip configuration files that are immutable or on a read-only filesystem with a warning instead of failing")
+	recoverEmpty := flagSet.Bool("recover-empty", false, "Seed an empty configuration file from its newest backup, --recover-template or the catalog defaults instead of failing")
+	recoverTemplate := flagSet.String("recover-template", "", "Template an empty configuration file is seeded from when it has no backup, with --recover-empty")
+	fidelity := flagSet.Bool("fidelity", false, "Leave the file untouched when nothing changes and refuse rewrites that alter unchanged content")
+	patch := flagSet.Bool("patch", false, "Splice changed values into the original file instead of re-marshalling it")
+	readRetries := flagSet.Int("read-retries", configarr.DefaultReadRetries, "Retry reading this many times when the file looks partially written")
+	readRetryDelay := flagSet.Duration("read-retry-delay", configarr.DefaultReadRetryDelay, "Delay between read retries")
+	settleDelay := flagSet.Duration("settle-delay", 0, "Require the file's modification time and size to be unchanged for this long before reading it")
+	settleTimeout := flagSet.Duration("settle-timeout", configarr.DefaultSettleTimeout, "Give up when the file does not settle within this time")
+	watch := flagSet.Bool("watch", false, "Keep running and re-apply the overrides whenever the app rewrites the configuration file")
+	watchInterval := flagSet.Duration("watch-interval", configarr.DefaultWatchInterval, "Interval the configuration file is polled with in --watch mode")
+	watchDebounce := flagSet.Duration("watch-debounce", 0, "Window changes of the file are coalesced in before --watch re-applies the overrides (default: --watch-interval)")
+	writeRetryDelay := flagSet.Duration("write-retry-delay", configarr.DefaultWriteRetryDelay, "Delay before --watch retries changes whose write failed, doubled after every failure (0 waits for the next change of the file)")
+	maxWriteRetryDelay := flagSet.Duration("max-write-retry-delay", configarr.DefaultMaxWriteRetryDelay, "Longest delay between retries of failed writes in --watch mode")
+	metricsFile := flagSet.String("metrics-file", "", "In --watch mode, write metrics such as the depth of the write queue to this file after every run, in the Prometheus text format")
+	requireAppStopped := flagSet.StringSlice("require-app-stopped", nil, "Refuse to modify the file while the application runs (process:<name>, pidfile:<path> or port:[<host>:]<port>)")
+	verify := flagSet.Bool("verify", true, "Re-read the file after writing and restore the original content if the changes are missing")
+	backups := flagSet.Int("backup", 0, fmt.Sprintf("Copy the configuration file to <file>.bak.<time> before writing changes, keeping this many backups (default when given without a value: %d)", configarr.DefaultBackups))
+	flagSet.Lookup("backup").NoOptDefVal = strconv.Itoa(configarr.DefaultBackups)
+	fileMode := flagSet.String("file-mode", "", "Write the configuration file with this octal mode, e.g. 0640, instead of keeping its mode")
+	owner := flagSet.String("owner", "", "Write the configuration file owned by this numeric uid:gid, e.g. 1000:1000, instead of keeping its owner")
+	fromJSON := flagSet.String("from-json", "", "Read key/value overrides from a flat JSON document (- for stdin)")
+	fromYAML := flagSet.String("from-yaml", "", "Read key/value overrides from a flat YAML document (- for stdin)")
+	stdinKV := flagSet.Bool("stdin-kv", false, "Read KEY=VALUE override lines from stdin")
+	set := flagSet.StringArray("set", nil, "Set a property, as <key>=<value> with the --kv-delimiter, taking precedence over all other sources (repeatable)")
+	sourceCommands := flagSet.StringArray("source-cmd", nil, "Read overrides from the output of a command, as KEY=VALUE lines or a flat JSON object, e.g. 'op inject -i values.env' (repeatable)")
+	downwardDir := flagSet.String("downward-dir", "", "Read overrides from the configarr.io/ annotations and labels in a Kubernetes Downward API volume")
+	secretsDir := flagSet.String("secrets-dir", "", "Read overrides from the files in a secrets directory, named after their key (default when given without a value: "+defaultSecretsDir+")")
+	flagSet.Lookup("secrets-dir").NoOptDefVal = defaultSecretsDir
+	secretsPattern := flagSet.String("secrets-pattern", secretKeyPlaceholder, "Names of the files read from --secrets-dir, with "+secretKeyPlaceholder+" in place of the key, e.g. sonarr_"+secretKeyPlaceholder)
+	secretsCase := flagSet.String("secrets-case", secretsCaseExact, "How the key is derived from the file names of --secrets-dir: exact, or pascal for e.g. api_key as ApiKey")
+	compact := flagSet.Bool("compact", false, "Write the document on a single line without indentation")
+	pretty := flagSet.Bool("pretty", true, "Write the document indented with --indent; --pretty=false is the same as --compact")
+	indent := flagSet.String("indent", configarr.DefaultIndent, "Indentation used for pretty output")
+	reformat := flagSet.Bool("reformat", false, "Re-marshal the whole XML document with --indent instead of only changing the modified lines")
+	postProcess := flagSet.StringArray("post-process", nil, "Change the rendered file before it is written (<name>[:<arg>], e.g. header, indent:<indent> or sort, repeatable)")
+	managedHeader := flagSet.Bool("managed-header", false, "Put a comment telling that the file is managed by configarr at the top of written files, updated when they change")
+	cdata := flagSet.Bool("cdata", false, "Write XML values holding markup characters (<, > or &) as CDATA sections instead of escaping them")
+	encryptionKeyFile := flagSet.String("encryption-key-file", "", "File with a hex or base64 AES key the configuration file is encrypted with")
+	decryptCommand := flagSet.String("decrypt-command", "", "Command decrypting the configuration file from stdin to stdout, e.g. 'age -d -i key.txt'")
+	decrypters := flagSet.StringArray("decrypter", nil, "Decrypt override values of the form enc:<name>:<ciphertext> by piping the ciphertext through a command (<name>=<command>, e.g. 'age=age -d -i key.txt', repeatable)")
+	encryptCommand := flagSet.String("encrypt-command", "", "Command encrypting the configuration file from stdin to stdout, e.g. 'age -r age1...'")
+	childEnv := flagSet.StringArray("child-env", nil, "Set KEY=VALUE in the environment of the command after --; can be repeated")
+	stripEnv := flagSet.Bool("strip-env", false, "Remove the prefixed variables from the environment of the command after --")
+	keyGroups := flagSet.StringArray("key-group", nil, "Comma-separated keys that are only changed together, e.g. SslPort,EnableSsl,SslCertPath; can be repeated")
+	rulesFile := flagSet.String("rules", "", "Rename properties and rewrite their values with the rules in this YAML file before applying the overrides")
+	createKeys := flagSet.String("create-keys", "", "Create known keys missing from the file, ordered by append or catalog")
+	finalNewline := flagSet.String("final-newline", configarr.FinalNewlinePreserve, "Whether the written file ends with a newline (always, never or preserve)")
+	catalogFile := flagSet.String("catalog-file", "", "Load additional or replacement app definitions for the key catalog from a file (default: configarr/catalog.json in $XDG_CONFIG_HOME or $XDG_CONFIG_DIRS, if it exists)")
+	catalogURL := flagSet.String("catalog-url", "", "Load additional or replacement app definitions for the key catalog from a URL")
+	progress := flagSet.String("progress", "", "Report the progress of --desired-state runs over several targets on stderr (text or ndjson)")
+	eventsFormat := flagSet.String("events-format", "", "Stream one structured event per change and skipped override (ndjson)")
+	onlyKeys := flagSet.StringSlice("only-keys", nil, "Only apply overrides for keys matching these glob patterns")
+	skipKeys := flagSet.StringSlice("skip-keys", nil, "Never apply overrides for keys matching these glob patterns")
+	unmanaged := flagSet.StringSlice("unmanaged", nil, "Keep the manual edits of keys matching these glob patterns, even when an override targets them")
+	unmanagedFile := flagSet.String("unmanaged-file", "", "File listing glob patterns of unmanaged keys, one per line")
+	desiredState := flagSet.String("desired-state", "", "Apply a YAML file mapping app names to their properties to the --target files")
+	serveAddr := flagSet.String("serve", "", "After applying --desired-state, keep serving the configuration files of the targets at /v1/targets/<app>/config on this address, e.g. :8080")
+	serveTokens := flagSet.StringArray("serve-token", nil, "File holding the bearer token of a target in --serve mode (<app>=<path>, repeatable)")
+	targets := flagSet.StringArray("target", nil, "Configuration file of an app in the desired state (<app>=<path>), or of the environment variables with a prefix ending in _ (<prefix>=<path>, e.g. SONARR__=/sonarr/config.xml); repeatable")
+	targetTimeout := flagSet.Duration("target-timeout", 0, "Give up on a target of --desired-state or several --config files after this long and continue with the next one (0 disables the timeout)")
+	atomic := flagSet.Bool("atomic", false, "Apply several configuration files or --target entries all or nothing: plan every file before writing any and restore the files already written when one fails")
+	stateFile := flagSet.String("state-file", "", "Record the source of every written change in this file, shown by 'configarr list --with-source' (default: $XDG_STATE_HOME/configarr/state.json, disabled inside containers without $XDG_STATE_HOME, empty disables)")
+	var faults configarr.Faults
+	flagSet.IntVar(&faults.WriteFailures, "chaos-write-failures", 0, "Fail this many writes of the configuration file (fault injection for testing)")
+	flagSet.IntVar(&faults.TornWrites, "chaos-torn-writes", 0, "Write only half of the file this many times, reporting success (fault injection for testing)")
+	flagSet.IntVar(&faults.PartialReads, "chaos-partial-reads", 0, "Return only half of the file on this many reads (fault injection for testing)")
+	flagSet.IntVar(&faults.Conflicts, "chaos-conflicts", 0, "Simulate a concurrent modification of the file on this many re-reads (fault injection for testing)")
+	for _, name := range []string{"chaos-write-failures", "chaos-torn-writes", "chaos-partial-reads", "chaos-conflicts"} {
+		_ = flagSet.MarkHidden(name) // Only documented in the README
+	}
+	record := flagSet.String("record", "", "Write the inputs and the plan of the run, with secrets masked, to a bundle for 'configarr replay' (e.g. bundle.tgz)")
+	publishSecrets := flagSet.StringArray("publish-secret", nil, "Publish a property to a Kubernetes Secret after the run ([<property>=]<namespace>/<name>/<key>, property defaults to ApiKey, repeatable)")
+	links := flagSet.StringArray("link", nil, "Copy a property into a dependent file after the run ([<property>=]<format>:<path>:<key>, format yaml or dotenv, property defaults to ApiKey, repeatable)")
+	notify := flagSet.StringArray("notify", nil, "Notify about written changes (<kind>:<target>[;keys=<glob>,...], repeatable)")
+	presets := flagSet.StringArray("preset", nil, "Apply the properties of a preset before all other sources ("+strings.Join(configarr.PresetNames(), ", ")+"), repeatable")
+	strictSecrets := flagSet.Bool("strict-secrets", false, "Refuse to write placeholder or otherwise weak values of secret properties such as ApiKey instead of warning about them")
+	dryRun := flagSet.Bool("dry-run", false, "Print a unified diff of the changes instead of writing the configuration file")
+	golden := flagSet.String("golden", "", "In a dry run, also report the properties that differ from this golden reference file")
+	exitCodes := flagSet.String("exit-code", "", "Also tell changes apart by the exit code: 'diff' exits with 1 when properties changed or would change and 2 or higher on errors, 'detailed' with 2 when properties changed and 3 when they would change in a dry run (default when given without a value: diff)")
+	flagSet.Lookup("exit-code").NoOptDefVal = exitCodesDiff
+	conflictRetries := flagSet.Int("conflict-retries", 0, "Re-read and re-apply this many times when the file changes while updating")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return Flags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	switch *finalNewline {
+	case configarr.FinalNewlineAlways, configarr.FinalNewlineNever, configarr.FinalNewlinePreserve:
+	default:
+		return Flags{}, fmt.Errorf("invalid --final-newline %q: expected always, never or preserve", *finalNewline)
+	}
+
+	for _, name := range *presets {
+		if _, exists := configarr.LookupPreset(name); !exists {
+			return Flags{}, fmt.Errorf("unknown preset %q: expected one of %s", name, strings.Join(configarr.PresetNames(), ", "))
+		}
+	}
+
+	switch *validationMode {
+	case configarr.ValidationModeError, configarr.ValidationModeWarn:
+	default:
+		return Flags{}, fmt.Errorf("invalid --validation-mode %q: expected error or warn", *validationMode)
+	}
+
+	if (*decryptCommand == "") != (*encryptCommand == "") {
+		return Flags{}, errors.New("--decrypt-command and --encrypt-command must be set together")
+	}
+	if *encryptionKeyFile != "" && *decryptCommand != "" {
+		return Flags{}, errors.New("--encryption-key-file can't be combined with --decrypt-command")
+	}
+
+	if flagSet.Changed("pretty") {
+		if *pretty && *compact {
+			return Flags{}, errors.New("--pretty can't be combined with --compact")
+		}
+		*compact = !*pretty
+	}
+
+	if *delimiter == "" {
+		return Flags{}, errors.New("--kv-delimiter must not be empty")
+	}
+
+	if strings.Count(*secretsPattern, secretKeyPlaceholder) != 1 {
+		return Flags{}, fmt.Errorf("invalid --secrets-pattern %q: expected %s once", *secretsPattern, secretKeyPlaceholder)
+	}
+	switch *secretsCase {
+	case secretsCaseExact, secretsCasePascal:
+	default:
+		return Flags{}, fmt.Errorf("invalid --secrets-case %q: expected %s or %s", *secretsCase, secretsCaseExact, secretsCasePascal)
+	}
+
+	switch *createKeys {
+	case "", configarr.KeyOrderAppend, configarr.KeyOrderCatalog:
+	default:
+		return Flags{}, fmt.Errorf("invalid --create-keys %q: expected append or catalog", *createKeys)
+	}
+
+	for _, pattern := range append(append(append([]string{}, *onlyKeys...), *skipKeys...), *unmanaged...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return Flags{}, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+	}
+
+	if *force {
+		*maxValueSize, *maxFileSize = 0, 0
+	}
+	if *exitCodes != "" && *exitCodes != exitCodesDiff && *exitCodes != exitCodesDetailed {
+		return Flags{}, fmt.Errorf("invalid --exit-code %q: expected %s or %s", *exitCodes, exitCodesDiff, exitCodesDetailed)
+	}
+	if _, err := parseKeyValues(*set, *delimiter, "flag:set"); err != nil {
+		return Flags{}, fmt.Errorf("invalid --set: %w", err)
+	}
+	if *recoverTemplate != "" && !*recoverEmpty {
+		return Flags{}, errors.New("--recover-template requires --recover-empty")
+	}
+	if (len(*postProcess) > 0 || *managedHeader) && (*patch || *fidelity) {
+		return Flags{}, errors.New("--post-process and --managed-header can't be combined with --patch or --fidelity")
+	}
+
+	if *app != "" && !flagSet.Changed("config") {
+		*configFiles = []string{configarr.DefaultConfigPathFor(*app, runtime.GOOS, os.Getenv)}
+	}
+	paths, err := expandConfigFiles(*configFiles, *ignoreMissingConfig)
+	if err != nil {
+		return Flags{}, err
+	}
+	configFilePath := paths[0]
+
+	if !flagSet.Changed("state-file") {
+		*stateFile = configarr.DefaultStateFile(runningInContainer(), os.Getenv)
+	}
+	if !flagSet.Changed("catalog-file") {
+		for _, file := range configarr.DefaultCatalogFiles(runningInContainer(), os.Getenv) {
+			if _, err := os.Stat(file); err == nil {
+				*catalogFile = file
+				break
 			}
-			return fmt.Errorf("error parsing XML token: %w", err)
 		}
+	}
 
-		switch t := token.(type) {
-		case xml.StartElement:
-			var content string
-			if err := d.DecodeElement(&content, &t); err != nil {
-				return fmt.Errorf("error decoding XML element %s: %w", t.Name.Local, err)
+	for _, pair := range *childEnv {
+		if name, _, found := strings.Cut(pair, "="); !found || name == "" {
+			return Flags{}, fmt.Errorf("invalid --child-env %q: expected KEY=VALUE", pair)
+		}
+	}
+	if (len(*childEnv) > 0 || *stripEnv) && flagSet.NArg() == 0 {
+		return Flags{}, errors.New("--child-env and --strip-env require a command after --")
+	}
+	var command []string
+	if flagSet.NArg() > 0 {
+		command = flagSet.Args()
+	}
+
+	var decrypterCommands map[string]string
+	for _, decrypter := range *decrypters {
+		name, command, found := strings.Cut(decrypter, "=")
+		if !found || name == "" || strings.TrimSpace(command) == "" {
+			return Flags{}, fmt.Errorf("invalid --decrypter %q: expected <name>=<command>", decrypter)
+		}
+		if decrypterCommands == nil {
+			decrypterCommands = make(map[string]string)
+		}
+		decrypterCommands[name] = command
+	}
+
+	var groups [][]string
+	for _, group := range *keyGroups {
+		members := strings.Split(group, ",")
+		if len(members) < 2 || slices.Contains(members, "") {
+			return Flags{}, fmt.Errorf("invalid --key-group %q: expected at least two comma-separated keys", group)
+		}
+		groups = append(groups, members)
+	}
+
+	var targetPaths map[string]string
+	var prefixTargets []PrefixTarget
+	for _, target := range *targets {
+		app, path, found := strings.Cut(target, "=")
+		if !found || app == "" || path == "" {
+			return Flags{}, fmt.Errorf("invalid --target %q: expected <app>=<path> or <prefix>=<path>", target)
+		}
+		if strings.HasSuffix(app, "_") {
+			for _, other := range prefixTargets {
+				if a, b := strings.ToUpper(other.Prefix), strings.ToUpper(app); strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+					return Flags{}, fmt.Errorf("the --target prefixes %s and %s overlap", other.Prefix, app)
+				}
 			}
-			// Store the element's content in the map
-			c.Properties[t.Name.Local] = content
-			// Track the key order
-			c.Keys = append(c.Keys, t.Name.Local)
+			prefixTargets = append(prefixTargets, PrefixTarget{Prefix: app, Path: filepath.Clean(path)})
+			continue
 		}
+		if targetPaths == nil {
+			targetPaths = make(map[string]string)
+		}
+		targetPaths[app] = filepath.Clean(path)
 	}
-	return nil
+	var serveTokenFiles map[string]string
+	for _, token := range *serveTokens {
+		app, path, found := strings.Cut(token, "=")
+		if !found || app == "" || path == "" {
+			return Flags{}, fmt.Errorf("invalid --serve-token %q: expected <app>=<path>", token)
+		}
+		if serveTokenFiles == nil {
+			serveTokenFiles = make(map[string]string)
+		}
+		serveTokenFiles[app] = path
+	}
+	if *serveAddr != "" && (*desiredState == "" || *dryRun || *watch || len(command) > 0) {
+		return Flags{}, errors.New("--serve requires --desired-state and can't be combined with --dry-run, --watch or a command")
+	}
+	if len(serveTokenFiles) > 0 && *serveAddr == "" {
+		return Flags{}, errors.New("--serve-token requires --serve")
+	}
+	if *prefix == "" && len(*allowKeys) == 0 {
+		return Flags{}, errors.New("an empty --prefix requires --allow-key")
+	}
+	if err := validateProgressFormat(*progress); err != nil {
+		return Flags{}, err
+	}
+	for _, path := range paths {
+		if _, err := configarr.LookupFormat(*format, path); err != nil {
+			return Flags{}, err
+		}
+	}
+	if len(paths) == 1 {
+		paths = nil // A single file is ConfigFilePath
+	}
+	if len(paths) > 1 && (*watch || *record != "" || *desiredState != "" || *app != "" || len(*links) > 0 || len(*publishSecrets) > 0) {
+		return Flags{}, errors.New("several configuration files can't be combined with --watch, --record, --desired-state, --app, --link or --publish-secret")
+	}
+	if len(prefixTargets) > 0 && (len(targetPaths) > 0 || *desiredState != "" || flagSet.Changed("config")) {
+		return Flags{}, errors.New("--target with a prefix can't be combined with app targets, --desired-state or --config")
+	}
+	if len(prefixTargets) > 0 && (*watch || *record != "" || *app != "" || len(*links) > 0 || len(*publishSecrets) > 0) {
+		return Flags{}, errors.New("--target with a prefix can't be combined with --watch, --record, --app, --link or --publish-secret")
+	}
+	for _, target := range prefixTargets {
+		if _, err := configarr.LookupFormat(*format, target.Path); err != nil {
+			return Flags{}, err
+		}
+	}
+	if len(prefixTargets) > 0 {
+		configFilePath = prefixTargets[0].Path
+	}
+	if *atomic && *targetTimeout > 0 {
+		return Flags{}, errors.New("--atomic can't be combined with --target-timeout, which continues with the next target")
+	}
+	if *watchDebounce < 0 {
+		return Flags{}, errors.New("--watch-debounce can't be negative")
+	}
+	if *targetTimeout < 0 {
+		return Flags{}, errors.New("--target-timeout can't be negative")
+	}
+	if *backups < 0 {
+		return Flags{}, errors.New("--backup can't be negative")
+	}
+	mode, err := parseFileMode(*fileMode)
+	if err != nil {
+		return Flags{}, err
+	}
+	fileOwner, err := parseOwner(*owner)
+	if err != nil {
+		return Flags{}, err
+	}
+	if faults.WriteFailures < 0 || faults.TornWrites < 0 || faults.PartialReads < 0 || faults.Conflicts < 0 {
+		return Flags{}, errors.New("the --chaos-* counts can't be negative")
+	}
+	if *record != "" && (*desiredState != "" || *watch) {
+		return Flags{}, errors.New("--record can't be combined with --desired-state or --watch")
+	}
+	if *golden != "" && (!*dryRun || *desiredState != "") {
+		return Flags{}, errors.New("--golden requires --dry-run and can't be combined with --desired-state")
+	}
+	if *metricsFile != "" && !*watch {
+		return Flags{}, errors.New("--metrics-file requires --watch")
+	}
+	if *watch && (*desiredState != "" || *dryRun || len(command) > 0) {
+		return Flags{}, errors.New("--watch can't be combined with --desired-state, --dry-run or a command")
+	}
+	if *desiredState != "" && len(*publishSecrets) > 0 {
+		return Flags{}, errors.New("--publish-secret can't be combined with --desired-state")
+	}
+	if *desiredState != "" && len(*links) > 0 {
+		return Flags{}, errors.New("--link can't be combined with --desired-state")
+	}
+	if *desiredState != "" && len(*set) > 0 {
+		return Flags{}, errors.New("--set can't be combined with --desired-state, which sets the properties of each app")
+	}
+
+	return Flags{
+		ConfigFilePath:      configFilePath,
+		ConfigFiles:         paths,
+		Format:              *format,
+		IgnoreMissingConfig: *ignoreMissingConfig,
+		SkipUnwritable:      *skipUnwritable,
+		RecoverEmpty:        *recoverEmpty,
+		RecoverTemplate:     *recoverTemplate,
+		Prefix:              *prefix,
+		PrefixIgnoreCase:    *prefixIgnoreCase,
+		AllowKeys:           *allowKeys,
+		Delimiter:           *delimiter,
+		Debug:               *debug,
+		Fidelity:            *fidelity,
+		Patch:               *patch,
+		ConflictRetries:     *conflictRetries,
+		ReadRetries:         *readRetries,
+		ReadRetryDelay:      *readRetryDelay,
+		SettleDelay:         *settleDelay,
+		Watch:               *watch,
+		WatchInterval:       *watchInterval,
+		WatchDebounce:       *watchDebounce,
+		WriteRetryDelay:     *writeRetryDelay,
+		MaxWriteRetryDelay:  *maxWriteRetryDelay,
+		MetricsFile:         *metricsFile,
+		SettleTimeout:       *settleTimeout,
+		RequireAppStopped:   *requireAppStopped,
+		Verify:              *verify,
+		Backups:             *backups,
+		FileMode:            mode,
+		Owner:               fileOwner,
+		FromJSON:            *fromJSON,
+		FromYAML:            *fromYAML,
+		StdinKV:             *stdinKV,
+		DownwardDir:         *downwardDir,
+		SecretsDir:          *secretsDir,
+		SecretsPattern:      *secretsPattern,
+		SecretsCase:         *secretsCase,
+		Compact:             *compact,
+		Indent:              *indent,
+		Reformat:            *reformat,
+		CDATA:               *cdata,
+		PostProcess:         *postProcess,
+		ManagedHeader:       *managedHeader,
+		FinalNewline:        *finalNewline,
+		CreateKeys:          *createKeys,
+		KeyGroups:           groups,
+		RulesFile:           *rulesFile,
+		EncryptionKeyFile:   *encryptionKeyFile,
+		DecryptCommand:      *decryptCommand,
+		SourceCommands:      *sourceCommands,
+		Set:                 *set,
+		EncryptCommand:      *encryptCommand,
+		Decrypters:          decrypterCommands,
+		Command:             command,
+		ChildEnv:            *childEnv,
+		StripEnv:            *stripEnv,
+		ExitCode:            *exitCodes,
+		StrictSecrets:       *strictSecrets,
+		DryRun:              *dryRun,
+		GoldenFile:          *golden,
+		Presets:             *presets,
+		CatalogFile:         *catalogFile,
+		CatalogURL:          *catalogURL,
+		EventsFormat:        *eventsFormat,
+		Progress:            *progress,
+		Notify:              *notify,
+		OnlyKeys:            *onlyKeys,
+		SkipKeys:            *skipKeys,
+		Unmanaged:           *unmanaged,
+		UnmanagedFile:       *unmanagedFile,
+		PublishSecrets:      *publishSecrets,
+		Links:               *links,
+		DesiredState:        *desiredState,
+		Targets:             targetPaths,
+		Serve:               *serveAddr,
+		ServeTokens:         serveTokenFiles,
+		PrefixTargets:       prefixTargets,
+		TargetTimeout:       *targetTimeout,
+		Atomic:              *atomic,
+		StateFile:           *stateFile,
+		App:                 *app,
+		MaxValueSize:        *maxValueSize,
+		MaxFileSize:         *maxFileSize,
+		ValidationMode:      *validationMode,
+		Record:              *record,
+		Faults:              faults,
+	}, nil
+}
+
+// expandConfigFiles returns the configuration files of the --config flags with their
+// glob patterns expanded, cleaned and without duplicates. Patterns matching no file are
+// an error unless missing files are ignored; when nothing matches at all, the first
+// pattern is returned, so the run reports or ignores it like a missing file.
+func expandConfigFiles(configs []string, ignoreMissing bool) ([]string, error) {
+	var paths []string
+	for _, config := range configs {
+		matches := []string{config}
+		if strings.ContainsAny(config, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(config); err != nil {
+				return nil, fmt.Errorf("invalid --config pattern %q: %w", config, err)
+			}
+			if len(matches) == 0 && !ignoreMissing {
+				return nil, fmt.Errorf("no configuration file matches --config %q", config)
+			}
+		}
+		for _, match := range matches {
+			match = filepath.Clean(match) // Normalizes slashes, keeps drive letters and UNC shares on Windows
+			if !slices.Contains(paths, match) {
+				paths = append(paths, match)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		paths = []string{filepath.Clean(configs[0])}
+	}
+	return paths, nil
 }
 
-// MarshalXML customizes the marshalling of the Config struct into XML.
-// It encodes the Properties map into XML elements preserving the key order.
-func (c *Config) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
-	start.Name.Local = "Config"
-	if err := e.EncodeToken(start); err != nil {
-		return fmt.Errorf("error encoding XML start token: %w", err)
+// parseFileMode parses the octal permission bits of --file-mode; empty keeps the mode.
+func parseFileMode(spec string) (os.FileMode, error) {
+	if spec == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(spec, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid --file-mode %q: expected octal permission bits such as 0640", spec)
 	}
+	return os.FileMode(mode), nil
+}
+
+// parseOwner parses the numeric uid:gid of --owner; empty keeps the owner.
+func parseOwner(spec string) (*configarr.FileOwner, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("--owner is not supported on Windows")
+	}
+	uid, gid, found := strings.Cut(spec, ":")
+	owner := &configarr.FileOwner{}
+	var uidErr, gidErr error
+	owner.UID, uidErr = strconv.Atoi(uid)
+	owner.GID, gidErr = strconv.Atoi(gid)
+	if !found || uidErr != nil || gidErr != nil || owner.UID < 0 || owner.GID < 0 {
+		return nil, fmt.Errorf("invalid --owner %q: expected a numeric uid:gid such as 1000:1000", spec)
+	}
+	return owner, nil
+}
 
-	// Marshal in the order stored in Keys
-	for _, key := range c.Keys {
-		value := c.Properties[key]
-		elem := xml.StartElement{Name: xml.Name{Local: key}}
-		if err := e.EncodeElement(value, elem); err != nil {
-			return fmt.Errorf("error encoding XML element %s: %w", key, err)
+// parseKeyPatterns parses the glob patterns of --unmanaged-file, one per line. Blank lines
+// and lines starting with # are ignored.
+func parseKeyPatterns(data []byte) ([]string, error) {
+	var patterns []string
+	for i, line := range strings.Split(string(data), "\n") {
+		pattern := strings.TrimSpace(line)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("line %d: invalid key pattern %q: %w", i+1, pattern, err)
 		}
+		patterns = append(patterns, pattern)
 	}
+	return patterns, nil
+}
 
-	if err := e.EncodeToken(xml.EndElement{Name: start.Name}); err != nil {
-		return fmt.Errorf("error encoding XML end token: %w", err)
+// runningInContainer reports whether configarr runs inside a container, where the
+// home directory usually isn't persisted.
+func runningInContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
 	}
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
 
-	return nil
+// run performs the main logic of the application, handling XML configuration updates,
+// and returns the exit code of the process (see exitCode).
+func run(environ []string, args []string, stdin io.Reader, output io.Writer) (int, error) {
+	if len(args) > 1 {
+		switch args[1] {
+		case "export":
+			return exitCode(runExport(args[2:], output))
+		case "s6-install":
+			return exitCode(runS6Install(args[2:], output))
+		case "flatten":
+			return exitCode(runFlatten(args[2:], stdin, output))
+		case "generate":
+			return exitCode(runGenerate(args[2:], stdin, output))
+		case "list":
+			return exitCode(runList(args[2:], output))
+		case "verify":
+			return exitCode(runVerify(args[2:], stdin, output))
+		case "inventory":
+			return exitCode(runInventory(args[2:], output))
+		case "exec":
+			return exitCode(runExec(environ, args[2:], stdin, output))
+		case "replay":
+			return exitCode(runReplay(args[2:], output))
+		case "snapshot":
+			return exitCode(runSnapshot(args[2:], output))
+		case "get":
+			return exitCode(runGet(args[2:], output))
+		case "set":
+			return runSet(environ, args[2:], stdin, output, false)
+		case "unset":
+			return runSet(environ, args[2:], stdin, output, true)
+		case "apply":
+			args = args[1:] // The same as without a subcommand
+		case "diff":
+			return runDiff(environ, args[2:], stdin, output)
+		case "validate":
+			return exitCode(runValidate(environ, args[2:], stdin, output))
+		}
+	}
+
+	flags, err := parseFlags(args[1:]) // exclude the program name
+	if err != nil {
+		return exitInvalid, err
+	}
+	return applyFlags(environ, flags, stdin, output)
 }
 
-// readAndParseXML reads and parses the XML file into a Config struct.
-func readAndParseXML(xmlFile string) (*Config, error) {
-	if _, err := os.Stat(xmlFile); os.IsNotExist(err) {
-		return nil, fmt.Errorf("file does not exist: %s", xmlFile)
+// clock is the clock of the timestamps and durations of runs, recordings and progress
+// reports. Replaced in tests.
+var clock = configarr.SystemClock()
+
+// eventsLogOutput receives the logs when --events-format streams events to the output, so
+// every line of the output is an event. Replaced in tests.
+var eventsLogOutput io.Writer = os.Stderr
+
+// applyFlags applies the overrides as requested by the flags and returns the exit code of
+// the process (see exitCode).
+func applyFlags(environ []string, flags Flags, stdin io.Reader, output io.Writer) (int, error) {
+	changed, err := apply(environ, flags, stdin, output)
+	if err != nil {
+		code, err := exitCode(err)
+		if flags.ExitCode == exitCodesDiff && code == exitFailure {
+			code = exitDiffFailure
+		}
+		return code, err
+	}
+	switch {
+	case !changed || flags.ExitCode == "":
+		return exitOK, nil
+	case flags.ExitCode == exitCodesDiff:
+		return exitDiffChanged, nil
+	case flags.DryRun:
+		return exitDrift, nil
 	}
+	return exitChanged, nil
+}
 
-	file, err := os.ReadFile(xmlFile)
+// apply updates the configuration files as requested by the flags and reports whether
+// any property changed.
+func apply(environ []string, flags Flags, stdin io.Reader, output io.Writer) (bool, error) {
+	level := slog.LevelInfo
+	if flags.Debug {
+		level = slog.LevelDebug
+	}
+	logOutput := output
+	if flags.EventsFormat != "" { // Keep the event stream parseable
+		logOutput = eventsLogOutput
+	}
+	logger := slog.New(slog.NewTextHandler(logOutput, &slog.HandlerOptions{Level: level}))
+
+	catalog, err := configarr.LoadCatalog(flags.CatalogFile, flags.CatalogURL)
 	if err != nil {
-		return nil, fmt.Errorf("error reading file %s: %w", xmlFile, err)
+		return false, err
 	}
 
-	var cfg Config
-	if err := xml.Unmarshal(file, &cfg); err != nil {
-		return nil, fmt.Errorf("error unmarshalling XML: %w", err)
+	if _, known := catalog.Apps[flags.App]; flags.App != "" && !known {
+		return false, invalidInput(fmt.Errorf("unknown app %q: not in the key catalog", flags.App))
 	}
 
-	return &cfg, nil
-}
+	events, err := configarr.NewEventWriter(flags.EventsFormat, output)
+	if err != nil {
+		return false, invalidInput(err)
+	}
+	events = events.WithClock(clock)
 
-// updateConfigWithEnv updates the Config map with values from environment variables
-// that match the given prefix. Returns a map of changed properties.
-func updateConfigWithEnv(environ []string, config *Config, prefix string, logger *slog.Logger) map[string]string {
-	changedProperties := make(map[string]string)
-	envPrefix := strings.ToUpper(prefix)
+	var secretTargets []configarr.SecretTarget
+	for _, spec := range flags.PublishSecrets {
+		target, err := configarr.ParseSecretTarget(spec)
+		if err != nil {
+			return false, invalidInput(err)
+		}
+		secretTargets = append(secretTargets, target)
+	}
 
-	for _, envVar := range environ {
-		if !strings.HasPrefix(envVar, envPrefix) { // Check if the environment variable starts with the prefix
-			continue
+	var links []configarr.Link
+	for _, spec := range flags.Links {
+		link, err := configarr.ParseLink(spec)
+		if err != nil {
+			return false, invalidInput(err)
 		}
+		links = append(links, link)
+	}
 
-		// Split the environment variable into key and value
-		parts := strings.SplitN(envVar[len(envPrefix):], "=", 2)
-		if len(parts) != 2 {
-			logger.Warn(fmt.Sprintf("Invalid environment variable format: %s", envVar))
-			continue
+	var postProcessors []configarr.PostProcessor
+	for _, spec := range flags.PostProcess {
+		processor, err := configarr.NewPostProcessor(spec)
+		if err != nil {
+			return false, invalidInput(err)
 		}
+		postProcessors = append(postProcessors, processor)
+	}
+	if flags.ManagedHeader { // Last, so the other post-processors don't move it
+		processor, err := configarr.NewPostProcessor("header:" + configarr.ManagedHeader)
+		if err != nil {
+			return false, err
+		}
+		postProcessors = append(postProcessors, processor)
+	}
 
-		// Extract the property key and its value from the environment variable
-		envKeyValue := strings.SplitN(parts[1], "=", 2)
-		if len(envKeyValue) != 2 {
-			logger.Warn(fmt.Sprintf("Invalid key-value pair in environment variable: %s", envVar))
-			continue
+	var notifiers []configarr.Notifier
+	for _, spec := range flags.Notify {
+		notifier, err := configarr.NewNotifier(spec)
+		if err != nil {
+			return false, invalidInput(err)
 		}
+		notifiers = append(notifiers, notifier)
+	}
 
-		envKey := envKeyValue[0]
-		envValue := envKeyValue[1]
+	documentOverrides, err := readDocuments(flags, stdin)
+	if err != nil {
+		return false, err
+	}
 
-		// Update the config if the environment variable is different
-		if currentValue, exists := config.Properties[envKey]; exists && envValue != currentValue {
-			config.Properties[envKey] = envValue
-			changedProperties[envKey] = envValue
-			logger.Debug(fmt.Sprintf("Updated '%s' to '%s'", envKey, envValue))
+	var rules []configarr.Rule
+	if flags.RulesFile != "" {
+		data, err := readDocument(flags.RulesFile, nil)
+		if err != nil {
+			return false, err
+		}
+		if rules, err = configarr.ParseRules(data); err != nil {
+			return false, parseFailure(fmt.Errorf("error parsing rules from %s: %w", flags.RulesFile, err))
+		}
+		for i := range rules {
+			rules[i].Source = fmt.Sprintf("rules:%s#%d", flags.RulesFile, i+1)
 		}
 	}
 
-	if len(changedProperties) == 0 {
-		logger.Debug("No updates made to the configuration.")
+	unmanagedKeys := flags.Unmanaged
+	if flags.UnmanagedFile != "" {
+		data, err := readDocument(flags.UnmanagedFile, nil)
+		if err != nil {
+			return false, err
+		}
+		patterns, err := parseKeyPatterns(data)
+		if err != nil {
+			return false, parseFailure(fmt.Errorf("error parsing unmanaged keys from %s: %w", flags.UnmanagedFile, err))
+		}
+		unmanagedKeys = append(slices.Clip(unmanagedKeys), patterns...)
 	}
 
-	return changedProperties
-}
+	opts := []configarr.Option{
+		configarr.WithRenderOptions(configarr.RenderOptions{Compact: flags.Compact, Indent: flags.Indent, Reformat: flags.Reformat, CDATA: flags.CDATA}),
+		configarr.WithFinalNewline(flags.FinalNewline),
+		configarr.WithPostProcessors(postProcessors...),
+		configarr.WithCreateKeys(flags.CreateKeys),
+		configarr.WithKeyGroups(flags.KeyGroups...),
+		configarr.WithRules(rules...),
+		configarr.WithVerify(flags.Verify),
+		configarr.WithBackups(flags.Backups),
+		configarr.WithConflictRetries(flags.ConflictRetries),
+		configarr.WithReadRetries(flags.ReadRetries, flags.ReadRetryDelay),
+		configarr.WithWriteRetryDelay(flags.WriteRetryDelay, flags.MaxWriteRetryDelay),
+		configarr.WithWatchDebounce(flags.WatchDebounce),
+		configarr.WithSettleDelay(flags.SettleDelay, flags.SettleTimeout),
+		configarr.WithRequireAppStopped(flags.RequireAppStopped...),
+		configarr.WithCatalog(catalog),
+		configarr.WithEvents(events),
+		configarr.WithNotifiers(notifiers...),
+		configarr.WithKeyFilter(flags.OnlyKeys, flags.SkipKeys),
+		configarr.WithUnmanagedKeys(unmanagedKeys...),
+		configarr.WithStateFile(flags.StateFile),
+		configarr.WithLimits(flags.MaxValueSize, flags.MaxFileSize),
+		configarr.WithValidationMode(flags.ValidationMode),
+		configarr.WithClock(clock),
+		configarr.WithLogger(logger),
+	}
+	if flags.IgnoreMissingConfig {
+		opts = append(opts, configarr.WithIgnoreMissingConfig())
+	}
+	if flags.SkipUnwritable {
+		opts = append(opts, configarr.WithSkipUnwritable())
+	}
+	if flags.RecoverEmpty {
+		opts = append(opts, configarr.WithRecoverEmpty(flags.RecoverTemplate))
+	}
+	fsys := configarr.OSFSWith(configarr.WriteOptions{Mode: flags.FileMode, Owner: flags.Owner})
+	if flags.Faults != (configarr.Faults{}) {
+		logger.Warn(fmt.Sprintf("Injecting faults into file operations: %+v", flags.Faults))
+		fsys = configarr.FaultFS(fsys, flags.Faults)
+	}
+	codec, err := newCodec(flags)
+	if err != nil {
+		return false, err
+	}
+	if codec != nil {
+		fsys = configarr.CodecFS(fsys, codec)
+	}
+	opts = append(opts, configarr.WithFS(fsys))
+	if flags.Fidelity {
+		opts = append(opts, configarr.WithFidelity())
+	}
+	if flags.Patch {
+		opts = append(opts, configarr.WithPatch())
+	}
+	if flags.StrictSecrets {
+		opts = append(opts, configarr.WithStrictSecrets())
+	}
+	if flags.DryRun {
+		opts = append(opts, configarr.WithDryRun())
+	}
+	if flags.Format != "" {
+		format, _ := configarr.LookupFormat(flags.Format, "") // Validated by parseFlags
+		opts = append(opts, configarr.WithFormat(format))
+	}
+	for name, command := range flags.Decrypters {
+		argv, err := splitCommand(command)
+		if err == nil && len(argv) == 0 {
+			err = errors.New("empty command")
+		}
+		if err != nil {
+			return false, invalidInput(fmt.Errorf("invalid --decrypter %s: %w", name, err))
+		}
+		opts = append(opts, configarr.WithDecrypter(name, commandDecrypter(argv)))
+	}
 
-// writeConfigToFile writes the updated Config map back to the XML file.
-func writeConfigToFile(config *Config, xmlFile string) error {
-	output, err := xml.MarshalIndent(config, "", "  ")
+	ctx := context.Background()
+	if flags.DesiredState != "" {
+		changed, err := runDesiredState(ctx, flags, stdin, output, opts, logger)
+		if err != nil || flags.DryRun {
+			return changed, err
+		}
+		if flags.Serve != "" {
+			return false, serve(flags, opts, logger)
+		}
+		return changed, execChild(flags, environ)
+	}
+
+	if len(flags.ConfigFiles) > 1 || len(flags.PrefixTargets) > 0 {
+		changed, err := applyConfigFiles(ctx, environ, flags, output, documentOverrides, catalog, opts, logger)
+		if err != nil || flags.DryRun {
+			return changed, err
+		}
+		return changed, execChild(flags, environ)
+	}
+
+	sources, err := configSources(environ, flags, documentOverrides, catalog, opts)
 	if err != nil {
-		return fmt.Errorf("error marshalling XML: %w", err)
+		return false, err
+	}
+	opts = append(opts, configarr.WithConfigPath(flags.ConfigFilePath))
+	if flags.Record != "" {
+		recorded, err := recordRun(ctx, flags, sources, opts, logger)
+		if err != nil {
+			return false, err
+		}
+		sources = []configarr.Source{recorded}
+	}
+	opts = append(opts, configarr.WithSources(sources...))
+	if flags.Watch {
+		return false, watch(flags, opts, links, secretTargets, logger)
 	}
 
-	if err := os.WriteFile(xmlFile, output, 0644); err != nil {
-		return fmt.Errorf("error writing file %s: %w", xmlFile, err)
+	result, err := configarr.Run(ctx, opts...)
+	if errors.Is(err, configarr.ErrEmptyConfig) && !flags.RecoverEmpty {
+		return false, fmt.Errorf("%w; use --recover-empty to seed it from a backup, a template or the catalog defaults", err)
+	}
+	if err != nil {
+		return false, err
+	}
+	if flags.DryRun {
+		if !flags.validateOnly {
+			printDiff(output, result)
+		}
+		drift, err := reportGolden(output, flags, []configarr.Result{result})
+		return len(result.Changed) > 0 || drift, err // Nothing was written to link, publish or run
 	}
 
-	return nil
+	if len(links) > 0 {
+		if err := updateLinks(flags, opts, links, logger); err != nil {
+			return false, err
+		}
+	}
+	if len(secretTargets) > 0 {
+		if err := publishSecrets(ctx, flags, opts, secretTargets, logger); err != nil {
+			return false, err
+		}
+	}
+	return len(result.Changed) > 0, execChild(flags, environ)
 }
 
-// parseFlags parses the provided command-line flags and returns a Flags struct.
-func parseFlags(flags []string) (Flags, error) {
-	flagSet := pflag.NewFlagSet("configFlags", pflag.ContinueOnError) // Create a new flag set to avoid affecting the global command line flags
-
-	configFilePath := flagSet.String("config", DefaultConfigPath, "Path to the XML configuration file")
-	prefix := flagSet.String("prefix", DefaultPrefix, "Prefix for environment variables")
-	debug := flagSet.Bool("debug", false, "Enable debug logging")
-	ignoreMissingConfig := flagSet.Bool("ignore-missing-config", false, "Ignore missing configuration file")
+// configSources returns the sources of the overrides for the configuration file of the
+// flags: the presets for its app, the environment and the documents, or the overrides
+// replacing them, e.g. of a replayed run. The app is detected from the file read with the
+// options of the run, see configarr.ReadConfig.
+func configSources(environ []string, flags Flags, documentOverrides []configarr.Override, catalog *configarr.Catalog, opts []configarr.Option) ([]configarr.Source, error) {
+	if flags.overrides != nil {
+		return []configarr.Source{configarr.StaticSource(flags.overrides...)}, nil
+	}
 
-	if err := flagSet.Parse(flags); err != nil {
-		return Flags{}, fmt.Errorf("error parsing flags: %w", err)
+	app := flags.App
+	if app == "" && len(flags.Presets) > 0 {
+		config, err := configarr.ReadConfig(append(append([]configarr.Option{}, opts...), configarr.WithConfigPath(flags.ConfigFilePath))...)
+		if err != nil {
+			config = &configarr.Config{} // Detected by path only
+		}
+		app = configarr.DetectApp(flags.ConfigFilePath, config, catalog)
+	}
+	presetOverrides, err := expandPresets(flags.Presets, app)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+	setOverrides, err := parseKeyValues(flags.Set, flags.Delimiter, "flag:set")
+	if err != nil {
+		return nil, invalidInput(err)
 	}
 
-	return Flags{
-		ConfigFilePath:      *configFilePath,
-		IgnoreMissingConfig: *ignoreMissingConfig,
-		Prefix:              *prefix,
-		Debug:               *debug,
+	return []configarr.Source{
+		configarr.StaticSource(presetOverrides...), // Presets are defaults for the other sources
+		configarr.EnvSourceWith(environ, flags.Prefix, configarr.EnvOptions{Delimiter: flags.Delimiter, IgnoreCase: flags.PrefixIgnoreCase, AllowKeys: flags.AllowKeys}),
+		configarr.StaticSource(documentOverrides...), // Documents take precedence over env vars
+		configarr.StaticSource(setOverrides...),      // --set takes precedence over everything
 	}, nil
 }
 
-// run performs the main logic of the application, handling XML configuration updates.
-func run(environ []string, args []string, output io.Writer) error {
-	flags, err := parseFlags(args[1:]) // exclude the program name
-	if err != nil {
-		return err
+// applyConfigFiles applies the overrides to each of several configuration files, e.g.
+// of Sonarr, Radarr and Prowlarr in a shared init container. With prefix targets, each
+// file only gets the environment variables of its prefix. Each run logs its own summary;
+// the errors of all files are joined, each prefixed with its file, so a broken or hung
+// file doesn't keep the others from being updated, see runTarget. Files that would
+// listen on the same port are refused before anything is written, see
+// checkPortConflicts. With --atomic, the files are applied all or nothing instead, see
+// applyAtomically.
+func applyConfigFiles(ctx context.Context, environ []string, flags Flags, output io.Writer, documentOverrides []configarr.Override, catalog *configarr.Catalog, opts []configarr.Option, logger *slog.Logger) (bool, error) {
+	targets := flags.PrefixTargets
+	if len(targets) == 0 {
+		for _, path := range flags.ConfigFiles {
+			targets = append(targets, PrefixTarget{Prefix: flags.Prefix, Path: path})
+		}
 	}
 
-	level := slog.LevelInfo
-	if flags.Debug {
-		level = slog.LevelDebug
+	var portTargets []portTarget
+	for _, target := range targets {
+		fileFlags := flags
+		fileFlags.ConfigFilePath, fileFlags.Prefix = target.Path, target.Prefix
+		if sources, err := configSources(environ, fileFlags, documentOverrides, catalog, opts); err == nil {
+			portTargets = append(portTargets, portTarget{name: target.Path, path: target.Path, sources: sources})
+		}
+	}
+	// Files that can't be planned fail their own run below
+	conflicts, _ := checkPortConflicts(ctx, portTargets, opts)
+	if err := reportPortConflicts(flags, conflicts, logger); err != nil {
+		return false, err
+	}
+
+	if flags.Atomic && !flags.DryRun {
+		return applyAtomically(ctx, environ, flags, targets, documentOverrides, catalog, opts, logger)
+	}
+
+	changed := false
+	var errs []error
+	var results []configarr.Result // Of dry runs, compared with --golden at the end
+	progress := newProgressReporter(flags.Progress, len(targets))
+	for _, target := range targets {
+		path := target.Path
+		progress.Next(path)
+		fileFlags := flags
+		fileFlags.ConfigFilePath, fileFlags.Prefix = path, target.Prefix
+		sources, err := configSources(environ, fileFlags, documentOverrides, catalog, opts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		fileOpts := append(append([]configarr.Option{}, opts...), configarr.WithConfigPath(path), configarr.WithSources(sources...))
+		result, err := runTarget(ctx, flags.TargetTimeout, fileOpts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		if flags.DryRun {
+			if !flags.validateOnly {
+				printDiff(output, result)
+			}
+			results = append(results, result)
+		}
+		changed = changed || len(result.Changed) > 0
+	}
+	progress.Done()
+	drift, err := reportGolden(output, flags, results)
+	return changed || drift, errors.Join(append(errs, err)...)
+}
+
+// expandPresets returns the overrides of the presets for the app, in order.
+func expandPresets(names []string, app string) ([]configarr.Override, error) {
+	var overrides []configarr.Override
+	for _, name := range names {
+		presetOverrides, err := configarr.ExpandPreset(name, app)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, presetOverrides...)
 	}
-	logger := slog.New(slog.NewTextHandler(output, &slog.HandlerOptions{Level: level}))
+	return overrides, nil
+}
 
-	// Attempt to read and parse the XML configuration file
-	config, err := readAndParseXML(flags.ConfigFilePath)
+// printDiff prints the changes of a dry run as a unified diff with secret values masked,
+// colored when the output supports it, see colorEnabled.
+func printDiff(output io.Writer, result configarr.Result) {
+	diff := configarr.MaskSecretElements(configarr.UnifiedDiff(result.ConfigPath, result.Original, result.Rendered))
+	if colorEnabled(output, os.Getenv) {
+		diff = colorizeDiff(diff)
+	}
+	fmt.Fprint(output, diff)
+}
+
+// updateLinks copies the linked properties of the configuration file into their files,
+// reading it like the run did, see configarr.ReadConfig.
+func updateLinks(flags Flags, opts []configarr.Option, links []configarr.Link, logger *slog.Logger) error {
+	config, err := configarr.ReadConfig(opts...)
 	if err != nil {
-		if strings.Contains(err.Error(), "file does not exist") && flags.IgnoreMissingConfig {
-			logger.Debug("No configuration file found. Skipping update.")
+		if errors.Is(err, fs.ErrNotExist) && flags.IgnoreMissingConfig {
+			logger.Debug("No configuration file found. Skipping links.")
 			return nil
 		}
-		return fmt.Errorf("error reading XML file: %w", err)
+		return fmt.Errorf("error reading configuration file: %w", err)
 	}
 
-	updateConfigWithEnv(environ, config, flags.Prefix, logger)
+	updated, err := configarr.UpdateLinks(configarr.OSFS(), config, links)
+	for _, file := range updated {
+		logger.Info(fmt.Sprintf("Updated linked file %s", file))
+	}
+	return err
+}
 
-	if err := writeConfigToFile(config, flags.ConfigFilePath); err != nil {
-		return fmt.Errorf("error writing updated configuration to XML file: %w", err)
+// publishSecrets writes the targeted properties of the configuration file into
+// Kubernetes Secrets using the pod's service account, reading the file like the run did,
+// see configarr.ReadConfig.
+func publishSecrets(ctx context.Context, flags Flags, opts []configarr.Option, targets []configarr.SecretTarget, logger *slog.Logger) error {
+	config, err := configarr.ReadConfig(opts...)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && flags.IgnoreMissingConfig {
+			logger.Debug("No configuration file found. Skipping secret publishing.")
+			return nil
+		}
+		return fmt.Errorf("error reading configuration file: %w", err)
 	}
 
+	client, err := configarr.NewInClusterKubeClient()
+	if err != nil {
+		return err
+	}
+	if err := configarr.PublishSecrets(ctx, client, config, targets); err != nil {
+		return err
+	}
+	logger.Debug(fmt.Sprintf("Published %d properties to Kubernetes Secrets.", len(targets)))
 	return nil
 }
 
 func main() {
-	if err := run(os.Environ(), os.Args, os.Stdout); err != nil {
+	code, err := run(os.Environ(), os.Args, os.Stdin, os.Stdout)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
-		os.Exit(1)
 	}
+	os.Exit(code)
+}
+
+// watch re-applies the overrides whenever the configuration file changes until configarr
+// receives SIGINT or SIGTERM. Linked files and Secrets are updated after every successful
+// run; failed runs are logged and retried as described for configarr.Watch. The metrics
+// file, if any, is rewritten after every run.
+func watch(flags Flags, opts []configarr.Option, links []configarr.Link, secretTargets []configarr.SecretTarget, logger *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info(fmt.Sprintf("Watching %s for changes every %s.", flags.ConfigFilePath, flags.WatchInterval))
+	return configarr.Watch(ctx, flags.WatchInterval, func(result configarr.Result, err error) {
+		if err == nil && len(links) > 0 {
+			err = updateLinks(flags, opts, links, logger)
+		}
+		if err == nil && len(secretTargets) > 0 {
+			err = publishSecrets(ctx, flags, opts, secretTargets, logger)
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error applying overrides: %s", err))
+		}
+		if flags.MetricsFile != "" {
+			if err := writeMetrics(flags.MetricsFile, result); err != nil {
+				logger.Warn(fmt.Sprintf("Error writing metrics: %s", err))
+			}
+		}
+	}, opts...)
 }
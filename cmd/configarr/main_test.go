@@ -2,224 +2,401 @@ package main
 
 import (
 	"bytes"
-	"encoding/xml"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
+
+	"configarr"
 )
 
-// TestConfig_UnmarshalXML tests the XML unmarshalling into Config struct.
-func TestConfig_UnmarshalXML(t *testing.T) {
-	t.Run("Valid XML", func(t *testing.T) {
-		xmlData := `<Config><LogLevel>info</LogLevel><Theme>dark</Theme></Config>`
-		var config Config
-		err := xml.Unmarshal([]byte(xmlData), &config)
-		if err != nil {
-			t.Fatalf("Unexpected error: %v", err)
+// TestMain points the XDG base directories to a temporary directory, so tests never
+// read or write the state and catalog files of the user running them.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "configarr-xdg")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// TestParseFlags tests the parsing of command-line flags.
+func TestParseFlags(t *testing.T) {
+	t.Run("Parse valid flags", func(t *testing.T) {
+		args := []string{"--config", "/path/to/config.xml", "--prefix", "PREFIX__", "--debug", "--ignore-missing-config", "--conflict-retries", "2"}
+		expectedFlags := Flags{
+			ConfigFilePath:      "/path/to/config.xml",
+			Prefix:              "PREFIX__",
+			Delimiter:           configarr.DefaultDelimiter,
+			Debug:               true,
+			IgnoreMissingConfig: true,
+			ConflictRetries:     2,
+			ReadRetries:         configarr.DefaultReadRetries,
+			ReadRetryDelay:      configarr.DefaultReadRetryDelay,
+			SettleTimeout:       configarr.DefaultSettleTimeout,
+			WatchInterval:       configarr.DefaultWatchInterval,
+			WriteRetryDelay:     configarr.DefaultWriteRetryDelay,
+			MaxWriteRetryDelay:  configarr.DefaultMaxWriteRetryDelay,
+			Verify:              true,
+			Indent:              configarr.DefaultIndent,
+			FinalNewline:        configarr.FinalNewlinePreserve,
+			SecretsPattern:      secretKeyPlaceholder,
+			SecretsCase:         secretsCaseExact,
+			MaxValueSize:        configarr.DefaultMaxValueSize,
+			MaxFileSize:         configarr.DefaultMaxFileSize,
+			ValidationMode:      configarr.ValidationModeError,
+			StateFile:           configarr.DefaultStateFile(runningInContainer(), os.Getenv),
 		}
 
-		if config.Properties["LogLevel"] != "info" || config.Properties["Theme"] != "dark" {
-			t.Fatalf("Expected properties not set correctly: %v", config.Properties)
+		flags, err := parseFlags(args)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing flags: %v", err)
 		}
 
-		if len(config.Keys) != 2 || config.Keys[0] != "LogLevel" || config.Keys[1] != "Theme" {
-			t.Fatalf("Expected key order ['LogLevel', 'Theme'], got %v", config.Keys)
+		if !reflect.DeepEqual(flags, expectedFlags) {
+			t.Fatalf("Expected flags %+v, got %+v", expectedFlags, flags)
 		}
 	})
 
-	t.Run("Invalid XML", func(t *testing.T) {
-		xmlData := `<Config><LogLevel>info<LogLevel></Config>` // malformed XML
-		var config Config
-		err := xml.Unmarshal([]byte(xmlData), &config)
+	t.Run("Error on invalid flags", func(t *testing.T) {
+		args := []string{"--invalid"}
+		_, err := parseFlags(args)
 		if err == nil {
-			t.Fatal("Expected error due to malformed XML, but got none")
+			t.Fatal("Expected error on invalid flags, but got none")
 		}
 	})
-}
 
-// TestConfig_MarshalXML tests the XML marshalling from Config struct.
-func TestConfig_MarshalXML(t *testing.T) {
-	t.Run("Marshal to XML", func(t *testing.T) {
-		config := Config{
-			Properties: map[string]string{
-				"LogLevel": "info",
-				"Theme":    "dark",
-			},
-			Keys: []string{"LogLevel", "Theme"},
+	t.Run("Parse app default config path", func(t *testing.T) {
+		flags, err := parseFlags([]string{"--app", "lidarr"})
+		if err != nil {
+			t.Fatalf("Unexpected error parsing flags: %v", err)
+		}
+		expected := configarr.DefaultConfigPathFor("lidarr", runtime.GOOS, os.Getenv)
+		if flags.App != "lidarr" || flags.ConfigFilePath != expected {
+			t.Fatalf("Expected app lidarr with config %s, got %s with %s", expected, flags.App, flags.ConfigFilePath)
 		}
 
-		expectedXML := `<Config><LogLevel>info</LogLevel><Theme>dark</Theme></Config>`
-		output, err := xml.Marshal(&config)
+		flags, err = parseFlags([]string{"--app", "lidarr", "--config", "/data//lidarr/config.xml"})
 		if err != nil {
-			t.Fatalf("Unexpected error during marshalling: %v", err)
+			t.Fatalf("Unexpected error parsing flags: %v", err)
 		}
-
-		output = bytes.TrimSpace(output) // Trim space to match expected exactly
-		if string(output) != expectedXML {
-			t.Fatalf("Expected XML %s, got %s", expectedXML, output)
+		if flags.ConfigFilePath != filepath.Clean("/data/lidarr/config.xml") {
+			t.Fatalf("Expected explicit --config to win, got %s", flags.ConfigFilePath)
 		}
 	})
-}
 
-// TestReadAndParseXML tests the reading and parsing of XML from a file.
-func TestReadAndParseXML(t *testing.T) {
-	t.Run("File Exists and Valid XML", func(t *testing.T) {
-		content := `<Config><LogLevel>info</LogLevel><Theme>dark</Theme></Config>`
-		file, err := os.CreateTemp("", "test*.xml")
+	t.Run("Force disables size limits", func(t *testing.T) {
+		flags, err := parseFlags([]string{"--max-value-size", "1024", "--force"})
 		if err != nil {
-			t.Fatalf("Unexpected error creating temp file: %v", err)
+			t.Fatalf("Unexpected error parsing flags: %v", err)
 		}
-		defer os.Remove(file.Name())
+		if flags.MaxValueSize != 0 || flags.MaxFileSize != 0 {
+			t.Fatalf("Expected no limits with --force, got %d and %d", flags.MaxValueSize, flags.MaxFileSize)
+		}
+	})
 
-		if _, err := file.Write([]byte(content)); err != nil {
-			t.Fatalf("Unexpected error writing to temp file: %v", err)
+	t.Run("Parse pretty output", func(t *testing.T) {
+		flags, err := parseFlags([]string{"--pretty"})
+		if err != nil {
+			t.Fatalf("Unexpected error parsing flags: %v", err)
+		}
+		if flags.Compact || flags.Indent != configarr.DefaultIndent {
+			t.Fatalf("Expected indented output with --pretty, got compact %t and indent %q", flags.Compact, flags.Indent)
 		}
-		file.Close()
 
-		config, err := readAndParseXML(file.Name())
+		flags, err = parseFlags([]string{"--pretty=false"})
 		if err != nil {
-			t.Fatalf("Unexpected error reading XML: %v", err)
+			t.Fatalf("Unexpected error parsing flags: %v", err)
+		}
+		if !flags.Compact {
+			t.Fatal("Expected compact output with --pretty=false")
+		}
+
+		if _, err := parseFlags([]string{"--pretty", "--compact"}); err == nil {
+			t.Fatal("Expected error on --pretty with --compact, but got none")
 		}
+	})
 
-		if config.Properties["LogLevel"] != "info" || config.Properties["Theme"] != "dark" {
-			t.Fatalf("Expected properties not set correctly: %v", config.Properties)
+	t.Run("Parse backup count", func(t *testing.T) {
+		for args, expected := range map[string]int{"--backup": configarr.DefaultBackups, "--backup=2": 2} {
+			flags, err := parseFlags([]string{args})
+			if err != nil {
+				t.Fatalf("Unexpected error parsing flags: %v", err)
+			}
+			if flags.Backups != expected {
+				t.Fatalf("Expected %d backups for %s, got %d", expected, args, flags.Backups)
+			}
 		}
 
-		if len(config.Keys) != 2 || config.Keys[0] != "LogLevel" || config.Keys[1] != "Theme" {
-			t.Fatalf("Expected key order ['LogLevel', 'Theme'], got %v", config.Keys)
+		if _, err := parseFlags([]string{"--backup=-1"}); err == nil {
+			t.Fatal("Expected error on a negative count, but got none")
 		}
 	})
 
-	t.Run("File Does Not Exist", func(t *testing.T) {
-		_, err := readAndParseXML("nonexistent.xml")
-		if err == nil {
-			t.Fatal("Expected error for nonexistent file, got none")
+	t.Run("Recover template requires recovery", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--recover-template", "template.xml"}); err == nil || !strings.Contains(err.Error(), "--recover-empty") {
+			t.Fatalf("Expected error on --recover-template without --recover-empty, got: %v", err)
 		}
 	})
-}
 
-// TestUpdateConfigWithEnv tests updating configuration with environment variables.
-func TestUpdateConfigWithEnv(t *testing.T) {
-	t.Run("Update with Environment Variables", func(t *testing.T) {
-		envVars := []string{
-			"CONFIGARR__LOG=LogLevel=debug",
-			"CONFIGARR__THEME=Theme=light",
+	t.Run("Serve requires desired state", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--serve", ":8080"}); err == nil || !strings.Contains(err.Error(), "--desired-state") {
+			t.Fatalf("Expected error on --serve without --desired-state, got: %v", err)
+		}
+		flags, err := parseFlags([]string{"--serve", ":8080", "--desired-state", "stack.yaml", "--target", "sonarr=/sonarr/config.xml", "--serve-token", "sonarr=/run/secrets/sonarr"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if flags.ServeTokens["sonarr"] != "/run/secrets/sonarr" {
+			t.Fatalf("Expected the token file of sonarr, got %v", flags.ServeTokens)
 		}
+	})
 
-		config := &Config{
-			Properties: map[string]string{
-				"LogLevel": "info",
-				"Theme":    "dark",
-			},
-			Keys: []string{"LogLevel", "Theme"},
+	t.Run("Post-processors refused with patch mode", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--post-process", "header", "--patch"}); err == nil {
+			t.Fatal("Expected error on --post-process with --patch, but got none")
 		}
+	})
 
-		var stdOut strings.Builder
-		logger := slog.New(slog.NewTextHandler(&stdOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	t.Run("Parse file mode and owner", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("--owner is not supported on Windows")
+		}
+		flags, err := parseFlags([]string{"--file-mode", "0640", "--owner", "1000:1001"})
+		if err != nil {
+			t.Fatalf("Unexpected error parsing flags: %v", err)
+		}
+		if flags.FileMode != 0640 || flags.Owner == nil || *flags.Owner != (configarr.FileOwner{UID: 1000, GID: 1001}) {
+			t.Fatalf("Expected mode 0640 and owner 1000:1001, got %v and %+v", flags.FileMode, flags.Owner)
+		}
 
-		changed := updateConfigWithEnv(envVars, config, "CONFIGARR__", logger)
-		if len(changed) != 2 || changed["LogLevel"] != "debug" || changed["Theme"] != "light" {
-			t.Fatalf("Expected changes not applied correctly: %v", changed)
+		for _, args := range [][]string{{"--file-mode", "0800"}, {"--file-mode", "rw"}, {"--owner", "1000"}, {"--owner", "abc:1000"}, {"--owner", "-1:0"}} {
+			if _, err := parseFlags(args); err == nil {
+				t.Fatalf("Expected error for %v, but got none", args)
+			}
 		}
+	})
 
-		if !strings.Contains(stdOut.String(), "Updated 'LogLevel' to 'debug'") {
-			t.Fatalf("Expected log entry for LogLevel change, got: %s", stdOut.String())
+	t.Run("Parse key groups", func(t *testing.T) {
+		flags, err := parseFlags([]string{"--key-group", "SslPort,EnableSsl,SslCertPath", "--key-group", "Port,UrlBase"})
+		if err != nil {
+			t.Fatalf("Unexpected error parsing flags: %v", err)
+		}
+		expected := [][]string{{"SslPort", "EnableSsl", "SslCertPath"}, {"Port", "UrlBase"}}
+		if !reflect.DeepEqual(flags.KeyGroups, expected) {
+			t.Fatalf("Expected key groups %v, got %v", expected, flags.KeyGroups)
+		}
+
+		if _, err := parseFlags([]string{"--key-group", "SslPort"}); err == nil {
+			t.Fatal("Expected error on a group with a single key, but got none")
 		}
 	})
 
-	t.Run("No Changes When Env Vars Unmatched", func(t *testing.T) {
-		envVars := []string{
-			"OTHER_LOG=LogLevel=debug",
+	t.Run("Parse child command", func(t *testing.T) {
+		flags, err := parseFlags([]string{"--strip-env", "--child-env", "TZ=UTC", "--", "/app/sonarr", "-nobrowser"})
+		if err != nil {
+			t.Fatalf("Unexpected error parsing flags: %v", err)
+		}
+		if expected := []string{"/app/sonarr", "-nobrowser"}; !reflect.DeepEqual(flags.Command, expected) {
+			t.Fatalf("Expected command %v, got %v", expected, flags.Command)
+		}
+		if !flags.StripEnv || !reflect.DeepEqual(flags.ChildEnv, []string{"TZ=UTC"}) {
+			t.Fatalf("Expected child environment flags, got %+v", flags)
 		}
 
-		config := &Config{
-			Properties: map[string]string{
-				"LogLevel": "info",
-			},
-			Keys: []string{"LogLevel"},
+		if _, err := parseFlags([]string{"--child-env", "TZ", "--", "/app/sonarr"}); err == nil {
+			t.Fatal("Expected error on --child-env without value, but got none")
 		}
+		if _, err := parseFlags([]string{"--strip-env"}); err == nil {
+			t.Fatal("Expected error on --strip-env without command, but got none")
+		}
+	})
 
-		var stdOut strings.Builder
-		logger := slog.New(slog.NewTextHandler(&stdOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	t.Run("Error on incomplete encryption commands", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--decrypt-command", "age -d -i key.txt"}); err == nil {
+			t.Fatal("Expected error on --decrypt-command without --encrypt-command, but got none")
+		}
+	})
 
-		changed := updateConfigWithEnv(envVars, config, "CONFIGARR__", logger)
-		if len(changed) != 0 {
-			t.Fatalf("Expected no changes, but got: %v", changed)
+	t.Run("Error on unknown preset", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--preset", "fast"}); err == nil {
+			t.Fatal("Expected error on unknown preset, but got none")
 		}
+	})
 
-		if !strings.Contains(stdOut.String(), "No updates made to the configuration.") {
-			t.Fatalf("Expected log entry for no updates, got: %s", stdOut.String())
+	t.Run("Error on invalid validation mode", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--validation-mode", "strict"}); err == nil {
+			t.Fatal("Expected error on invalid validation mode, but got none")
+		}
+	})
+
+	t.Run("Error on negative watch debounce", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--watch", "--watch-debounce", "-1s"}); err == nil {
+			t.Fatal("Expected error on negative --watch-debounce, but got none")
 		}
 	})
-}
 
-// TestWriteConfigToFile tests writing the configuration back to the XML file.
-func TestWriteConfigToFile(t *testing.T) {
-	t.Run("Write to XML File", func(t *testing.T) {
-		config := &Config{
-			Properties: map[string]string{
-				"Theme":    "dark",
-				"LogLevel": "info",
-			},
-			Keys: []string{"Theme", "LogLevel"},
+	t.Run("Error on watch with a command", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--watch", "--", "/app/sonarr"}); err == nil {
+			t.Fatal("Expected error on --watch with a command, but got none")
 		}
+	})
 
-		file, err := os.CreateTemp("", "test*.xml")
+	t.Run("Error on empty prefix without allowed names", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--prefix", ""}); err == nil {
+			t.Fatal("Expected error on empty prefix without --allow-key, but got none")
+		}
+		flags, err := parseFlags([]string{"--prefix", "", "--allow-key", "SONARR_*"})
 		if err != nil {
-			t.Fatalf("Unexpected error creating temp file: %v", err)
+			t.Fatalf("Unexpected error: %v", err)
 		}
-		defer os.Remove(file.Name())
+		if !reflect.DeepEqual(flags.AllowKeys, []string{"SONARR_*"}) {
+			t.Fatalf("Expected allowed names [SONARR_*], got %v", flags.AllowKeys)
+		}
+	})
 
-		if err := writeConfigToFile(config, file.Name()); err != nil {
-			t.Fatalf("Unexpected error writing to XML file: %v", err)
+	t.Run("Hidden fault injection flags", func(t *testing.T) {
+		flags, err := parseFlags([]string{"--chaos-write-failures", "1", "--chaos-conflicts", "2"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := (configarr.Faults{WriteFailures: 1, Conflicts: 2}); flags.Faults != expected {
+			t.Fatalf("Expected faults %+v, got %+v", expected, flags.Faults)
+		}
+		if _, err := parseFlags([]string{"--chaos-partial-reads", "-1"}); err == nil {
+			t.Fatal("Expected error on negative fault count, but got none")
 		}
+	})
 
-		content, err := os.ReadFile(file.Name())
+	t.Run("Parse several configuration files", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, app := range []string{"radarr", "sonarr"} {
+			if err := os.Mkdir(filepath.Join(dir, app), 0755); err != nil {
+				t.Fatalf("Unexpected error creating directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, app, "config.xml"), []byte("<Config></Config>"), 0644); err != nil {
+				t.Fatalf("Unexpected error writing file: %v", err)
+			}
+		}
+
+		prowlarr := filepath.Join(dir, "prowlarr", "config.xml")
+		flags, err := parseFlags([]string{"--config", filepath.Join(dir, "*", "config.xml"), "--config", prowlarr, "--config", filepath.Join(dir, "sonarr", "config.xml")})
 		if err != nil {
-			t.Fatalf("Unexpected error reading written file: %v", err)
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []string{filepath.Join(dir, "radarr", "config.xml"), filepath.Join(dir, "sonarr", "config.xml"), prowlarr}
+		if !reflect.DeepEqual(flags.ConfigFiles, expected) || flags.ConfigFilePath != expected[0] {
+			t.Fatalf("Expected configuration files %v, got %v (%s)", expected, flags.ConfigFiles, flags.ConfigFilePath)
 		}
 
-		expectedXML := `<Config>
-  <Theme>dark</Theme>
-  <LogLevel>info</LogLevel>
-</Config>`
-		if string(content) != expectedXML {
-			t.Fatalf("Expected XML %s, got %s", expectedXML, string(content))
+		if _, err := parseFlags([]string{"--config", filepath.Join(dir, "*", "settings.json")}); err == nil {
+			t.Fatal("Expected error on a pattern matching no file, but got none")
+		}
+		if _, err := parseFlags([]string{"--config", filepath.Join(dir, "*", "config.xml"), "--watch"}); err == nil {
+			t.Fatal("Expected error on several files with --watch, but got none")
 		}
 	})
-}
 
-// TestParseFlags tests the parsing of command-line flags.
-func TestParseFlags(t *testing.T) {
-	t.Run("Parse valid flags", func(t *testing.T) {
-		args := []string{"--config", "/path/to/config.xml", "--prefix", "PREFIX__", "--debug", "--ignore-missing-config"}
-		expectedFlags := Flags{
-			ConfigFilePath:      "/path/to/config.xml",
-			Prefix:              "PREFIX__",
-			Debug:               true,
-			IgnoreMissingConfig: true,
+	t.Run("Error on unknown format", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--format", "toml"}); err == nil {
+			t.Fatal("Expected error on unknown format, but got none")
 		}
+	})
 
-		flags, err := parseFlags(args)
+	t.Run("Error on empty delimiter", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--kv-delimiter", ""}); err == nil {
+			t.Fatal("Expected error on empty delimiter, but got none")
+		}
+	})
+
+	t.Run("Error on invalid key order", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--create-keys", "sorted"}); err == nil {
+			t.Fatal("Expected error on invalid key order, but got none")
+		}
+	})
+
+	t.Run("Error on invalid final newline mode", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--final-newline", "sometimes"}); err == nil {
+			t.Fatal("Expected error on invalid final newline mode, but got none")
+		}
+	})
+
+	t.Run("Parse key filters", func(t *testing.T) {
+		flags, err := parseFlags([]string{"--only-keys", "ApiKey,Url*", "--skip-keys", "UrlBase"})
 		if err != nil {
 			t.Fatalf("Unexpected error parsing flags: %v", err)
 		}
+		if !reflect.DeepEqual(flags.OnlyKeys, []string{"ApiKey", "Url*"}) || !reflect.DeepEqual(flags.SkipKeys, []string{"UrlBase"}) {
+			t.Fatalf("Unexpected key filters: only %v, skip %v", flags.OnlyKeys, flags.SkipKeys)
+		}
+	})
 
-		if flags != expectedFlags {
-			t.Fatalf("Expected flags %+v, got %+v", expectedFlags, flags)
+	t.Run("Parse prefix targets", func(t *testing.T) {
+		flags, err := parseFlags([]string{"--target", "SONARR__=/sonarr/config.xml", "--target", "RADARR__=/radarr/config.xml"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []PrefixTarget{{Prefix: "SONARR__", Path: filepath.Clean("/sonarr/config.xml")}, {Prefix: "RADARR__", Path: filepath.Clean("/radarr/config.xml")}}
+		if !reflect.DeepEqual(flags.PrefixTargets, expected) || flags.Targets != nil {
+			t.Fatalf("Expected prefix targets %+v, got %+v and app targets %v", expected, flags.PrefixTargets, flags.Targets)
+		}
+
+		for _, args := range [][]string{
+			{"--target", "SONARR_=/sonarr/config.xml", "--target", "SONARR_4K_=/sonarr-4k/config.xml"},
+			{"--target", "SONARR__=/sonarr/config.xml", "--target", "radarr=/radarr/config.xml"},
+			{"--target", "SONARR__=/sonarr/config.xml", "--config", "/radarr/config.xml"},
+		} {
+			if _, err := parseFlags(args); err == nil {
+				t.Fatalf("Expected error for %v, but got none", args)
+			}
 		}
 	})
 
-	t.Run("Error on invalid flags", func(t *testing.T) {
-		args := []string{"--invalid"}
-		_, err := parseFlags(args)
-		if err == nil {
-			t.Fatal("Expected error on invalid flags, but got none")
+	t.Run("Error on invalid target", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--target", "sonarr"}); err == nil {
+			t.Fatal("Expected error on invalid target, but got none")
+		}
+	})
+
+	t.Run("Error on invalid key pattern", func(t *testing.T) {
+		if _, err := parseFlags([]string{"--only-keys", "Api["}); err == nil {
+			t.Fatal("Expected error on invalid key pattern, but got none")
 		}
 	})
 }
 
+// TestPublishSecrets tests that a missing configuration file is skipped with
+// --ignore-missing-config, also behind a codec filesystem.
+func TestPublishSecrets(t *testing.T) {
+	codec, err := configarr.NewAESGCMCodec([]byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	opts := []configarr.Option{configarr.WithFS(configarr.CodecFS(configarr.OSFS(), codec)), configarr.WithConfigPath(filepath.Join(t.TempDir(), "config.xml"))}
+	targets := []configarr.SecretTarget{{Property: "ApiKey", Namespace: "media", Name: "sonarr", Key: "api-key"}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if err := publishSecrets(context.Background(), Flags{IgnoreMissingConfig: true}, opts, targets, logger); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := publishSecrets(context.Background(), Flags{}, opts, targets, logger); err == nil || !strings.Contains(err.Error(), "error reading configuration file") {
+		t.Fatalf("Expected error for the missing file, got %v", err)
+	}
+}
+
 // TestRun tests the main functionality of the application, ensuring it updates
 // the configuration file based on environment variables.
 func TestRun(t *testing.T) {
@@ -248,7 +425,7 @@ func TestRun(t *testing.T) {
 		args := []string{"cmd", "--config", file.Name(), "--prefix", "CONFIGARR__", "--debug"}
 
 		var stdOut strings.Builder
-		err = run(envVars, args, &stdOut)
+		_, err = run(envVars, args, nil, &stdOut)
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
@@ -272,6 +449,139 @@ func TestRun(t *testing.T) {
 		}
 	})
 
+	t.Run("Empty configuration file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.xml")
+		if err := os.WriteFile(file, nil, 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		envVars := []string{"CONFIGARR__LOG=LogLevel=debug"}
+
+		_, err := run(envVars, []string{"cmd", "--config", file, "--prefix", "CONFIGARR__"}, nil, io.Discard)
+		if !errors.Is(err, configarr.ErrEmptyConfig) || !strings.Contains(err.Error(), "use --recover-empty") {
+			t.Fatalf("Expected an empty configuration error with a hint, got: %v", err)
+		}
+
+		if _, err := run(envVars, []string{"cmd", "--config", file, "--prefix", "CONFIGARR__", "--recover-empty", "--create-keys", "append"}, nil, io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		updatedContent, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error reading updated file: %v", err)
+		}
+		if expectedXML := "<Config>\n\t<LogLevel>debug</LogLevel>\n</Config>\n"; string(updatedContent) != expectedXML {
+			t.Fatalf("Expected XML %q, got %q", expectedXML, updatedContent)
+		}
+	})
+
+	t.Run("Managed header", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.xml")
+		if err := os.WriteFile(file, []byte("<Config>\n  <LogLevel>info</LogLevel>\n</Config>\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		args := []string{"cmd", "--config", file, "--prefix", "CONFIGARR__", "--managed-header"}
+
+		for _, level := range []string{"debug", "debug", "trace"} {
+			if _, err := run([]string{"CONFIGARR__LOG=LogLevel=" + level}, args, nil, io.Discard); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			updatedContent, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Unexpected error reading updated file: %v", err)
+			}
+			header, body, _ := strings.Cut(string(updatedContent), "\n")
+			if !strings.HasPrefix(header, "<!-- managed by configarr "+configarr.Version+" at ") || !strings.HasSuffix(header, "; manual edits may be overwritten -->") {
+				t.Fatalf("Expected a managed header, got: %s", updatedContent)
+			}
+			if expected := "<Config>\n  <LogLevel>" + level + "</LogLevel>\n</Config>\n"; body != expected {
+				t.Fatalf("Expected a single header above %q, got: %s", expected, updatedContent)
+			}
+		}
+	})
+
+	t.Run("Set flags", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.xml")
+		if err := os.WriteFile(file, []byte("<Config>\n  <LogLevel>info</LogLevel>\n  <Port>8989</Port>\n</Config>\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		args := []string{"cmd", "--config", file, "--prefix", "CONFIGARR__", "--set", "LogLevel=debug", "--set", "Port=8990"}
+		if _, err := run([]string{"CONFIGARR__LOG=LogLevel=trace"}, args, nil, io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		updatedContent, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error reading updated file: %v", err)
+		}
+		if expected := "<Config>\n  <LogLevel>debug</LogLevel>\n  <Port>8990</Port>\n</Config>\n"; string(updatedContent) != expected {
+			t.Fatalf("Expected --set to take precedence over the environment, got: %s", updatedContent)
+		}
+
+		if code, err := run(nil, []string{"cmd", "--config", file, "--set", "LogLevel"}, nil, io.Discard); err == nil || code != exitInvalid {
+			t.Fatalf("Expected error for --set without a value, got: %v (exit code %d)", err, code)
+		}
+	})
+
+	t.Run("Events keep logs off the output", func(t *testing.T) {
+		var logs bytes.Buffer
+		defer func(w io.Writer) { eventsLogOutput = w }(eventsLogOutput)
+		eventsLogOutput = &logs
+
+		file := filepath.Join(t.TempDir(), "config.xml")
+		if err := os.WriteFile(file, []byte("<Config>\n  <LogLevel>info</LogLevel>\n  <Port>8989</Port>\n</Config>\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		envVars := []string{"CONFIGARR__LOG=LogLevel=debug", "CONFIGARR__PORT=Port=8989", "CONFIGARR__TYPO=Typo=x"}
+		args := []string{"cmd", "--config", file, "--prefix", "CONFIGARR__", "--events-format", "ndjson", "--debug"}
+		var output bytes.Buffer
+		if _, err := run(envVars, args, nil, &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("Expected an event per override, got:\n%s", output.String())
+		}
+		for _, line := range lines {
+			if !json.Valid([]byte(line)) {
+				t.Fatalf("Expected every line of the output to be JSON, got %q in:\n%s", line, output.String())
+			}
+		}
+		if !strings.Contains(logs.String(), "Updated 'LogLevel' to 'debug'") {
+			t.Fatalf("Expected the logs on the separate output, got: %s", logs.String())
+		}
+	})
+
+	t.Run("Unmanaged keys", func(t *testing.T) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "config.xml")
+		if err := os.WriteFile(file, []byte("<Config>\n  <LogLevel>info</LogLevel>\n  <Theme>dark</Theme>\n  <UrlBase>/a</UrlBase>\n</Config>\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		unmanagedFile := filepath.Join(dir, "unmanaged.txt")
+		if err := os.WriteFile(unmanagedFile, []byte("# Edited in the UI\nTheme\n\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		envVars := []string{"CONFIGARR__LOG=LogLevel=debug", "CONFIGARR__THEME=Theme=light", "CONFIGARR__URL=UrlBase=/b"}
+
+		args := []string{"cmd", "--config", file, "--prefix", "CONFIGARR__", "--unmanaged", "Url*", "--unmanaged-file", unmanagedFile}
+		if _, err := run(envVars, args, nil, io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		updatedContent, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Unexpected error reading updated file: %v", err)
+		}
+		if expectedXML := "<Config>\n  <LogLevel>debug</LogLevel>\n  <Theme>dark</Theme>\n  <UrlBase>/a</UrlBase>\n</Config>\n"; string(updatedContent) != expectedXML {
+			t.Fatalf("Expected XML %q, got %q", expectedXML, updatedContent)
+		}
+
+		if err := os.WriteFile(unmanagedFile, []byte("Theme[\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := run(envVars, args, nil, io.Discard); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Fatalf("Expected error on an invalid pattern, got: %v", err)
+		}
+	})
+
 	t.Run("No updates when environment variables do not match", func(t *testing.T) {
 		// Set up temporary XML file
 		xmlContent := `<Config>
@@ -297,7 +607,7 @@ func TestRun(t *testing.T) {
 		args := []string{"cmd", "--config", file.Name(), "--prefix", "CONFIGARR__", "--debug"}
 
 		var stdOut strings.Builder
-		err = run(envVars, args, &stdOut)
+		_, err = run(envVars, args, nil, &stdOut)
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
@@ -321,6 +631,151 @@ func TestRun(t *testing.T) {
 		}
 	})
 
+	t.Run("JSON overrides from stdin take precedence over env", func(t *testing.T) {
+		xmlContent := `<Config>
+  <LogLevel>info</LogLevel>
+  <Port>8989</Port>
+</Config>`
+		file, err := os.CreateTemp("", "config*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(xmlContent)); err != nil {
+			t.Fatalf("Unexpected error writing XML content to temp file: %v", err)
+		}
+		file.Close()
+
+		envVars := []string{
+			"CONFIGARR__LOG=LogLevel=trace",
+		}
+
+		args := []string{"cmd", "--config", file.Name(), "--from-json", "-"}
+
+		var stdOut strings.Builder
+		if _, err := run(envVars, args, strings.NewReader(`{"LogLevel":"debug","Port":8990}`), &stdOut); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		content, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading file: %v", err)
+		}
+
+		expectedXML := `<Config>
+  <LogLevel>debug</LogLevel>
+  <Port>8990</Port>
+</Config>`
+		if string(content) != expectedXML {
+			t.Fatalf("Expected XML %s, got %s", expectedXML, string(content))
+		}
+	})
+
+	t.Run("Fidelity mode leaves file untouched without changes", func(t *testing.T) {
+		xmlContent := "<Config>\r\n\t<LogLevel>info</LogLevel>\r\n</Config>\r\n"
+		file, err := os.CreateTemp("", "config*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(xmlContent)); err != nil {
+			t.Fatalf("Unexpected error writing XML content to temp file: %v", err)
+		}
+		file.Close()
+
+		envVars := []string{
+			"CONFIGARR__LOG=LogLevel=info",
+		}
+
+		args := []string{"cmd", "--config", file.Name(), "--fidelity"}
+
+		var stdOut strings.Builder
+		if _, err := run(envVars, args, nil, &stdOut); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		content, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading file: %v", err)
+		}
+
+		if string(content) != xmlContent {
+			t.Fatalf("Expected byte-identical file, got %q", string(content))
+		}
+	})
+
+	t.Run("Fidelity mode refuses cosmetic rewrite", func(t *testing.T) {
+		xmlContent := "<Config>\r\n\t<LogLevel>info</LogLevel>\r\n\t<UrlBase />\r\n</Config>\r\n" // The empty element would be expanded
+		file, err := os.CreateTemp("", "config*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(xmlContent)); err != nil {
+			t.Fatalf("Unexpected error writing XML content to temp file: %v", err)
+		}
+		file.Close()
+
+		envVars := []string{
+			"CONFIGARR__LOG=LogLevel=debug",
+		}
+
+		args := []string{"cmd", "--config", file.Name(), "--fidelity", "--reformat"}
+
+		var stdOut strings.Builder
+		_, err = run(envVars, args, nil, &stdOut)
+		if err == nil {
+			t.Fatal("Expected fidelity error, but got none")
+		}
+
+		content, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading file: %v", err)
+		}
+
+		if string(content) != xmlContent {
+			t.Fatalf("Expected file to remain unchanged, got %q", string(content))
+		}
+	})
+
+	t.Run("Patch mode passes fidelity check", func(t *testing.T) {
+		xmlContent := "<Config>\r\n\t<LogLevel>info</LogLevel>\r\n</Config>\r\n"
+		file, err := os.CreateTemp("", "config*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(xmlContent)); err != nil {
+			t.Fatalf("Unexpected error writing XML content to temp file: %v", err)
+		}
+		file.Close()
+
+		envVars := []string{
+			"CONFIGARR__LOG=LogLevel=debug",
+		}
+
+		args := []string{"cmd", "--config", file.Name(), "--fidelity", "--patch"}
+
+		var stdOut strings.Builder
+		if _, err := run(envVars, args, nil, &stdOut); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		content, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading file: %v", err)
+		}
+
+		expected := "<Config>\r\n\t<LogLevel>debug</LogLevel>\r\n</Config>\r\n"
+		if string(content) != expected {
+			t.Fatalf("Expected %q, got %q", expected, string(content))
+		}
+	})
+
 	t.Run("Ignore missing config file", func(t *testing.T) {
 		// Ensure the file does not exist
 		nonExistentFile := "nonexistent.xml"
@@ -333,7 +788,7 @@ func TestRun(t *testing.T) {
 		args := []string{"cmd", "--config", nonExistentFile, "--prefix", "CONFIGARR__", "--ignore-missing-config", "--debug"}
 
 		var stdOut strings.Builder
-		err := run(envVars, args, &stdOut)
+		_, err := run(envVars, args, nil, &stdOut)
 		if err != nil {
 			t.Fatalf("Unexpected error: %v", err)
 		}
@@ -355,9 +810,325 @@ func TestRun(t *testing.T) {
 		args := []string{"cmd", "--config", nonExistentFile, "--prefix", "CONFIGARR__"}
 
 		var logOutput bytes.Buffer
-		err := run(envVars, args, &logOutput)
+		_, err := run(envVars, args, nil, &logOutput)
 		if err == nil {
 			t.Fatal("Expected error for missing configuration file, but got none")
 		}
 	})
+
+	t.Run("Update linked files", func(t *testing.T) {
+		dir := t.TempDir()
+		configFile := filepath.Join(dir, "config.xml")
+		envFile := filepath.Join(dir, ".env")
+		if err := os.WriteFile(configFile, []byte("<Config><ApiKey>old</ApiKey></Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		args := []string{"cmd", "--config", configFile, "--link", "dotenv:" + envFile + ":SONARR_API_KEY"}
+		var stdOut strings.Builder
+		if _, err := run([]string{"CONFIGARR__APIKEY=ApiKey=new"}, args, nil, &stdOut); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(envFile)
+		if err != nil {
+			t.Fatalf("Unexpected error reading linked file: %v", err)
+		}
+		if string(data) != "SONARR_API_KEY=new\n" {
+			t.Fatalf("Expected the new API key in the linked file, got %q", data)
+		}
+	})
+
+	t.Run("Update linked files with the format of the run", func(t *testing.T) {
+		dir := t.TempDir()
+		configFile := filepath.Join(dir, "settings.conf")
+		envFile := filepath.Join(dir, ".env")
+		if err := os.WriteFile(configFile, []byte(`{"ApiKey": "old"}`), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		args := []string{"cmd", "--config", configFile, "--format", "json", "--link", "dotenv:" + envFile + ":SONARR_API_KEY"}
+		if _, err := run([]string{"CONFIGARR__APIKEY=ApiKey=new"}, args, nil, io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if data, _ := os.ReadFile(envFile); string(data) != "SONARR_API_KEY=new\n" {
+			t.Fatalf("Expected the new API key in the linked file, got %q", data)
+		}
+	})
+
+	t.Run("Dry run prints a diff", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "config.xml")
+		content := "<Config>\n  <Port>8989</Port>\n  <ApiKey>old</ApiKey>\n</Config>\n"
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		envVars := []string{"CONFIGARR__PORT=Port=9000", "CONFIGARR__APIKEY=ApiKey=new"}
+		var stdOut strings.Builder
+		code, err := run(envVars, []string{"cmd", "--config", configFile, "--dry-run", "--exit-code=detailed"}, nil, &stdOut)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if code != exitDrift {
+			t.Fatalf("Expected exit code %d, got %d", exitDrift, code)
+		}
+
+		for _, line := range []string{"-  <Port>8989</Port>\n", "+  <Port>9000</Port>\n", "+  <ApiKey>********</ApiKey>\n"} {
+			if !strings.Contains(stdOut.String(), line) {
+				t.Fatalf("Expected %q in diff, got:\n%s", line, stdOut.String())
+			}
+		}
+		if data, _ := os.ReadFile(configFile); string(data) != content {
+			t.Fatalf("Expected file to be unchanged, got %q", data)
+		}
+	})
+
+	t.Run("Dry run masks secret attributes", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "Preferences.xml")
+		content := "<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<Preferences PlexOnlineToken=\"supersecrettoken\" FriendlyName=\"x\"/>\n"
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		envVars := []string{"CONFIGARR__NAME=FriendlyName=nas", "CONFIGARR__TOKEN=PlexOnlineToken=rotatedtoken"}
+		var stdOut strings.Builder
+		if _, err := run(envVars, []string{"cmd", "--config", configFile, "--dry-run"}, nil, &stdOut); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, secret := range []string{"supersecrettoken", "rotatedtoken"} {
+			if strings.Contains(stdOut.String(), secret) {
+				t.Fatalf("Expected %s to be masked in the diff, got:\n%s", secret, stdOut.String())
+			}
+		}
+		if line := "+<Preferences PlexOnlineToken=\"********\" FriendlyName=\"nas\"/>\n"; !strings.Contains(stdOut.String(), line) {
+			t.Fatalf("Expected %q in diff, got:\n%s", line, stdOut.String())
+		}
+	})
+
+	t.Run("Dry run masks secret CDATA sections", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "config.xml")
+		content := "<Config>\n  <ApiKey><![CDATA[sekrit1]]></ApiKey>\n</Config>\n"
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		var stdOut strings.Builder
+		if _, err := run([]string{"CONFIGARR__KEY=ApiKey=new<sekrit>"}, []string{"cmd", "--config", configFile, "--cdata", "--dry-run"}, nil, &stdOut); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for _, secret := range []string{"sekrit1", "new<sekrit>"} {
+			if strings.Contains(stdOut.String(), secret) {
+				t.Fatalf("Expected %s to be masked in the diff, got:\n%s", secret, stdOut.String())
+			}
+		}
+		if line := "+  <ApiKey><![CDATA[********]]></ApiKey>\n"; !strings.Contains(stdOut.String(), line) {
+			t.Fatalf("Expected %q in diff, got:\n%s", line, stdOut.String())
+		}
+	})
+
+	t.Run("Dry run reports drift from a golden file", func(t *testing.T) {
+		dir := t.TempDir()
+		configFile, goldenFile := filepath.Join(dir, "config.xml"), filepath.Join(dir, "golden.xml")
+		if err := os.WriteFile(configFile, []byte("<Config><Port>8989</Port><LogLevel>debug</LogLevel><ApiKey>abc</ApiKey></Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		if err := os.WriteFile(goldenFile, []byte("<Config><Port>8989</Port><LogLevel>info</LogLevel><UrlBase>/sonarr</UrlBase><ApiKey>xyz</ApiKey></Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		var stdOut strings.Builder
+		code, err := run(nil, []string{"cmd", "--config", configFile, "--dry-run", "--golden", goldenFile, "--exit-code=detailed"}, nil, &stdOut)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if code != exitDrift {
+			t.Fatalf("Expected exit code %d, got %d", exitDrift, code)
+		}
+		for _, fragment := range []string{"drift    LogLevel  debug    info", "missing  UrlBase   -        /sonarr"} {
+			if !strings.Contains(stdOut.String(), fragment) {
+				t.Fatalf("Expected %q in the report, got:\n%s", fragment, stdOut.String())
+			}
+		}
+		_, report, _ := strings.Cut(stdOut.String(), "FILE")
+		if strings.Contains(report, "ApiKey") || strings.Contains(report, "Port") {
+			t.Fatalf("Expected only drifted non-secret keys in the report, got:\n%s", report)
+		}
+
+		stdOut.Reset()
+		code, err = run(nil, []string{"cmd", "--config", configFile, "--dry-run", "--golden", configFile}, nil, &stdOut)
+		if err != nil || code != exitOK || !strings.Contains(stdOut.String(), configFile+"  ok") {
+			t.Fatalf("Expected no drift from the file itself, got %d, %v:\n%s", code, err, stdOut.String())
+		}
+
+		if _, err := parseFlags([]string{"--golden", goldenFile}); err == nil {
+			t.Fatal("Expected error on --golden without --dry-run, but got none")
+		}
+	})
+
+	t.Run("Several configuration files", func(t *testing.T) {
+		dir := t.TempDir()
+		files := map[string]string{
+			"sonarr":   "<Config><UrlBase></UrlBase><LogLevel>info</LogLevel></Config>",
+			"radarr":   "<Config><UrlBase></UrlBase><LogLevel>info</LogLevel></Config>",
+			"prowlarr": "<Config><UrlBase>",
+		}
+		for app, content := range files {
+			if err := os.MkdirAll(filepath.Join(dir, app), 0755); err != nil {
+				t.Fatalf("Unexpected error creating directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, app, "config.xml"), []byte(content), 0644); err != nil {
+				t.Fatalf("Unexpected error writing file: %v", err)
+			}
+		}
+
+		args := []string{"cmd", "--config", filepath.Join(dir, "*", "config.xml"), "--preset", "behind-reverse-proxy", "--read-retries", "0"}
+		var stdOut strings.Builder
+		_, err := run([]string{"CONFIGARR__LOG=LogLevel=debug"}, args, nil, &stdOut)
+		if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "prowlarr", "config.xml")) {
+			t.Fatalf("Expected an error naming the broken file, got %v", err)
+		}
+
+		for _, app := range []string{"sonarr", "radarr"} {
+			config, err := configarr.ReadConfigFile(filepath.Join(dir, app, "config.xml"))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			expected := map[string]string{"UrlBase": "/" + app, "LogLevel": "debug"}
+			if !reflect.DeepEqual(config.Properties, expected) {
+				t.Fatalf("Expected properties %v for %s, got %v", expected, app, config.Properties)
+			}
+			if !strings.Contains(stdOut.String(), "file="+filepath.Join(dir, app, "config.xml")) {
+				t.Fatalf("Expected a summary for %s, got: %s", app, stdOut.String())
+			}
+		}
+	})
+
+	t.Run("Prefix targets", func(t *testing.T) {
+		dir := t.TempDir()
+		sonarr, radarr := filepath.Join(dir, "sonarr.xml"), filepath.Join(dir, "radarr.xml")
+		for _, configFile := range []string{sonarr, radarr} {
+			if err := os.WriteFile(configFile, []byte("<Config><Port>1</Port><LogLevel>info</LogLevel></Config>"), 0644); err != nil {
+				t.Fatalf("Unexpected error writing file: %v", err)
+			}
+		}
+
+		envVars := []string{"SONARR__PORT=Port=8989", "RADARR__PORT=Port=7878", "RADARR__LOG=LogLevel=debug", "CONFIGARR__PORT=Port=9999"}
+		args := []string{"cmd", "--target", "SONARR__=" + sonarr, "--target", "RADARR__=" + radarr}
+		if _, err := run(envVars, args, nil, io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for configFile, expected := range map[string]map[string]string{
+			sonarr: {"Port": "8989", "LogLevel": "info"},
+			radarr: {"Port": "7878", "LogLevel": "debug"},
+		} {
+			config, err := configarr.ReadConfigFile(configFile)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config.Properties, expected) {
+				t.Fatalf("Expected properties %v in %s, got %v", expected, configFile, config.Properties)
+			}
+		}
+	})
+
+	t.Run("Port conflict across targets", func(t *testing.T) {
+		dir := t.TempDir()
+		sonarr, radarr := filepath.Join(dir, "sonarr.xml"), filepath.Join(dir, "radarr.xml")
+		for configFile, port := range map[string]string{sonarr: "8989", radarr: "7878"} {
+			if err := os.WriteFile(configFile, []byte("<Config><Port>"+port+"</Port></Config>"), 0644); err != nil {
+				t.Fatalf("Unexpected error writing file: %v", err)
+			}
+		}
+
+		args := []string{"cmd", "--target", "SONARR__=" + sonarr, "--target", "RADARR__=" + radarr}
+		code, err := run([]string{"RADARR__PORT=Port=8989"}, args, nil, io.Discard)
+		if err == nil || code != exitInvalid || !strings.Contains(err.Error(), "port 8989 is configured for "+sonarr+" (Port) and "+radarr+" (Port)") {
+			t.Fatalf("Expected error for a port conflict, got: %v (exit code %d)", err, code)
+		}
+		if data, _ := os.ReadFile(radarr); strings.Contains(string(data), "8989") {
+			t.Fatalf("Expected nothing to be written, got %s", data)
+		}
+
+		args = []string{"cmd", "--config", sonarr, "--config", radarr, "--validation-mode", "warn"}
+		var stdOut strings.Builder
+		if _, err := run([]string{"CONFIGARR__PORT=Port=9000"}, args, nil, &stdOut); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(stdOut.String(), "Validation failed: port 9000") {
+			t.Fatalf("Expected a warning for the port conflict, got:\n%s", stdOut.String())
+		}
+	})
+
+	t.Run("Targets time out separately", func(t *testing.T) {
+		dir := t.TempDir()
+		var configFiles []string
+		for _, app := range []string{"sonarr", "radarr"} {
+			configFile := filepath.Join(dir, app+".xml")
+			if err := os.WriteFile(configFile, []byte("<Config><LogLevel>info</LogLevel></Config>"), 0644); err != nil {
+				t.Fatalf("Unexpected error writing file: %v", err)
+			}
+			configFiles = append(configFiles, configFile)
+		}
+
+		// The settle delay keeps both runs waiting until they time out
+		args := []string{"cmd", "--config", configFiles[0], "--config", configFiles[1], "--settle-delay", "10s", "--target-timeout", "50ms"}
+		start := time.Now()
+		_, err := run([]string{"CONFIGARR__LOG=LogLevel=debug"}, args, nil, io.Discard)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected a timeout, got %v", err)
+		}
+		for _, configFile := range configFiles {
+			if !strings.Contains(err.Error(), configFile+": timed out after 50ms") {
+				t.Fatalf("Expected a timeout of %s, got %v", configFile, err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("Expected the targets to time out quickly, took %s", elapsed)
+		}
+	})
+
+	t.Run("Presets follow the app read with the format of the run", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "settings.conf")
+		if err := os.WriteFile(configFile, []byte(`{"InstanceName": "Radarr", "UrlBase": ""}`), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		args := []string{"cmd", "--config", configFile, "--format", "json", "--preset", "behind-reverse-proxy"}
+		if _, err := run(nil, args, nil, io.Discard); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if data, _ := os.ReadFile(configFile); !strings.Contains(string(data), `"UrlBase":"/radarr"`) {
+			t.Fatalf("Expected the UrlBase of radarr, got %s", data)
+		}
+	})
+
+	t.Run("Presets are overridden by env", func(t *testing.T) {
+		configFile := filepath.Join(t.TempDir(), "sonarr", "config.xml")
+		if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+			t.Fatalf("Unexpected error creating directory: %v", err)
+		}
+		content := "<Config><BindAddress>127.0.0.1</BindAddress><UrlBase></UrlBase><EnableSsl>True</EnableSsl><AuthenticationRequired>Enabled</AuthenticationRequired></Config>"
+		if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		args := []string{"cmd", "--config", configFile, "--preset", "behind-reverse-proxy"}
+		var stdOut strings.Builder
+		if _, err := run([]string{"CONFIGARR__BIND=BindAddress=10.0.0.2"}, args, nil, &stdOut); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		config, err := configarr.ReadConfigFile(configFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := map[string]string{"BindAddress": "10.0.0.2", "UrlBase": "/sonarr", "EnableSsl": "False", "AuthenticationRequired": "Enabled"}
+		if !reflect.DeepEqual(config.Properties, expected) {
+			t.Fatalf("Expected properties %v, got %v", expected, config.Properties)
+		}
+	})
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"configarr"
+)
+
+// writeMetrics writes the metrics of the run to the file in the Prometheus text format,
+// e.g. for the textfile collector of the node exporter. The file is replaced atomically,
+// so the collector never reads it half-written.
+func writeMetrics(path string, result configarr.Result) error {
+	metrics := fmt.Sprintf(`# HELP configarr_write_queue_depth Change sets waiting to be retried after failed writes.
+# TYPE configarr_write_queue_depth gauge
+configarr_write_queue_depth{file=%q} %d
+`, result.ConfigPath, result.Queued)
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // Fails once renamed
+
+	if _, err := temp.WriteString(metrics); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// TestWriteMetrics tests writing the depth of the write queue in the Prometheus text format.
+func TestWriteMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configarr.prom")
+	for _, queued := range []int{2, 0} {
+		if err := writeMetrics(path, configarr.Result{ConfigPath: "/config/config.xml", Queued: queued}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), "\nconfigarr_write_queue_depth{file=\"/config/config.xml\"} 0\n") {
+		t.Fatalf("Expected the queue depth of the last run, got:\n%s", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Fatalf("Expected no temporary files to be left, got %d files", len(entries))
+	}
+}
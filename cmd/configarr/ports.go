@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"configarr"
+)
+
+// portTarget is a configuration file checked by checkPortConflicts.
+type portTarget struct {
+	name    string // App or file named in the errors
+	path    string
+	sources []configarr.Source
+}
+
+// appPort is a port an app listens on once its target is applied.
+type appPort struct {
+	app string
+	key string // Property holding the port, e.g. SslPort
+}
+
+// checkPortConflicts returns an error for every port that more than one target would
+// listen on once it is applied, a common copy-paste mistake in compose stacks. Ports are
+// the planned value of Port and, with EnableSsl set, SslPort, or the value already in
+// the file. Nothing is written, and the files aren't waited on to settle; their runs
+// still do. Targets that can't be planned are left out of the check; their errors are
+// joined in the returned error.
+func checkPortConflicts(ctx context.Context, targets []portTarget, opts []configarr.Option) ([]error, error) {
+	ports := make(map[string][]appPort)
+	var errs []error
+	for _, target := range targets {
+		targetOpts := append(append([]configarr.Option{}, opts...), configarr.WithConfigPath(target.path), configarr.WithSources(target.sources...), configarr.WithSettleDelay(0, 0))
+		plan, err := configarr.NewPlan(ctx, targetOpts...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.name, err))
+			continue
+		}
+
+		properties := make(map[string]string)
+		if config, err := configarr.ReadConfig(targetOpts...); err == nil {
+			properties = config.Properties
+		}
+		for key, value := range plan.Changes() {
+			properties[key] = value
+		}
+
+		for _, key := range []string{"Port", "SslPort"} {
+			port := strings.TrimSpace(properties[key])
+			if port == "" || key == "SslPort" && !strings.EqualFold(properties["EnableSsl"], "true") {
+				continue
+			}
+			ports[port] = append(ports[port], appPort{app: target.name, key: key})
+		}
+	}
+
+	var conflicts []error
+	for port, apps := range ports {
+		if len(apps) < 2 {
+			continue
+		}
+		names := make([]string, 0, len(apps))
+		for _, app := range apps {
+			names = append(names, fmt.Sprintf("%s (%s)", app.app, app.key))
+		}
+		conflicts = append(conflicts, fmt.Errorf("port %s is configured for %s", port, strings.Join(names, " and ")))
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Error() < conflicts[j].Error() })
+	return conflicts, errors.Join(errs...)
+}
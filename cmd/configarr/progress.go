@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Progress formats of --progress.
+const (
+	progressText   = "text"
+	progressNDJSON = "ndjson"
+)
+
+// progressOutput receives the progress of multi-target runs, so it doesn't mix with the
+// output of the run. Replaced in tests.
+var progressOutput io.Writer = os.Stderr
+
+// progressEvent is a progress record in the ndjson format.
+type progressEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // "progress" when a target starts, "done" after the last one
+	Target  string    `json:"target,omitempty"`
+	Current int       `json:"current,omitempty"` // 1-based index of the target
+	Total   int       `json:"total"`
+	Elapsed string    `json:"elapsed"`
+}
+
+// progressReporter reports which of the targets of a run is processed, so wrapper UIs
+// and CI logs show liveness during long runs. A nil progressReporter reports nothing.
+type progressReporter struct {
+	format  string
+	output  io.Writer
+	total   int
+	current int
+	start   time.Time
+	now     func() time.Time
+}
+
+// newProgressReporter returns a reporter for the total number of targets, or nil when
+// the format is empty.
+func newProgressReporter(format string, total int) *progressReporter {
+	if format == "" {
+		return nil
+	}
+	return &progressReporter{format: format, output: progressOutput, total: total, start: clock.Now(), now: clock.Now}
+}
+
+// validateProgressFormat checks the value of --progress.
+func validateProgressFormat(format string) error {
+	switch format {
+	case "", progressText, progressNDJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid --progress %q: expected text or ndjson", format)
+}
+
+// Next reports that the next target starts.
+func (p *progressReporter) Next(target string) {
+	if p == nil {
+		return
+	}
+	p.current++
+	p.report(progressEvent{Type: "progress", Target: target, Current: p.current})
+}
+
+// Done reports that all targets were processed.
+func (p *progressReporter) Done() {
+	if p == nil {
+		return
+	}
+	p.report(progressEvent{Type: "done"})
+}
+
+// report writes the event in the reporter's format. Write errors are ignored, since
+// progress is informational.
+func (p *progressReporter) report(event progressEvent) {
+	now := p.now()
+	event.Time, event.Total, event.Elapsed = now.UTC(), p.total, now.Sub(p.start).Round(time.Millisecond).String()
+
+	if p.format == progressNDJSON {
+		_ = json.NewEncoder(p.output).Encode(event)
+		return
+	}
+	if event.Type == "done" {
+		fmt.Fprintf(p.output, "Processed %d targets in %s\n", event.Total, event.Elapsed)
+		return
+	}
+	fmt.Fprintf(p.output, "[%d/%d] %s (elapsed %s)\n", event.Current, event.Total, event.Target, event.Elapsed)
+}
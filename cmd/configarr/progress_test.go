@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProgressReporter tests reporting the progress over several targets.
+func TestProgressReporter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newReporter := func(format string, output *strings.Builder) *progressReporter {
+		now := start
+		return &progressReporter{format: format, output: output, total: 2, start: start, now: func() time.Time {
+			now = now.Add(1500 * time.Millisecond)
+			return now
+		}}
+	}
+
+	t.Run("Text", func(t *testing.T) {
+		var output strings.Builder
+		progress := newReporter(progressText, &output)
+		progress.Next("sonarr")
+		progress.Next("radarr")
+		progress.Done()
+
+		expected := "[1/2] sonarr (elapsed 1.5s)\n[2/2] radarr (elapsed 3s)\nProcessed 2 targets in 4.5s\n"
+		if output.String() != expected {
+			t.Fatalf("Expected output:\n%s\ngot:\n%s", expected, output.String())
+		}
+	})
+
+	t.Run("NDJSON", func(t *testing.T) {
+		var output strings.Builder
+		progress := newReporter(progressNDJSON, &output)
+		progress.Next("sonarr")
+		progress.Done()
+
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 events, got:\n%s", output.String())
+		}
+		var event progressEvent
+		if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if event.Type != "progress" || event.Target != "sonarr" || event.Current != 1 || event.Total != 2 || event.Elapsed != "1.5s" {
+			t.Fatalf("Unexpected event: %+v", event)
+		}
+		if !strings.Contains(lines[1], `"type":"done"`) {
+			t.Fatalf("Expected done event, got: %s", lines[1])
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		progress := newProgressReporter("", 2)
+		progress.Next("sonarr") // Must not panic
+		progress.Done()
+	})
+
+	t.Run("Invalid format", func(t *testing.T) {
+		if err := validateProgressFormat("xml"); err == nil {
+			t.Fatal("Expected error for invalid format, but got none")
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"configarr"
+)
+
+// Names of the files in a record bundle.
+const (
+	recordManifest  = "manifest.json"
+	recordConfigDir = "config/"
+	recordVersion   = 1
+)
+
+// recording is the manifest of a record bundle: what a run was given and what it planned,
+// with secret values masked, so it can be attached to a bug report.
+type recording struct {
+	Version   int                    `json:"version"`
+	Time      time.Time              `json:"time"`
+	Flags     Flags                  `json:"flags"`
+	Overrides []configarr.Override   `json:"overrides"`        // Overrides of all sources, in order
+	Plan      []configarr.PlanAction `json:"plan"`             // Actions planned for the configuration file
+	Config    string                 `json:"config,omitempty"` // Name of the configuration file in the bundle, empty when it was missing
+}
+
+// recordRun reads the sources once and writes a record bundle of the run to the path of
+// --record. The returned source provides the overrides read, so the run doesn't read
+// stdin or run commands a second time.
+func recordRun(ctx context.Context, flags Flags, sources []configarr.Source, opts []configarr.Option, logger *slog.Logger) (configarr.Source, error) {
+	var overrides []configarr.Override
+	for _, source := range sources {
+		sourceOverrides, err := source.Overrides(ctx, logger)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, sourceOverrides...)
+	}
+	replay := configarr.StaticSource(overrides...)
+
+	plan, err := configarr.NewPlan(ctx, append(opts, configarr.WithSources(replay))...)
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := os.ReadFile(flags.ConfigFilePath)
+	if err == nil {
+		var codec configarr.Codec
+		if codec, err = newCodec(flags); err == nil && codec != nil {
+			original, err = codec.Decode(original)
+		}
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading %s for the record: %w", flags.ConfigFilePath, err)
+	}
+
+	rec := recording{Version: recordVersion, Time: clock.Now().UTC(), Flags: redactFlags(flags), Plan: plan.Actions}
+	for _, override := range overrides {
+		override.Value = redactValue(override.Key, override.Value)
+		override.Source = redactSource(override.Source)
+		rec.Overrides = append(rec.Overrides, override)
+	}
+	for i, action := range rec.Plan {
+		rec.Plan[i].Current = configarr.MaskSecretValue(action.Key, action.Current)
+		rec.Plan[i].Value = configarr.MaskSecretValue(action.Key, action.Value)
+		rec.Plan[i].Source = redactSource(action.Source)
+	}
+	if original != nil {
+		rec.Config = recordConfigDir + filepath.Base(flags.ConfigFilePath)
+		original = []byte(configarr.MaskSecretElements(string(original)))
+	}
+
+	if err := writeBundle(flags.Record, rec, original); err != nil {
+		return nil, err
+	}
+	logger.Info(fmt.Sprintf("Recorded the run to %s", flags.Record))
+	return replay, nil
+}
+
+// redactValue masks the values of secret properties and encrypted values, which can't
+// be decrypted when the bundle is replayed.
+func redactValue(key, value string) string {
+	if strings.HasPrefix(value, configarr.EncryptedValuePrefix) {
+		return configarr.SecretMask
+	}
+	return configarr.MaskSecretValue(key, value)
+}
+
+// redactFlags masks the flags that may hold credentials: the values given with --set, the
+// values of the variables set for the child, the arguments of commands and the targets of
+// notifiers, e.g. webhook URLs with tokens.
+func redactFlags(flags Flags) Flags {
+	redacted := flags
+	redacted.Set = nil
+	for _, pair := range flags.Set {
+		key, value, found := strings.Cut(pair, flags.Delimiter)
+		if !found {
+			redacted.Set = append(redacted.Set, configarr.SecretMask)
+			continue
+		}
+		redacted.Set = append(redacted.Set, key+flags.Delimiter+redactValue(key, value))
+	}
+	redacted.SourceCommands = nil
+	for _, command := range flags.SourceCommands {
+		redacted.SourceCommands = append(redacted.SourceCommands, redactCommand(command))
+	}
+	redacted.Decrypters = nil
+	for name, command := range flags.Decrypters {
+		if redacted.Decrypters == nil {
+			redacted.Decrypters = make(map[string]string, len(flags.Decrypters))
+		}
+		redacted.Decrypters[name] = redactCommand(command)
+	}
+	redacted.ChildEnv = nil
+	for _, pair := range flags.ChildEnv {
+		name, _, _ := strings.Cut(pair, "=")
+		redacted.ChildEnv = append(redacted.ChildEnv, name+"="+configarr.SecretMask)
+	}
+	redacted.Notify = nil
+	for _, spec := range flags.Notify {
+		kind, _, _ := strings.Cut(spec, ":")
+		redacted.Notify = append(redacted.Notify, kind+":"+configarr.SecretMask)
+	}
+	return redacted
+}
+
+// redactCommand masks the arguments of a command, which may hold tokens, and keeps the
+// program to tell the commands apart.
+func redactCommand(command string) string {
+	program, args, _ := strings.Cut(strings.TrimSpace(command), " ")
+	if strings.TrimSpace(args) == "" {
+		return program
+	}
+	return program + " " + configarr.SecretMask
+}
+
+// redactSource masks the arguments of the command in the label of a --source-cmd source.
+func redactSource(source string) string {
+	if command, ok := strings.CutPrefix(source, "cmd:"); ok {
+		return "cmd:" + redactCommand(command)
+	}
+	return source
+}
+
+// writeBundle writes the manifest and the configuration file, if any, to a
+// gzip-compressed tar archive.
+func writeBundle(bundle string, rec recording, config []byte) error {
+	manifest, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding record: %w", err)
+	}
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	files := map[string][]byte{recordManifest: append(manifest, '\n')}
+	names := []string{recordManifest}
+	if rec.Config != "" {
+		files[rec.Config] = config
+		names = append(names, rec.Config)
+	}
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(files[name])), ModTime: rec.Time}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("error writing record: %w", err)
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return fmt.Errorf("error writing record: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error writing record: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("error writing record: %w", err)
+	}
+
+	if err := os.WriteFile(bundle, archive.Bytes(), 0600); err != nil {
+		return fmt.Errorf("error writing record %s: %w", bundle, err)
+	}
+	return nil
+}
+
+// readBundle reads the manifest and the files of a record bundle.
+func readBundle(bundle string) (recording, map[string][]byte, error) {
+	var rec recording
+	file, err := os.Open(bundle)
+	if err != nil {
+		return rec, nil, fmt.Errorf("error opening record %s: %w", bundle, err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return rec, nil, fmt.Errorf("error reading record %s: %w", bundle, err)
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rec, nil, fmt.Errorf("error reading record %s: %w", bundle, err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return rec, nil, fmt.Errorf("error reading record %s: %w", bundle, err)
+		}
+		files[header.Name] = data
+	}
+
+	manifest, exists := files[recordManifest]
+	if !exists {
+		return rec, nil, fmt.Errorf("invalid record %s: %s is missing", bundle, recordManifest)
+	}
+	if err := json.Unmarshal(manifest, &rec); err != nil {
+		return rec, nil, fmt.Errorf("invalid record %s: %w", bundle, err)
+	}
+	if rec.Version != recordVersion {
+		return rec, nil, fmt.Errorf("unsupported record version %d in %s", rec.Version, bundle)
+	}
+	return rec, files, nil
+}
+
+// runReplay re-runs a recorded run as a dry run on a copy of the recorded configuration
+// file: it prints the recorded plan, followed by the diff the run produces with this
+// version of configarr. Nothing outside the temporary copy is read, written or executed.
+func runReplay(args []string, output io.Writer) error {
+	flagSet := pflag.NewFlagSet("replay", pflag.ContinueOnError)
+	debug := flagSet.Bool("debug", false, "Enable debug logging")
+	if err := flagSet.Parse(args); err != nil {
+		return invalidInput(fmt.Errorf("error parsing flags: %w", err))
+	}
+	if flagSet.NArg() != 1 {
+		return invalidInput(errors.New("expected the path of a record bundle"))
+	}
+
+	rec, files, err := readBundle(flagSet.Arg(0))
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	fmt.Fprintf(output, "Recorded %s for %s:\n", rec.Time.Format(time.RFC3339), rec.Flags.ConfigFilePath)
+	for _, action := range rec.Plan {
+		detail := action.Source
+		if action.Reason != "" {
+			detail = action.Reason
+		}
+		fmt.Fprintf(output, "  %-7s %s (%s)\n", action.Type, action.Key, detail)
+	}
+
+	flags := replayFlags(rec.Flags)
+	flags.Debug = flags.Debug || *debug
+	dir, err := os.MkdirTemp("", "configarr-replay-")
+	if err != nil {
+		return fmt.Errorf("error creating replay directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	flags.ConfigFilePath = filepath.Join(dir, path.Base(rec.Flags.ConfigFilePath))
+	if rec.Config != "" {
+		if err := os.WriteFile(flags.ConfigFilePath, files[rec.Config], 0600); err != nil {
+			return fmt.Errorf("error writing replay copy: %w", err)
+		}
+	}
+	flags.overrides = rec.Overrides
+
+	_, err = apply(nil, flags, strings.NewReader(""), output)
+	return err
+}
+
+// replayFlags returns the recorded flags as a dry run of the recorded overrides, without
+// anything reaching outside the configuration file: no documents, commands, notifiers,
+// links, secrets, state, app checks, golden files or catalogs other than the built-in one.
+func replayFlags(recorded Flags) Flags {
+	flags := recorded
+	flags.DryRun = true
+	flags.Watch, flags.Record = false, ""
+	flags.FromJSON, flags.FromYAML, flags.StdinKV, flags.DownwardDir, flags.SecretsDir, flags.SourceCommands = "", "", false, "", "", nil
+	flags.Presets = nil  // Recorded as overrides
+	flags.RulesFile = "" // Not part of the bundle; the renames show in the recorded plan
+	flags.EncryptionKeyFile, flags.DecryptCommand, flags.EncryptCommand, flags.Decrypters = "", "", "", nil
+	flags.Command, flags.ChildEnv, flags.StripEnv = nil, nil, false
+	flags.Notify, flags.PublishSecrets, flags.Links, flags.StateFile = nil, nil, nil, ""
+	flags.RequireAppStopped, flags.SettleDelay = nil, 0
+	flags.EventsFormat, flags.Progress = "", ""
+	flags.DesiredState, flags.Targets = "", nil
+	flags.CatalogFile, flags.CatalogURL, flags.GoldenFile = "", "", ""
+	flags.Faults = configarr.Faults{}
+	return flags
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"configarr"
+)
+
+// TestRecordReplay tests recording a run to a bundle and replaying it.
+func TestRecordReplay(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	defer func(system configarr.Clock) { clock = system }(clock)
+	clock = configarr.FixedClock(at)
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.xml")
+	original := "<Config>\n  <Port>8989</Port>\n  <ApiKey>old-key</ApiKey>\n</Config>\n"
+	if err := os.WriteFile(configFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	bundle := filepath.Join(dir, "bundle.tgz")
+
+	environ := []string{"CONFIGARR__PORT=Port=9000", "CONFIGARR__KEY=ApiKey=new-key", "HOME=/root"}
+	args := []string{"cmd", "--config", configFile, "--record", bundle, "--notify", "webhook:https://example.com/hook?token=abc"}
+	if _, err := run(environ, args, nil, &bytes.Buffer{}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	t.Run("Bundle is redacted", func(t *testing.T) {
+		rec, files, err := readBundle(bundle)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(rec.Overrides) != 2 || len(rec.Plan) != 2 || rec.Config != "config/config.xml" || !rec.Time.Equal(at) {
+			t.Fatalf("Unexpected record %+v", rec)
+		}
+		for _, data := range files {
+			for _, secret := range []string{"old-key", "new-key", "token=abc"} {
+				if strings.Contains(string(data), secret) {
+					t.Fatalf("Expected %s to be masked in the bundle, got:\n%s", secret, data)
+				}
+			}
+		}
+		if !strings.Contains(string(files[rec.Config]), "<Port>8989</Port>") {
+			t.Fatalf("Expected the original configuration file, got:\n%s", files[rec.Config])
+		}
+	})
+
+	t.Run("Run is applied", func(t *testing.T) {
+		config, err := configarr.ReadConfigFile(configFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Properties["Port"] != "9000" || config.Properties["ApiKey"] != "new-key" {
+			t.Fatalf("Unexpected properties %v", config.Properties)
+		}
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		var output bytes.Buffer
+		code, err := run(nil, []string{"cmd", "replay", bundle}, nil, &output)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if code != exitOK {
+			t.Fatalf("Expected exit code %d, got %d", exitOK, code)
+		}
+		for _, expected := range []string{"change  Port (env:CONFIGARR__PORT)", "-  <Port>8989</Port>", "+  <Port>9000</Port>"} {
+			if !strings.Contains(output.String(), expected) {
+				t.Fatalf("Expected output to contain %q, got:\n%s", expected, output.String())
+			}
+		}
+	})
+
+	t.Run("Flags are redacted", func(t *testing.T) {
+		bundle := filepath.Join(dir, "flags.tgz")
+		args := []string{"cmd", "--config", configFile, "--record", bundle, "--dry-run",
+			"--set", "ApiKey=set-secret", "--set", "Port=9001",
+			"--source-cmd", "echo ApiKey=cmd-secret",
+			"--decrypter", "age=age -d -i decrypter-secret"}
+		if _, err := run(nil, args, nil, &bytes.Buffer{}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		rec, files, err := readBundle(bundle)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, secret := range []string{"set-secret", "cmd-secret", "decrypter-secret"} {
+			if strings.Contains(string(files[recordManifest]), secret) {
+				t.Fatalf("Expected %s to be masked in the manifest, got:\n%s", secret, files[recordManifest])
+			}
+		}
+		if len(rec.Flags.Set) != 2 || rec.Flags.Set[1] != "Port=9001" {
+			t.Fatalf("Expected the values of non-secret properties to be kept, got %v", rec.Flags.Set)
+		}
+	})
+
+	t.Run("Invalid bundle", func(t *testing.T) {
+		if _, err := run(nil, []string{"cmd", "replay", configFile}, nil, &bytes.Buffer{}); err == nil {
+			t.Fatal("Expected error for an invalid bundle, but got none")
+		}
+	})
+}
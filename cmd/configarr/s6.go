@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Defaults of the s6-install subcommand, following the LinuxServer.io docker mod conventions.
+const (
+	defaultS6Root    = "/"
+	defaultS6Name    = "init-mod-configarr"
+	defaultS6Binary  = "/usr/local/bin/configarr"
+	s6ServiceDir     = "etc/s6-overlay/s6-rc.d"
+	s6ModsDependency = "init-mods"     // Service that has to run before docker mods
+	s6ModsEnd        = "init-mods-end" // Service that waits for all docker mods
+)
+
+// S6Flags represents the command-line flags of the s6-install subcommand.
+type S6Flags struct {
+	Root   string
+	Name   string
+	Binary string
+	Args   []string
+}
+
+// parseS6Flags parses the flags of the s6-install subcommand. Arguments after "--"
+// are passed to configarr when the service runs.
+func parseS6Flags(flags []string) (S6Flags, error) {
+	flagSet := pflag.NewFlagSet("s6-install", pflag.ContinueOnError)
+
+	root := flagSet.String("root", defaultS6Root, "Root directory of the image to install the service into")
+	name := flagSet.String("name", defaultS6Name, "Name of the s6-rc oneshot service")
+	binary := flagSet.String("binary", defaultS6Binary, "Path of the configarr binary inside the image")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return S6Flags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+
+	if *name == "" || strings.ContainsRune(*name, '/') {
+		return S6Flags{}, fmt.Errorf("invalid service name %q", *name)
+	}
+
+	return S6Flags{
+		Root:   *root,
+		Name:   *name,
+		Binary: *binary,
+		Args:   flagSet.Args(),
+	}, nil
+}
+
+// runS6Install writes an s6-overlay oneshot service that runs configarr after the
+// container init and before the app service starts.
+func runS6Install(args []string, output io.Writer) error {
+	flags, err := parseS6Flags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	services := filepath.Join(flags.Root, s6ServiceDir)
+	serviceDir := filepath.Join(services, flags.Name)
+	runScript := path.Join("/", s6ServiceDir, flags.Name, "run") // Path inside the image, always with forward slashes
+
+	command := []string{shellQuote(flags.Binary)}
+	for _, arg := range flags.Args {
+		command = append(command, shellQuote(arg))
+	}
+
+	files := []struct {
+		path    string
+		content string
+		mode    os.FileMode
+	}{
+		{filepath.Join(serviceDir, "type"), "oneshot\n", 0644},
+		{filepath.Join(serviceDir, "up"), runScript + "\n", 0644},
+		{filepath.Join(serviceDir, "run"), "#!/usr/bin/with-contenv bash\n# shellcheck shell=bash\n\nexec " + strings.Join(command, " ") + "\n", 0755},
+		{filepath.Join(serviceDir, "dependencies.d", s6ModsDependency), "", 0644},
+		{filepath.Join(services, s6ModsEnd, "dependencies.d", flags.Name), "", 0644},
+		{filepath.Join(services, "user", "contents.d", flags.Name), "", 0644},
+	}
+
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(file.path), 0755); err != nil {
+			return fmt.Errorf("error creating directory for %s: %w", file.path, err)
+		}
+		if err := os.WriteFile(file.path, []byte(file.content), file.mode); err != nil {
+			return fmt.Errorf("error writing file %s: %w", file.path, err)
+		}
+		if err := os.Chmod(file.path, file.mode); err != nil { // WriteFile keeps the mode of existing files
+			return fmt.Errorf("error setting mode of %s: %w", file.path, err)
+		}
+		fmt.Fprintln(output, file.path)
+	}
+	return nil
+}
+
+// shellQuote quotes an argument for a POSIX shell unless it only contains safe characters.
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@%+") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
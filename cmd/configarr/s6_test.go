@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseS6Flags tests parsing the flags of the s6-install subcommand.
+func TestParseS6Flags(t *testing.T) {
+	t.Run("Defaults with forwarded arguments", func(t *testing.T) {
+		flags, err := parseS6Flags([]string{"--", "--config", "/config/config.xml"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if flags.Root != defaultS6Root || flags.Name != defaultS6Name || flags.Binary != defaultS6Binary {
+			t.Fatalf("Unexpected default flags: %+v", flags)
+		}
+		if strings.Join(flags.Args, " ") != "--config /config/config.xml" {
+			t.Fatalf("Unexpected forwarded arguments: %v", flags.Args)
+		}
+	})
+
+	t.Run("Invalid service name", func(t *testing.T) {
+		if _, err := parseS6Flags([]string{"--name", "a/b"}); err == nil {
+			t.Fatal("Expected error for invalid service name, but got none")
+		}
+	})
+}
+
+// TestRunS6Install tests writing the s6-overlay service files.
+func TestRunS6Install(t *testing.T) {
+	root := t.TempDir()
+	var output strings.Builder
+
+	if err := runS6Install([]string{"--root", root, "--", "--prefix", "CONFIGARR__", "--only-keys", "Api*"}, &output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	services := filepath.Join(root, "etc/s6-overlay/s6-rc.d")
+	expected := map[string]string{
+		"init-mod-configarr/type":                         "oneshot\n",
+		"init-mod-configarr/up":                           "/etc/s6-overlay/s6-rc.d/init-mod-configarr/run\n",
+		"init-mod-configarr/dependencies.d/init-mods":     "",
+		"init-mods-end/dependencies.d/init-mod-configarr": "",
+		"user/contents.d/init-mod-configarr":              "",
+	}
+	for path, content := range expected {
+		data, err := os.ReadFile(filepath.Join(services, path))
+		if err != nil {
+			t.Fatalf("Unexpected error reading %s: %v", path, err)
+		}
+		if string(data) != content {
+			t.Fatalf("Expected %s to contain %q, got %q", path, content, data)
+		}
+	}
+
+	run := filepath.Join(services, "init-mod-configarr/run")
+	data, err := os.ReadFile(run)
+	if err != nil {
+		t.Fatalf("Unexpected error reading run script: %v", err)
+	}
+	if !strings.HasSuffix(string(data), "exec /usr/local/bin/configarr --prefix CONFIGARR__ --only-keys 'Api*'\n") {
+		t.Fatalf("Unexpected run script: %q", data)
+	}
+	info, err := os.Stat(run)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Fatalf("Expected run script to be executable, got %v", info.Mode())
+	}
+
+	if strings.Count(output.String(), "\n") != 6 {
+		t.Fatalf("Expected 6 written files to be listed, got %q", output.String())
+	}
+}
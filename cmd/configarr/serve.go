@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"configarr"
+)
+
+// maxServeBody is the largest request body serve mode reads, so a client can't exhaust
+// the memory of the sidecar.
+const maxServeBody = 1 << 20
+
+// serveTarget is a configuration file exposed in serve mode with the token its requests
+// need.
+type serveTarget struct {
+	path  string
+	token string
+}
+
+// serve exposes the configuration files of the targets at /v1/targets/<app>/config
+// until configarr receives SIGINT or SIGTERM. Every target needs its own token, read from
+// the file of its --serve-token, so a client can only reach the apps it has a token for.
+func serve(flags Flags, opts []configarr.Option, logger *slog.Logger) error {
+	targets := make(map[string]serveTarget, len(flags.Targets))
+	for app, path := range flags.Targets {
+		tokenFile, exists := flags.ServeTokens[app]
+		if !exists {
+			return invalidInput(fmt.Errorf("no --serve-token for target %s", app))
+		}
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return fmt.Errorf("error reading token of %s: %w", app, err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return invalidInput(fmt.Errorf("token file %s of %s is empty", tokenFile, app))
+		}
+		targets[app] = serveTarget{path: path, token: token}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:              flags.Serve,
+		Handler:           newTargetHandler(targets, opts, logger),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdown)
+	}()
+
+	logger.Info(fmt.Sprintf("Serving %d targets on %s.", len(targets), flags.Serve))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// targetHandler serves the configuration files of the targets: GET returns the
+// properties as a JSON object with the values of secret properties masked, PATCH applies
+// the properties of a flat JSON object with the options of the run. Requests are
+// handled one at a time, so changes of different clients don't race.
+type targetHandler struct {
+	mu      sync.Mutex
+	targets map[string]serveTarget
+	opts    []configarr.Option
+	logger  *slog.Logger
+}
+
+// newTargetHandler returns the handler of serve mode for the targets.
+func newTargetHandler(targets map[string]serveTarget, opts []configarr.Option, logger *slog.Logger) http.Handler {
+	return &targetHandler{targets: targets, opts: opts, logger: logger}
+}
+
+// ServeHTTP handles requests to /v1/targets/<app>/config. Unknown targets and wrong
+// tokens get the same 404, so clients can't probe which apps exist.
+func (h *targetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app, found := strings.CutPrefix(r.URL.Path, "/v1/targets/")
+	if found {
+		app, found = strings.CutSuffix(app, "/config")
+	}
+	target, exists := h.targets[app]
+	if !found || !exists || !authorized(r, target.token) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, target)
+	case http.MethodPatch:
+		h.patch(w, r, app, target)
+	default:
+		w.Header().Set("Allow", "GET, PATCH")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// get responds with the properties of the target.
+func (h *targetHandler) get(w http.ResponseWriter, target serveTarget) {
+	config, err := configarr.ReadConfig(append(append([]configarr.Option{}, h.opts...), configarr.WithConfigPath(target.path))...)
+	if err != nil {
+		h.logger.Error(fmt.Sprintf("Error reading %s: %s", target.path, err))
+		writeJSONError(w, http.StatusInternalServerError, "error reading the configuration file")
+		return
+	}
+	properties := make(map[string]string, len(config.Properties))
+	for key, value := range config.Properties {
+		properties[key] = exportValue(key, value, false)
+	}
+	writeJSON(w, http.StatusOK, properties)
+}
+
+// patch applies the properties of the request body to the target and responds with the
+// keys that changed.
+func (h *targetHandler) patch(w http.ResponseWriter, r *http.Request, app string, target serveTarget) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxServeBody))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	overrides, err := configarr.ParseJSONOverrides(data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := append(append([]configarr.Option{}, h.opts...),
+		configarr.WithConfigPath(target.path),
+		configarr.WithSources(configarr.StaticSource(configarr.WithSourceLabel(overrides, "api:"+app)...)),
+	)
+	result, err := configarr.Run(r.Context(), opts...)
+	switch {
+	case errors.Is(err, configarr.ErrInvalid) || errors.Is(err, configarr.ErrParse):
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	case err != nil:
+		h.logger.Error(fmt.Sprintf("Error applying overrides to %s: %s", target.path, err))
+		writeJSONError(w, http.StatusInternalServerError, "error applying the properties")
+		return
+	}
+
+	changed := make([]string, 0, len(result.Changed))
+	for key := range result.Changed {
+		changed = append(changed, key)
+	}
+	sort.Strings(changed)
+	writeJSON(w, http.StatusOK, map[string][]string{"changed": changed})
+}
+
+// authorized reports whether the request carries the token as a bearer token, comparing
+// in constant time.
+func authorized(r *http.Request, token string) bool {
+	given, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// writeJSON writes the value as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// writeJSONError writes an error response with the message.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// TestTargetHandler tests reading and changing the configuration files of several
+// targets, each with its own token.
+func TestTargetHandler(t *testing.T) {
+	dir := t.TempDir()
+	targets := map[string]serveTarget{}
+	for app, content := range map[string]string{
+		"sonarr": "<Config>\n  <Port>8989</Port>\n  <ApiKey>0123456789abcdef</ApiKey>\n</Config>\n",
+		"radarr": "<Config>\n  <Port>7878</Port>\n</Config>\n",
+	} {
+		path := filepath.Join(dir, app+".xml")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		targets[app] = serveTarget{path: path, token: app + "-token"}
+	}
+	opts := []configarr.Option{configarr.WithCreateKeys(configarr.KeyOrderAppend)}
+	server := httptest.NewServer(newTargetHandler(targets, opts, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	defer server.Close()
+
+	request := func(t *testing.T, method, path, token, body string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		status, body := request(t, http.MethodGet, "/v1/targets/sonarr/config", "sonarr-token", "")
+		if status != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", status, body)
+		}
+		var properties map[string]string
+		if err := json.Unmarshal([]byte(body), &properties); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if properties["Port"] != "8989" || properties["ApiKey"] == "0123456789abcdef" {
+			t.Fatalf("Expected the properties with the API key masked, got %v", properties)
+		}
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		status, body := request(t, http.MethodPatch, "/v1/targets/radarr/config", "radarr-token", `{"Port": 7879, "LogLevel": "debug"}`)
+		if status != http.StatusOK || strings.TrimSpace(body) != `{"changed":["LogLevel","Port"]}` {
+			t.Fatalf("Expected the changed keys, got %d: %s", status, body)
+		}
+		if data, _ := os.ReadFile(targets["radarr"].path); !strings.Contains(string(data), "<Port>7879</Port>") {
+			t.Fatalf("Expected the file to be written, got:\n%s", data)
+		}
+
+		if status, _ := request(t, http.MethodPatch, "/v1/targets/radarr/config", "radarr-token", `["Port"]`); status != http.StatusBadRequest {
+			t.Fatalf("Expected status 400 for a body that isn't an object, got %d", status)
+		}
+	})
+
+	t.Run("Get through the filesystem and format", func(t *testing.T) {
+		codec, err := configarr.NewAESGCMCodec([]byte(strings.Repeat("k", 32)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		path := filepath.Join(dir, "bazarr.cfg")
+		encrypted, err := codec.Encode([]byte(`{"general": {"port": 6767}}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := os.WriteFile(path, encrypted, 0600); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		opts := []configarr.Option{configarr.WithFS(configarr.CodecFS(configarr.OSFS(), codec)), configarr.WithFormat(configarr.JSONFormat)}
+		handler := newTargetHandler(map[string]serveTarget{"bazarr": {path: path, token: "bazarr-token"}}, opts, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		req := httptest.NewRequest(http.MethodGet, "/v1/targets/bazarr/config", nil)
+		req.Header.Set("Authorization", "Bearer bazarr-token")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK || strings.TrimSpace(recorder.Body.String()) != `{"general.port":"6767"}` {
+			t.Fatalf("Expected the decrypted JSON properties, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+	})
+
+	t.Run("Refused", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			method, path, token string
+			expected            int
+		}{
+			"Token of another target": {http.MethodGet, "/v1/targets/radarr/config", "sonarr-token", http.StatusNotFound},
+			"Missing token":           {http.MethodGet, "/v1/targets/sonarr/config", "", http.StatusNotFound},
+			"Unknown target":          {http.MethodGet, "/v1/targets/lidarr/config", "sonarr-token", http.StatusNotFound},
+			"Other path":              {http.MethodGet, "/v1/targets/sonarr", "sonarr-token", http.StatusNotFound},
+			"Other method":            {http.MethodDelete, "/v1/targets/sonarr/config", "sonarr-token", http.StatusMethodNotAllowed},
+		} {
+			if status, _ := request(t, tt.method, tt.path, tt.token, ""); status != tt.expected {
+				t.Fatalf("Expected status %d for %s, got %d", tt.expected, strings.ToLower(name), status)
+			}
+		}
+	})
+}
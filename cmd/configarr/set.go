@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"configarr"
+)
+
+// runSet sets the properties given as <key>=<value> arguments, or with unset removes the
+// properties given as keys, taking the same flags as a plain run. Only the arguments are
+// applied: environment variables, documents and presets are not read.
+func runSet(environ []string, args []string, stdin io.Reader, output io.Writer, unset bool) (int, error) {
+	name := "set"
+	if unset {
+		name = "unset"
+	}
+	flags, err := parseFlags(args)
+	if err != nil {
+		return exitInvalid, err
+	}
+	if len(flags.Command) == 0 {
+		if unset {
+			return exitInvalid, errors.New("expected the properties to remove, e.g. configarr unset UrlBase")
+		}
+		return exitInvalid, errors.New("expected the properties to set, e.g. configarr set LogLevel=debug")
+	}
+	if flags.DesiredState != "" || len(flags.ConfigFiles) > 1 || len(flags.PrefixTargets) > 0 {
+		return exitInvalid, fmt.Errorf("configarr %s can't be combined with --desired-state, several configuration files or --target", name)
+	}
+
+	if unset {
+		flags.overrides = make([]configarr.Override, 0, len(flags.Command))
+		for _, key := range flags.Command {
+			flags.overrides = append(flags.overrides, configarr.Override{Key: key, Delete: true, Source: "arg:unset"})
+		}
+	} else if flags.overrides, err = parseKeyValues(flags.Command, flags.Delimiter, "arg:set"); err != nil {
+		return exitInvalid, err
+	}
+	flags.Command = nil
+	return applyFlags(environ, flags, stdin, output)
+}
+
+// runDiff prints the changes the overrides would make as a unified diff, like a plain run
+// with --dry-run.
+func runDiff(environ []string, args []string, stdin io.Reader, output io.Writer) (int, error) {
+	flags, err := parseFlags(append([]string{"--dry-run"}, args...))
+	if err != nil {
+		return exitInvalid, err
+	}
+	return applyFlags(environ, flags, stdin, output)
+}
+
+// runValidate checks that the configuration file can be read and the overrides pass
+// validation, as a dry run that refuses values exceeding the limits regardless of
+// --validation-mode and prints no diff. Nothing is written.
+func runValidate(environ []string, args []string, stdin io.Reader, output io.Writer) error {
+	flags, err := parseFlags(append([]string{"--dry-run"}, args...))
+	if err != nil {
+		return invalidInput(err)
+	}
+	flags.ValidationMode = configarr.ValidationModeError
+	flags.validateOnly = true
+	if _, err := apply(environ, flags, stdin, output); err != nil {
+		return err
+	}
+	fmt.Fprintln(output, "Configuration is valid.")
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunSet tests the set, unset, apply, diff and validate subcommands.
+func TestRunSet(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.xml")
+	writeConfig := func(t *testing.T) {
+		if err := os.WriteFile(configFile, []byte("<Config>\n  <Port>8989</Port>\n  <UrlBase>/sonarr</UrlBase>\n</Config>\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+	}
+	env := []string{"CONFIGARR__PORT=Port=9000"}
+	runCommand := func(t *testing.T, args ...string) (int, string, error) {
+		var output strings.Builder
+		code, err := run(env, append([]string{"configarr"}, append(args, "--config", configFile, "--state-file", "")...), nil, &output)
+		return code, output.String(), err
+	}
+	readConfig := func(t *testing.T) string {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			t.Fatalf("Unexpected error reading file: %v", err)
+		}
+		return string(data)
+	}
+
+	t.Run("Set", func(t *testing.T) {
+		writeConfig(t)
+		code, _, err := runCommand(t, "set", "Port=8990", "UrlBase=/tv")
+		if err != nil || code != exitOK {
+			t.Fatalf("Unexpected error: %v (exit code %d)", err, code)
+		}
+		if expected := "<Config>\n  <Port>8990</Port>\n  <UrlBase>/tv</UrlBase>\n</Config>\n"; readConfig(t) != expected {
+			t.Fatalf("Expected only the arguments to be applied, got:\n%s", readConfig(t))
+		}
+
+		if code, _, err := runCommand(t, "set", "Port"); err == nil || code != exitInvalid {
+			t.Fatalf("Expected error for a property without a value, got: %v (exit code %d)", err, code)
+		}
+		if code, _, err := runCommand(t, "set"); err == nil || code != exitInvalid {
+			t.Fatalf("Expected error without properties, got: %v (exit code %d)", err, code)
+		}
+	})
+
+	t.Run("Unset", func(t *testing.T) {
+		writeConfig(t)
+		if _, _, err := runCommand(t, "unset", "UrlBase"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := "<Config>\n  <Port>8989</Port>\n</Config>\n"; readConfig(t) != expected {
+			t.Fatalf("Expected UrlBase to be removed, got:\n%s", readConfig(t))
+		}
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		writeConfig(t)
+		if _, _, err := runCommand(t, "apply"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(readConfig(t), "<Port>9000</Port>") {
+			t.Fatalf("Expected the environment to be applied, got:\n%s", readConfig(t))
+		}
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+		writeConfig(t)
+		code, output, err := runCommand(t, "diff")
+		if err != nil || code != exitOK {
+			t.Fatalf("Unexpected error: %v (exit code %d)", err, code)
+		}
+		if !strings.Contains(output, "+  <Port>9000</Port>") || strings.Contains(readConfig(t), "9000") {
+			t.Fatalf("Expected a diff without writing, got:\n%s", output)
+		}
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		writeConfig(t)
+		code, output, err := runCommand(t, "validate")
+		if err != nil || code != exitOK {
+			t.Fatalf("Unexpected error: %v (exit code %d)", err, code)
+		}
+		if strings.Contains(output, "<Port>") || !strings.Contains(output, "Configuration is valid.") || strings.Contains(readConfig(t), "9000") {
+			t.Fatalf("Expected no diff and nothing written, got:\n%s", output)
+		}
+
+		if code, _, err := runCommand(t, "validate", "--max-value-size", "2", "--validation-mode", "warn"); err == nil || code != exitInvalid {
+			t.Fatalf("Expected error for a value exceeding the limit, got: %v (exit code %d)", err, code)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+
+	"configarr"
+)
+
+// SnapshotFlags represents the command-line flags of the snapshot subcommand.
+type SnapshotFlags struct {
+	ArrURL     string // Base URL of the running app
+	APIKey     string // API key of the app; empty uses the one of ConfigFile
+	ConfigFile string // Configuration file the API key is read from
+	Output     string // Values file to write, - for stdout
+	SecretsDir string // Directory the values of secret properties are written to; empty leaves them out
+	All        bool   // Include the settings the catalog doesn't know
+}
+
+// parseSnapshotFlags parses the flags of the snapshot subcommand.
+func parseSnapshotFlags(flags []string) (SnapshotFlags, error) {
+	flagSet := pflag.NewFlagSet("snapshot", pflag.ContinueOnError)
+
+	arrURL := flagSet.String("arr-url", "", "URL of the running app to capture the host settings of, e.g. http://localhost:8989")
+	apiKey := flagSet.String("api-key", "", "API key of the running app (default: the ApiKey of --config)")
+	configFile := flagSet.String("config", configarr.DefaultConfigPath, "Configuration file the API key is read from without --api-key")
+	outputFile := flagSet.StringP("output", "o", "-", "Values file to write (- for stdout)")
+	secretsDir := flagSet.String("secrets-dir", "", "Write the values of secret properties as files to this directory, for --secrets-dir, instead of leaving them out")
+	all := flagSet.Bool("all", false, "Include the settings the key catalog doesn't know")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return SnapshotFlags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+	if *arrURL == "" {
+		return SnapshotFlags{}, errors.New("missing --arr-url of the app to capture")
+	}
+
+	return SnapshotFlags{
+		ArrURL:     *arrURL,
+		APIKey:     *apiKey,
+		ConfigFile: *configFile,
+		Output:     *outputFile,
+		SecretsDir: *secretsDir,
+		All:        *all,
+	}, nil
+}
+
+// runSnapshot captures the host settings of a running app as a values file for
+// --from-yaml, so instances configured by hand can move to declarative management.
+func runSnapshot(args []string, output io.Writer) error {
+	flags, err := parseSnapshotFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+	return snapshot(context.Background(), flags, output, nil)
+}
+
+// snapshot writes the values file of the app at flags.ArrURL, reading its settings with
+// the client. Secret properties are only referenced in comments; their values go to
+// flags.SecretsDir, if any, so the values file can be committed.
+func snapshot(ctx context.Context, flags SnapshotFlags, output io.Writer, client *http.Client) error {
+	apiKey := flags.APIKey
+	if apiKey == "" {
+		config, err := configarr.ReadConfigFile(flags.ConfigFile)
+		if err != nil {
+			return invalidInput(fmt.Errorf("missing --api-key: error reading %s: %w", flags.ConfigFile, err))
+		}
+		if apiKey = config.Properties["ApiKey"]; apiKey == "" {
+			return invalidInput(fmt.Errorf("missing --api-key: %s has no ApiKey", flags.ConfigFile))
+		}
+	}
+
+	running, err := configarr.FetchHostConfig(ctx, flags.ArrURL, apiKey, client)
+	if err != nil {
+		return err
+	}
+	catalog, err := configarr.LoadCatalog("", "")
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(running))
+	for key := range running {
+		if flags.All || catalog.IsKnownKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var values strings.Builder
+	fmt.Fprintf(&values, "# Host settings of %s, captured with configarr snapshot.\n", flags.ArrURL)
+	if flags.SecretsDir != "" {
+		if err := os.MkdirAll(flags.SecretsDir, 0700); err != nil {
+			return fmt.Errorf("error creating secrets directory: %w", err)
+		}
+	}
+	for _, key := range keys {
+		value := running[key]
+		if !configarr.IsSecretKey(key) {
+			fmt.Fprintf(&values, "%s: %s\n", key, yamlScalar(value))
+			continue
+		}
+		if flags.SecretsDir == "" || value == "" {
+			fmt.Fprintf(&values, "# %s: secret, left out; set it with an environment variable or --secrets-dir\n", key)
+			continue
+		}
+		secret := filepath.Join(flags.SecretsDir, key)
+		if err := os.WriteFile(secret, []byte(value), 0600); err != nil {
+			return fmt.Errorf("error writing secret %s: %w", secret, err)
+		}
+		fmt.Fprintf(&values, "# %s: secret, read from %s with --secrets-dir %s\n", key, secret, flags.SecretsDir)
+	}
+
+	if flags.Output == "-" {
+		if _, err := io.WriteString(output, values.String()); err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(flags.Output, []byte(values.String()), 0644); err != nil {
+		return fmt.Errorf("error writing values file %s: %w", flags.Output, err)
+	}
+	fmt.Fprintf(output, "Captured %d settings of %s to %s\n", len(keys), flags.ArrURL, flags.Output)
+	return nil
+}
+
+// yamlScalar returns the value as a YAML scalar, quoted when it would otherwise be read
+// differently, e.g. an empty string.
+func yamlScalar(value string) string {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", value)
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
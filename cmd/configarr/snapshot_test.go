@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// TestSnapshot tests capturing the host settings of a running app as a values file with
+// the secrets left out of it.
+func TestSnapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "0123456789abcdef" || r.URL.Path != "/api/v3/config/host" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": 1, "port": 8990, "apiKey": "0123456789abcdef", "urlBase": "", "launchBrowser": true, "logLevel": "debug"}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	flags := SnapshotFlags{ArrURL: server.URL, APIKey: "0123456789abcdef", Output: filepath.Join(dir, "sonarr.values.yaml"), SecretsDir: filepath.Join(dir, "secrets")}
+	var output strings.Builder
+	if err := snapshot(context.Background(), flags, &output, server.Client()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(flags.Output)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "# Host settings of " + server.URL + ", captured with configarr snapshot.\n" +
+		"# ApiKey: secret, read from " + filepath.Join(flags.SecretsDir, "ApiKey") + " with --secrets-dir " + flags.SecretsDir + "\n" +
+		"LaunchBrowser: \"True\"\n" +
+		"LogLevel: debug\n" +
+		"Port: \"8990\"\n" +
+		"UrlBase: \"\"\n"
+	if string(data) != expected {
+		t.Fatalf("Expected values file:\n%s\ngot:\n%s", expected, data)
+	}
+	if secret, err := os.ReadFile(filepath.Join(flags.SecretsDir, "ApiKey")); err != nil || string(secret) != "0123456789abcdef" {
+		t.Fatalf("Expected the API key in the secrets directory, got %q (%v)", secret, err)
+	}
+
+	overrides, err := configarr.ParseYAMLOverrides(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(overrides) != 4 || overrides[0].Key != "LaunchBrowser" || overrides[0].Value != "True" || overrides[3].Value != "" {
+		t.Fatalf("Expected the values file to be read back, got %+v", overrides)
+	}
+
+	t.Run("Secrets left out", func(t *testing.T) {
+		flags := SnapshotFlags{ArrURL: server.URL, APIKey: "0123456789abcdef", Output: "-", All: true}
+		var output strings.Builder
+		if err := snapshot(context.Background(), flags, &output, server.Client()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(output.String(), "0123456789abcdef") || !strings.Contains(output.String(), "# ApiKey: secret, left out") || !strings.Contains(output.String(), "Id: \"1\"") {
+			t.Fatalf("Expected all settings without the API key, got:\n%s", output.String())
+		}
+	})
+
+	t.Run("Missing API key", func(t *testing.T) {
+		flags := SnapshotFlags{ArrURL: server.URL, ConfigFile: filepath.Join(dir, "missing.xml"), Output: "-"}
+		if err := snapshot(context.Background(), flags, &strings.Builder{}, server.Client()); err == nil || !strings.Contains(err.Error(), "--api-key") {
+			t.Fatalf("Expected error on a missing API key, got: %v", err)
+		}
+	})
+}
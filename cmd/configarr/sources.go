@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"configarr"
+)
+
+// Defaults and naming conventions of --secrets-dir.
+const (
+	defaultSecretsDir    = "/run/secrets"
+	secretKeyPlaceholder = "{key}"
+	secretsCaseExact     = "exact"
+	secretsCasePascal    = "pascal"
+)
+
+// readDocuments reads the overrides from the secrets directory, the Downward API volume,
+// the JSON and YAML documents, the key=value lines on stdin and the output of the source
+// commands given by the flags, in that order of precedence from lowest to highest.
+func readDocuments(flags Flags, stdin io.Reader) ([]configarr.Override, error) {
+	stdinReaders := 0
+	for _, readsStdin := range []bool{flags.FromJSON == "-", flags.FromYAML == "-", flags.StdinKV} {
+		if readsStdin {
+			stdinReaders++
+		}
+	}
+	if stdinReaders > 1 {
+		return nil, errors.New("only one of --from-json, --from-yaml and --stdin-kv can read from stdin")
+	}
+
+	var overrides []configarr.Override
+	if flags.SecretsDir != "" {
+		secretOverrides, err := readSecretsDir(flags.SecretsDir, flags.SecretsPattern, flags.SecretsCase)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, secretOverrides...)
+	}
+
+	if flags.DownwardDir != "" {
+		downwardOverrides, err := readDownwardDir(flags.DownwardDir)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, downwardOverrides...)
+	}
+
+	if flags.FromJSON != "" {
+		data, err := readDocument(flags.FromJSON, stdin)
+		if err != nil {
+			return nil, err
+		}
+		jsonOverrides, err := configarr.ParseJSONOverrides(data)
+		if err != nil {
+			return nil, parseFailure(fmt.Errorf("error parsing JSON overrides from %s: %w", flags.FromJSON, err))
+		}
+		overrides = append(overrides, configarr.WithSourceLabel(jsonOverrides, documentLabel("json", flags.FromJSON))...)
+	}
+
+	if flags.FromYAML != "" {
+		data, err := readDocument(flags.FromYAML, stdin)
+		if err != nil {
+			return nil, err
+		}
+		yamlOverrides, err := configarr.ParseYAMLOverrides(data)
+		if err != nil {
+			return nil, parseFailure(fmt.Errorf("error parsing YAML overrides from %s: %w", flags.FromYAML, err))
+		}
+		overrides = append(overrides, configarr.WithSourceLabel(yamlOverrides, documentLabel("yaml", flags.FromYAML))...)
+	}
+
+	if flags.StdinKV {
+		data, err := readDocument("-", stdin)
+		if err != nil {
+			return nil, err
+		}
+		kvOverrides, err := configarr.ParseKVOverrides(data)
+		if err != nil {
+			return nil, parseFailure(fmt.Errorf("error parsing key=value overrides from stdin: %w", err))
+		}
+		overrides = append(overrides, configarr.WithSourceLabel(kvOverrides, documentLabel("kv", "-"))...)
+	}
+
+	for _, command := range flags.SourceCommands {
+		commandOverrides, err := readSourceCommand(command)
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, configarr.WithSourceLabel(commandOverrides, "cmd:"+command)...)
+	}
+
+	return overrides, nil
+}
+
+// readSourceCommand runs the command and parses its stdout as a flat JSON object when it
+// starts with '{', or as KEY=VALUE lines otherwise.
+func readSourceCommand(command string) ([]configarr.Override, error) {
+	fields, err := splitCommand(command)
+	if err != nil {
+		return nil, invalidInput(fmt.Errorf("invalid --source-cmd: %w", err))
+	}
+	if len(fields) == 0 {
+		return nil, invalidInput(errors.New("empty --source-cmd"))
+	}
+	output, err := pipe(context.Background(), fields, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading overrides from command: %w", err)
+	}
+
+	var overrides []configarr.Override
+	if bytes.HasPrefix(bytes.TrimSpace(output), []byte("{")) {
+		overrides, err = configarr.ParseJSONOverrides(output)
+	} else {
+		overrides, err = configarr.ParseKVOverrides(output)
+	}
+	if err != nil {
+		return nil, parseFailure(fmt.Errorf("error parsing overrides from output of %s: %w", fields[0], err))
+	}
+	return overrides, nil
+}
+
+// readDownwardDir reads the overrides from the files of a Kubernetes Downward API volume,
+// e.g. /etc/podinfo/annotations. The hidden ..data directories the kubelet uses for
+// atomic updates are skipped.
+func readDownwardDir(dir string) ([]configarr.Override, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Downward API volume %s: %w", dir, err)
+	}
+
+	var overrides []configarr.Override
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() { // Files are symlinks into ..data
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %w", file, err)
+		}
+		fileOverrides, err := configarr.ParseDownwardOverrides(data)
+		if err != nil {
+			return nil, parseFailure(fmt.Errorf("error parsing Downward API file %s: %w", file, err))
+		}
+		overrides = append(overrides, configarr.WithSourceLabel(fileOverrides, "downward:"+file)...)
+	}
+	return overrides, nil
+}
+
+// readSecretsDir reads an override from each file in a secrets directory, e.g. the
+// /run/secrets of Docker Swarm or a Kubernetes CSI mount, with the key taken from the
+// file name, see secretKey, and the content without a trailing newline as the value.
+// Hidden files, such as the ..data directories of Kubernetes volumes, and files not
+// matching the pattern are skipped.
+func readSecretsDir(dir, pattern, keyCase string) ([]configarr.Override, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading secrets directory %s: %w", dir, err)
+	}
+
+	var overrides []configarr.Override
+	for _, entry := range entries {
+		key, matched := secretKey(entry.Name(), pattern, keyCase)
+		if !matched || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() { // Files may be symlinks into ..data
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading secret %s: %w", file, err)
+		}
+		value := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+		overrides = append(overrides, configarr.Override{Key: key, Value: value, Source: "secret:" + file})
+	}
+	return overrides, nil
+}
+
+// secretKey returns the key of a secret file named after the pattern, e.g. ApiKey for
+// sonarr_api_key with the pattern sonarr_{key} and pascal case, and whether the name
+// matches the pattern.
+func secretKey(name, pattern, keyCase string) (string, bool) {
+	before, after, _ := strings.Cut(pattern, secretKeyPlaceholder)
+	if len(name) <= len(before)+len(after) || !strings.HasPrefix(name, before) || !strings.HasSuffix(name, after) {
+		return "", false
+	}
+	key := name[len(before) : len(name)-len(after)]
+	if keyCase != secretsCasePascal {
+		return key, true
+	}
+
+	var pascal strings.Builder
+	for _, word := range strings.FieldsFunc(key, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		pascal.WriteString(strings.ToUpper(word[:1]) + strings.ToLower(word[1:]))
+	}
+	return pascal.String(), pascal.Len() > 0
+}
+
+// parseKeyValues parses <key><delimiter><value> pairs given on the command line into
+// overrides from the source.
+func parseKeyValues(pairs []string, delimiter, source string) ([]configarr.Override, error) {
+	overrides := make([]configarr.Override, 0, len(pairs))
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, delimiter)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid property %q: expected <key>%s<value>", pair, delimiter)
+		}
+		overrides = append(overrides, configarr.Override{Key: key, Value: value, Source: source})
+	}
+	return overrides, nil
+}
+
+// documentLabel names the source of overrides read from a document, e.g. "json:values.json".
+func documentLabel(format, path string) string {
+	if path == "-" {
+		path = "stdin"
+	}
+	return format + ":" + path
+}
+
+// readDocument reads the file at path, or stdin when path is "-".
+func readDocument(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		if stdin == nil {
+			return nil, errors.New("no stdin available")
+		}
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading stdin: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file %s: %w", path, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// TestReadDocuments tests reading override documents from files and stdin.
+func TestReadDocuments(t *testing.T) {
+	t.Run("JSON from stdin and YAML from file", func(t *testing.T) {
+		yamlFile := filepath.Join(t.TempDir(), "values.yaml")
+		if err := os.WriteFile(yamlFile, []byte("Port: 8990\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		flags := Flags{FromJSON: "-", FromYAML: yamlFile}
+		overrides, err := readDocuments(flags, strings.NewReader(`{"LogLevel":"debug"}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []configarr.Override{
+			{Key: "LogLevel", Value: "debug", Source: "json:stdin"},
+			{Key: "Port", Value: "8990", Source: "yaml:" + yamlFile},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+	})
+
+	t.Run("Key=value lines from stdin", func(t *testing.T) {
+		overrides, err := readDocuments(Flags{StdinKV: true}, strings.NewReader("LogLevel=debug\nPort=8990\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []configarr.Override{
+			{Key: "LogLevel", Value: "debug", Source: "kv:stdin"},
+			{Key: "Port", Value: "8990", Source: "kv:stdin"},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+	})
+
+	t.Run("Downward API volume", func(t *testing.T) {
+		dir := t.TempDir()
+		data := filepath.Join(dir, "..data")
+		if err := os.Mkdir(data, 0755); err != nil {
+			t.Fatalf("Unexpected error creating directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(data, "annotations"), []byte("configarr.io/LogLevel=\"debug\"\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		if err := os.Symlink(filepath.Join("..data", "annotations"), filepath.Join(dir, "annotations")); err != nil {
+			t.Fatalf("Unexpected error creating symlink: %v", err)
+		}
+
+		overrides, err := readDocuments(Flags{DownwardDir: dir, StdinKV: true}, strings.NewReader("Port=8990\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []configarr.Override{
+			{Key: "LogLevel", Value: "debug", Source: "downward:" + filepath.Join(dir, "annotations")},
+			{Key: "Port", Value: "8990", Source: "kv:stdin"},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+	})
+
+	t.Run("Secrets directory", func(t *testing.T) {
+		dir := t.TempDir()
+		files := map[string]string{"sonarr_api_key": "0123456789abcdef\n", "sonarr_url_base": "/sonarr", "radarr_api_key": "fedcba9876543210", ".hidden": "x"}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				t.Fatalf("Unexpected error writing file: %v", err)
+			}
+		}
+
+		flags := Flags{SecretsDir: dir, SecretsPattern: "sonarr_{key}", SecretsCase: secretsCasePascal, StdinKV: true}
+		overrides, err := readDocuments(flags, strings.NewReader("UrlBase=/tv\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []configarr.Override{
+			{Key: "ApiKey", Value: "0123456789abcdef", Source: "secret:" + filepath.Join(dir, "sonarr_api_key")},
+			{Key: "UrlBase", Value: "/sonarr", Source: "secret:" + filepath.Join(dir, "sonarr_url_base")},
+			{Key: "UrlBase", Value: "/tv", Source: "kv:stdin"},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+
+		if _, err := readDocuments(Flags{SecretsDir: filepath.Join(dir, "missing"), SecretsPattern: secretKeyPlaceholder}, nil); err == nil {
+			t.Fatal("Expected error for a missing secrets directory, but got none")
+		}
+	})
+
+	t.Run("Command output", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("echo is a shell builtin on Windows")
+		}
+		flags := Flags{SourceCommands: []string{"echo LogLevel=debug", `echo '{"Port":8990}'`, `echo "Theme=dark  blue"`}}
+		overrides, err := readDocuments(flags, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []configarr.Override{
+			{Key: "LogLevel", Value: "debug", Source: "cmd:echo LogLevel=debug"},
+			{Key: "Port", Value: "8990", Source: `cmd:echo '{"Port":8990}'`},
+			{Key: "Theme", Value: "dark  blue", Source: `cmd:echo "Theme=dark  blue"`},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+
+		if _, err := readDocuments(Flags{SourceCommands: []string{"false"}}, nil); err == nil {
+			t.Fatal("Expected error for failing command, but got none")
+		}
+		if _, err := readDocuments(Flags{SourceCommands: []string{"echo 'LogLevel=debug"}}, nil); err == nil {
+			t.Fatal("Expected error for an unterminated quote, but got none")
+		}
+	})
+
+	t.Run("Multiple readers of stdin", func(t *testing.T) {
+		if _, err := readDocuments(Flags{FromJSON: "-", FromYAML: "-"}, strings.NewReader("")); err == nil {
+			t.Fatal("Expected error when both documents read stdin, but got none")
+		}
+
+		if _, err := readDocuments(Flags{FromYAML: "-", StdinKV: true}, strings.NewReader("")); err == nil {
+			t.Fatal("Expected error when YAML and key=value lines read stdin, but got none")
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		if _, err := readDocuments(Flags{FromJSON: "nonexistent.json"}, nil); err == nil {
+			t.Fatal("Expected error for missing file, but got none")
+		}
+	})
+}
+
+// TestSecretKey tests deriving keys from the names of secret files.
+func TestSecretKey(t *testing.T) {
+	tests := []struct {
+		name, pattern, keyCase string
+		key                    string
+		matched                bool
+	}{
+		{"ApiKey", secretKeyPlaceholder, secretsCaseExact, "ApiKey", true},
+		{"api_key", secretKeyPlaceholder, secretsCasePascal, "ApiKey", true},
+		{"SSL-CERT-PATH", secretKeyPlaceholder, secretsCasePascal, "SslCertPath", true},
+		{"sonarr_LogLevel.txt", "sonarr_{key}.txt", secretsCaseExact, "LogLevel", true},
+		{"radarr_LogLevel", "sonarr_{key}", secretsCaseExact, "", false},
+		{"sonarr_", "sonarr_{key}", secretsCaseExact, "", false},
+		{"sonarr___", "sonarr_{key}", secretsCasePascal, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, matched := secretKey(tt.name, tt.pattern, tt.keyCase)
+			if key != tt.key || matched != tt.matched {
+				t.Fatalf("Expected %q, %v, got %q, %v", tt.key, tt.matched, key, matched)
+			}
+		})
+	}
+}
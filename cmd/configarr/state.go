@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"configarr"
+)
+
+// runDesiredState applies the properties of every app in the desired state file to the
+// configuration file of its target and reports whether any property changed. Apps are
+// processed in the order of the file; a target timing out doesn't stop the others, but
+// fails the run after all of them were processed, see runTarget. Apps that would listen
+// on the same port are refused before anything is written, or only logged in
+// ValidationModeWarn.
+func runDesiredState(ctx context.Context, flags Flags, stdin io.Reader, output io.Writer, opts []configarr.Option, logger *slog.Logger) (bool, error) {
+	data, err := readDocument(flags.DesiredState, stdin)
+	if err != nil {
+		return false, err
+	}
+
+	states, err := configarr.ParseDesiredState(data)
+	if err != nil {
+		return false, parseFailure(fmt.Errorf("error parsing desired state from %s: %w", flags.DesiredState, err))
+	}
+
+	for _, state := range states {
+		if _, exists := flags.Targets[state.App]; !exists {
+			return false, invalidInput(fmt.Errorf("no --target for app %s in the desired state", state.App))
+		}
+	}
+
+	portTargets := make([]portTarget, 0, len(states))
+	for _, state := range states {
+		portTargets = append(portTargets, portTarget{name: state.App, path: flags.Targets[state.App], sources: []configarr.Source{configarr.StaticSource(state.Overrides...)}})
+	}
+	conflicts, err := checkPortConflicts(ctx, portTargets, opts)
+	if err != nil {
+		return false, err
+	}
+	if err := reportPortConflicts(flags, conflicts, logger); err != nil {
+		return false, err
+	}
+
+	changed := false
+	var timeouts []error
+	progress := newProgressReporter(flags.Progress, len(states))
+
+	for _, state := range states {
+		progress.Next(fmt.Sprintf("%s: %s", state.App, flags.Targets[state.App]))
+		presetOverrides, err := expandPresets(flags.Presets, state.App)
+		if err != nil {
+			return false, invalidInput(err)
+		}
+		overrides := configarr.WithSourceLabel(state.Overrides, documentLabel("state", flags.DesiredState))
+		appOpts := append(append([]configarr.Option{}, opts...),
+			configarr.WithConfigPath(flags.Targets[state.App]),
+			configarr.WithSources(configarr.StaticSource(presetOverrides...), configarr.StaticSource(overrides...)),
+		)
+		result, err := runTarget(ctx, flags.TargetTimeout, appOpts)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			timeouts = append(timeouts, fmt.Errorf("%s: %w", state.App, err))
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", state.App, err)
+		}
+		if flags.DryRun && !flags.validateOnly {
+			printDiff(output, result)
+		}
+		changed = changed || len(result.Changed) > 0
+	}
+	progress.Done()
+	return changed, errors.Join(timeouts...)
+}
+
+// reportPortConflicts fails with the port conflicts, or only logs them in
+// ValidationModeWarn.
+func reportPortConflicts(flags Flags, conflicts []error, logger *slog.Logger) error {
+	if len(conflicts) > 0 && flags.ValidationMode != configarr.ValidationModeWarn {
+		return invalidInput(errors.Join(conflicts...))
+	}
+	for _, conflict := range conflicts {
+		logger.Warn(fmt.Sprintf("Validation failed: %s", conflict))
+	}
+	return nil
+}
+
+// runTarget runs configarr for a single target of a run over several of them, within
+// its own timeout unless it is zero. A run still blocked when the timeout expires, e.g.
+// reading from a hung NFS mount, is abandoned, so the next target can start; since the
+// run checks its context before writing, it won't write the file once it unblocks.
+func runTarget(ctx context.Context, timeout time.Duration, opts []configarr.Option) (configarr.Result, error) {
+	if timeout <= 0 {
+		return configarr.Run(ctx, opts...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type outcome struct {
+		result configarr.Result
+		err    error
+	}
+	done := make(chan outcome, 1) // Buffered, so an abandoned run can still finish
+	go func() {
+		result, err := configarr.Run(ctx, opts...)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		if errors.Is(o.err, context.DeadlineExceeded) {
+			return o.result, fmt.Errorf("timed out after %s: %w", timeout, o.err)
+		}
+		return o.result, o.err
+	case <-ctx.Done():
+		return configarr.Result{}, fmt.Errorf("timed out after %s: %w", timeout, ctx.Err())
+	}
+}
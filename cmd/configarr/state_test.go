@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunDesiredState tests applying a desired state file to several app targets.
+func TestRunDesiredState(t *testing.T) {
+	dir := t.TempDir()
+	sonarr := filepath.Join(dir, "sonarr.xml")
+	radarr := filepath.Join(dir, "radarr.xml")
+	for _, file := range []string{sonarr, radarr} {
+		if err := os.WriteFile(file, []byte("<Config><LogLevel>info</LogLevel><UrlBase></UrlBase></Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+	}
+	state := "sonarr: {LogLevel: debug, UrlBase: /sonarr}\nradarr: {UrlBase: /radarr}\n"
+
+	t.Run("Apply to targets", func(t *testing.T) {
+		var output strings.Builder
+		args := []string{"configarr", "--desired-state", "-", "--target", "sonarr=" + sonarr, "--target", "radarr=" + radarr}
+		if _, err := run(nil, args, strings.NewReader(state), &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		for file, expected := range map[string][]string{
+			sonarr: {"<LogLevel>debug</LogLevel>", "<UrlBase>/sonarr</UrlBase>"},
+			radarr: {"<LogLevel>info</LogLevel>", "<UrlBase>/radarr</UrlBase>"},
+		} {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Unexpected error reading file: %v", err)
+			}
+			for _, element := range expected {
+				if !strings.Contains(string(data), element) {
+					t.Fatalf("Expected %s to contain %s, got %s", file, element, data)
+				}
+			}
+		}
+	})
+
+	t.Run("Port conflict", func(t *testing.T) {
+		sonarr := filepath.Join(dir, "sonarr-ports.xml")
+		radarr := filepath.Join(dir, "radarr-ports.xml")
+		for file, port := range map[string]string{sonarr: "8989", radarr: "7878"} {
+			if err := os.WriteFile(file, []byte("<Config><Port>"+port+"</Port><SslPort>9898</SslPort></Config>"), 0644); err != nil {
+				t.Fatalf("Unexpected error writing file: %v", err)
+			}
+		}
+		conflicting := "sonarr: {LogLevel: debug}\nradarr: {Port: 8989}\n"
+		args := []string{"configarr", "--desired-state", "-", "--target", "sonarr=" + sonarr, "--target", "radarr=" + radarr}
+		var output strings.Builder
+		code, err := run(nil, args, strings.NewReader(conflicting), &output)
+		if err == nil || code != exitInvalid || !strings.Contains(err.Error(), "port 8989 is configured for sonarr (Port) and radarr (Port)") {
+			t.Fatalf("Expected error for a port conflict, got: %v (exit code %d)", err, code)
+		}
+		if data, _ := os.ReadFile(radarr); strings.Contains(string(data), "8989") {
+			t.Fatalf("Expected nothing to be written, got %s", data)
+		}
+
+		output.Reset()
+		if _, err := run(nil, append(args, "--validation-mode", "warn"), strings.NewReader(conflicting), &output); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output.String(), "Validation failed: port 8989") {
+			t.Fatalf("Expected a warning for the port conflict, got:\n%s", output.String())
+		}
+	})
+
+	t.Run("Missing target", func(t *testing.T) {
+		var output strings.Builder
+		args := []string{"configarr", "--desired-state", "-", "--target", "sonarr=" + sonarr}
+		if _, err := run(nil, args, strings.NewReader(state), &output); err == nil {
+			t.Fatal("Expected error for app without target, but got none")
+		}
+	})
+}
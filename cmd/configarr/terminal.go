@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI escape sequences of the colored output.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// isTerminal reports whether the writer is a terminal, as opposed to a file, a pipe or
+// the log collector of a container runtime.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorEnabled reports whether output to the writer is colored. A non-empty NO_COLOR
+// disables colors and a FORCE_COLOR other than 0 or false enables them, see
+// https://no-color.org and https://force-color.org; otherwise only terminals other than
+// TERM=dumb get colors, so cron mails, CI and docker logs stay free of escape sequences.
+func colorEnabled(w io.Writer, getenv func(string) string) bool {
+	if getenv("NO_COLOR") != "" {
+		return false
+	}
+	switch force := strings.ToLower(getenv("FORCE_COLOR")); force {
+	case "":
+	case "0", "false":
+		return false
+	default:
+		return true
+	}
+	return getenv("TERM") != "dumb" && isTerminal(w)
+}
+
+// colorizeDiff colors the lines of a unified diff: file headers bold, hunk headers cyan,
+// removed lines red and added lines green.
+func colorizeDiff(diff string) string {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		text, newline := strings.CutSuffix(line, "\n")
+		color := ""
+		switch {
+		case strings.HasPrefix(text, "--- ") || strings.HasPrefix(text, "+++ "):
+			color = ansiBold
+		case strings.HasPrefix(text, "@@"):
+			color = ansiCyan
+		case strings.HasPrefix(text, "-"):
+			color = ansiRed
+		case strings.HasPrefix(text, "+"):
+			color = ansiGreen
+		}
+		if color != "" {
+			text = color + text + ansiReset
+		}
+		out.WriteString(text)
+		if newline {
+			out.WriteByte('\n')
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestColorEnabled tests the NO_COLOR, FORCE_COLOR and TERM variables and the terminal detection.
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected bool
+	}{
+		{"No terminal", nil, false},
+		{"Forced", map[string]string{"FORCE_COLOR": "1"}, true},
+		{"Forced off", map[string]string{"FORCE_COLOR": "false"}, false},
+		{"NO_COLOR wins", map[string]string{"NO_COLOR": "1", "FORCE_COLOR": "1"}, false},
+		{"Empty NO_COLOR is ignored", map[string]string{"NO_COLOR": "", "FORCE_COLOR": "true"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(name string) string { return tt.env[name] }
+			if enabled := colorEnabled(&bytes.Buffer{}, getenv); enabled != tt.expected {
+				t.Fatalf("Expected color enabled %t, got %t", tt.expected, enabled)
+			}
+		})
+	}
+}
+
+// TestColorizeDiff tests coloring the lines of a unified diff.
+func TestColorizeDiff(t *testing.T) {
+	diff := "--- a/config.xml\n+++ b/config.xml\n@@ -1,2 +1,2 @@\n <Config>\n-  <Port>1</Port>\n+  <Port>2</Port>\n"
+
+	expected := ansiBold + "--- a/config.xml" + ansiReset + "\n" +
+		ansiBold + "+++ b/config.xml" + ansiReset + "\n" +
+		ansiCyan + "@@ -1,2 +1,2 @@" + ansiReset + "\n" +
+		" <Config>\n" +
+		ansiRed + "-  <Port>1</Port>" + ansiReset + "\n" +
+		ansiGreen + "+  <Port>2</Port>" + ansiReset + "\n"
+	if colored := colorizeDiff(diff); colored != expected {
+		t.Fatalf("Expected colored diff %q, got %q", expected, colored)
+	}
+}
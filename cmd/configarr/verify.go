@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"configarr"
+
+	"github.com/spf13/pflag"
+)
+
+// errDrift is returned by the verify subcommand when any host differs from its desired state.
+var errDrift = errors.New("configuration drift detected")
+
+// VerifyFlags represents the command-line flags of the verify subcommand.
+type VerifyFlags struct {
+	FleetFile       string
+	SSHBinary       string
+	ShowSecrets     bool
+	ExitZeroOnDrift bool
+	Progress        string
+	ArrURL          string // Base URL of a running app to compare its configuration file with
+	ConfigFile      string // Configuration file of the app at ArrURL
+	APIKey          string // API key of the app at ArrURL; empty uses the one of ConfigFile
+}
+
+// fetchFunc reads the configuration file of a fleet host.
+type fetchFunc func(ctx context.Context, host configarr.FleetHost) ([]byte, error)
+
+// parseVerifyFlags parses the flags of the verify subcommand.
+func parseVerifyFlags(flags []string) (VerifyFlags, error) {
+	flagSet := pflag.NewFlagSet("verify", pflag.ContinueOnError)
+
+	fleetFile := flagSet.StringP("file", "f", "", "YAML file with the hosts and their desired properties (- for stdin)")
+	sshBinary := flagSet.String("ssh", "ssh", "SSH client used to read the configuration files of the hosts")
+	showSecrets := flagSet.Bool("show-secrets", false, "Do not mask the values of secret properties")
+	exitZeroOnDrift := flagSet.Bool("exit-zero-on-drift", false, "Exit with 0 instead of 3 when any host drifted")
+	progress := flagSet.String("progress", "", "Report the progress over the hosts on stderr (text or ndjson)")
+	arrURL := flagSet.String("arr-url", "", "Compare the configuration file with the settings of the app running at this URL instead of a fleet")
+	configFile := flagSet.String("config", configarr.DefaultConfigPath, "Configuration file to compare with the running app")
+	apiKey := flagSet.String("api-key", "", "API key of the running app (default: the ApiKey of the configuration file)")
+
+	if err := flagSet.Parse(flags); err != nil {
+		return VerifyFlags{}, fmt.Errorf("error parsing flags: %w", err)
+	}
+	switch {
+	case *fleetFile != "" && *arrURL != "":
+		return VerifyFlags{}, errors.New("--file and --arr-url can't be combined")
+	case *fleetFile == "" && *arrURL == "":
+		return VerifyFlags{}, errors.New("missing --file with the fleet to verify or --arr-url of the app to compare with")
+	}
+	if err := validateProgressFormat(*progress); err != nil {
+		return VerifyFlags{}, err
+	}
+
+	return VerifyFlags{
+		FleetFile:       *fleetFile,
+		SSHBinary:       *sshBinary,
+		ShowSecrets:     *showSecrets,
+		ExitZeroOnDrift: *exitZeroOnDrift,
+		Progress:        *progress,
+		ArrURL:          *arrURL,
+		ConfigFile:      *configFile,
+		APIKey:          *apiKey,
+	}, nil
+}
+
+// runVerify compares the configuration file of every host in the fleet with its desired
+// properties, or a configuration file with the settings of the running app, and prints
+// the drift as a table.
+func runVerify(args []string, stdin io.Reader, output io.Writer) error {
+	flags, err := parseVerifyFlags(args)
+	if err != nil {
+		return invalidInput(err)
+	}
+	if flags.ArrURL != "" {
+		return verifyRuntime(context.Background(), flags, output, nil)
+	}
+	return verifyFleet(context.Background(), flags, stdin, output, sshFetch(flags.SSHBinary))
+}
+
+// verifyFleet prints the drift of every host, reading the configuration files with fetch
+// in the format detected from their path. Hosts that can't be read are reported and count
+// as drift.
+func verifyFleet(ctx context.Context, flags VerifyFlags, stdin io.Reader, output io.Writer, fetch fetchFunc) error {
+	data, err := readDocument(flags.FleetFile, stdin)
+	if err != nil {
+		return err
+	}
+	fleet, err := configarr.ParseFleet(data)
+	if err != nil {
+		return parseFailure(fmt.Errorf("error parsing fleet from %s: %w", flags.FleetFile, err))
+	}
+
+	w := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tKEY\tCURRENT\tDESIRED")
+
+	drift := false
+	progress := newProgressReporter(flags.Progress, len(fleet))
+	for _, host := range fleet {
+		progress.Next(host.Name)
+		data, err := fetch(ctx, host)
+		if err == nil {
+			var config *configarr.Config
+			if config, err = configarr.DetectFormat(host.ConfigPath).Parse(data); err == nil {
+				drift = printHostDrift(w, host, config, flags.ShowSecrets) || drift
+				continue
+			}
+		}
+		drift = true
+		fmt.Fprintf(w, "%s\terror\t-\t%s\t-\n", host.Name, strings.Join(strings.Fields(err.Error()), " ")) // On a single row
+	}
+	progress.Done()
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing drift report: %w", err)
+	}
+	if drift && !flags.ExitZeroOnDrift {
+		return errDrift
+	}
+	return nil
+}
+
+// printHostDrift prints a row per drifted property of the host, or a single row when the
+// host is in sync, and reports whether there was any drift.
+func printHostDrift(w io.Writer, host configarr.FleetHost, config *configarr.Config, showSecrets bool) bool {
+	drift := false
+	for _, action := range (configarr.Differ{}).Diff(config, host.Overrides) {
+		if action.Type != configarr.ActionChange {
+			continue
+		}
+		drift = true
+		fmt.Fprintf(w, "%s\tdrift\t%s\t%s\t%s\n", host.Name, action.Key,
+			exportValue(action.Key, action.Current, showSecrets), exportValue(action.Key, action.Value, showSecrets))
+	}
+	if !drift {
+		fmt.Fprintf(w, "%s\tok\t-\t-\t-\n", host.Name)
+	}
+	return drift
+}
+
+// verifyRuntime prints the properties of the configuration file whose values differ from
+// the settings the app running at --arr-url reports, fetched with client (nil for the
+// default), e.g. a port changed in the UI that was never saved or a file edited without
+// restarting the app.
+func verifyRuntime(ctx context.Context, flags VerifyFlags, output io.Writer, client *http.Client) error {
+	config, err := configarr.ReadConfigFile(flags.ConfigFile)
+	if err != nil {
+		return parseFailure(fmt.Errorf("error reading %s: %w", flags.ConfigFile, err))
+	}
+	apiKey := flags.APIKey
+	if apiKey == "" {
+		apiKey = config.Properties["ApiKey"]
+	}
+	if apiKey == "" {
+		return invalidInput(fmt.Errorf("missing --api-key: %s has no ApiKey", flags.ConfigFile))
+	}
+
+	running, err := configarr.FetchHostConfig(ctx, flags.ArrURL, apiKey, client)
+	if err != nil {
+		return err
+	}
+	drift := configarr.CompareHostConfig(config, running)
+
+	w := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tKEY\tFILE\tRUNNING")
+	for _, property := range drift {
+		fmt.Fprintf(w, "drift\t%s\t%s\t%s\n", property.Key,
+			exportValue(property.Key, property.File, flags.ShowSecrets), exportValue(property.Key, property.Running, flags.ShowSecrets))
+	}
+	if len(drift) == 0 {
+		fmt.Fprintln(w, "ok\t-\t-\t-")
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing drift report: %w", err)
+	}
+	if len(drift) > 0 && !flags.ExitZeroOnDrift {
+		return errDrift
+	}
+	return nil
+}
+
+// sshFetch returns a fetchFunc that reads the configuration file with the SSH client. The
+// destination follows --, so the client never takes it for an option.
+func sshFetch(sshBinary string) fetchFunc {
+	return func(ctx context.Context, host configarr.FleetHost) ([]byte, error) {
+		if err := configarr.ValidateSSHDestination(host.SSH); err != nil {
+			return nil, invalidInput(err)
+		}
+		cmd := exec.CommandContext(ctx, sshBinary, "-o", "BatchMode=yes", "--", host.SSH, "cat -- "+shellQuote(host.ConfigPath))
+		data, err := cmd.Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("error reading %s via ssh: %w: %s", host.ConfigPath, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s via ssh: %w", host.ConfigPath, err)
+		}
+		return data, nil
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"configarr"
+)
+
+// TestParseVerifyFlags tests parsing the flags of the verify subcommand.
+func TestParseVerifyFlags(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		flags, err := parseVerifyFlags([]string{"-f", "fleet.yaml"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if flags.FleetFile != "fleet.yaml" || flags.SSHBinary != "ssh" || flags.ShowSecrets {
+			t.Fatalf("Unexpected default flags: %+v", flags)
+		}
+	})
+
+	t.Run("Missing fleet file", func(t *testing.T) {
+		if _, err := parseVerifyFlags(nil); err == nil {
+			t.Fatal("Expected error for missing --file, but got none")
+		}
+	})
+
+	t.Run("Running app", func(t *testing.T) {
+		flags, err := parseVerifyFlags([]string{"--arr-url", "http://localhost:8989"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if flags.ArrURL != "http://localhost:8989" || flags.ConfigFile != configarr.DefaultConfigPath {
+			t.Fatalf("Unexpected flags: %+v", flags)
+		}
+		if _, err := parseVerifyFlags([]string{"-f", "fleet.yaml", "--arr-url", "http://localhost:8989"}); err == nil {
+			t.Fatal("Expected error for --file with --arr-url, but got none")
+		}
+	})
+}
+
+// TestVerifyFleet tests reporting the drift of every host in a fleet.
+func TestVerifyFleet(t *testing.T) {
+	fleet := "nas:\n  properties: {Port: 8989, ApiKey: new}\npi:\n  properties: {Port: 8989}\nbroken: {}\n"
+	configs := map[string]string{
+		"nas": "<Config><Port>8990</Port><ApiKey>old</ApiKey></Config>",
+		"pi":  "<Config><Port>8989</Port></Config>",
+	}
+	fetch := func(ctx context.Context, host configarr.FleetHost) ([]byte, error) {
+		if config, exists := configs[host.Name]; exists {
+			return []byte(config), nil
+		}
+		return nil, errors.New("connection refused")
+	}
+
+	var output strings.Builder
+	err := verifyFleet(context.Background(), VerifyFlags{FleetFile: "-"}, strings.NewReader(fleet), &output, fetch)
+	if !errors.Is(err, errDrift) {
+		t.Fatalf("Expected drift error, got: %v", err)
+	}
+
+	for _, row := range [][]string{
+		{"nas", "drift", "Port", "8990", "8989"},
+		{"nas", "drift", "ApiKey", "********", "********"},
+		{"pi", "ok"},
+		{"broken", "error", "-", "connection refused"},
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(output.String()), " "), strings.Join(row, " ")) {
+			t.Fatalf("Expected row %v in output:\n%s", row, output.String())
+		}
+	}
+
+	flags := VerifyFlags{FleetFile: "-", ExitZeroOnDrift: true}
+	if err := verifyFleet(context.Background(), flags, strings.NewReader(fleet), &output, fetch); err != nil {
+		t.Fatalf("Unexpected error with --exit-zero-on-drift: %v", err)
+	}
+
+	t.Run("Progress", func(t *testing.T) {
+		var progress strings.Builder
+		defer func(w io.Writer) { progressOutput = w }(progressOutput)
+		progressOutput = &progress
+
+		flags := VerifyFlags{FleetFile: "-", ExitZeroOnDrift: true, Progress: progressText}
+		if err := verifyFleet(context.Background(), flags, strings.NewReader(fleet), io.Discard, fetch); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, line := range []string{"[1/3] nas ", "[3/3] broken ", "Processed 3 targets"} {
+			if !strings.Contains(progress.String(), line) {
+				t.Fatalf("Expected %q in progress:\n%s", line, progress.String())
+			}
+		}
+	})
+
+	t.Run("In sync", func(t *testing.T) {
+		var output strings.Builder
+		err := verifyFleet(context.Background(), VerifyFlags{FleetFile: "-"}, strings.NewReader("pi:\n  properties: {Port: 8989}\n"), &output, fetch)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Formats and multi-line errors", func(t *testing.T) {
+		fleet := "bazarr:\n  config: /srv/bazarr/config.yaml\n  properties: {general.port: 6767}\nflaky: {}\n"
+		fetch := func(ctx context.Context, host configarr.FleetHost) ([]byte, error) {
+			if host.Name == "bazarr" {
+				return []byte("general:\n  port: 6767\n"), nil
+			}
+			return nil, errors.New("ssh failed:\nPermission denied\tpublickey")
+		}
+
+		var output strings.Builder
+		_ = verifyFleet(context.Background(), VerifyFlags{FleetFile: "-"}, strings.NewReader(fleet), &output, fetch)
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[1], "bazarr  ok") || !strings.Contains(lines[2], "flaky") || !strings.Contains(lines[2], "ssh failed: Permission denied publickey") {
+			t.Fatalf("Expected a row per host, got:\n%s", output.String())
+		}
+	})
+}
+
+// TestVerifyRuntime tests comparing a configuration file with the settings of the running app.
+func TestVerifyRuntime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "0123456789abcdef" || r.URL.Path != "/api/v3/config/host" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"port": 8990, "apiKey": "0123456789abcdef", "urlBase": ""}`))
+	}))
+	defer server.Close()
+
+	configFile := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(configFile, []byte("<Config><Port>8989</Port><ApiKey>0123456789abcdef</ApiKey><UrlBase></UrlBase></Config>"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var output strings.Builder
+	err := verifyRuntime(context.Background(), VerifyFlags{ArrURL: server.URL, ConfigFile: configFile}, &output, server.Client())
+	if !errors.Is(err, errDrift) {
+		t.Fatalf("Expected drift error, got: %v", err)
+	}
+	report := strings.Join(strings.Fields(output.String()), " ")
+	if !strings.Contains(report, "drift Port 8989 8990") || strings.Contains(report, "ApiKey") || strings.Contains(report, "UrlBase") {
+		t.Fatalf("Expected only the port to drift, got:\n%s", output.String())
+	}
+
+	t.Run("Wrong API key", func(t *testing.T) {
+		flags := VerifyFlags{ArrURL: server.URL, ConfigFile: configFile, APIKey: "wrong"}
+		if err := verifyRuntime(context.Background(), flags, io.Discard, server.Client()); err == nil || errors.Is(err, errDrift) {
+			t.Fatalf("Expected error for the wrong API key, got: %v", err)
+		}
+	})
+}
+
+// TestSSHFetch tests that the destination can't be taken for an option of the SSH client.
+func TestSSHFetch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake SSH client is a shell script")
+	}
+	dir := t.TempDir()
+	client := filepath.Join(dir, "ssh")
+	if err := os.WriteFile(client, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\"\n"), 0755); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	fetch := sshFetch(client)
+
+	data, err := fetch(context.Background(), configarr.FleetHost{SSH: "admin@nas.local", ConfigPath: "/config/config.xml"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "-o\nBatchMode=yes\n--\nadmin@nas.local\ncat -- /config/config.xml\n"; string(data) != expected {
+		t.Fatalf("Expected arguments:\n%s\ngot:\n%s", expected, data)
+	}
+
+	if _, err := fetch(context.Background(), configarr.FleetHost{SSH: "-oProxyCommand=id", ConfigPath: "/config/config.xml"}); err == nil {
+		t.Fatal("Expected error for a destination starting with -, but got none")
+	}
+}
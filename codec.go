@@ -0,0 +1,136 @@
+package configarr
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Codec converts configuration files between their stored and their plain form, e.g.
+// to operate on encrypted volumes without staging the plaintext on disk.
+type Codec interface {
+	Decode(stored []byte) ([]byte, error)
+	Encode(plain []byte) ([]byte, error)
+}
+
+// CodecFS returns a filesystem that decodes files read from fsys and encodes files
+// written to it, so configuration files are only ever plain in memory.
+func CodecFS(fsys FS, codec Codec) FS {
+	return codecFS{fsys: fsys, codec: codec}
+}
+
+// codecFS implements FS on top of another FS and a Codec.
+type codecFS struct {
+	fsys  FS
+	codec Codec
+}
+
+// Open reads and decodes the named file.
+func (c codecFS) Open(name string) (fs.File, error) {
+	stored, err := fs.ReadFile(c.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.fsys.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := c.codec.Decode(stored)
+	if err != nil {
+		return nil, &fs.PathError{Op: "decode", Path: name, Err: err}
+	}
+	return &memFile{Reader: bytes.NewReader(plain), info: info}, nil
+}
+
+// Stat returns the file info of the stored file.
+func (c codecFS) Stat(name string) (fs.FileInfo, error) {
+	return c.fsys.Stat(name)
+}
+
+// WriteFile encodes data and writes it to the named file.
+func (c codecFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	stored, err := c.codec.Encode(data)
+	if err != nil {
+		return &fs.PathError{Op: "encode", Path: name, Err: err}
+	}
+	return c.fsys.WriteFile(name, stored, perm)
+}
+
+// ReadDir returns the entries of the named directory of the underlying filesystem.
+func (c codecFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(c.fsys, name)
+}
+
+// Remove removes the named file from the underlying filesystem.
+func (c codecFS) Remove(name string) error {
+	return removeFile(c.fsys, name)
+}
+
+// CheckReplaceable reports why the underlying filesystem can't replace the named file.
+func (c codecFS) CheckReplaceable(name string) error {
+	return checkReplaceable(c.fsys, name)
+}
+
+// memFile is an fs.File holding decoded content in memory.
+type memFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+// Stat returns the file info of the stored file.
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Close does nothing, since the content is in memory.
+func (f *memFile) Close() error { return nil }
+
+// aesGCMCodec encrypts files with AES-GCM, storing the random nonce in front of the ciphertext.
+type aesGCMCodec struct {
+	aead   cipher.AEAD
+	random io.Reader
+}
+
+// NewAESGCMCodec returns a codec encrypting files with AES-GCM. The key must be 16, 24
+// or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+func NewAESGCMCodec(key []byte) (Codec, error) {
+	return NewAESGCMCodecWith(key, SystemRandom())
+}
+
+// NewAESGCMCodecWith returns a codec like NewAESGCMCodec, reading the nonces from the
+// random source, e.g. FixedRandom for reproducible golden tests.
+func NewAESGCMCodecWith(key []byte, random io.Reader) (Codec, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return aesGCMCodec{aead: aead, random: random}, nil
+}
+
+// Decode decrypts and authenticates the stored file.
+func (c aesGCMCodec) Decode(stored []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(stored) < size {
+		return nil, errors.New("encrypted file is too short")
+	}
+	plain, err := c.aead.Open(nil, stored[:size], stored[size:], nil)
+	if err != nil {
+		return nil, errors.New("decryption failed: wrong key or corrupted file")
+	}
+	return plain, nil
+}
+
+// Encode encrypts the file with a fresh random nonce.
+func (c aesGCMCodec) Encode(plain []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(c.random, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, plain, nil), nil
+}
@@ -0,0 +1,63 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+)
+
+// TestCodecFS tests updating an encrypted configuration file without storing the plaintext.
+func TestCodecFS(t *testing.T) {
+	codec, err := NewAESGCMCodec(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	encrypted, err := codec.Encode([]byte("<Config><Port>8989</Port></Config>"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	base := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: encrypted}}}
+	fsys := CodecFS(base, codec)
+
+	result, err := Run(context.Background(),
+		WithFS(fsys),
+		WithConfigPath("config.xml"),
+		WithSources(StaticSource(Override{Key: "Port", Value: "9000"})),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Written {
+		t.Fatal("Expected the configuration file to be written")
+	}
+
+	stored := base.MapFS["config.xml"].Data
+	if bytes.Contains(stored, []byte("Port")) {
+		t.Fatalf("Expected the stored file to be encrypted, got %q", stored)
+	}
+	config, err := ReadConfigFS(fsys, "config.xml")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config.Properties["Port"] != "9000" {
+		t.Fatalf("Expected Port to be '9000', got '%s'", config.Properties["Port"])
+	}
+
+	t.Run("Wrong key", func(t *testing.T) {
+		other, err := NewAESGCMCodec(bytes.Repeat([]byte{2}, 32))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := ReadConfigFS(CodecFS(base, other), "config.xml"); err == nil {
+			t.Fatal("Expected error decrypting with the wrong key, but got none")
+		}
+	})
+
+	t.Run("Invalid key", func(t *testing.T) {
+		if _, err := NewAESGCMCodec([]byte("short")); err == nil {
+			t.Fatal("Expected error for invalid key length, but got none")
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package configarr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condition is a test of a property value, see parseCondition.
+type condition struct {
+	key   string
+	op    string // "" (non-empty), "!" (empty or missing), "==" or "!="
+	value string
+}
+
+// parseCondition parses a condition of the form <Key> (the value is non-empty), !<Key>
+// (the value is empty or missing), <Key> == <value> or <Key> != <value>. Values may be
+// quoted, e.g. SslCertPath != "".
+func parseCondition(expr string) (condition, error) {
+	expr = strings.TrimSpace(expr)
+	for _, op := range []string{"==", "!="} {
+		key, value, found := strings.Cut(expr, op)
+		if !found {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return condition{}, fmt.Errorf("invalid condition %q: %w", expr, err)
+			}
+			value = unquoted
+		}
+		if key == "" {
+			return condition{}, fmt.Errorf("invalid condition %q: missing key", expr)
+		}
+		return condition{key: key, op: op, value: value}, nil
+	}
+
+	c := condition{key: expr}
+	if key, negated := strings.CutPrefix(expr, "!"); negated {
+		c = condition{key: strings.TrimSpace(key), op: "!"}
+	}
+	if c.key == "" || strings.ContainsAny(c.key, " \t") {
+		return condition{}, fmt.Errorf("invalid condition %q: expected <Key>, !<Key>, <Key> == <value> or <Key> != <value>", expr)
+	}
+	return c, nil
+}
+
+// holds reports whether the condition is met by the property values.
+func (c condition) holds(state map[string]string) bool {
+	value := state[c.key]
+	switch c.op {
+	case "!":
+		return value == ""
+	case "==":
+		return value == c.value
+	case "!=":
+		return value != c.value
+	default:
+		return value != ""
+	}
+}
@@ -0,0 +1,42 @@
+package configarr
+
+import "testing"
+
+// TestParseCondition tests parsing and evaluating conditions against property values.
+func TestParseCondition(t *testing.T) {
+	state := map[string]string{"SslCertPath": "/certs/tls.pfx", "UrlBase": "", "LogLevel": "info"}
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{"SslCertPath", true},
+		{"UrlBase", false},
+		{"Missing", false},
+		{"!UrlBase", true},
+		{"! SslCertPath", false},
+		{`SslCertPath != ""`, true},
+		{"LogLevel == info", true},
+		{`LogLevel == "debug"`, false},
+		{"LogLevel != debug", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := parseCondition(tt.expr)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if c.holds(state) != tt.expected {
+				t.Fatalf("Expected %q to be %t", tt.expr, tt.expected)
+			}
+		})
+	}
+
+	t.Run("Invalid conditions", func(t *testing.T) {
+		for _, expr := range []string{"", "!", "== debug", `LogLevel == "debug`, "Log Level"} {
+			if _, err := parseCondition(expr); err == nil {
+				t.Fatalf("Expected error for %q, but got none", expr)
+			}
+		}
+	})
+}
@@ -0,0 +1,640 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constants for default configuration
+const (
+	DefaultConfigPath = "/config/config.xml"
+	DefaultPrefix     = "CONFIGARR__"
+	DefaultDelimiter  = "=" // Separates the property from the value in environment variables
+	DefaultIndent     = "  "
+
+	DefaultReadRetries    = 3
+	DefaultReadRetryDelay = 250 * time.Millisecond
+	DefaultSettleTimeout  = 30 * time.Second
+
+	DefaultMaxValueSize = 64 << 10 // 64 KiB, far above any real property value
+	DefaultMaxFileSize  = 10 << 20 // 10 MiB, far above any real configuration file
+)
+
+// Validation modes, see WithValidationMode.
+const (
+	ValidationModeError = "error" // Refuse input failing validation
+	ValidationModeWarn  = "warn"  // Log validation failures as warnings and carry on
+)
+
+// xmlNamespace is the namespace bound to the reserved "xml" prefix.
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// Config represents the XML structure with properties as a map and key order tracking.
+// Element and attribute names are stored with their original namespace prefixes
+// (e.g. "a:Port") so documents with xmlns declarations round-trip unchanged. Elements
+// nested in other elements, as in Jellyfin's system.xml, are addressed by the path of
+// their names joined with dots, e.g. Server.Port; the flat files of the *arr apps only
+// have top-level keys. Repeated nested siblings are told apart by their index, as items
+// of JSON arrays, e.g. Servers.Server.0.Name; XML names never start with a digit.
+type Config struct {
+	XMLName      xml.Name              `xml:"Config"`
+	Attrs        []xml.Attr            `xml:"-"` // Attributes of the root element, including xmlns declarations
+	Properties   map[string]string     `xml:"-"`
+	Keys         []string              `xml:"-"`
+	ElementAttrs map[string][]xml.Attr `xml:"-"` // Attributes of child elements, keyed by their key or the path of parent elements
+
+	// Non-element tokens (comments, processing instructions and directives) are kept so
+	// they can be written back verbatim at their original position.
+	Prolog         []xml.Token            `xml:"-"` // Tokens before the root element, e.g. the XML declaration or DOCTYPE
+	Epilog         []xml.Token            `xml:"-"` // Tokens after the root element
+	Tokens         map[string][]xml.Token `xml:"-"` // Tokens preceding a child element, keyed like ElementAttrs
+	TrailingTokens []xml.Token            `xml:"-"` // Tokens after the last child element
+
+	source   []byte              // Original document as read from disk
+	spans    map[string][]span   // Byte ranges of each child element in the original document
+	parents  map[string][]span   // Byte ranges of the elements holding nested elements, keyed by their path
+	paths    map[string][]string // Element names of the nested keys, e.g. [Server Port] for Server.Port
+	opening  int64               // End of the start tag of the root element in the original document
+	closing  int64               // Start of the end tag of the root element in the original document
+	cdata    bool                // Write values holding markup as CDATA sections, see RenderOptions.CDATA
+	document any                 // Parsed document of other formats than XML, e.g. *jsonDocument; never modified
+}
+
+// span is the byte range [start, end) of an element within a parsed document.
+// content marks the end of the start tag, where the element's value begins.
+type span struct {
+	start, content, end int64
+}
+
+// UnmarshalXML customizes the unmarshalling of the XML into the Config struct.
+// This function reads XML elements and stores them in the Properties map and tracks key order.
+func (c *Config) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	c.Properties = make(map[string]string)
+	c.Keys = []string{}
+	c.ElementAttrs = make(map[string][]xml.Attr)
+	c.Tokens = make(map[string][]xml.Token)
+	c.TrailingTokens = nil
+	c.spans = make(map[string][]span)
+	c.parents = make(map[string][]span)
+	c.paths = make(map[string][]string)
+	c.opening = d.InputOffset()
+
+	prefixes := declarePrefixes(nil, start.Attr)
+	c.XMLName = xml.Name{Local: qualifiedName(start.Name, prefixes)}
+	c.Attrs = rawAttrs(start.Attr, prefixes)
+
+	var pending []xml.Token // Non-element tokens waiting for the next element
+	for {
+		offset := d.InputOffset() // Start of the next token
+		token, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				break // End of XML document
+			}
+			return fmt.Errorf("error parsing XML token: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := c.parseElement(d, t, offset, nil, -1, prefixes, pending); err != nil {
+				return err
+			}
+			pending = nil
+		case xml.EndElement:
+			c.closing = offset
+		case xml.Comment, xml.ProcInst, xml.Directive:
+			pending = append(pending, xml.CopyToken(t))
+		}
+	}
+	c.TrailingTokens = pending
+	return nil
+}
+
+// parseElement reads the element the decoder just returned the start of, which started at
+// offset below the parent elements of path. An element with text only is stored as a
+// property; the properties of an element with child elements are keyed by their path.
+// Index tells repeated siblings apart, -1 for the first or only one. Tokens are the
+// non-element tokens preceding the element.
+func (c *Config) parseElement(d *xml.Decoder, start xml.StartElement, offset int64, path []string, index int, prefixes map[string]string, tokens []xml.Token) error {
+	scope := declarePrefixes(prefixes, start.Attr)
+	path = append(slices.Clip(path), qualifiedName(start.Name, scope))
+	if index >= 0 {
+		path = append(path, strconv.Itoa(index))
+	}
+	key := strings.Join(path, ".")
+	content := d.InputOffset() // End of the start tag
+	if len(start.Attr) > 0 {
+		c.ElementAttrs[key] = rawAttrs(start.Attr, scope)
+	}
+	if len(tokens) > 0 {
+		c.Tokens[key] = append(c.Tokens[key], tokens...)
+	}
+
+	var value strings.Builder
+	var pending []xml.Token // Non-element tokens waiting for the next child element
+	siblings := make(map[string]int)
+	parent := false
+	for {
+		childOffset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			return fmt.Errorf("error decoding XML element %s: %w", key, err)
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			value.Write(t)
+		case xml.StartElement:
+			name := qualifiedName(t.Name, declarePrefixes(scope, t.Attr))
+			siblings[name]++
+			index := siblings[name] - 1
+			switch index {
+			case 0:
+				index = -1 // Not indexed unless repeated
+			case 1:
+				c.indexElement(key+"."+name, len(path)+1)
+			}
+			if err := c.parseElement(d, t, childOffset, path, index, scope, pending); err != nil {
+				return err
+			}
+			parent, pending = true, nil
+		case xml.Comment, xml.ProcInst, xml.Directive:
+			pending = append(pending, xml.CopyToken(t))
+		case xml.EndElement:
+			s := span{start: offset, content: content, end: d.InputOffset()}
+			if parent {
+				c.parents[key] = append(c.parents[key], s)
+				return nil
+			}
+			// Store the element's content in the map and track the key order
+			c.Properties[key] = value.String()
+			c.Keys = append(c.Keys, key)
+			c.spans[key] = append(c.spans[key], s)
+			if len(path) > 1 {
+				c.paths[key] = path
+			}
+			return nil
+		}
+	}
+}
+
+// indexElement moves the keys of the element at key, with depth elements in its path, to
+// index 0 when its first repeated sibling comes up, e.g. Servers.Server.Name to
+// Servers.Server.0.Name.
+func (c *Config) indexElement(key string, depth int) {
+	indexed := func(k string) (string, bool) {
+		if rest, found := strings.CutPrefix(k, key); found && (rest == "" || rest[0] == '.') {
+			return key + ".0" + rest, true
+		}
+		return k, false
+	}
+
+	for i, k := range c.Keys {
+		c.Keys[i], _ = indexed(k)
+	}
+	renameKeys(c.Properties, indexed)
+	renameKeys(c.ElementAttrs, indexed)
+	renameKeys(c.Tokens, indexed)
+	renameKeys(c.spans, indexed)
+	renameKeys(c.parents, indexed)
+	for k, path := range c.paths {
+		if _, found := indexed(k); found {
+			c.paths[k] = append(append(slices.Clip(path[:depth]), "0"), path[depth:]...)
+		}
+	}
+	renameKeys(c.paths, indexed)
+}
+
+// renameKeys renames the keys of m that rename reports to be renamed.
+func renameKeys[V any](m map[string]V, rename func(string) (string, bool)) {
+	renamed := make(map[string]V)
+	for k, v := range m {
+		if name, found := rename(k); found {
+			renamed[name] = v
+			delete(m, k)
+		}
+	}
+	for k, v := range renamed {
+		m[k] = v
+	}
+}
+
+// isIndex reports whether a part of a key is the index of a repeated sibling rather than
+// the name of an element.
+func isIndex(part string) bool {
+	return part != "" && strings.Trim(part, "0123456789") == ""
+}
+
+// elementPath returns the names of the elements of the key, with the indexes of repeated
+// siblings: the path it was read from, its name when it was read from a top-level
+// element, or the parts of a created key between its dots.
+func (c *Config) elementPath(key string) []string {
+	if path, exists := c.paths[key]; exists {
+		return path
+	}
+	if _, exists := c.spans[key]; exists {
+		return []string{key}
+	}
+	return strings.Split(key, ".")
+}
+
+// writesCDATA reports whether the value of the key is written as a CDATA section: when
+// it was one in the original document, or holds markup characters with
+// RenderOptions.CDATA. Values with carriage returns are escaped instead, since parsers
+// turn them into newlines within CDATA sections.
+func (c *Config) writesCDATA(key string) bool {
+	value := c.Properties[key]
+	if value == "" || strings.ContainsRune(value, '\r') {
+		return false
+	}
+	if c.cdata && strings.ContainsAny(value, "<>&") {
+		return true
+	}
+	if spans := c.spans[key]; len(spans) > 0 && c.source != nil {
+		content := bytes.TrimLeft(c.source[spans[0].content:spans[0].end], " \t\r\n")
+		return bytes.HasPrefix(content, []byte("<![CDATA["))
+	}
+	return false
+}
+
+// encodeValue returns the value of the key as element content: escaped, or as a CDATA
+// section, see writesCDATA. "]]>" within a CDATA section splits it in two.
+func (c *Config) encodeValue(key string) ([]byte, error) {
+	value := c.Properties[key]
+	if c.writesCDATA(key) {
+		return []byte("<![CDATA[" + strings.ReplaceAll(value, "]]>", "]]]]><![CDATA[>") + "]]>"), nil
+	}
+	var escaped bytes.Buffer
+	if err := xml.EscapeText(&escaped, []byte(value)); err != nil {
+		return nil, fmt.Errorf("error escaping value of %s: %w", key, err)
+	}
+	return escaped.Bytes(), nil
+}
+
+// elementName returns the name of the element at the path, before its index if it is a
+// repeated sibling.
+func elementName(path []string) string {
+	if len(path) > 1 && isIndex(path[len(path)-1]) {
+		return path[len(path)-2]
+	}
+	return path[len(path)-1]
+}
+
+// xmlNode is an element of the tree the keys of a Config form: a property when key is
+// set, or a parent of other elements. Index tells repeated siblings apart.
+type xmlNode struct {
+	name     string
+	index    string
+	key      string
+	children []*xmlNode
+}
+
+// elementTree arranges the keys in a tree of elements. Parents are created when their
+// first key comes up, and the later keys below them are added to the same parent, so keys
+// created below an existing parent go into it.
+func (c *Config) elementTree(keys []string, strip int) *xmlNode {
+	root := &xmlNode{}
+	for _, key := range keys {
+		var elements []*xmlNode
+		for _, part := range c.elementPath(key)[strip:] {
+			if isIndex(part) && len(elements) > 0 {
+				elements[len(elements)-1].index = part
+				continue
+			}
+			elements = append(elements, &xmlNode{name: part})
+		}
+		node := root
+		for _, element := range elements[:len(elements)-1] {
+			i := slices.IndexFunc(node.children, func(child *xmlNode) bool {
+				return child.key == "" && child.name == element.name && child.index == element.index
+			})
+			if i < 0 {
+				node.children = append(node.children, element)
+				i = len(node.children) - 1
+			}
+			node = node.children[i]
+		}
+		leaf := elements[len(elements)-1]
+		leaf.key = key
+		node.children = append(node.children, leaf)
+	}
+	return root
+}
+
+// encodeElements encodes the child elements of the node below the parent path, each
+// preceded by its tokens the first time it is written.
+func (c *Config) encodeElements(e *xml.Encoder, node *xmlNode, parent string, written map[string]bool) error {
+	for _, child := range node.children {
+		key := child.key
+		if key == "" {
+			key = strings.TrimPrefix(parent+"."+child.name, ".")
+			if child.index != "" {
+				key += "." + child.index
+			}
+		}
+		if !written[key] {
+			if err := encodeTokens(e, c.Tokens[key]); err != nil {
+				return err
+			}
+			written[key] = true
+		}
+
+		elem := xml.StartElement{Name: xml.Name{Local: child.name}, Attr: c.ElementAttrs[key]}
+		if child.key != "" {
+			var value any = c.Properties[key]
+			if c.writesCDATA(key) {
+				value = struct {
+					Text string `xml:",cdata"`
+				}{c.Properties[key]}
+			}
+			if err := e.EncodeElement(value, elem); err != nil {
+				return fmt.Errorf("error encoding XML element %s: %w", key, err)
+			}
+			continue
+		}
+		if err := e.EncodeToken(elem); err != nil {
+			return fmt.Errorf("error encoding XML element %s: %w", key, err)
+		}
+		if err := c.encodeElements(e, child, key, written); err != nil {
+			return err
+		}
+		if err := e.EncodeToken(elem.End()); err != nil {
+			return fmt.Errorf("error encoding XML element %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// MarshalXML customizes the marshalling of the Config struct into XML.
+// It encodes the Properties map into XML elements preserving the key order.
+func (c *Config) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "Config"}
+	if c.XMLName.Local != "" {
+		start.Name.Local = c.XMLName.Local
+	}
+	start.Attr = c.Attrs
+	if err := e.EncodeToken(start); err != nil {
+		return fmt.Errorf("error encoding XML start token: %w", err)
+	}
+
+	// Marshal in the order stored in Keys
+	if err := c.encodeElements(e, c.elementTree(c.Keys, 0), "", make(map[string]bool, len(c.Keys))); err != nil {
+		return err
+	}
+
+	if err := encodeTokens(e, c.TrailingTokens); err != nil {
+		return err
+	}
+
+	if err := e.EncodeToken(xml.EndElement{Name: start.Name}); err != nil {
+		return fmt.Errorf("error encoding XML end token: %w", err)
+	}
+
+	return nil
+}
+
+// Clone returns a deep copy of the configuration that can be modified without
+// affecting the original.
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.Attrs = append([]xml.Attr(nil), c.Attrs...)
+	clone.Keys = append([]string(nil), c.Keys...)
+	clone.Prolog = copyTokens(c.Prolog)
+	clone.Epilog = copyTokens(c.Epilog)
+	clone.TrailingTokens = copyTokens(c.TrailingTokens)
+
+	clone.Properties = make(map[string]string, len(c.Properties))
+	for key, value := range c.Properties {
+		clone.Properties[key] = value
+	}
+	clone.ElementAttrs = make(map[string][]xml.Attr, len(c.ElementAttrs))
+	for key, attrs := range c.ElementAttrs {
+		clone.ElementAttrs[key] = append([]xml.Attr(nil), attrs...)
+	}
+	clone.Tokens = make(map[string][]xml.Token, len(c.Tokens))
+	for key, tokens := range c.Tokens {
+		clone.Tokens[key] = copyTokens(tokens)
+	}
+	clone.spans = make(map[string][]span, len(c.spans))
+	for key, spans := range c.spans {
+		clone.spans[key] = append([]span(nil), spans...)
+	}
+	clone.parents = make(map[string][]span, len(c.parents))
+	for key, spans := range c.parents {
+		clone.parents[key] = append([]span(nil), spans...)
+	}
+	clone.paths = make(map[string][]string, len(c.paths))
+	for key, path := range c.paths {
+		clone.paths[key] = path // Never modified
+	}
+	return &clone // source is never modified and can be shared
+}
+
+// copyTokens returns a deep copy of the tokens.
+func copyTokens(tokens []xml.Token) []xml.Token {
+	if tokens == nil {
+		return nil
+	}
+	copied := make([]xml.Token, len(tokens))
+	for i, token := range tokens {
+		copied[i] = xml.CopyToken(token)
+	}
+	return copied
+}
+
+// encodeTokens writes the given non-element tokens verbatim.
+func encodeTokens(e *xml.Encoder, tokens []xml.Token) error {
+	for _, token := range tokens {
+		if err := e.EncodeToken(token); err != nil {
+			return fmt.Errorf("error encoding XML token: %w", err)
+		}
+	}
+	return nil
+}
+
+// declarePrefixes returns a namespace-URL-to-prefix mapping extended with the
+// xmlns declarations found in attrs. The parent mapping is never modified.
+func declarePrefixes(parent map[string]string, attrs []xml.Attr) map[string]string {
+	prefixes := make(map[string]string, len(parent))
+	for url, prefix := range parent {
+		prefixes[url] = prefix
+	}
+	for _, attr := range attrs {
+		switch {
+		case attr.Name.Space == "xmlns":
+			prefixes[attr.Value] = attr.Name.Local
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			prefixes[attr.Value] = ""
+		}
+	}
+	return prefixes
+}
+
+// qualifiedName turns a namespace-resolved name back into its prefixed form as
+// written in the document (e.g. "a:Port").
+func qualifiedName(name xml.Name, prefixes map[string]string) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if name.Space == xmlNamespace {
+		return "xml:" + name.Local
+	}
+	prefix, found := prefixes[name.Space]
+	if !found {
+		prefix = name.Space // Undeclared prefixes are left untranslated by the decoder
+	}
+	if prefix == "" {
+		return name.Local
+	}
+	return prefix + ":" + name.Local
+}
+
+// rawAttrs converts namespace-resolved attributes back into their prefixed form,
+// so the encoder writes them exactly as they appeared in the document.
+func rawAttrs(attrs []xml.Attr, prefixes map[string]string) []xml.Attr {
+	if len(attrs) == 0 {
+		return nil
+	}
+	raw := make([]xml.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		name := attr.Name.Local
+		switch {
+		case attr.Name.Space == "xmlns":
+			name = "xmlns:" + attr.Name.Local
+		case attr.Name.Space != "":
+			name = qualifiedName(attr.Name, prefixes)
+		}
+		raw = append(raw, xml.Attr{Name: xml.Name{Local: name}, Value: attr.Value})
+	}
+	return raw
+}
+
+// ReadConfigFile reads and parses the file into a Config struct, in the format detected
+// from its extension (see DetectFormat).
+func ReadConfigFile(xmlFile string) (*Config, error) {
+	return ReadConfigFS(OSFS(), xmlFile)
+}
+
+// ReadConfigFS reads and parses the named file from the filesystem into a Config struct,
+// in the format detected from its extension (see DetectFormat).
+func ReadConfigFS(fsys fs.FS, xmlFile string) (*Config, error) {
+	return readConfigFS(fsys, xmlFile, DetectFormat(xmlFile))
+}
+
+// ReadConfig reads and parses the configuration file the way Run does: the file set with
+// WithConfigPath, read through the filesystem of WithFS and in the format of WithFormat,
+// detected from its extension by default.
+func ReadConfig(opts ...Option) (*Config, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return readConfigFS(o.fs, o.configPath, o.configFormat())
+}
+
+// readConfigFS reads and parses the named file in the given format.
+func readConfigFS(fsys fs.FS, xmlFile string, format Format) (*Config, error) {
+	file, err := fs.ReadFile(fsys, xmlFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, xmlFile)
+		}
+		return nil, fmt.Errorf("error reading file %s: %w", xmlFile, err)
+	}
+
+	return format.Parse(file)
+}
+
+// ParseConfig parses the document into a Config that remembers its source, e.g. a
+// configuration file read from a remote host.
+func ParseConfig(data []byte) (*Config, error) {
+	var cfg Config
+	if err := parseXML(data, &cfg); err != nil {
+		return nil, categorize(ErrParse, fmt.Errorf("error unmarshalling XML: %w", err))
+	}
+	cfg.source = data
+
+	return &cfg, nil
+}
+
+// readConfigFileWithRetry reads the file in the given format, but retries when the
+// document looks truncated, which happens when the application is rewriting it.
+func readConfigFileWithRetry(ctx context.Context, fsys fs.FS, xmlFile string, format Format, retries int, delay time.Duration, logger *slog.Logger) (*Config, error) {
+	for attempt := 1; ; attempt++ {
+		cfg, err := readConfigFS(fsys, xmlFile, format)
+		if err == nil || !isTruncatedXML(err) || attempt > retries {
+			return cfg, err
+		}
+		logger.Debug(fmt.Sprintf("Configuration file looks partially written. Retrying in %s (%d/%d).", delay, attempt, retries))
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isTruncatedXML reports whether err was caused by a document ending prematurely.
+func isTruncatedXML(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var syntaxErr *xml.SyntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.Msg == "unexpected EOF"
+}
+
+// parseXML decodes the document into cfg, keeping comments, processing instructions and
+// directives found before and after the root element.
+func parseXML(data []byte, cfg *Config) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	rootFound := false
+	for {
+		token, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if rootFound {
+				return fmt.Errorf("unexpected element %s after root element", t.Name.Local)
+			}
+			if err := d.DecodeElement(cfg, &t); err != nil {
+				return err
+			}
+			rootFound = true
+		case xml.Comment, xml.ProcInst, xml.Directive:
+			if rootFound {
+				cfg.Epilog = append(cfg.Epilog, xml.CopyToken(t))
+			} else {
+				cfg.Prolog = append(cfg.Prolog, xml.CopyToken(t))
+			}
+		}
+	}
+
+	if !rootFound {
+		return io.EOF // Same error xml.Unmarshal reports for a document without elements
+	}
+	return nil
+}
+
+// writeToken encodes a single top-level token. A fresh encoder is used per token
+// since the XML declaration is only accepted as the first token of an encoder.
+func writeToken(w io.Writer, token xml.Token) error {
+	e := xml.NewEncoder(w)
+	if err := e.EncodeToken(token); err != nil {
+		return err
+	}
+	return e.Flush()
+}
@@ -0,0 +1,337 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestConfig_UnmarshalXML tests the XML unmarshalling into Config struct.
+func TestConfig_UnmarshalXML(t *testing.T) {
+	t.Run("Valid XML", func(t *testing.T) {
+		xmlData := `<Config><LogLevel>info</LogLevel><Theme>dark</Theme></Config>`
+		var config Config
+		err := xml.Unmarshal([]byte(xmlData), &config)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if config.Properties["LogLevel"] != "info" || config.Properties["Theme"] != "dark" {
+			t.Fatalf("Expected properties not set correctly: %v", config.Properties)
+		}
+
+		if len(config.Keys) != 2 || config.Keys[0] != "LogLevel" || config.Keys[1] != "Theme" {
+			t.Fatalf("Expected key order ['LogLevel', 'Theme'], got %v", config.Keys)
+		}
+	})
+
+	t.Run("Invalid XML", func(t *testing.T) {
+		xmlData := `<Config><LogLevel>info<LogLevel></Config>` // malformed XML
+		var config Config
+		err := xml.Unmarshal([]byte(xmlData), &config)
+		if err == nil {
+			t.Fatal("Expected error due to malformed XML, but got none")
+		}
+	})
+}
+
+// TestConfig_Namespaces tests that namespace prefixes and xmlns declarations survive a round-trip.
+func TestConfig_Namespaces(t *testing.T) {
+	t.Run("Prefixed elements and declarations", func(t *testing.T) {
+		xmlData := `<Config xmlns="urn:default" xmlns:a="urn:a" xml:lang="en"><a:Port>8989</a:Port><Theme>dark</Theme><b:Item xmlns:b="urn:b" b:kind="x">1</b:Item></Config>`
+		var config Config
+		if err := xml.Unmarshal([]byte(xmlData), &config); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if config.Properties["a:Port"] != "8989" || config.Properties["Theme"] != "dark" || config.Properties["b:Item"] != "1" {
+			t.Fatalf("Expected prefixed properties, got: %v", config.Properties)
+		}
+
+		output, err := xml.Marshal(&config)
+		if err != nil {
+			t.Fatalf("Unexpected error during marshalling: %v", err)
+		}
+
+		if string(output) != xmlData {
+			t.Fatalf("Expected XML %s, got %s", xmlData, output)
+		}
+	})
+
+	t.Run("Undeclared prefix", func(t *testing.T) {
+		xmlData := `<Config><x:Key>value</x:Key></Config>`
+		var config Config
+		if err := xml.Unmarshal([]byte(xmlData), &config); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(config.Keys) != 1 || config.Keys[0] != "x:Key" {
+			t.Fatalf("Expected key order ['x:Key'], got %v", config.Keys)
+		}
+	})
+}
+
+// TestConfig_MarshalXML tests the XML marshalling from Config struct.
+func TestConfig_MarshalXML(t *testing.T) {
+	t.Run("Marshal to XML", func(t *testing.T) {
+		config := Config{
+			Properties: map[string]string{
+				"LogLevel": "info",
+				"Theme":    "dark",
+			},
+			Keys: []string{"LogLevel", "Theme"},
+		}
+
+		expectedXML := `<Config><LogLevel>info</LogLevel><Theme>dark</Theme></Config>`
+		output, err := xml.Marshal(&config)
+		if err != nil {
+			t.Fatalf("Unexpected error during marshalling: %v", err)
+		}
+
+		output = bytes.TrimSpace(output) // Trim space to match expected exactly
+		if string(output) != expectedXML {
+			t.Fatalf("Expected XML %s, got %s", expectedXML, output)
+		}
+	})
+}
+
+// TestReadAndParseXML tests the reading and parsing of XML from a file.
+func TestReadAndParseXML(t *testing.T) {
+	t.Run("File Exists and Valid XML", func(t *testing.T) {
+		content := `<Config><LogLevel>info</LogLevel><Theme>dark</Theme></Config>`
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatalf("Unexpected error writing to temp file: %v", err)
+		}
+		file.Close()
+
+		config, err := ReadConfigFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading XML: %v", err)
+		}
+
+		if config.Properties["LogLevel"] != "info" || config.Properties["Theme"] != "dark" {
+			t.Fatalf("Expected properties not set correctly: %v", config.Properties)
+		}
+
+		if len(config.Keys) != 2 || config.Keys[0] != "LogLevel" || config.Keys[1] != "Theme" {
+			t.Fatalf("Expected key order ['LogLevel', 'Theme'], got %v", config.Keys)
+		}
+	})
+
+	t.Run("Keeps Processing Instructions and Directives", func(t *testing.T) {
+		content := `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE Config>
+<Config><?app-hint keep?><LogLevel>info</LogLevel><?trailing pi?></Config>
+<?after root?>`
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatalf("Unexpected error writing to temp file: %v", err)
+		}
+		file.Close()
+
+		config, err := ReadConfigFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading XML: %v", err)
+		}
+
+		if len(config.Prolog) != 2 || len(config.Epilog) != 1 {
+			t.Fatalf("Expected 2 prolog and 1 epilog tokens, got %d and %d", len(config.Prolog), len(config.Epilog))
+		}
+
+		if len(config.Tokens["LogLevel"]) != 1 || len(config.TrailingTokens) != 1 {
+			t.Fatalf("Expected inner tokens to be kept, got %v and %v", config.Tokens, config.TrailingTokens)
+		}
+	})
+
+	t.Run("File Does Not Exist", func(t *testing.T) {
+		_, err := ReadConfigFile("nonexistent.xml")
+		if err == nil {
+			t.Fatal("Expected error for nonexistent file, got none")
+		}
+	})
+}
+
+// TestReadAndParseXMLWithRetry tests retrying reads of partially written files.
+func TestReadAndParseXMLWithRetry(t *testing.T) {
+	t.Run("Retries truncated XML", func(t *testing.T) {
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(`<Config><LogLevel>info</LogLev`)); err != nil {
+			t.Fatalf("Unexpected error writing to temp file: %v", err)
+		}
+		file.Close()
+
+		var stdOut strings.Builder
+		logger := slog.New(slog.NewTextHandler(&stdOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		_, err = readConfigFileWithRetry(context.Background(), OSFS(), file.Name(), XMLFormat, 2, time.Millisecond, logger)
+		if err == nil {
+			t.Fatal("Expected error for truncated XML, but got none")
+		}
+
+		if strings.Count(stdOut.String(), "partially written") != 2 {
+			t.Fatalf("Expected 2 retries, got: %s", stdOut.String())
+		}
+	})
+
+	t.Run("Does not retry malformed XML", func(t *testing.T) {
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(`<Config><LogLevel>info<LogLevel></Config>`)); err != nil {
+			t.Fatalf("Unexpected error writing to temp file: %v", err)
+		}
+		file.Close()
+
+		var stdOut strings.Builder
+		logger := slog.New(slog.NewTextHandler(&stdOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		if _, err := readConfigFileWithRetry(context.Background(), OSFS(), file.Name(), XMLFormat, 2, time.Millisecond, logger); err == nil {
+			t.Fatal("Expected error for malformed XML, but got none")
+		}
+
+		if strings.Contains(stdOut.String(), "partially written") {
+			t.Fatalf("Expected no retries, got: %s", stdOut.String())
+		}
+	})
+}
+
+// TestConfig_Clone tests that a cloned configuration is independent of the original.
+func TestConfig_Clone(t *testing.T) {
+	config, err := ParseConfig([]byte(`<?xml version="1.0"?><Config><Port a="1">8989</Port></Config>`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	clone := config.Clone()
+	clone.Properties["Port"] = "9000"
+	clone.Keys[0] = "Other"
+	clone.ElementAttrs["Port"][0].Value = "2"
+
+	if config.Properties["Port"] != "8989" || config.Keys[0] != "Port" || config.ElementAttrs["Port"][0].Value != "1" {
+		t.Fatalf("Expected original configuration to be unmodified, got %+v", config)
+	}
+}
+
+// TestConfig_RepeatedSiblings tests that repeated nested elements are addressed by their
+// index, and written back in place.
+func TestConfig_RepeatedSiblings(t *testing.T) {
+	source := "<ServerConfiguration>\n  <PathSubstitutions>\n    <PathSubstitution>\n      <From>/a</From>\n      <To>/b</To>\n    </PathSubstitution>\n    <PathSubstitution>\n      <From>/c</From>\n      <To>/d</To>\n    </PathSubstitution>\n  </PathSubstitutions>\n  <CodecsUsed>\n    <string>h264</string>\n    <string>hevc</string>\n  </CodecsUsed>\n</ServerConfiguration>\n"
+	config, err := ParseConfig([]byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"PathSubstitutions.PathSubstitution.0.From", "PathSubstitutions.PathSubstitution.0.To",
+		"PathSubstitutions.PathSubstitution.1.From", "PathSubstitutions.PathSubstitution.1.To",
+		"CodecsUsed.string.0", "CodecsUsed.string.1",
+	}
+	if !reflect.DeepEqual(config.Keys, expected) {
+		t.Fatalf("Expected keys %v, got %v", expected, config.Keys)
+	}
+	if config.Properties["PathSubstitutions.PathSubstitution.1.From"] != "/c" || config.Properties["CodecsUsed.string.0"] != "h264" {
+		t.Fatalf("Unexpected properties %v", config.Properties)
+	}
+
+	config.Properties["PathSubstitutions.PathSubstitution.1.To"] = "/e"
+	config.Properties["CodecsUsed.string.0"] = "av1"
+
+	t.Run("Splice", func(t *testing.T) {
+		output, err := preserveSource(config, RenderOptions{Indent: DefaultIndent})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := strings.Replace(strings.Replace(source, "/d", "/e", 1), "h264", "av1", 1)
+		if string(output) != expected {
+			t.Fatalf("Expected %q, got %q", expected, string(output))
+		}
+	})
+
+	t.Run("Reformat", func(t *testing.T) {
+		output, err := preserveSource(config, RenderOptions{Indent: "  ", Reformat: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := strings.TrimSuffix(strings.Replace(strings.Replace(source, "/d", "/e", 1), "h264", "av1", 1), "\n")
+		if string(output) != expected {
+			t.Fatalf("Expected %q, got %q", expected, string(output))
+		}
+	})
+}
+
+// TestConfig_Nested tests addressing nested elements by their path and writing them back,
+// including created keys below existing and missing parents.
+func TestConfig_Nested(t *testing.T) {
+	source := "<ServerConfiguration>\n  <LogFileRetentionDays>3</LogFileRetentionDays>\n  <Server>\n    <Port>8096</Port>\n    <!-- Public -->\n    <UrlBase />\n  </Server>\n</ServerConfiguration>\n"
+	config, err := ParseConfig([]byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []string{"LogFileRetentionDays", "Server.Port", "Server.UrlBase"}; !reflect.DeepEqual(config.Keys, expected) {
+		t.Fatalf("Expected keys %v, got %v", expected, config.Keys)
+	}
+
+	t.Run("Environment variables", func(t *testing.T) {
+		fsys := mapFS{fstest.MapFS{"system.xml": &fstest.MapFile{Data: []byte(source)}}}
+		_, err := Run(context.Background(), WithFS(fsys), WithConfigPath("system.xml"), WithSources(EnvSource([]string{"CONFIGARR__X=Server.Port=8097"}, "CONFIGARR__")))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := strings.Replace(source, "8096", "8097", 1); string(fsys.MapFS["system.xml"].Data) != expected {
+			t.Fatalf("Expected %q, got %q", expected, string(fsys.MapFS["system.xml"].Data))
+		}
+	})
+
+	config.Properties["Server.Port"] = "8097"
+	config.Properties["Server.UrlBase"] = "/jellyfin"
+	config.Keys = append(config.Keys, "Network.Http.Port", "Server.Address")
+	config.Properties["Network.Http.Port"] = "80"
+	config.Properties["Server.Address"] = "0.0.0.0"
+
+	t.Run("Splice", func(t *testing.T) {
+		output, err := preserveSource(config, RenderOptions{Indent: DefaultIndent})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := "<ServerConfiguration>\n  <LogFileRetentionDays>3</LogFileRetentionDays>\n  <Server>\n    <Port>8097</Port>\n    <!-- Public -->\n    <UrlBase>/jellyfin</UrlBase>\n    <Address>0.0.0.0</Address>\n  </Server>\n  <Network>\n    <Http>\n      <Port>80</Port>\n    </Http>\n  </Network>\n</ServerConfiguration>\n"
+		if string(output) != expected {
+			t.Fatalf("Expected %q, got %q", expected, string(output))
+		}
+	})
+
+	t.Run("Reformat", func(t *testing.T) {
+		output, err := preserveSource(config, RenderOptions{Indent: "\t", Reformat: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := "<ServerConfiguration>\n\t<LogFileRetentionDays>3</LogFileRetentionDays>\n\t<Server>\n\t\t<Port>8097</Port><!-- Public -->\n\t\t<UrlBase>/jellyfin</UrlBase>\n\t\t<Address>0.0.0.0</Address>\n\t</Server>\n\t<Network>\n\t\t<Http>\n\t\t\t<Port>80</Port>\n\t\t</Http>\n\t</Network>\n</ServerConfiguration>"
+		if string(output) != expected {
+			t.Fatalf("Expected %q, got %q", expected, string(output))
+		}
+	})
+}
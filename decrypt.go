@@ -0,0 +1,106 @@
+package configarr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EncryptedValuePrefix marks encrypted override values of the form
+// enc:<provider>:<ciphertext>, e.g. enc:vault:vault:v1:8SDd3WHDOjf7mq69... Such values
+// are decrypted by the named provider when the sources are read, before the overrides
+// are planned.
+const EncryptedValuePrefix = "enc:"
+
+// Decrypter decrypts override values, e.g. with age, a cloud KMS or Vault transit.
+type Decrypter interface {
+	Decrypt(ctx context.Context, ciphertext string) (string, error)
+}
+
+// DecrypterFunc adapts a function to the Decrypter interface.
+type DecrypterFunc func(ctx context.Context, ciphertext string) (string, error)
+
+// Decrypt calls f(ctx, ciphertext).
+func (f DecrypterFunc) Decrypt(ctx context.Context, ciphertext string) (string, error) {
+	return f(ctx, ciphertext)
+}
+
+var (
+	decrypterMu sync.RWMutex
+	decrypters  = map[string]Decrypter{}
+)
+
+// RegisterDecrypter makes a provider available to all runs under the name, see
+// EncryptedValuePrefix. Registering an existing name replaces it; WithDecrypter takes
+// precedence for a single run.
+func RegisterDecrypter(name string, decrypter Decrypter) {
+	decrypterMu.Lock()
+	defer decrypterMu.Unlock()
+
+	decrypters[name] = decrypter
+}
+
+// DecrypterNames returns the names of the registered providers in sorted order.
+func DecrypterNames() []string {
+	decrypterMu.RLock()
+	defer decrypterMu.RUnlock()
+
+	names := make([]string, 0, len(decrypters))
+	for name := range decrypters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupDecrypter returns the provider of the run or the registered one with the name.
+func (o options) lookupDecrypter(name string) (Decrypter, bool) {
+	if decrypter, exists := o.decrypters[name]; exists {
+		return decrypter, true
+	}
+	decrypterMu.RLock()
+	defer decrypterMu.RUnlock()
+
+	decrypter, exists := decrypters[name]
+	return decrypter, exists
+}
+
+// hasDecrypters reports whether any provider is available to the run.
+func (o options) hasDecrypters() bool {
+	decrypterMu.RLock()
+	defer decrypterMu.RUnlock()
+
+	return len(o.decrypters) > 0 || len(decrypters) > 0
+}
+
+// decryptOverrides returns the overrides with their encrypted values replaced by their
+// plaintext. Without any provider, values are taken as they are, so a value that merely
+// starts with enc: isn't refused. Errors name the source of the override, never its value.
+func decryptOverrides(ctx context.Context, overrides []Override, o options) ([]Override, error) {
+	if !o.hasDecrypters() {
+		return overrides, nil
+	}
+	decrypted := append([]Override(nil), overrides...)
+	for i, override := range overrides {
+		encrypted, found := strings.CutPrefix(override.Value, EncryptedValuePrefix)
+		if !found || override.Delete {
+			continue
+		}
+		name, ciphertext, found := strings.Cut(encrypted, ":")
+		if !found || name == "" {
+			return nil, categorize(ErrInvalid, fmt.Errorf("invalid encrypted value for %s%s: expected %s<provider>:<ciphertext>", override.Key, describeSource(override.Source), EncryptedValuePrefix))
+		}
+		decrypter, exists := o.lookupDecrypter(name)
+		if !exists {
+			return nil, categorize(ErrInvalid, fmt.Errorf("unknown decryption provider %q for %s%s", name, override.Key, describeSource(override.Source)))
+		}
+		plaintext, err := decrypter.Decrypt(ctx, ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting %s with %s%s: %w", override.Key, name, describeSource(override.Source), err)
+		}
+		decrypted[i].Value = plaintext
+	}
+	return decrypted, nil
+}
@@ -0,0 +1,88 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDecryptOverrides tests decrypting encrypted override values with registered and per-run providers.
+func TestDecryptOverrides(t *testing.T) {
+	t.Run("No providers", func(t *testing.T) {
+		overrides := []Override{{Key: "ApiKey", Value: "enc:reverse:terces"}}
+		decrypted, err := decryptOverrides(context.Background(), overrides, defaultOptions())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(decrypted, overrides) {
+			t.Fatalf("Expected the values to be taken as they are, got %+v", decrypted)
+		}
+	})
+
+	reverse := DecrypterFunc(func(ctx context.Context, ciphertext string) (string, error) {
+		runes := []rune(ciphertext)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	})
+	RegisterDecrypter("reverse", reverse)
+
+	overrides := []Override{
+		{Key: "ApiKey", Value: "enc:reverse:terces", Source: "env:CONFIGARR__KEY"},
+		{Key: "Port", Value: "8989"},
+	}
+
+	t.Run("Registered provider", func(t *testing.T) {
+		decrypted, err := decryptOverrides(context.Background(), overrides, defaultOptions())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []Override{{Key: "ApiKey", Value: "secret", Source: "env:CONFIGARR__KEY"}, {Key: "Port", Value: "8989"}}
+		if !reflect.DeepEqual(decrypted, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, decrypted)
+		}
+		if overrides[0].Value != "enc:reverse:terces" {
+			t.Fatal("Expected the overrides of the source to be left untouched")
+		}
+	})
+
+	t.Run("Provider of the run takes precedence", func(t *testing.T) {
+		upper := DecrypterFunc(func(ctx context.Context, ciphertext string) (string, error) {
+			return strings.ToUpper(ciphertext), nil
+		})
+		o, _ := newOptions([]Option{WithDecrypter("reverse", upper)})
+		decrypted, err := decryptOverrides(context.Background(), overrides, o)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if decrypted[0].Value != "TERCES" {
+			t.Fatalf("Expected value 'TERCES', got '%s'", decrypted[0].Value)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		failing := DecrypterFunc(func(ctx context.Context, ciphertext string) (string, error) {
+			return "", errors.New("access denied")
+		})
+		o, _ := newOptions([]Option{WithDecrypter("vault", failing)})
+
+		for _, value := range []string{"enc:unknown:abc", "enc:abc"} {
+			_, err := decryptOverrides(context.Background(), []Override{{Key: "ApiKey", Value: value}}, o)
+			if !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Expected ErrInvalid for %s, got %v", value, err)
+			}
+		}
+
+		_, err := decryptOverrides(context.Background(), []Override{{Key: "ApiKey", Value: "enc:vault:ciphertext", Source: "env:KEY"}}, o)
+		if err == nil || !strings.Contains(err.Error(), "access denied") || strings.Contains(err.Error(), "ciphertext") {
+			t.Fatalf("Expected provider error without the value, got %v", err)
+		}
+	})
+
+	if names := DecrypterNames(); !reflect.DeepEqual(names, []string{"reverse"}) {
+		t.Fatalf("Expected registered providers [reverse], got %v", names)
+	}
+}
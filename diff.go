@@ -0,0 +1,159 @@
+package configarr
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes in a unified diff.
+const diffContext = 3
+
+// diffLine is a line of a diff: ' ' unchanged, '-' removed or '+' added.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// UnifiedDiff returns the changes from before to after as a unified diff of the named
+// file, or the empty string when the contents are equal.
+func UnifiedDiff(name string, before, after []byte) string {
+	if bytes.Equal(before, after) {
+		return ""
+	}
+	lines := diffLines(splitLines(before), splitLines(after))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", strings.TrimPrefix(name, "/"), strings.TrimPrefix(name, "/"))
+
+	oldLine, newLine := 1, 1 // Line numbers at lines[i]
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i, oldLine, newLine = i+1, oldLine+1, newLine+1
+			continue
+		}
+
+		// A hunk starts with up to diffContext unchanged lines and extends while the
+		// next change is at most 2*diffContext unchanged lines away
+		start := max(i-diffContext, 0)
+		end := i
+		for unchanged := 0; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > i && lines[end-1].op == ' ' {
+			end--
+		}
+		end = min(end+diffContext, len(lines))
+
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		var oldCount, newCount int
+		var hunk strings.Builder
+		for _, line := range lines[start:end] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+			hunk.WriteByte(line.op)
+			hunk.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				hunk.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		out.WriteString(hunk.String())
+
+		for _, line := range lines[i:end] {
+			if line.op != '+' {
+				oldLine++
+			}
+			if line.op != '-' {
+				newLine++
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of a hunk, following GNU diff for empty ranges.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits the content after each newline, keeping the newlines.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
+	}
+	return lines
+}
+
+// diffLines computes a minimal line diff with a longest common subsequence, skipping
+// the common prefix and suffix first since changes to configuration files are small.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of ma[i:] and mb[j:]
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			lines = append(lines, diffLine{' ', ma[i]})
+			i, j = i+1, j+1
+		case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', ma[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', mb[j]})
+			j++
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', line})
+	}
+	return lines
+}
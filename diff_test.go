@@ -0,0 +1,95 @@
+package configarr
+
+import "testing"
+
+// TestUnifiedDiff tests the unified diffs of configuration files.
+func TestUnifiedDiff(t *testing.T) {
+	before := "<Config>\n  <A>1</A>\n  <B>2</B>\n  <C>3</C>\n  <D>4</D>\n  <E>5</E>\n  <F>6</F>\n  <G>7</G>\n  <H>8</H>\n  <I>9</I>\n  <J>10</J>\n</Config>\n"
+
+	tests := []struct {
+		name, after, expected string
+	}{
+		{"Equal", before, ""},
+		{
+			"Changed line",
+			"<Config>\n  <A>1</A>\n  <B>20</B>\n  <C>3</C>\n  <D>4</D>\n  <E>5</E>\n  <F>6</F>\n  <G>7</G>\n  <H>8</H>\n  <I>9</I>\n  <J>10</J>\n</Config>\n",
+			"--- a/config/config.xml\n+++ b/config/config.xml\n@@ -1,6 +1,6 @@\n <Config>\n   <A>1</A>\n-  <B>2</B>\n+  <B>20</B>\n   <C>3</C>\n   <D>4</D>\n   <E>5</E>\n",
+		},
+		{
+			"Separate hunks",
+			"<Config>\n  <A>10</A>\n  <B>2</B>\n  <C>3</C>\n  <D>4</D>\n  <E>5</E>\n  <F>6</F>\n  <G>7</G>\n  <H>8</H>\n  <I>9</I>\n  <J>10</J>\n  <K>11</K>\n</Config>",
+			"--- a/config/config.xml\n+++ b/config/config.xml\n@@ -1,5 +1,5 @@\n <Config>\n-  <A>1</A>\n+  <A>10</A>\n   <B>2</B>\n   <C>3</C>\n   <D>4</D>\n" +
+				"@@ -9,4 +9,5 @@\n   <H>8</H>\n   <I>9</I>\n   <J>10</J>\n-</Config>\n+  <K>11</K>\n+</Config>\n\\ No newline at end of file\n",
+		},
+		{
+			"Empty after",
+			"",
+			"--- a/config/config.xml\n+++ b/config/config.xml\n@@ -1,12 +0,0 @@\n" + prefixLines("-", before),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := UnifiedDiff("/config/config.xml", []byte(before), []byte(tt.after)); diff != tt.expected {
+				t.Fatalf("Expected diff:\n%s\ngot:\n%s", tt.expected, diff)
+			}
+		})
+	}
+}
+
+// prefixLines prefixes every line of the text.
+func prefixLines(prefix, text string) string {
+	var out string
+	for _, line := range splitLines([]byte(text)) {
+		out += prefix + line
+	}
+	return out
+}
+
+// TestMaskSecretElements tests masking secret values in XML, JSON, YAML and INI text.
+func TestMaskSecretElements(t *testing.T) {
+	text := "-  <ApiKey>old</ApiKey>\n+  <ApiKey>new</ApiKey>\n   <Port>8989</Port>\n"
+	expected := "-  <ApiKey>********</ApiKey>\n+  <ApiKey>********</ApiKey>\n   <Port>8989</Port>\n"
+	if masked := MaskSecretElements(text); masked != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, masked)
+	}
+
+	t.Run("CDATA", func(t *testing.T) {
+		text := "-  <ApiKey><![CDATA[sekrit1]]></ApiKey>\n+  <ApiKey><![CDATA[new<]]>]]><![CDATA[>sekrit]]></ApiKey>\n   <Port><![CDATA[8989]]></Port>\n"
+		expected := "-  <ApiKey><![CDATA[********]]></ApiKey>\n+  <ApiKey><![CDATA[********]]></ApiKey>\n   <Port><![CDATA[8989]]></Port>\n"
+		if masked := MaskSecretElements(text); masked != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, masked)
+		}
+	})
+
+	t.Run("XML attributes", func(t *testing.T) {
+		text := "-<Preferences PlexOnlineToken=\"old\" FriendlyName=\"x\"/>\n+<Preferences PlexOnlineToken='new' FriendlyName=\"x\"\n+  ApiKey=\"a>b\" Password=\"\"/>\n"
+		expected := "-<Preferences PlexOnlineToken=\"********\" FriendlyName=\"x\"/>\n+<Preferences PlexOnlineToken='********' FriendlyName=\"x\"\n+  ApiKey=\"********\" Password=\"\"/>\n"
+		if masked := MaskSecretElements(text); masked != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, masked)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		text := "-    \"apiKey\": \"old\\\"key\",\n+    \"apiKey\": \"new\",\n     \"port\": \"5055\"\n"
+		expected := "-    \"apiKey\": \"********\",\n+    \"apiKey\": \"********\",\n     \"port\": \"5055\"\n"
+		if masked := MaskSecretElements(text); masked != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, masked)
+		}
+	})
+
+	t.Run("INI", func(t *testing.T) {
+		text := "-api_key = old\n+api_key = new\n port = 8080\n WebUI\\Password_PBKDF2=\"@ByteArray(abc)\"\n"
+		expected := "-api_key = ********\n+api_key = ********\n port = 8080\n WebUI\\Password_PBKDF2=********\n"
+		if masked := MaskSecretElements(text); masked != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, masked)
+		}
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		text := "   sonarr:\n-    apikey: old\n+    apikey: new # rotated\n     port: 8989\n     password: ''\n"
+		expected := "   sonarr:\n-    apikey: ********\n+    apikey: ********\n     port: 8989\n     password: ********\n"
+		if masked := MaskSecretElements(text); masked != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, masked)
+		}
+	})
+}
@@ -0,0 +1,411 @@
+package configarr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseJSONOverrides parses a flat JSON object into overrides, keeping the document order.
+// Numbers and booleans are taken verbatim as written in the document.
+func ParseJSONOverrides(data []byte) ([]Override, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	if token, err := d.Token(); err != nil || token != json.Delim('{') {
+		return nil, errors.New("expected a JSON object")
+	}
+
+	var overrides []Override
+	for d.More() {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string) // Object keys are always strings
+
+		token, err = d.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value string
+		switch v := token.(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = fmt.Sprint(v)
+		case nil:
+			return nil, fmt.Errorf("value of %s is null", key)
+		default:
+			return nil, fmt.Errorf("value of %s must be a string, number or boolean", key)
+		}
+		overrides = append(overrides, Override{Key: key, Value: value})
+	}
+
+	if _, err := d.Token(); err != nil { // Closing brace
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+
+	return overrides, nil
+}
+
+// ParseYAMLOverrides parses a flat YAML mapping into overrides, keeping the document order.
+// Scalars are taken verbatim as written in the document.
+func ParseYAMLOverrides(data []byte) ([]Override, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil // Empty document
+	}
+
+	return yamlMappingOverrides(doc.Content[0])
+}
+
+// yamlMappingOverrides converts a flat YAML mapping node into overrides.
+func yamlMappingOverrides(mapping *yaml.Node) ([]Override, error) {
+	if mapping.Kind != yaml.MappingNode {
+		return nil, errors.New("expected a YAML mapping")
+	}
+
+	var overrides []Override
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if value.Kind == yaml.MappingNode {
+			override, err := yamlConditionalOverride(key.Value, value)
+			if err != nil {
+				return nil, err
+			}
+			overrides = append(overrides, override)
+			continue
+		}
+		if value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("value of %s must be a scalar", key.Value)
+		}
+		if value.Tag == "!!null" {
+			return nil, fmt.Errorf("value of %s is null", key.Value)
+		}
+		overrides = append(overrides, Override{Key: key.Value, Value: value.Value})
+	}
+
+	return overrides, nil
+}
+
+// yamlConditionalOverride parses a value of the form {value: <value>, if: <condition>},
+// which is only applied when the condition holds (see parseCondition).
+func yamlConditionalOverride(key string, mapping *yaml.Node) (Override, error) {
+	override := Override{Key: key}
+	hasValue := false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		field, value := mapping.Content[i].Value, mapping.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.Tag == "!!null" {
+			return Override{}, fmt.Errorf("%s of %s must be a scalar", field, key)
+		}
+		switch field {
+		case "value":
+			override.Value, hasValue = value.Value, true
+		case "if":
+			if _, err := parseCondition(value.Value); err != nil {
+				return Override{}, fmt.Errorf("condition of %s: %w", key, err)
+			}
+			override.Condition = value.Value
+		default:
+			return Override{}, fmt.Errorf("value of %s has unknown field %s, expected value and if", key, field)
+		}
+	}
+	if !hasValue {
+		return Override{}, fmt.Errorf("value of %s is missing", key)
+	}
+	return override, nil
+}
+
+// AppState is the desired state of the properties of a single application.
+type AppState struct {
+	App       string
+	Overrides []Override
+}
+
+// ParseDesiredState parses a YAML document mapping application names to flat mappings
+// of their properties, e.g. "sonarr: {LogLevel: debug}", keeping the document order.
+func ParseDesiredState(data []byte) ([]AppState, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil // Empty document
+	}
+
+	apps := doc.Content[0]
+	if apps.Kind != yaml.MappingNode {
+		return nil, errors.New("expected a YAML mapping of applications")
+	}
+
+	var states []AppState
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(apps.Content); i += 2 {
+		app := apps.Content[i].Value
+		if seen[app] {
+			return nil, fmt.Errorf("application %s is defined more than once", app)
+		}
+		seen[app] = true
+
+		overrides, err := yamlMappingOverrides(apps.Content[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("application %s: %w", app, err)
+		}
+		states = append(states, AppState{App: app, Overrides: overrides})
+	}
+	return states, nil
+}
+
+// FleetHost is a remote host whose configuration file is verified against its desired properties.
+type FleetHost struct {
+	Name       string
+	SSH        string // SSH destination, e.g. admin@nas.local
+	ConfigPath string
+	Overrides  []Override
+}
+
+// ParseFleet parses a YAML mapping of host names to their SSH destination, configuration
+// file and desired properties, keeping the document order:
+//
+//	nas:
+//	  ssh: admin@nas.local
+//	  config: /srv/sonarr/config.xml
+//	  properties:
+//	    Port: 8989
+//
+// The destination defaults to the host name and the configuration file to DefaultConfigPath.
+// Destinations are checked with ValidateSSHDestination.
+func ParseFleet(data []byte) ([]FleetHost, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil // Empty document
+	}
+
+	hosts := doc.Content[0]
+	if hosts.Kind != yaml.MappingNode {
+		return nil, errors.New("expected a YAML mapping of hosts")
+	}
+
+	var fleet []FleetHost
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(hosts.Content); i += 2 {
+		name, spec := hosts.Content[i].Value, hosts.Content[i+1]
+		if seen[name] {
+			return nil, fmt.Errorf("host %s is defined more than once", name)
+		}
+		seen[name] = true
+		if spec.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("host %s: expected a YAML mapping", name)
+		}
+
+		host := FleetHost{Name: name, SSH: name, ConfigPath: DefaultConfigPath}
+		for j := 0; j+1 < len(spec.Content); j += 2 {
+			field, value := spec.Content[j].Value, spec.Content[j+1]
+			switch field {
+			case "ssh":
+				host.SSH = value.Value
+			case "config":
+				host.ConfigPath = value.Value
+			case "properties":
+				overrides, err := yamlMappingOverrides(value)
+				if err != nil {
+					return nil, fmt.Errorf("host %s: %w", name, err)
+				}
+				host.Overrides = overrides
+			default:
+				return nil, fmt.Errorf("host %s: unknown field %s", name, field)
+			}
+		}
+		if err := ValidateSSHDestination(host.SSH); err != nil {
+			return nil, fmt.Errorf("host %s: %w", name, err)
+		}
+		fleet = append(fleet, host)
+	}
+	return fleet, nil
+}
+
+// ValidateSSHDestination refuses SSH destinations that are empty or the SSH client would
+// take for an option, e.g. -oProxyCommand=..., which runs a command on the local host.
+func ValidateSSHDestination(destination string) error {
+	switch {
+	case destination == "":
+		return errors.New("empty SSH destination")
+	case strings.HasPrefix(destination, "-"):
+		return fmt.Errorf("invalid SSH destination %q: must not start with -", destination)
+	}
+	return nil
+}
+
+// ParseKVOverrides parses KEY=VALUE lines into overrides. Blank lines and lines
+// starting with '#' are ignored.
+func ParseKVOverrides(data []byte) ([]Override, error) {
+	var overrides []Override
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE, got %q", i+1, line)
+		}
+		overrides = append(overrides, Override{Key: key, Value: value})
+	}
+	return overrides, nil
+}
+
+// DownwardPrefix is the prefix of pod annotations and labels that set properties,
+// e.g. configarr.io/LogLevel.
+const DownwardPrefix = "configarr.io/"
+
+// ParseDownwardOverrides parses an annotations or labels file of a Kubernetes Downward API
+// volume, with lines of the form key="value". Keys starting with DownwardPrefix become
+// overrides of the property named by the rest of the key; other keys are ignored.
+func ParseDownwardOverrides(data []byte) ([]Override, error) {
+	var overrides []Override
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		key, quoted, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected key=\"value\", got %q", i+1, line)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %s: %w", i+1, quoted, err)
+		}
+
+		property, found := strings.CutPrefix(key, DownwardPrefix)
+		if !found || property == "" {
+			continue
+		}
+		overrides = append(overrides, Override{Key: property, Value: value})
+	}
+	return overrides, nil
+}
+
+// EnvVar is an environment variable encoding an override.
+type EnvVar struct {
+	Name  string
+	Value string // <PROPERTY>=<VALUE>
+}
+
+// OverrideEnvVars encodes the overrides as the environment variables EnvSourceWith reads
+// with the prefix and delimiter, named after their key, e.g. {Key: "LogLevel", Value:
+// "debug"} becomes CONFIGARR__LOGLEVEL=LogLevel=debug. Deletes become variables with the
+// unset prefix. Conditions, keys containing the delimiter and keys mapping to the same
+// variable can't be encoded and are errors.
+func OverrideEnvVars(overrides []Override, prefix, delimiter string) ([]EnvVar, error) {
+	if delimiter == "" {
+		delimiter = DefaultDelimiter
+	}
+
+	var vars []EnvVar
+	seen := make(map[string]string)
+	for _, override := range overrides {
+		switch {
+		case override.Condition != "":
+			return nil, fmt.Errorf("condition of %s can't be encoded in an environment variable", override.Key)
+		case strings.Contains(override.Key, delimiter):
+			return nil, fmt.Errorf("key %s contains the delimiter %q, use another one", override.Key, delimiter)
+		}
+
+		name := strings.ToUpper(prefix) + envIdentifier([]string{override.Key})
+		value := override.Key + delimiter + override.Value
+		if override.Delete {
+			name, value = UnsetPrefix(prefix)+envIdentifier([]string{override.Key}), override.Key
+		}
+		if other, exists := seen[name]; exists {
+			return nil, fmt.Errorf("%s and %s map to the same variable %s", other, override.Key, name)
+		}
+		seen[name] = override.Key
+		vars = append(vars, EnvVar{Name: name, Value: value})
+	}
+	return vars, nil
+}
+
+// FlattenYAML converts a nested YAML mapping into the environment variables that encode
+// its leaves as overrides, keeping the document order. The leaf key is the property and
+// the path to it, joined with underscores and upper-cased, forms the identifier, e.g.
+// "sonarr: {Port: 8989}" becomes CONFIGARR__SONARR_PORT=Port=8989.
+func FlattenYAML(data []byte, prefix string) ([]EnvVar, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil // Empty document
+	}
+
+	var vars []EnvVar
+	seen := make(map[string]bool)
+	var walk func(node *yaml.Node, path []string) error
+	walk = func(node *yaml.Node, path []string) error {
+		if node.Kind != yaml.MappingNode {
+			if len(path) == 0 {
+				return errors.New("expected a YAML mapping")
+			}
+			return fmt.Errorf("value of %s must be a mapping or a scalar", strings.Join(path, "."))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := append(append([]string(nil), path...), key.Value)
+
+			if value.Kind != yaml.ScalarNode {
+				if err := walk(value, keyPath); err != nil {
+					return err
+				}
+				continue
+			}
+			if value.Tag == "!!null" {
+				return fmt.Errorf("value of %s is null", strings.Join(keyPath, "."))
+			}
+
+			name := strings.ToUpper(prefix) + envIdentifier(keyPath)
+			if seen[name] {
+				return fmt.Errorf("%s maps to the already used variable %s", strings.Join(keyPath, "."), name)
+			}
+			seen[name] = true
+			vars = append(vars, EnvVar{Name: name, Value: key.Value + "=" + value.Value})
+		}
+		return nil
+	}
+
+	if err := walk(doc.Content[0], nil); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// envIdentifier joins the path into an upper-case identifier, replacing characters
+// that are not valid in environment variable names with underscores.
+func envIdentifier(path []string) string {
+	identifier := strings.ToUpper(strings.Join(path, "_"))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, identifier)
+}
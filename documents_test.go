@@ -0,0 +1,236 @@
+package configarr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseJSONOverrides tests parsing flat JSON documents into overrides.
+func TestParseJSONOverrides(t *testing.T) {
+	t.Run("Flat object", func(t *testing.T) {
+		overrides, err := ParseJSONOverrides([]byte(`{"LogLevel":"debug","Port":8990,"LaunchBrowser":false,"Ratio":1.10}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []Override{
+			{Key: "LogLevel", Value: "debug"},
+			{Key: "Port", Value: "8990"},
+			{Key: "LaunchBrowser", Value: "false"},
+			{Key: "Ratio", Value: "1.10"},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+	})
+
+	t.Run("Invalid documents", func(t *testing.T) {
+		for _, doc := range []string{`["LogLevel"]`, `{"LogLevel":{"Nested":1}}`, `{"LogLevel":null}`, `{"LogLevel":"debug"} {}`, `{"LogLevel":`} {
+			if _, err := ParseJSONOverrides([]byte(doc)); err == nil {
+				t.Fatalf("Expected error for %s, but got none", doc)
+			}
+		}
+	})
+}
+
+// TestParseYAMLOverrides tests parsing flat YAML documents into overrides.
+func TestParseYAMLOverrides(t *testing.T) {
+	t.Run("Flat mapping", func(t *testing.T) {
+		overrides, err := ParseYAMLOverrides([]byte("LogLevel: debug\nPort: 8990\nUrlBase: \"\"\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []Override{
+			{Key: "LogLevel", Value: "debug"},
+			{Key: "Port", Value: "8990"},
+			{Key: "UrlBase", Value: ""},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+	})
+
+	t.Run("Conditional values", func(t *testing.T) {
+		overrides, err := ParseYAMLOverrides([]byte("EnableSsl:\n  value: True\n  if: SslCertPath != \"\"\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []Override{{Key: "EnableSsl", Value: "True", Condition: `SslCertPath != ""`}}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+	})
+
+	t.Run("Invalid documents", func(t *testing.T) {
+		for _, doc := range []string{"- LogLevel", "LogLevel:\n  Nested: 1", "LogLevel: ~", "LogLevel: [a", "LogLevel: {if: Port}", "LogLevel: {value: debug, if: \"Log Level\"}"} {
+			if _, err := ParseYAMLOverrides([]byte(doc)); err == nil {
+				t.Fatalf("Expected error for %q, but got none", doc)
+			}
+		}
+	})
+}
+
+// TestParseKVOverrides tests parsing KEY=VALUE lines into overrides.
+func TestParseKVOverrides(t *testing.T) {
+	t.Run("Lines with comments and blanks", func(t *testing.T) {
+		overrides, err := ParseKVOverrides([]byte("# comment\nLogLevel=debug\r\n\nApiKey=a=b\nUrlBase=\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []Override{
+			{Key: "LogLevel", Value: "debug"},
+			{Key: "ApiKey", Value: "a=b"},
+			{Key: "UrlBase", Value: ""},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+	})
+
+	t.Run("Invalid line", func(t *testing.T) {
+		if _, err := ParseKVOverrides([]byte("LogLevel=debug\nPort\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Fatalf("Expected error for line 2, got: %v", err)
+		}
+	})
+}
+
+// TestParseDownwardOverrides tests parsing Downward API annotation files into overrides.
+func TestParseDownwardOverrides(t *testing.T) {
+	t.Run("Prefixed keys", func(t *testing.T) {
+		data := "app=\"sonarr\"\nconfigarr.io/LogLevel=\"debug\"\nconfigarr.io/UrlBase=\"/tv \\\"x\\\"\"\n"
+		overrides, err := ParseDownwardOverrides([]byte(data))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []Override{
+			{Key: "LogLevel", Value: "debug"},
+			{Key: "UrlBase", Value: `/tv "x"`},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %v, got %v", expected, overrides)
+		}
+	})
+
+	t.Run("Unquoted value", func(t *testing.T) {
+		if _, err := ParseDownwardOverrides([]byte("configarr.io/LogLevel=debug\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Fatalf("Expected error for line 1, got: %v", err)
+		}
+	})
+}
+
+// TestFlattenYAML tests converting nested values into override environment variables.
+func TestFlattenYAML(t *testing.T) {
+	t.Run("Nested mapping", func(t *testing.T) {
+		data := []byte("LogLevel: debug\nsonarr:\n  Port: 8989\n  auth:\n    AuthenticationMethod: Forms\n  UrlBase: /sonarr\n")
+
+		vars, err := FlattenYAML(data, "configarr__")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []EnvVar{
+			{Name: "CONFIGARR__LOGLEVEL", Value: "LogLevel=debug"},
+			{Name: "CONFIGARR__SONARR_PORT", Value: "Port=8989"},
+			{Name: "CONFIGARR__SONARR_AUTH_AUTHENTICATIONMETHOD", Value: "AuthenticationMethod=Forms"},
+			{Name: "CONFIGARR__SONARR_URLBASE", Value: "UrlBase=/sonarr"},
+		}
+		if !reflect.DeepEqual(vars, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, vars)
+		}
+	})
+
+	t.Run("Invalid documents", func(t *testing.T) {
+		for _, doc := range []string{"- a\n", "a:\n  - b\n", "a: ~\n", "a-b: 1\na_b: 2\n"} {
+			if _, err := FlattenYAML([]byte(doc), DefaultPrefix); err == nil {
+				t.Fatalf("Expected error for %q, but got none", doc)
+			}
+		}
+	})
+}
+
+// TestOverrideEnvVars tests encoding overrides as environment variables.
+func TestOverrideEnvVars(t *testing.T) {
+	overrides := []Override{{Key: "LogLevel", Value: "debug"}, {Key: "Url.Base", Value: "a=b"}, {Key: "SslCertPath", Delete: true}}
+	vars, err := OverrideEnvVars(overrides, DefaultPrefix, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []EnvVar{
+		{Name: "CONFIGARR__LOGLEVEL", Value: "LogLevel=debug"},
+		{Name: "CONFIGARR__URL_BASE", Value: "Url.Base=a=b"},
+		{Name: "CONFIGARR_UNSET__SSLCERTPATH", Value: "SslCertPath"},
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, vars)
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, overrides := range [][]Override{
+			{{Key: "Port", Value: "1", Condition: "Port == 2"}},
+			{{Key: "A=B", Value: "1"}},
+			{{Key: "A-B", Value: "1"}, {Key: "A_B", Value: "2"}},
+		} {
+			if _, err := OverrideEnvVars(overrides, DefaultPrefix, DefaultDelimiter); err == nil {
+				t.Fatalf("Expected error for %+v, but got none", overrides)
+			}
+		}
+	})
+}
+
+// TestParseDesiredState tests parsing per-app desired state documents.
+func TestParseDesiredState(t *testing.T) {
+	t.Run("Apps in document order", func(t *testing.T) {
+		states, err := ParseDesiredState([]byte("sonarr: {LogLevel: debug, UrlBase: /sonarr}\nradarr:\n  Port: 7878\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []AppState{
+			{App: "sonarr", Overrides: []Override{{Key: "LogLevel", Value: "debug"}, {Key: "UrlBase", Value: "/sonarr"}}},
+			{App: "radarr", Overrides: []Override{{Key: "Port", Value: "7878"}}},
+		}
+		if !reflect.DeepEqual(states, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, states)
+		}
+	})
+
+	t.Run("Invalid documents", func(t *testing.T) {
+		for _, doc := range []string{"- sonarr\n", "sonarr: debug\n", "sonarr: {Auth: {Method: Forms}}\n", "sonarr: {}\nsonarr: {}\n"} {
+			if _, err := ParseDesiredState([]byte(doc)); err == nil {
+				t.Fatalf("Expected error for %q, but got none", doc)
+			}
+		}
+	})
+}
+
+// TestParseFleet tests parsing the hosts of a fleet with their desired properties.
+func TestParseFleet(t *testing.T) {
+	t.Run("Hosts in document order", func(t *testing.T) {
+		doc := "nas:\n  ssh: admin@nas.local\n  config: /srv/sonarr/config.xml\n  properties: {Port: 8989}\npi: {}\n"
+		fleet, err := ParseFleet([]byte(doc))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []FleetHost{
+			{Name: "nas", SSH: "admin@nas.local", ConfigPath: "/srv/sonarr/config.xml", Overrides: []Override{{Key: "Port", Value: "8989"}}},
+			{Name: "pi", SSH: "pi", ConfigPath: DefaultConfigPath},
+		}
+		if !reflect.DeepEqual(fleet, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, fleet)
+		}
+	})
+
+	t.Run("Invalid documents", func(t *testing.T) {
+		for _, doc := range []string{"- nas\n", "nas: admin@nas\n", "nas: {user: admin}\n", "nas: {properties: {Auth: {Method: Forms}}}\n", "nas: {}\nnas: {}\n", "nas: {ssh: -oProxyCommand=touch /tmp/pwned}\n", "-oProxyCommand=id: {}\n", "nas: {ssh: ''}\n"} {
+			if _, err := ParseFleet([]byte(doc)); err == nil {
+				t.Fatalf("Expected error for %q, but got none", doc)
+			}
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package configarr
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// envVar is a variable of an indexed environment, split once.
+type envVar struct {
+	raw         string // As in the environment, NAME=VALUE
+	name, value string
+	found       bool // Whether the variable has a '='
+}
+
+// envIndex is an environment sorted for looking up its variables by the prefix of their
+// name, so sources for many prefixes, e.g. of dozens of targets in daemon mode, don't
+// sort, split and compare every variable of a large environment on each read.
+type envIndex struct {
+	vars  []envVar // In byte order
+	upper []string // Names of vars in upper case, in the same order
+	order []int    // Indexes of vars, ordered by their upper-case name
+}
+
+// lastEnvIndex is the index of the most recently indexed environment, since the sources
+// of all targets usually share one.
+var lastEnvIndex struct {
+	sync.Mutex
+	environ []string
+	index   *envIndex
+}
+
+// indexEnv returns the index of the environment, reusing the last one when environ is the
+// same slice.
+func indexEnv(environ []string) *envIndex {
+	lastEnvIndex.Lock()
+	defer lastEnvIndex.Unlock()
+	cached := lastEnvIndex.environ
+	if lastEnvIndex.index != nil && len(cached) == len(environ) && (len(environ) == 0 || &cached[0] == &environ[0]) {
+		return lastEnvIndex.index
+	}
+
+	sorted := append([]string(nil), environ...)
+	sort.Strings(sorted)
+	index := &envIndex{vars: make([]envVar, len(sorted)), upper: make([]string, len(sorted)), order: make([]int, len(sorted))}
+	for i, raw := range sorted {
+		name, value, found := strings.Cut(raw, "=")
+		index.vars[i] = envVar{raw: raw, name: name, value: value, found: found}
+		index.upper[i] = strings.ToUpper(name)
+		index.order[i] = i
+	}
+	sort.SliceStable(index.order, func(i, j int) bool { return index.upper[index.order[i]] < index.upper[index.order[j]] })
+
+	lastEnvIndex.environ, lastEnvIndex.index = environ, index
+	return index
+}
+
+// withPrefix returns the variables whose name starts with the prefix in upper case, in
+// byte order. An empty prefix returns all variables.
+func (x *envIndex) withPrefix(prefix string) []envVar {
+	if prefix == "" {
+		return append([]envVar(nil), x.vars...)
+	}
+	first := sort.Search(len(x.order), func(i int) bool { return x.upper[x.order[i]] >= prefix })
+	var matches []int
+	for _, i := range x.order[first:] {
+		if !strings.HasPrefix(x.upper[i], prefix) {
+			break
+		}
+		matches = append(matches, i)
+	}
+	sort.Ints(matches)
+
+	vars := make([]envVar, len(matches))
+	for i, match := range matches {
+		vars[i] = x.vars[match]
+	}
+	return vars
+}
+
+// envCandidates returns the variables that may match the prefix or its unset prefix, or
+// nearly match it, see envOverrides.
+func envCandidates(index *envIndex, prefix string) []envVar {
+	return index.withPrefix(strings.TrimRight(strings.ToUpper(prefix), "_"))
+}
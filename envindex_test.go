@@ -0,0 +1,37 @@
+package configarr
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestIndexEnv tests looking up the variables of an environment by prefix.
+func TestIndexEnv(t *testing.T) {
+	environ := []string{"SONARR__PORT=Port=8989", "PATH=/bin", "configarr__log=LogLevel=debug", "CONFIGARR__PORT=Port=1", "CONFIGARR_UNSET__A=UrlBase", "CONFIGARRX=1"}
+	index := indexEnv(environ)
+
+	var names []string
+	for _, v := range envCandidates(index, DefaultPrefix) {
+		names = append(names, v.name)
+	}
+	expected := []string{"CONFIGARRX", "CONFIGARR_UNSET__A", "CONFIGARR__PORT", "configarr__log"} // Byte order
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected candidates %v, got %v", expected, names)
+	}
+	if vars := index.withPrefix("RADARR"); len(vars) != 0 {
+		t.Fatalf("Expected no variables for RADARR, got %v", vars)
+	}
+	if vars := index.withPrefix(""); len(vars) != len(environ) {
+		t.Fatalf("Expected all variables for an empty prefix, got %v", vars)
+	}
+
+	t.Run("Reuse", func(t *testing.T) {
+		if indexEnv(environ) != index {
+			t.Fatal("Expected the index of the same environment to be reused")
+		}
+		other := append([]string(nil), environ...)
+		if indexEnv(other) == index {
+			t.Fatal("Expected a new index for another environment")
+		}
+	})
+}
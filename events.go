@@ -0,0 +1,115 @@
+package configarr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Event types and skip reasons reported by the event stream.
+const (
+	EventChange = "change"
+	EventDelete = "delete"
+	EventSkip   = "skip"
+
+	SkipReasonUnchanged  = "unchanged"
+	SkipReasonMissingKey = "key not present in configuration file"
+	SkipReasonUnknownKey = "unknown key"
+	SkipReasonFiltered   = "excluded by key filter"
+	SkipReasonCondition  = "condition not met"
+	SkipReasonGroup      = "key group incomplete"
+	SkipReasonUnmanaged  = "unmanaged"
+)
+
+// Event is a structured record of a single change, deletion or skipped override.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	File   string    `json:"file"`
+	Key    string    `json:"key"`
+	Old    string    `json:"old,omitempty"`
+	Value  string    `json:"value,omitempty"`
+	Source string    `json:"source,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// EventWriter streams events to an output as newline-delimited JSON.
+// A nil EventWriter discards all events.
+type EventWriter struct {
+	encoder *json.Encoder
+	clock   Clock
+}
+
+// NewEventWriter returns an EventWriter for the given format, or nil when the format is empty.
+func NewEventWriter(format string, output io.Writer) (*EventWriter, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case "ndjson":
+		return &EventWriter{encoder: json.NewEncoder(output), clock: SystemClock()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported events format %q", format)
+	}
+}
+
+// WithClock sets the clock events without a time are timestamped with (default:
+// SystemClock()).
+func (w *EventWriter) WithClock(clock Clock) *EventWriter {
+	if w != nil {
+		w.clock = clock
+	}
+	return w
+}
+
+// Emit writes a single event. Secret values are masked.
+func (w *EventWriter) Emit(event Event) error {
+	if w == nil {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = w.clock.Now().UTC()
+	}
+	event.Old = MaskSecretValue(event.Key, event.Old)
+	event.Value = MaskSecretValue(event.Key, event.Value)
+	if err := w.encoder.Encode(event); err != nil {
+		return fmt.Errorf("error writing event: %w", err)
+	}
+	return nil
+}
+
+// emitPlanEvents emits a change or skip event, timestamped by the clock, for every
+// property targeted by the plan.
+func emitPlanEvents(w *EventWriter, file string, actions []PlanAction, clock Clock) error {
+	if w == nil {
+		return nil
+	}
+
+	for _, action := range actions {
+		event := Event{Time: clock.Now().UTC(), File: file, Key: action.Key, Source: action.Source}
+		switch {
+		case action.Type == ActionDelete:
+			event.Type, event.Old = EventDelete, action.Current
+		case action.changes():
+			event.Type, event.Old, event.Value = EventChange, action.Current, action.Value
+		default:
+			event.Type, event.Reason = EventSkip, action.Reason
+		}
+
+		if err := w.Emit(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipReason explains why an override for the key did not change the configuration.
+func skipReason(key string, config *Config, catalog *Catalog) string {
+	if _, exists := config.Properties[key]; exists {
+		return SkipReasonUnchanged
+	}
+	if catalog.IsKnownKey(key) {
+		return SkipReasonMissingKey
+	}
+	return SkipReasonUnknownKey
+}
@@ -0,0 +1,102 @@
+package configarr
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestNewEventWriter tests selecting the event format.
+func TestNewEventWriter(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		w, err := NewEventWriter("", &bytes.Buffer{})
+		if err != nil || w != nil {
+			t.Fatalf("Expected nil writer without error, got %v, %v", w, err)
+		}
+
+		if err := w.Emit(Event{Key: "LogLevel"}); err != nil {
+			t.Fatalf("Unexpected error emitting to nil writer: %v", err)
+		}
+	})
+
+	t.Run("Clock", func(t *testing.T) {
+		var output bytes.Buffer
+		w, err := NewEventWriter("ndjson", &output)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		if err := w.WithClock(FixedClock(at)).Emit(Event{Type: EventChange, Key: "Port"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(output.String(), `"time":"2024-05-01T12:00:00Z"`) {
+			t.Fatalf("Expected the timestamp of the clock, got %s", output.String())
+		}
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		if _, err := NewEventWriter("xml", &bytes.Buffer{}); err == nil {
+			t.Fatal("Expected error for unsupported format, but got none")
+		}
+	})
+}
+
+// TestEmitPlanEvents tests emitting one event per targeted property.
+func TestEmitPlanEvents(t *testing.T) {
+	catalog, err := LoadCatalog("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	config := &Config{
+		Properties: map[string]string{"LogLevel": "info", "Theme": "dark", "ApiKey": "old"},
+		Keys:       []string{"LogLevel", "Theme", "ApiKey"},
+	}
+	overrides := []Override{
+		{Key: "LogLevel", Value: "trace", Source: "env:CONFIGARR__LOG"},
+		{Key: "Theme", Value: "dark"},
+		{Key: "ApiKey", Value: "secret"},
+		{Key: "UrlBase", Value: "/sonarr"},
+		{Key: "Typo", Value: "x"},
+		{Key: "LogLevel", Value: "debug", Source: "json:values.json"},
+	}
+	actions := Differ{Catalog: catalog}.Diff(config, overrides)
+
+	var output bytes.Buffer
+	w, err := NewEventWriter("ndjson", &output)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := emitPlanEvents(w, "/config/config.xml", actions, SystemClock()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 events, got %d: %s", len(lines), output.String())
+	}
+
+	expected := []Event{
+		{Type: EventChange, File: "/config/config.xml", Key: "LogLevel", Old: "info", Value: "debug", Source: "json:values.json"},
+		{Type: EventSkip, File: "/config/config.xml", Key: "Theme", Reason: SkipReasonUnchanged},
+		{Type: EventChange, File: "/config/config.xml", Key: "ApiKey", Old: SecretMask, Value: SecretMask},
+		{Type: EventSkip, File: "/config/config.xml", Key: "UrlBase", Reason: SkipReasonMissingKey},
+		{Type: EventSkip, File: "/config/config.xml", Key: "Typo", Reason: SkipReasonUnknownKey},
+	}
+	for i, line := range lines {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Unexpected error decoding event %q: %v", line, err)
+		}
+		if event.Time.IsZero() || time.Since(event.Time) > time.Minute {
+			t.Fatalf("Expected current timestamp, got %v", event.Time)
+		}
+		event.Time = time.Time{}
+		if event != expected[i] {
+			t.Fatalf("Expected event %+v, got %+v", expected[i], event)
+		}
+	}
+}
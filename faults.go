@@ -0,0 +1,104 @@
+package configarr
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"sync"
+)
+
+// ErrInjectedFault is returned by the operations of a FaultFS that were made to fail.
+var ErrInjectedFault = errors.New("injected fault")
+
+// Faults selects the failures a FaultFS injects. Each count is the number of operations
+// that fail, starting with the first one; afterwards, operations succeed again.
+type Faults struct {
+	WriteFailures int // Writes failing with ErrInjectedFault without writing anything
+	TornWrites    int // Writes that only write the first half of the data but report success
+	PartialReads  int // Reads returning only the first half of the file, as while the app writes it
+	Conflicts     int // Re-reads seeing the file modified by another process since it was read
+}
+
+// FaultFS returns a filesystem injecting the faults into the operations on fsys, so
+// retries, conflict handling and the restore after a failed verification can be tested
+// end to end, e.g. in staging. It is not meant for production use.
+func FaultFS(fsys FS, faults Faults) FS {
+	return &faultFS{fsys: fsys, faults: faults, read: make(map[string]bool)}
+}
+
+// faultFS implements FS on top of another FS, injecting Faults.
+type faultFS struct {
+	fsys FS
+
+	mu     sync.Mutex
+	faults Faults          // Remaining faults
+	read   map[string]bool // Files read since they were last written
+}
+
+// Open reads the named file, returning half of it for partial reads and a modified copy
+// for conflicts.
+func (f *faultFS) Open(name string) (fs.File, error) {
+	data, err := fs.ReadFile(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.fsys.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case f.faults.PartialReads > 0:
+		f.faults.PartialReads--
+		data = data[:len(data)/2]
+	case f.faults.Conflicts > 0 && f.read[name]:
+		f.faults.Conflicts--
+		data = append(bytes.Clone(data), '\n')
+	}
+	f.read[name] = true
+	return &memFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+// Stat returns the file info of the named file.
+func (f *faultFS) Stat(name string) (fs.FileInfo, error) {
+	return f.fsys.Stat(name)
+}
+
+// WriteFile writes data to the named file, failing or writing half of it as requested.
+func (f *faultFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f.mu.Lock()
+	delete(f.read, name)
+	var torn bool
+	switch {
+	case f.faults.WriteFailures > 0:
+		f.faults.WriteFailures--
+		f.mu.Unlock()
+		return &fs.PathError{Op: "write", Path: name, Err: ErrInjectedFault}
+	case f.faults.TornWrites > 0:
+		f.faults.TornWrites--
+		torn = true
+	}
+	f.mu.Unlock()
+
+	if torn {
+		data = data[:len(data)/2]
+	}
+	return f.fsys.WriteFile(name, data, perm)
+}
+
+// ReadDir returns the entries of the named directory of the underlying filesystem.
+func (f *faultFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, name)
+}
+
+// Remove removes the named file from the underlying filesystem.
+func (f *faultFS) Remove(name string) error {
+	return removeFile(f.fsys, name)
+}
+
+// CheckReplaceable reports why the underlying filesystem can't replace the named file.
+func (f *faultFS) CheckReplaceable(name string) error {
+	return checkReplaceable(f.fsys, name)
+}
@@ -0,0 +1,71 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+// TestFaultFS tests that injected faults are handled by the retries, the conflict
+// detection and the restore after a failed verification.
+func TestFaultFS(t *testing.T) {
+	original := "<Config><Port>8989</Port><LogLevel>info</LogLevel></Config>"
+	run := func(faults Faults, opts ...Option) (mapFS, error) {
+		fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte(original)}}}
+		opts = append([]Option{
+			WithFS(FaultFS(fsys, faults)),
+			WithConfigPath("config.xml"),
+			WithSources(StaticSource(Override{Key: "Port", Value: "9000"})),
+			WithReadRetries(1, 0),
+		}, opts...)
+		_, err := Run(context.Background(), opts...)
+		return fsys, err
+	}
+
+	t.Run("Write failure", func(t *testing.T) {
+		fsys, err := run(Faults{WriteFailures: 1})
+		if !errors.Is(err, ErrInjectedFault) || !errors.Is(err, ErrWrite) {
+			t.Fatalf("Expected injected write error, got: %v", err)
+		}
+		if string(fsys.MapFS["config.xml"].Data) != original {
+			t.Fatalf("Expected file to be untouched, got: %s", fsys.MapFS["config.xml"].Data)
+		}
+	})
+
+	t.Run("Torn write is restored", func(t *testing.T) {
+		fsys, err := run(Faults{TornWrites: 1})
+		if err == nil {
+			t.Fatal("Expected verification error, but got none")
+		}
+		if string(fsys.MapFS["config.xml"].Data) != original {
+			t.Fatalf("Expected original content to be restored, got: %s", fsys.MapFS["config.xml"].Data)
+		}
+	})
+
+	t.Run("Partial read is retried", func(t *testing.T) {
+		if _, err := run(Faults{PartialReads: 1}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := run(Faults{PartialReads: 2}); err == nil {
+			t.Fatal("Expected error after exhausting the read retries, but got none")
+		}
+	})
+
+	t.Run("Conflict is retried", func(t *testing.T) {
+		if _, err := run(Faults{Conflicts: 1}); !errors.Is(err, ErrConflict) {
+			t.Fatalf("Expected ErrConflict without retries, got: %v", err)
+		}
+		fsys, err := run(Faults{Conflicts: 1}, WithConflictRetries(1))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		config, err := ReadConfigFS(fsys, "config.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Properties["Port"] != "9000" {
+			t.Fatalf("Expected Port to be '9000', got '%s'", config.Properties["Port"])
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package configarr
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the supported configuration file formats.
+const (
+	FormatXML  = "xml"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatINI  = "ini"
+
+	FormatXMLAttributes = "xmlattr"
+)
+
+// Format parses and renders the configuration files of one file format, so overrides
+// work the same on any of them. Keys address the properties of the parsed Config.
+type Format interface {
+	Name() string
+	Parse(data []byte) (*Config, error)
+	Render(config *Config, opts RenderOptions) ([]byte, error)
+}
+
+// The supported formats, see WithFormat.
+var (
+	XMLFormat  Format = xmlFormat{}
+	JSONFormat Format = jsonFormat{}
+	YAMLFormat Format = yamlFormat{}
+	INIFormat  Format = iniFormat{}
+
+	XMLAttributesFormat Format = xmlAttrFormat{}
+)
+
+// formats holds the supported formats by name.
+var formats = map[string]Format{
+	FormatXML:  XMLFormat,
+	FormatJSON: JSONFormat,
+	FormatYAML: YAMLFormat,
+	FormatINI:  INIFormat,
+
+	FormatXMLAttributes: XMLAttributesFormat,
+}
+
+// LookupFormat returns the format with the given name. Without a name, the format is
+// detected from the extension of the path, see DetectFormat.
+func LookupFormat(name, path string) (Format, error) {
+	if name == "" {
+		return DetectFormat(path), nil
+	}
+	format, exists := formats[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown format %q: expected %s, %s, %s, %s or %s", name, FormatXML, FormatJSON, FormatYAML, FormatINI, FormatXMLAttributes)
+	}
+	return format, nil
+}
+
+// DetectFormat returns the format of a configuration file by its extension: JSON for
+// .json, YAML for .yaml and .yml, INI for .ini and .conf, XML otherwise. Plex's
+// Preferences.xml is read as XML attributes.
+func DetectFormat(path string) Format {
+	if strings.EqualFold(filepath.Base(path), "Preferences.xml") {
+		return XMLAttributesFormat
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSONFormat
+	case ".yaml", ".yml":
+		return YAMLFormat
+	case ".ini", ".conf":
+		return INIFormat
+	}
+	return XMLFormat
+}
+
+// xmlFormat is the format of the *arr apps' config.xml.
+type xmlFormat struct{}
+
+// Name returns FormatXML.
+func (xmlFormat) Name() string {
+	return FormatXML
+}
+
+// Parse parses the XML document, see ParseConfig.
+func (xmlFormat) Parse(data []byte) (*Config, error) {
+	return ParseConfig(data)
+}
+
+// Render renders the Config as an XML document, changing only the modified lines of the
+// original document unless the output is compact or reformatted, see preserveSource.
+func (xmlFormat) Render(config *Config, opts RenderOptions) ([]byte, error) {
+	return preserveSource(config, opts)
+}
@@ -0,0 +1,200 @@
+package configarr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// FS is a filesystem configuration files are read from and written to. Any fs.FS
+// that also implements Stat and WriteFile can be used, e.g. an in-memory filesystem
+// for test fixtures or an adapter for a remote backend. A filesystem that can tell
+// up front why a file can't be written may also implement ReplaceChecker.
+type FS interface {
+	fs.StatFS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// ReplaceChecker is implemented by filesystems that can tell why WriteFile would fail
+// for a file, e.g. because it is immutable, before a run does any work.
+type ReplaceChecker interface {
+	CheckReplaceable(name string) error
+}
+
+// checkReplaceable returns why the filesystem can't replace the named file, or nil when
+// it can or the filesystem doesn't implement ReplaceChecker.
+func checkReplaceable(fsys FS, name string) error {
+	if checker, ok := fsys.(ReplaceChecker); ok {
+		return checker.CheckReplaceable(name)
+	}
+	return nil
+}
+
+// OSFS returns the local filesystem. Unlike os.DirFS, names are passed to the os
+// package as given, so absolute paths such as DefaultConfigPath work.
+func OSFS() FS {
+	return osFS{}
+}
+
+// FileOwner is the numeric user and group owning a file.
+type FileOwner struct {
+	UID, GID int
+}
+
+// WriteOptions override the mode and owner files are written with, which otherwise are
+// those of the file being replaced.
+type WriteOptions struct {
+	Mode  fs.FileMode // Permission bits of written files; zero keeps those of the file
+	Owner *FileOwner  // Owner of written files; nil keeps the owner of the file
+}
+
+// OSFSWith returns the local filesystem like OSFS, writing files with the mode and owner
+// of the options, e.g. to hand a file rewritten as root to the PUID and PGID of an app.
+// Changing the owner usually requires root.
+func OSFSWith(opts WriteOptions) FS {
+	return osFS{write: opts}
+}
+
+// osFS implements FS on top of the os package.
+type osFS struct {
+	write WriteOptions
+}
+
+// Open opens the named file for reading.
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// Stat returns the file info of the named file.
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// ReadDir returns the entries of the named directory, sorted by name.
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// Remove removes the named file.
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// WriteFile writes data to the named file atomically, creating it with perm if necessary:
+// the data goes to a temporary file in the same directory, which is synced and renamed
+// over the file, so it is never left truncated, e.g. when configarr is killed. The mode
+// and, where supported, the owner of an existing file are preserved unless WriteOptions
+// override them; symlinks are followed, so the file they point to is replaced. Files that
+// can't be renamed over, such as bind mounts, are written in place instead.
+func (f osFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	info, err := os.Stat(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if info != nil {
+		perm = info.Mode().Perm()
+	}
+	if f.write.Mode != 0 {
+		perm = f.write.Mode.Perm()
+	}
+
+	dir := filepath.Dir(name)
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // Fails once renamed
+
+	if err := writeTemp(temp, data, perm, info, f.write.Owner); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := renameFile(temp.Name(), name); err != nil {
+		if errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EXDEV) {
+			return f.writeInPlace(name, data, perm)
+		}
+		return fmt.Errorf("error replacing %s: %w", name, err)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// renameFile renames the temporary file over the file written; tests replace it to fake
+// the errors of bind mounts.
+var renameFile = os.Rename
+
+// writeInPlace truncates the named file and writes the data to it, syncing it to disk. It
+// is the fallback for files that can't be renamed over, e.g. a single file bind-mounted
+// into a container (EBUSY) or one on another filesystem than its directory (EXDEV), and
+// unlike the rename, it can leave the file truncated when interrupted.
+func (f osFS) writeInPlace(name string, data []byte, perm fs.FileMode) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("error writing %s in place: %w", name, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing %s in place: %w", name, err)
+	}
+	if f.write.Mode != 0 {
+		if err := file.Chmod(perm); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if owner := f.write.Owner; owner != nil {
+		if err := file.Chown(owner.UID, owner.GID); err != nil {
+			file.Close()
+			return fmt.Errorf("error changing owner to %d:%d: %w", owner.UID, owner.GID, err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// CheckReplaceable reports why WriteFile can't replace the named file: it is immutable
+// or append-only (chattr +i or +a), on a read-only filesystem or, on Windows, read-only.
+// Missing files and failures to tell are left to WriteFile.
+func (osFS) CheckReplaceable(name string) error {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	info, err := os.Stat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return whyNotReplaceable(name, info)
+}
+
+// writeTemp writes the data to the temporary file, sets its mode and the owner, if given,
+// or that of the original file, if any, and syncs it to disk.
+func writeTemp(temp *os.File, data []byte, perm fs.FileMode, original fs.FileInfo, owner *FileOwner) error {
+	if _, err := temp.Write(data); err != nil {
+		return err
+	}
+	if err := temp.Chmod(perm); err != nil {
+		return err
+	}
+	if owner != nil {
+		if err := temp.Chown(owner.UID, owner.GID); err != nil {
+			return fmt.Errorf("error changing owner to %d:%d: %w", owner.UID, owner.GID, err)
+		}
+	} else if original != nil {
+		if err := chownLike(temp, original); err != nil && !errors.Is(err, fs.ErrPermission) {
+			return err // Without privileges, the file gets the owner of the process
+		}
+	}
+	return temp.Sync()
+}
@@ -0,0 +1,8 @@
+//go:build unix && !linux
+
+package configarr
+
+// fileAttributes reports neither attribute, since they are only read on Linux.
+func fileAttributes(name string) (immutable, appendOnly bool) {
+	return false, false
+}
@@ -0,0 +1,33 @@
+package configarr
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// fsIocGetFlags is FS_IOC_GETFLAGS, _IOR('f', 1, long) in the generic ioctl encoding.
+// Architectures encoding it differently fail the call, so no attributes are reported.
+const fsIocGetFlags = 2<<30 | unsafe.Sizeof(uintptr(0))<<16 | 'f'<<8 | 1
+
+// Inode flags of FS_IOC_GETFLAGS, as set by chattr.
+const (
+	fsImmutableFl = 0x10
+	fsAppendFl    = 0x20
+)
+
+// fileAttributes reports whether the file has the immutable or the append-only attribute.
+// Filesystems without attributes report neither.
+func fileAttributes(name string) (immutable, appendOnly bool) {
+	file, err := os.Open(name)
+	if err != nil {
+		return false, false
+	}
+	defer file.Close()
+
+	var flags int32 // The kernel writes an int, despite the size in the request
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), fsIocGetFlags, uintptr(unsafe.Pointer(&flags))); errno != 0 {
+		return false, false
+	}
+	return flags&fsImmutableFl != 0, flags&fsAppendFl != 0
+}
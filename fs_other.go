@@ -0,0 +1,26 @@
+//go:build !unix
+
+package configarr
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// chownLike does nothing, since files have no numeric owner on this platform.
+func chownLike(file *os.File, original fs.FileInfo) error {
+	return nil
+}
+
+// syncDir does nothing, since directories can't be synced on this platform.
+func syncDir(dir string) {}
+
+// whyNotReplaceable returns an error for files with the read-only attribute, which can't
+// be replaced.
+func whyNotReplaceable(name string, info fs.FileInfo) error {
+	if info.Mode().Perm()&0200 == 0 {
+		return errors.New("the file is read-only, clear the attribute with attrib -r")
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+// mapFS is a writable in-memory filesystem for tests.
+type mapFS struct {
+	fstest.MapFS
+}
+
+// WriteFile stores the data under the given name.
+func (m mapFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+// TestWithFS tests running against an in-memory filesystem.
+func TestWithFS(t *testing.T) {
+	fsys := mapFS{fstest.MapFS{
+		"config.xml": &fstest.MapFile{Data: []byte("<Config><Port>8989</Port></Config>")},
+	}}
+
+	t.Run("Update in-memory file", func(t *testing.T) {
+		result, err := Run(context.Background(),
+			WithFS(fsys),
+			WithConfigPath("config.xml"),
+			WithSources(StaticSource(Override{Key: "Port", Value: "9000"})),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !result.Written {
+			t.Fatal("Expected the configuration file to be written")
+		}
+
+		config, err := ReadConfigFS(fsys, "config.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Properties["Port"] != "9000" {
+			t.Fatalf("Expected Port to be '9000', got '%s'", config.Properties["Port"])
+		}
+	})
+
+	t.Run("Read with the options", func(t *testing.T) {
+		fsys.MapFS["settings"] = &fstest.MapFile{Data: []byte(`{"general": {"port": 6767}}`)}
+		config, err := ReadConfig(WithFS(fsys), WithConfigPath("settings"), WithFormat(JSONFormat))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Properties["general.port"] != "6767" {
+			t.Fatalf("Expected general.port to be '6767', got %v", config.Properties)
+		}
+	})
+
+	t.Run("Missing in-memory file", func(t *testing.T) {
+		if _, err := ReadConfigFS(fsys, "missing.xml"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("Expected fs.ErrNotExist for missing file, got %v", err)
+		}
+	})
+}
+
+// TestOSFSWriteFile tests that writes replace the file atomically, keeping its mode.
+func TestOSFSWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.xml")
+	if err := os.WriteFile(file, []byte("<Config></Config>"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := OSFS().WriteFile(file, []byte("<Config><Port>9000</Port></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "<Config><Port>9000</Port></Config>" {
+		t.Fatalf("Expected the new content, got %q", data)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected mode 0600 to be preserved, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("Expected no temporary files to be left, got %v", entries)
+	}
+
+	t.Run("Symlink", func(t *testing.T) {
+		link := filepath.Join(dir, "link.xml")
+		if err := os.Symlink(file, link); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+		if err := OSFS().WriteFile(link, []byte("<Config></Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info, err := os.Lstat(link); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			t.Fatalf("Expected the symlink to be kept, got %v, %v", info, err)
+		}
+		if data, _ := os.ReadFile(file); string(data) != "<Config></Config>" {
+			t.Fatalf("Expected the target to be written, got %q", data)
+		}
+	})
+
+	t.Run("New file", func(t *testing.T) {
+		created := filepath.Join(dir, "new.xml")
+		if err := OSFS().WriteFile(created, []byte("<Config></Config>"), 0640); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info, err := os.Stat(created); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0640) {
+			t.Fatalf("Expected a new file with mode 0640, got %v, %v", info, err)
+		}
+	})
+}
+
+// TestOSFSWriteFile_InPlace tests that files which can't be renamed over, e.g. bind
+// mounts, are written in place.
+func TestOSFSWriteFile_InPlace(t *testing.T) {
+	defer func(rename func(string, string) error) { renameFile = rename }(renameFile)
+
+	for _, errno := range []syscall.Errno{syscall.EBUSY, syscall.EXDEV} {
+		t.Run(errno.Error(), func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, "config.xml")
+			if err := os.WriteFile(file, []byte("<Config><Port>8989</Port><ApiKey>abc</ApiKey></Config>"), 0600); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			renameFile = func(oldpath, newpath string) error {
+				return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errno}
+			}
+
+			if err := OSFS().WriteFile(file, []byte("<Config><Port>9000</Port></Config>"), 0644); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if data, _ := os.ReadFile(file); string(data) != "<Config><Port>9000</Port></Config>" {
+				t.Fatalf("Expected the file to be written in place, got %q", data)
+			}
+			if info, err := os.Stat(file); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0600) {
+				t.Fatalf("Expected mode 0600 to be preserved, got %v, %v", info, err)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Fatalf("Expected no temporary files to be left, got %v", entries)
+			}
+		})
+	}
+
+	t.Run("Other rename errors", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.xml")
+		if err := os.WriteFile(file, []byte("<Config></Config>"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		renameFile = func(oldpath, newpath string) error {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EACCES}
+		}
+		if err := OSFS().WriteFile(file, []byte("<Config><Port>9000</Port></Config>"), 0644); err == nil {
+			t.Fatal("Expected error for a failing rename, but got none")
+		}
+		if data, _ := os.ReadFile(file); string(data) != "<Config></Config>" {
+			t.Fatalf("Expected the file to be left alone, got %q", data)
+		}
+	})
+}
+
+// TestOSFSWith tests that the write options override the mode and owner of the file.
+func TestOSFSWith(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Files have no numeric owner on Windows")
+	}
+	file := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(file, []byte("<Config></Config>"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fsys := OSFSWith(WriteOptions{Mode: 0640, Owner: &FileOwner{UID: os.Getuid(), GID: os.Getgid()}})
+	if err := fsys.WriteFile(file, []byte("<Config><Port>9000</Port></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("Expected mode 0640, got %v", info.Mode().Perm())
+	}
+}
+
+// unreplaceableFS is a mapFS whose files can't be replaced.
+type unreplaceableFS struct {
+	mapFS
+}
+
+// CheckReplaceable reports every file as immutable.
+func (unreplaceableFS) CheckReplaceable(name string) error {
+	return errors.New("the file is immutable (chattr +i), clear the attribute with chattr -i")
+}
+
+// TestRun_Unreplaceable tests that files the filesystem can't replace are refused, or
+// skipped with a warning, before the sources are read.
+func TestRun_Unreplaceable(t *testing.T) {
+	original := "<Config><Port>8989</Port></Config>"
+	fsys := unreplaceableFS{mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte(original)}}}}
+	read := false
+	source := SourceFunc(func(ctx context.Context, logger *slog.Logger) ([]Override, error) {
+		read = true
+		return []Override{{Key: "Port", Value: "9000"}}, nil
+	})
+
+	_, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithSources(source))
+	if !errors.Is(err, ErrWrite) || !strings.Contains(err.Error(), "refusing to modify config.xml: the file is immutable") {
+		t.Fatalf("Expected a write error for the immutable file, got %v", err)
+	}
+	if read {
+		t.Fatalf("Expected the sources not to be read")
+	}
+
+	t.Run("Skip", func(t *testing.T) {
+		var logs strings.Builder
+		result, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithSources(source), WithSkipUnwritable(),
+			WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Written || read || string(fsys.MapFS["config.xml"].Data) != original {
+			t.Fatalf("Expected the file to be skipped, got %+v", result)
+		}
+		if !strings.Contains(logs.String(), "Skipping config.xml: the file is immutable") {
+			t.Fatalf("Expected a warning, got: %s", logs.String())
+		}
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		if _, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithSources(source), WithDryRun()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !read {
+			t.Fatalf("Expected dry runs not to check the file")
+		}
+	})
+
+	t.Run("Wrapped", func(t *testing.T) {
+		if err := checkReplaceable(FaultFS(fsys, Faults{}), "config.xml"); err == nil {
+			t.Fatalf("Expected the check to reach the underlying filesystem")
+		}
+	})
+}
+
+// TestOSFSCheckReplaceable tests that writable and missing files pass the check.
+func TestOSFSCheckReplaceable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.xml")
+	if err := OSFS().(ReplaceChecker).CheckReplaceable(file); err != nil {
+		t.Fatalf("Unexpected error for a missing file: %v", err)
+	}
+	if err := os.WriteFile(file, []byte("<Config></Config>"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := OSFS().(ReplaceChecker).CheckReplaceable(file); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
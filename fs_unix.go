@@ -0,0 +1,48 @@
+//go:build unix
+
+package configarr
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// accessWriteOK is W_OK of access(2).
+const accessWriteOK = 2
+
+// chownLike gives the file the owner and group of the original, so the app can still
+// write its configuration file after configarr, e.g. running as root, replaced it.
+func chownLike(file *os.File, original fs.FileInfo) error {
+	stat, ok := original.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return file.Chown(int(stat.Uid), int(stat.Gid))
+}
+
+// syncDir syncs the directory, so a rename in it survives a crash. Errors are ignored,
+// since the file itself is already synced.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
+
+// whyNotReplaceable returns why the file can't be replaced, or nil when nothing stands in
+// the way as far as can be told.
+func whyNotReplaceable(name string, info fs.FileInfo) error {
+	if err := syscall.Access(name, accessWriteOK); errors.Is(err, syscall.EROFS) {
+		return errors.New("the file is on a read-only filesystem, remount it read-write")
+	}
+	immutable, appendOnly := fileAttributes(name)
+	switch {
+	case immutable:
+		return errors.New("the file is immutable (chattr +i), clear the attribute with chattr -i")
+	case appendOnly:
+		return errors.New("the file is append-only (chattr +a), clear the attribute with chattr -a")
+	}
+	return nil
+}
@@ -2,4 +2,7 @@ module configarr
 
 go 1.21.5
 
-require github.com/spf13/pflag v1.0.5
+require (
+	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,128 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// hostConfigTimeout bounds the request for the host settings of a running app.
+const hostConfigTimeout = 10 * time.Second
+
+// hostConfigPaths are the endpoints of the host settings, of Sonarr and Radarr (v3) and
+// of Lidarr, Prowlarr and Readarr (v1), tried in order.
+var hostConfigPaths = []string{"/api/v3/config/host", "/api/v1/config/host"}
+
+// FetchHostConfig reads the host settings a running app reports on its API at baseURL,
+// e.g. http://localhost:8989, keyed like the properties of its configuration file, e.g.
+// Port for port. Booleans are formatted as in the file, e.g. True; fields that are not
+// scalars are left out. A nil client uses a client with a timeout.
+func FetchHostConfig(ctx context.Context, baseURL, apiKey string, client *http.Client) (map[string]string, error) {
+	if client == nil {
+		client = &http.Client{Timeout: hostConfigTimeout}
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	var err error
+	for _, path := range hostConfigPaths {
+		var fields map[string]json.RawMessage
+		var status int
+		status, err = getJSON(ctx, client, baseURL+path, apiKey, &fields)
+		if status == http.StatusNotFound {
+			continue // Other API version
+		}
+		if err != nil {
+			return nil, err
+		}
+		return hostProperties(fields), nil
+	}
+	return nil, fmt.Errorf("no host settings at %s: %w", baseURL, err)
+}
+
+// getJSON sends a GET request with the API key and decodes the JSON response into out,
+// returning the status code of the response, if any.
+func getJSON(ctx context.Context, client *http.Client, url, apiKey string, out any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request for %s: %w", url, err)
+	}
+	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error sending GET %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("error sending GET %s: unexpected status %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("error decoding response of %s: %w", url, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// hostProperties converts the scalar fields of the host settings into properties.
+func hostProperties(fields map[string]json.RawMessage) map[string]string {
+	properties := make(map[string]string, len(fields))
+	for field, raw := range fields {
+		if field == "" {
+			continue
+		}
+		var value string
+		switch raw = bytes.TrimSpace(raw); {
+		case bytes.Equal(raw, []byte("true")):
+			value = "True"
+		case bytes.Equal(raw, []byte("false")):
+			value = "False"
+		case len(raw) > 0 && raw[0] == '"':
+			if err := json.Unmarshal(raw, &value); err != nil {
+				continue
+			}
+		case len(raw) > 0 && (raw[0] == '-' || raw[0] >= '0' && raw[0] <= '9'):
+			value = string(raw)
+		default:
+			continue // null, objects and arrays
+		}
+		key := []rune(field)
+		key[0] = unicode.ToUpper(key[0])
+		properties[string(key)] = value
+	}
+	return properties
+}
+
+// RuntimeDrift is a property whose value in the configuration file differs from the one
+// the running app reports, e.g. because it was changed in the UI and not written yet, or
+// the file was changed and the app not restarted.
+type RuntimeDrift struct {
+	Key     string
+	File    string // Value in the configuration file
+	Running string // Value reported by the app
+}
+
+// CompareHostConfig returns the properties of the configuration that differ from the
+// host settings of the running app, in the order of the file. Keys and values are
+// compared regardless of case, since the API reports enums such as the
+// AuthenticationMethod in camel case; properties the API doesn't report are skipped.
+func CompareHostConfig(config *Config, running map[string]string) []RuntimeDrift {
+	folded := make(map[string]string, len(running))
+	for key, value := range running {
+		folded[strings.ToLower(key)] = value
+	}
+
+	var drift []RuntimeDrift
+	for _, key := range config.Keys {
+		value, reported := folded[strings.ToLower(key)]
+		if reported && !strings.EqualFold(config.Properties[key], value) {
+			drift = append(drift, RuntimeDrift{Key: key, File: config.Properties[key], Running: value})
+		}
+	}
+	return drift
+}
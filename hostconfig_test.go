@@ -0,0 +1,55 @@
+package configarr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestFetchHostConfig tests reading the host settings of a running app, falling back to
+// the v1 API of Lidarr, Prowlarr and Readarr.
+func TestFetchHostConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("X-Api-Key") != "key":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/api/v1/config/host":
+			_, _ = w.Write([]byte(`{"port": 8686, "enableSsl": false, "urlBase": "/lidarr", "authenticationMethod": "forms", "proxyPassword": null, "backupRetention": 7, "certificateValidation": {}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	running, err := FetchHostConfig(context.Background(), server.URL+"/", "key", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{"Port": "8686", "EnableSsl": "False", "UrlBase": "/lidarr", "AuthenticationMethod": "forms", "BackupRetention": "7"}
+	if !reflect.DeepEqual(running, expected) {
+		t.Fatalf("Expected properties %v, got %v", expected, running)
+	}
+
+	t.Run("Wrong API key", func(t *testing.T) {
+		if _, err := FetchHostConfig(context.Background(), server.URL, "wrong", nil); err == nil {
+			t.Fatal("Expected error for the wrong API key, but got none")
+		}
+	})
+}
+
+// TestCompareHostConfig tests comparing a configuration file with the host settings.
+func TestCompareHostConfig(t *testing.T) {
+	config, err := ParseConfig([]byte("<Config><Port>8989</Port><EnableSsl>False</EnableSsl><AuthenticationMethod>Forms</AuthenticationMethod><UrlBase>/tv</UrlBase><LogLevel>info</LogLevel></Config>"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	running := map[string]string{"Port": "8990", "EnableSsl": "False", "AuthenticationMethod": "forms", "UrlBase": "/sonarr"}
+
+	drift := CompareHostConfig(config, running)
+	expected := []RuntimeDrift{{Key: "Port", File: "8989", Running: "8990"}, {Key: "UrlBase", File: "/tv", Running: "/sonarr"}}
+	if !reflect.DeepEqual(drift, expected) {
+		t.Fatalf("Expected drift %+v, got %+v", expected, drift)
+	}
+}
@@ -0,0 +1,204 @@
+package configarr
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+)
+
+// iniLine is a line of an INI file. Lines holding a value remember where it starts, so
+// it can be replaced without touching the rest of the line.
+type iniLine struct {
+	text       string
+	key        string // Property of the value, empty for other lines
+	section    string // Section the line belongs to, empty before the first section
+	valueStart int    // Offset of the value in text, after an opening quote
+	quote      string // Quote around the value, if any
+}
+
+// iniDocument is a parsed INI configuration file.
+type iniDocument struct {
+	lines        []iniLine
+	sections     []string // Sections in the order of their headers
+	assign       string   // Assignment of the first value, e.g. " = " or "=", used for created ones
+	eol          string   // Line ending of the original file
+	finalNewline bool
+}
+
+// iniFormat is the format of INI files, e.g. SABnzbd's sabnzbd.ini or qBittorrent's
+// qBittorrent.conf. Values are addressed by their section and key joined with a dot,
+// e.g. misc.port or Preferences.WebUI\Port; values before the first section by their
+// key. Nested sections, e.g. [[news.example.com]] below [servers], are joined as well.
+type iniFormat struct{}
+
+// Name returns FormatINI.
+func (iniFormat) Name() string {
+	return FormatINI
+}
+
+// Parse parses the INI file into a Config with a property per key. Surrounding quotes
+// are removed from values; lines that are neither headers nor assignments are kept as
+// they are.
+func (iniFormat) Parse(data []byte) (*Config, error) {
+	doc := &iniDocument{assign: " = ", eol: "\n"}
+	if bytes.Contains(data, []byte("\r\n")) {
+		doc.eol = "\r\n"
+	}
+	text := string(data)
+	doc.finalNewline = strings.HasSuffix(text, "\n")
+	text = strings.TrimSuffix(text, "\n")
+
+	cfg := &Config{Properties: make(map[string]string), Keys: []string{}, source: data, document: doc}
+	var sections []string // Current section and its parents
+	for _, raw := range strings.Split(text, "\n") {
+		line := iniLine{text: strings.TrimSuffix(raw, "\r"), section: strings.Join(sections, ".")}
+		trimmed := strings.TrimSpace(line.text)
+
+		switch {
+		case trimmed == "" || trimmed[0] == ';' || trimmed[0] == '#':
+		case trimmed[0] == '[':
+			depth := len(trimmed) - len(strings.TrimLeft(trimmed, "["))
+			name := strings.TrimSpace(strings.Trim(trimmed, "[]"))
+			sections = append(sections[:min(depth-1, len(sections))], name)
+			line.section = strings.Join(sections, ".")
+			if !slices.Contains(doc.sections, line.section) {
+				doc.sections = append(doc.sections, line.section)
+			}
+		default:
+			name, value, found := strings.Cut(line.text, "=")
+			if !found || strings.TrimSpace(name) == "" {
+				break
+			}
+			line.key = joinJSONPath(line.section, strings.TrimSpace(name))
+			line.valueStart = len(line.text) - len(strings.TrimLeft(value, " \t"))
+			if len(cfg.Keys) == 0 {
+				doc.assign = line.text[len(strings.TrimRight(name, " \t")):line.valueStart]
+			}
+			value = strings.TrimSpace(value)
+			for _, quote := range []string{`"`, "'"} {
+				if len(value) >= 2 && strings.HasPrefix(value, quote) && strings.HasSuffix(value, quote) {
+					line.quote, value = quote, value[1:len(value)-1]
+					line.valueStart++
+					break
+				}
+			}
+			if _, exists := cfg.Properties[line.key]; !exists {
+				cfg.Keys = append(cfg.Keys, line.key)
+			}
+			cfg.Properties[line.key] = value
+		}
+		doc.lines = append(doc.lines, line)
+	}
+	return cfg, nil
+}
+
+// Render renders the Config as an INI file. Untouched lines are kept as they are, changed
+// values are replaced in their line, and lines of deleted properties are left out.
+// Created properties go after the last value of the longest existing section their key
+// starts with; otherwise a new section is added at the end, named after the key up to
+// its first dot. Keys without a dot go before the first section.
+func (iniFormat) Render(config *Config, _ RenderOptions) ([]byte, error) {
+	doc, _ := config.document.(*iniDocument)
+	if doc == nil {
+		doc = &iniDocument{assign: " = ", eol: "\n", finalNewline: true}
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range doc.lines {
+		if line.key != "" {
+			seen[line.key] = true
+		}
+	}
+	created := make(map[int][]string) // Lines to insert after the line at the index, -1 for the top
+	var addedSections []string
+	added := make(map[string][]string) // Lines of the new sections
+	for _, key := range config.Keys {
+		value, exists := config.Properties[key]
+		if seen[key] || !exists {
+			continue
+		}
+		section, name := doc.sectionOf(key)
+		if section == "" || slices.Contains(doc.sections, section) {
+			after := doc.lastLineOf(section)
+			created[after] = append(created[after], name+doc.assign+value)
+			continue
+		}
+		if _, exists := added[section]; !exists {
+			addedSections = append(addedSections, section)
+			added[section] = []string{"[" + section + "]"}
+		}
+		added[section] = append(added[section], name+doc.assign+value)
+	}
+
+	var lines []string
+	lines = append(lines, created[-1]...)
+	for i, line := range doc.lines {
+		value, exists := config.Properties[line.key]
+		switch {
+		case line.key == "":
+			lines = append(lines, line.text)
+		case !exists:
+			// Deleted
+		case value == iniValue(line):
+			lines = append(lines, line.text)
+		default:
+			lines = append(lines, line.text[:line.valueStart]+value+line.quote)
+		}
+		lines = append(lines, created[i]...)
+	}
+	for _, section := range addedSections {
+		lines = append(lines, added[section]...)
+	}
+
+	output := strings.Join(lines, doc.eol)
+	if doc.finalNewline && len(lines) > 0 {
+		output += doc.eol
+	}
+	return []byte(output), nil
+}
+
+// iniValue returns the value of the line as parsed.
+func iniValue(line iniLine) string {
+	return strings.TrimSuffix(strings.TrimRight(line.text[line.valueStart:], " \t"), line.quote)
+}
+
+// sectionOf splits the key into the longest existing section it starts with and the
+// name in it. Keys of sections that don't exist are split at their first dot.
+func (d *iniDocument) sectionOf(key string) (section, name string) {
+	for _, candidate := range d.sections {
+		if strings.HasPrefix(key, candidate+".") && len(candidate) > len(section) {
+			section = candidate
+		}
+	}
+	if section != "" {
+		return section, key[len(section)+1:]
+	}
+	if section, name, found := strings.Cut(key, "."); found {
+		return section, name
+	}
+	return "", key
+}
+
+// lastLineOf returns the index of the last value of the section, or of its header when
+// it has no values. For values before the first section, it is the last of them, or the
+// line before the first header when there are none; -1 is the top of the file.
+func (d *iniDocument) lastLineOf(section string) int {
+	last := -1
+	for i, line := range d.lines {
+		header := line.key == "" && strings.HasPrefix(strings.TrimSpace(line.text), "[")
+		switch {
+		case section == "" && header:
+			if last < 0 {
+				return i - 1
+			}
+			return last
+		case line.section != section:
+		case line.key != "" || header:
+			last = i
+		}
+	}
+	if section == "" && last < 0 {
+		return len(d.lines) - 1
+	}
+	return last
+}
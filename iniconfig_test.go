@@ -0,0 +1,115 @@
+package configarr
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestINIFormat tests parsing and rendering INI configuration files.
+func TestINIFormat(t *testing.T) {
+	qbittorrent := "[LegalNotice]\r\nAccepted=true\r\n\r\n[Preferences]\r\nWebUI\\Port=8080\r\nWebUI\\Username=admin\r\n"
+	sabnzbd := `__version__ = 19
+[misc]
+# Web interface
+port = 8080
+api_key = ""
+[servers]
+[[news.example.com]]
+host = news.example.com
+`
+
+	t.Run("Parse sections", func(t *testing.T) {
+		config, err := INIFormat.Parse([]byte(sabnzbd))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{
+			"__version__":                   "19",
+			"misc.port":                     "8080",
+			"misc.api_key":                  "",
+			"servers.news.example.com.host": "news.example.com",
+		}
+		if !reflect.DeepEqual(config.Properties, expected) {
+			t.Fatalf("Expected properties %v, got %v", expected, config.Properties)
+		}
+		if !reflect.DeepEqual(config.Keys, []string{"__version__", "misc.port", "misc.api_key", "servers.news.example.com.host"}) {
+			t.Fatalf("Expected keys in file order, got %v", config.Keys)
+		}
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		for _, document := range []string{qbittorrent, sabnzbd, "key=value"} {
+			config, err := INIFormat.Parse([]byte(document))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			output, err := INIFormat.Render(config, RenderOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(output) != document {
+				t.Fatalf("Expected unchanged document:\n%q\ngot:\n%q", document, output)
+			}
+		}
+	})
+
+	t.Run("Render changes", func(t *testing.T) {
+		config, err := INIFormat.Parse([]byte(sabnzbd))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		config.Properties["misc.port"] = "9090"
+		config.Properties["misc.api_key"] = "abc"
+		delete(config.Properties, "__version__")
+		for key, value := range map[string]string{"misc.host": "0.0.0.0", "servers.news.example.com.ssl": "1", "logging.level": "2", "top": "x"} {
+			config.Keys = append(config.Keys, key)
+			config.Properties[key] = value
+		}
+
+		output, err := INIFormat.Render(config, RenderOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := `top = x
+[misc]
+# Web interface
+port = 9090
+api_key = "abc"
+host = 0.0.0.0
+[servers]
+[[news.example.com]]
+host = news.example.com
+ssl = 1
+[logging]
+level = 2
+`
+		if string(output) != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, output)
+		}
+	})
+
+	t.Run("Run with overrides", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "qBittorrent.conf")
+		if err := os.WriteFile(path, []byte(qbittorrent), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		environ := []string{`CONFIGARR__PORT=Preferences.WebUI\Port=8081`}
+		if _, err := Run(context.Background(), WithConfigPath(path), WithSources(EnvSource(environ, DefaultPrefix))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := "[LegalNotice]\r\nAccepted=true\r\n\r\n[Preferences]\r\nWebUI\\Port=8081\r\nWebUI\\Username=admin\r\n"
+		if string(data) != expected {
+			t.Fatalf("Expected:\n%q\ngot:\n%q", expected, data)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package configarr
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of inconsistencies reported by NewInventory.
+const (
+	IssueDuplicatePort   = "duplicate-port"
+	IssueDuplicateAPIKey = "duplicate-api-key"
+)
+
+// Inventory summarizes the configuration files of a media stack.
+type Inventory struct {
+	Apps   []InventoryApp   `json:"apps"`
+	Issues []InventoryIssue `json:"issues"`
+}
+
+// InventoryApp holds the key settings of a single configuration file.
+type InventoryApp struct {
+	File                 string   `json:"file"`
+	App                  string   `json:"app"` // Detected app, empty when it couldn't be detected
+	InstanceName         string   `json:"instanceName,omitempty"`
+	BindAddress          string   `json:"bindAddress,omitempty"`
+	Port                 string   `json:"port,omitempty"`
+	SslPort              string   `json:"sslPort,omitempty"` // Only set when SSL is enabled
+	UrlBase              string   `json:"urlBase,omitempty"`
+	AuthenticationMethod string   `json:"authenticationMethod,omitempty"`
+	Hints                []string `json:"hints,omitempty"` // Hints about the version and setup, e.g. "branch: develop"
+}
+
+// InventoryIssue is an inconsistency across the configuration files.
+type InventoryIssue struct {
+	Kind    string   `json:"kind"`
+	Message string   `json:"message"`
+	Files   []string `json:"files"`
+}
+
+// NewInventory summarizes the configurations, keyed by file, and reports settings that
+// collide across apps, such as two apps listening on the same port. Apps are ordered by file.
+func NewInventory(configs map[string]*Config, catalog *Catalog) Inventory {
+	files := make([]string, 0, len(configs))
+	for file := range configs {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	inventory := Inventory{Apps: []InventoryApp{}, Issues: []InventoryIssue{}}
+	ports := make(map[string][]string)
+	apiKeys := make(map[string][]string)
+	for _, file := range files {
+		config := configs[file]
+		props := config.Properties
+		app := InventoryApp{
+			File:                 file,
+			App:                  DetectApp(file, config, catalog),
+			InstanceName:         props["InstanceName"],
+			BindAddress:          props["BindAddress"],
+			Port:                 props["Port"],
+			UrlBase:              props["UrlBase"],
+			AuthenticationMethod: props["AuthenticationMethod"],
+			Hints:                versionHints(config),
+		}
+		if strings.EqualFold(props["EnableSsl"], "true") {
+			app.SslPort = props["SslPort"]
+		}
+		inventory.Apps = append(inventory.Apps, app)
+
+		for _, port := range []string{app.Port, app.SslPort} {
+			if port != "" {
+				ports[port] = append(ports[port], file)
+			}
+		}
+		if apiKey := props["ApiKey"]; apiKey != "" {
+			apiKeys[apiKey] = append(apiKeys[apiKey], file)
+		}
+	}
+
+	for _, port := range sortedKeys(ports) {
+		if len(ports[port]) > 1 {
+			inventory.Issues = append(inventory.Issues, InventoryIssue{
+				Kind:    IssueDuplicatePort,
+				Message: fmt.Sprintf("port %s is used by %d apps", port, len(ports[port])),
+				Files:   ports[port],
+			})
+		}
+	}
+	for _, apiKey := range sortedKeys(apiKeys) {
+		if len(apiKeys[apiKey]) > 1 {
+			inventory.Issues = append(inventory.Issues, InventoryIssue{
+				Kind:    IssueDuplicateAPIKey,
+				Message: fmt.Sprintf("%d apps share the same API key", len(apiKeys[apiKey])),
+				Files:   apiKeys[apiKey],
+			})
+		}
+	}
+	return inventory
+}
+
+// DetectApp returns the catalog app a configuration file belongs to, since the apps share
+// the shape of their files: by InstanceName, then by a directory named after the app,
+// e.g. /configs/sonarr/config.xml, then by the app's default port. It returns the empty
+// string when no app matches.
+func DetectApp(file string, config *Config, catalog *Catalog) string {
+	if name := strings.ToLower(config.Properties["InstanceName"]); name != "" {
+		if _, known := catalog.Apps[name]; known {
+			return name
+		}
+	}
+
+	apps := make([]string, 0, len(catalog.Apps))
+	for app := range catalog.Apps {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	dir := filepath.Dir(file)
+	for parent := filepath.Dir(dir); dir != parent; dir, parent = parent, filepath.Dir(parent) {
+		name := strings.ToLower(filepath.Base(dir))
+		for _, app := range apps {
+			if strings.Contains(name, app) {
+				return app
+			}
+		}
+	}
+
+	if port, err := strconv.Atoi(config.Properties["Port"]); err == nil {
+		for _, app := range apps {
+			if catalog.Apps[app].DefaultPort == port {
+				return app
+			}
+		}
+	}
+	return ""
+}
+
+// versionHints describes what the keys of the file tell about the app's version and setup.
+func versionHints(config *Config) []string {
+	var hints []string
+	if branch := config.Properties["Branch"]; branch != "" {
+		hints = append(hints, "branch: "+branch)
+	}
+	if _, exists := config.Properties["AuthenticationRequired"]; exists {
+		hints = append(hints, "mandatory authentication (Sonarr v4, Radarr v5 or later)")
+	}
+	if config.Properties["PostgresHost"] != "" {
+		hints = append(hints, "database: postgres")
+	}
+	return hints
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,64 @@
+package configarr
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDetectApp tests detecting the app of a configuration file.
+func TestDetectApp(t *testing.T) {
+	catalog, err := LoadCatalog("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error loading catalog: %v", err)
+	}
+
+	tests := []struct {
+		name, file string
+		properties map[string]string
+		expected   string
+	}{
+		{"Instance name", "/configs/a/config.xml", map[string]string{"InstanceName": "Radarr", "Port": "8989"}, "radarr"},
+		{"Directory", "/configs/sonarr-anime/config.xml", map[string]string{"Port": "7878"}, "sonarr"},
+		{"Default port", "/configs/b/config.xml", map[string]string{"Port": "9696"}, "prowlarr"},
+		{"Unknown", "/configs/c/config.xml", map[string]string{"Port": "1234"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if app := DetectApp(tt.file, &Config{Properties: tt.properties}, catalog); app != tt.expected {
+				t.Fatalf("Expected app %q, got %q", tt.expected, app)
+			}
+		})
+	}
+}
+
+// TestNewInventory tests summarizing a stack and reporting inconsistencies.
+func TestNewInventory(t *testing.T) {
+	catalog, err := LoadCatalog("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error loading catalog: %v", err)
+	}
+
+	configs := map[string]*Config{
+		"/configs/sonarr/config.xml": {Properties: map[string]string{"Port": "8989", "ApiKey": "abc", "Branch": "main", "AuthenticationMethod": "Forms"}},
+		"/configs/radarr/config.xml": {Properties: map[string]string{"Port": "8989", "ApiKey": "abc", "EnableSsl": "True", "SslPort": "9898"}},
+		"/configs/lidarr/config.xml": {Properties: map[string]string{"Port": "8686", "ApiKey": "def", "SslPort": "8989"}},
+	}
+	inventory := NewInventory(configs, catalog)
+
+	expectedApps := []InventoryApp{
+		{File: "/configs/lidarr/config.xml", App: "lidarr", Port: "8686"},
+		{File: "/configs/radarr/config.xml", App: "radarr", Port: "8989", SslPort: "9898"},
+		{File: "/configs/sonarr/config.xml", App: "sonarr", Port: "8989", AuthenticationMethod: "Forms", Hints: []string{"branch: main"}},
+	}
+	if !reflect.DeepEqual(inventory.Apps, expectedApps) {
+		t.Fatalf("Expected apps %+v, got %+v", expectedApps, inventory.Apps)
+	}
+
+	expectedIssues := []InventoryIssue{
+		{Kind: IssueDuplicatePort, Message: "port 8989 is used by 2 apps", Files: []string{"/configs/radarr/config.xml", "/configs/sonarr/config.xml"}},
+		{Kind: IssueDuplicateAPIKey, Message: "2 apps share the same API key", Files: []string{"/configs/radarr/config.xml", "/configs/sonarr/config.xml"}},
+	}
+	if !reflect.DeepEqual(inventory.Issues, expectedIssues) {
+		t.Fatalf("Expected issues %+v, got %+v", expectedIssues, inventory.Issues)
+	}
+}
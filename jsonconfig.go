@@ -0,0 +1,357 @@
+package configarr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Kinds of the values of a JSON document.
+const (
+	jsonObject = iota
+	jsonArray
+	jsonString
+	jsonLiteral // Number, true, false or null, kept as written
+)
+
+// jsonNode is a value of a JSON document. Objects keep the order of their members.
+type jsonNode struct {
+	kind    int
+	members []jsonMember // Members of an object
+	items   []*jsonNode  // Items of an array
+	value   string       // Unquoted string, or literal as written
+}
+
+// jsonMember is a named member of a JSON object.
+type jsonMember struct {
+	name string
+	node *jsonNode
+}
+
+// jsonDocument is a parsed JSON configuration file: one or more concatenated values,
+// e.g. the version header followed by the settings in Deluge's core.conf.
+type jsonDocument struct {
+	roots  []*jsonNode
+	indent string // Indentation of the original file, empty when it was compact
+}
+
+// property returns the value of a scalar as a property: strings unquoted, literals as
+// written, and null as the empty string.
+func (n *jsonNode) property() string {
+	if n.kind == jsonLiteral && n.value == "null" {
+		return ""
+	}
+	return n.value
+}
+
+// jsonFormat is the format of JSON configuration files, e.g. Overseerr's settings.json.
+// Nested values are addressed by their path with dots, e.g. main.applicationUrl, and
+// array items by their index, e.g. servers.0.host.
+type jsonFormat struct{}
+
+// Name returns FormatJSON.
+func (jsonFormat) Name() string {
+	return FormatJSON
+}
+
+// Parse parses the JSON document into a Config with a property per scalar value.
+func (jsonFormat) Parse(data []byte) (*Config, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	doc := &jsonDocument{indent: detectJSONIndent(data)}
+	for {
+		root, err := decodeJSONNode(d, true)
+		if errors.Is(err, io.EOF) && len(doc.roots) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, categorize(ErrParse, fmt.Errorf("error parsing JSON: %w", err))
+		}
+		doc.roots = append(doc.roots, root)
+	}
+
+	cfg := &Config{Properties: make(map[string]string), Keys: []string{}, source: data, document: doc}
+	for _, root := range doc.roots {
+		flattenJSON(cfg, root, "")
+	}
+	return cfg, nil
+}
+
+// decodeJSONNode decodes the next value. The end of the input is reported as io.EOF at
+// the top level and as io.ErrUnexpectedEOF inside a value.
+func decodeJSONNode(d *json.Decoder, top bool) (*jsonNode, error) {
+	token, err := d.Token()
+	if err != nil && !top {
+		err = unexpectedEOF(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		node := &jsonNode{kind: jsonObject}
+		if t == '[' {
+			node.kind = jsonArray
+		}
+		for d.More() {
+			if node.kind == jsonArray {
+				item, err := decodeJSONNode(d, false)
+				if err != nil {
+					return nil, err
+				}
+				node.items = append(node.items, item)
+				continue
+			}
+			name, err := d.Token()
+			if err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			member, err := decodeJSONNode(d, false)
+			if err != nil {
+				return nil, err
+			}
+			node.members = append(node.members, jsonMember{name: name.(string), node: member})
+		}
+		if _, err := d.Token(); err != nil { // Closing delimiter
+			return nil, unexpectedEOF(err)
+		}
+		return node, nil
+	case string:
+		return &jsonNode{kind: jsonString, value: t}, nil
+	case json.Number:
+		return &jsonNode{kind: jsonLiteral, value: t.String()}, nil
+	case bool:
+		return &jsonNode{kind: jsonLiteral, value: strconv.FormatBool(t)}, nil
+	default: // null
+		return &jsonNode{kind: jsonLiteral, value: "null"}, nil
+	}
+}
+
+// unexpectedEOF reports the end of the input inside a value as io.ErrUnexpectedEOF, so
+// truncated documents are read again like truncated XML.
+func unexpectedEOF(err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.Is(err, io.EOF) || (errors.As(err, &syntaxErr) && syntaxErr.Error() == "unexpected end of JSON input") {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// flattenJSON adds a property per scalar below the node, keyed by its path.
+func flattenJSON(cfg *Config, node *jsonNode, path string) {
+	switch node.kind {
+	case jsonObject:
+		for _, member := range node.members {
+			flattenJSON(cfg, member.node, joinJSONPath(path, member.name))
+		}
+	case jsonArray:
+		for i, item := range node.items {
+			flattenJSON(cfg, item, joinJSONPath(path, strconv.Itoa(i)))
+		}
+	default:
+		if path == "" {
+			return // Scalar document, nothing to address
+		}
+		if _, exists := cfg.Properties[path]; !exists {
+			cfg.Keys = append(cfg.Keys, path)
+		}
+		cfg.Properties[path] = node.property()
+	}
+}
+
+// joinJSONPath appends the name of a member or the index of an item to the path.
+func joinJSONPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// detectJSONIndent returns the indentation of the first indented line, DefaultIndent when
+// lines are not indented, and the empty string for documents on a single line.
+func detectJSONIndent(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	i := bytes.IndexByte(trimmed, '\n')
+	if i < 0 {
+		return ""
+	}
+	for _, line := range bytes.Split(trimmed[i+1:], []byte("\n")) {
+		content := bytes.TrimLeft(line, " \t")
+		if len(content) > 0 && len(content) < len(line) {
+			return string(line[:len(line)-len(content)])
+		}
+	}
+	return DefaultIndent
+}
+
+// Render renders the Config as a JSON document in the layout of the original file, see
+// Parse. Changed values keep the type of the value they replace when they can, created
+// properties go into the last document with nested objects as needed, and deleted
+// properties are left out. With opts.Compact, the document is written on a single line.
+func (jsonFormat) Render(config *Config, opts RenderOptions) ([]byte, error) {
+	doc, _ := config.document.(*jsonDocument)
+	if doc == nil || len(doc.roots) == 0 { // e.g. a Config built in code
+		doc = &jsonDocument{roots: []*jsonNode{{kind: jsonObject}}, indent: DefaultIndent}
+	}
+
+	seen := make(map[string]bool)
+	roots := make([]*jsonNode, len(doc.roots))
+	for i, root := range doc.roots {
+		roots[i] = updateJSONNode(root, "", config.Properties, seen)
+	}
+	for _, key := range config.Keys {
+		value, exists := config.Properties[key]
+		if seen[key] || !exists {
+			continue
+		}
+		if err := insertJSONNode(roots[len(roots)-1], strings.Split(key, "."), jsonValue(value)); err != nil {
+			return nil, fmt.Errorf("cannot create %s: %w", key, err)
+		}
+	}
+
+	indent := doc.indent
+	if opts.Compact {
+		indent = ""
+	}
+	var output bytes.Buffer
+	for _, root := range roots {
+		writeJSONNode(&output, root, indent, 0)
+	}
+	return output.Bytes(), nil
+}
+
+// updateJSONNode returns a copy of the node with the values of the properties, or nil
+// when the property of a scalar was deleted. Visited paths are recorded in seen.
+func updateJSONNode(node *jsonNode, path string, properties map[string]string, seen map[string]bool) *jsonNode {
+	switch node.kind {
+	case jsonObject:
+		updated := &jsonNode{kind: jsonObject}
+		for _, member := range node.members {
+			if child := updateJSONNode(member.node, joinJSONPath(path, member.name), properties, seen); child != nil {
+				updated.members = append(updated.members, jsonMember{name: member.name, node: child})
+			}
+		}
+		return updated
+	case jsonArray:
+		updated := &jsonNode{kind: jsonArray}
+		for i, item := range node.items {
+			if child := updateJSONNode(item, joinJSONPath(path, strconv.Itoa(i)), properties, seen); child != nil {
+				updated.items = append(updated.items, child)
+			}
+		}
+		return updated
+	}
+
+	if path == "" {
+		return node
+	}
+	seen[path] = true
+	value, exists := properties[path]
+	switch {
+	case !exists:
+		return nil
+	case value == node.property():
+		return node // Unchanged, kept as written
+	case node.kind == jsonString:
+		return &jsonNode{kind: jsonString, value: value}
+	}
+	return jsonValue(value)
+}
+
+// jsonValue returns a literal for values that are JSON numbers or booleans, in any case,
+// and a string otherwise.
+func jsonValue(value string) *jsonNode {
+	if lower := strings.ToLower(value); lower == "true" || lower == "false" {
+		return &jsonNode{kind: jsonLiteral, value: lower}
+	}
+	var number json.Number
+	if value != "" && json.Unmarshal([]byte(value), &number) == nil {
+		return &jsonNode{kind: jsonLiteral, value: value}
+	}
+	return &jsonNode{kind: jsonString, value: value}
+}
+
+// insertJSONNode adds the value at the path below the object, creating the objects in
+// between.
+func insertJSONNode(node *jsonNode, path []string, value *jsonNode) error {
+	if node.kind != jsonObject {
+		return errors.New("parent is not an object")
+	}
+	for _, member := range node.members {
+		if member.name == path[0] {
+			if len(path) == 1 {
+				return errors.New("value already exists")
+			}
+			return insertJSONNode(member.node, path[1:], value)
+		}
+	}
+
+	child := value
+	if len(path) > 1 {
+		child = &jsonNode{kind: jsonObject}
+		if err := insertJSONNode(child, path[1:], value); err != nil {
+			return err
+		}
+	}
+	node.members = append(node.members, jsonMember{name: path[0], node: child})
+	return nil
+}
+
+// writeJSONNode writes the node at the nesting depth, with a line per member or item
+// unless indent is empty.
+func writeJSONNode(w *bytes.Buffer, node *jsonNode, indent string, depth int) {
+	newline := func(depth int) {
+		if indent != "" {
+			w.WriteString("\n" + strings.Repeat(indent, depth))
+		}
+	}
+
+	switch node.kind {
+	case jsonObject, jsonArray:
+		open, end, count := "{", "}", len(node.members)
+		if node.kind == jsonArray {
+			open, end, count = "[", "]", len(node.items)
+		}
+		w.WriteString(open)
+		for i := 0; i < count; i++ {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			newline(depth + 1)
+			var child *jsonNode
+			if node.kind == jsonObject {
+				w.WriteString(quoteJSON(node.members[i].name) + ":")
+				if indent != "" {
+					w.WriteByte(' ')
+				}
+				child = node.members[i].node
+			} else {
+				child = node.items[i]
+			}
+			writeJSONNode(w, child, indent, depth+1)
+		}
+		if count > 0 {
+			newline(depth)
+		}
+		w.WriteString(end)
+	case jsonString:
+		w.WriteString(quoteJSON(node.value))
+	default:
+		w.WriteString(node.value)
+	}
+}
+
+// quoteJSON returns the string as a JSON string, without escaping HTML characters.
+func quoteJSON(s string) string {
+	var quoted bytes.Buffer
+	encoder := json.NewEncoder(&quoted)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s) // Strings always encode
+	return strings.TrimSuffix(quoted.String(), "\n")
+}
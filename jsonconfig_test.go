@@ -0,0 +1,145 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestJSONFormat tests parsing and rendering JSON configuration files.
+func TestJSONFormat(t *testing.T) {
+	settings := `{
+    "main": {
+        "applicationUrl": "",
+        "trustProxy": false,
+        "port": 5055,
+        "apiKey": null
+    },
+    "servers": [
+        {
+            "host": "10.0.0.2"
+        }
+    ],
+    "tags": []
+}`
+
+	t.Run("Parse nested keys", func(t *testing.T) {
+		config, err := JSONFormat.Parse([]byte(settings))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{
+			"main.applicationUrl": "",
+			"main.trustProxy":     "false",
+			"main.port":           "5055",
+			"main.apiKey":         "",
+			"servers.0.host":      "10.0.0.2",
+		}
+		if !reflect.DeepEqual(config.Properties, expected) {
+			t.Fatalf("Expected properties %v, got %v", expected, config.Properties)
+		}
+		if config.Keys[0] != "main.applicationUrl" || config.Keys[4] != "servers.0.host" {
+			t.Fatalf("Expected keys in document order, got %v", config.Keys)
+		}
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		for _, document := range []string{settings, `{"a":1,"b":[1,2]}`, "{\n  \"file\": 1\n}{\n  \"a\": \"<&>\"\n}"} {
+			config, err := JSONFormat.Parse([]byte(document))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			output, err := JSONFormat.Render(config, RenderOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(output) != document {
+				t.Fatalf("Expected unchanged document:\n%s\ngot:\n%s", document, output)
+			}
+		}
+	})
+
+	t.Run("Render changes", func(t *testing.T) {
+		config, err := JSONFormat.Parse([]byte(`{"main":{"url":"","proxy":false,"port":5055,"name":"x"},"hosts":["a","b"]}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		config.Properties["main.url"] = "https://example.com"
+		config.Properties["main.proxy"] = "True"
+		config.Properties["main.port"] = "5056"
+		config.Properties["main.name"] = "42"
+		delete(config.Properties, "hosts.0")
+		config.Keys = append(config.Keys, "auth.local.enabled")
+		config.Properties["auth.local.enabled"] = "true"
+
+		output, err := JSONFormat.Render(config, RenderOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := `{"main":{"url":"https://example.com","proxy":true,"port":5056,"name":"42"},"hosts":["b"],"auth":{"local":{"enabled":true}}}`
+		if string(output) != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, output)
+		}
+	})
+
+	t.Run("Truncated document", func(t *testing.T) {
+		_, err := JSONFormat.Parse([]byte(`{"main": {"port": 5055`))
+		if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.Is(err, ErrParse) {
+			t.Fatalf("Expected truncated parse error, got: %v", err)
+		}
+	})
+
+	t.Run("Run with overrides", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "settings.json")
+		if err := os.WriteFile(path, []byte(settings+"\n"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		environ := []string{"CONFIGARR__URL=main.applicationUrl=https://requests.example.com", "CONFIGARR__PROXY=main.trustProxy=true"}
+		if _, err := Run(context.Background(), WithConfigPath(path), WithSources(EnvSource(environ, DefaultPrefix))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		config, err := ReadConfigFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Properties["main.applicationUrl"] != "https://requests.example.com" || config.Properties["main.trustProxy"] != "true" {
+			t.Fatalf("Unexpected properties %v", config.Properties)
+		}
+
+		if _, err := Run(context.Background(), WithConfigPath(path), WithPatch()); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("Expected patch mode to be refused for JSON, got: %v", err)
+		}
+	})
+}
+
+// TestLookupFormat tests selecting the format by name or file extension.
+func TestLookupFormat(t *testing.T) {
+	for _, tt := range []struct{ name, path, expected string }{
+		{"", "/config/config.xml", FormatXML},
+		{"", "/app/config/settings.JSON", FormatJSON},
+		{FormatJSON, "/config/core.conf", FormatJSON},
+		{"", "/config/config/config.yaml", FormatYAML},
+		{"", "/config/config.yml", FormatYAML},
+		{"", "/config/sabnzbd.ini", FormatINI},
+		{"", "/config/qBittorrent/qBittorrent.conf", FormatINI},
+	} {
+		format, err := LookupFormat(tt.name, tt.path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if format.Name() != tt.expected {
+			t.Fatalf("Expected format %s for %q and %s, got %s", tt.expected, tt.name, tt.path, format.Name())
+		}
+	}
+
+	if _, err := LookupFormat("toml", "config.toml"); err == nil {
+		t.Fatal("Expected error for unknown format, but got none")
+	}
+}
@@ -0,0 +1,179 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Kubernetes API access from inside a pod.
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	kubeTimeout       = 10 * time.Second
+)
+
+// SecretTarget names the key of a Kubernetes Secret a property is published to.
+type SecretTarget struct {
+	Property  string
+	Namespace string
+	Name      string
+	Key       string
+}
+
+// ParseSecretTarget parses a target of the form [<property>=]<namespace>/<name>/<key>.
+// The property defaults to ApiKey.
+func ParseSecretTarget(spec string) (SecretTarget, error) {
+	target := SecretTarget{Property: "ApiKey"}
+	if property, rest, found := strings.Cut(spec, "="); found {
+		target.Property, spec = property, rest
+	}
+
+	parts := strings.Split(spec, "/")
+	if len(parts) != 3 || target.Property == "" || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return SecretTarget{}, fmt.Errorf("invalid secret target %q: expected [<property>=]<namespace>/<name>/<key>", spec)
+	}
+	target.Namespace, target.Name, target.Key = parts[0], parts[1], parts[2]
+	return target, nil
+}
+
+// KubeClient is a minimal client for the Kubernetes API.
+type KubeClient struct {
+	BaseURL    string // e.g. https://10.0.0.1:443
+	Token      string // Bearer token, may be empty
+	HTTPClient *http.Client
+}
+
+// NewInClusterKubeClient returns a client using the service account of the pod it runs in.
+func NewInClusterKubeClient() (*KubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running inside a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account token: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("error parsing service account CA")
+	}
+
+	return &KubeClient{
+		BaseURL: "https://" + net.JoinHostPort(host, port),
+		Token:   strings.TrimSpace(string(token)),
+		HTTPClient: &http.Client{
+			Timeout:   kubeTimeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// ApplySecretData sets the keys of the Secret, creating the Secret when it doesn't exist.
+// Other keys of an existing Secret are kept.
+func (c *KubeClient) ApplySecretData(ctx context.Context, namespace, name string, data map[string]string) error {
+	encoded := make(map[string]string, len(data))
+	for key, value := range data {
+		encoded[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+
+	secretsURL := fmt.Sprintf("%s/api/v1/namespaces/%s/secrets", c.BaseURL, namespace)
+	patch := map[string]any{"data": encoded}
+	status, err := c.do(ctx, http.MethodPatch, secretsURL+"/"+name, "application/merge-patch+json", patch)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusNotFound {
+		return nil
+	}
+
+	secret := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]string{"name": name, "namespace": namespace},
+		"type":       "Opaque",
+		"data":       encoded,
+	}
+	_, err = c.do(ctx, http.MethodPost, secretsURL, "application/json", secret)
+	return err
+}
+
+// do sends a JSON request and returns the status code. Error statuses other than
+// 404 Not Found are returned as errors.
+func (c *KubeClient) do(ctx context.Context, method, url, contentType string, body any) (int, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request for %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: kubeTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error sending %s %s: %w", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return resp.StatusCode, nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, fmt.Errorf("error sending %s %s: unexpected status %s: %s", method, url, resp.Status, strings.TrimSpace(string(message)))
+}
+
+// PublishSecrets writes the values of the targeted properties into their Secrets,
+// with one request per Secret. Properties missing from the configuration are an error.
+func PublishSecrets(ctx context.Context, client *KubeClient, config *Config, targets []SecretTarget) error {
+	type secretRef struct{ namespace, name string }
+	var order []secretRef
+	data := make(map[secretRef]map[string]string)
+
+	for _, target := range targets {
+		value, exists := config.Properties[target.Property]
+		if !exists {
+			return fmt.Errorf("cannot publish '%s': key not present in configuration file", target.Property)
+		}
+
+		ref := secretRef{target.Namespace, target.Name}
+		if data[ref] == nil {
+			data[ref] = make(map[string]string)
+			order = append(order, ref)
+		}
+		data[ref][target.Key] = value
+	}
+
+	for _, ref := range order {
+		if err := client.ApplySecretData(ctx, ref.namespace, ref.name, data[ref]); err != nil {
+			return fmt.Errorf("error publishing secret %s/%s: %w", ref.namespace, ref.name, err)
+		}
+	}
+	return nil
+}
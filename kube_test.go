@@ -0,0 +1,103 @@
+package configarr
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestParseSecretTarget tests parsing Kubernetes Secret targets.
+func TestParseSecretTarget(t *testing.T) {
+	t.Run("Default property", func(t *testing.T) {
+		target, err := ParseSecretTarget("media/sonarr/api-key")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := SecretTarget{Property: "ApiKey", Namespace: "media", Name: "sonarr", Key: "api-key"}
+		if target != expected {
+			t.Fatalf("Expected %+v, got %+v", expected, target)
+		}
+	})
+
+	t.Run("Explicit property", func(t *testing.T) {
+		target, err := ParseSecretTarget("PostgresPassword=media/sonarr/db")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if target.Property != "PostgresPassword" || target.Key != "db" {
+			t.Fatalf("Unexpected target: %+v", target)
+		}
+	})
+
+	t.Run("Invalid targets", func(t *testing.T) {
+		for _, spec := range []string{"media/sonarr", "=media/sonarr/key", "media//key", "a/b/c/d"} {
+			if _, err := ParseSecretTarget(spec); err == nil {
+				t.Fatalf("Expected error for %q, but got none", spec)
+			}
+		}
+	})
+}
+
+// TestPublishSecrets tests patching existing Secrets and creating missing ones.
+func TestPublishSecrets(t *testing.T) {
+	type request struct {
+		Method, Path, ContentType string
+		Body                      map[string]any
+	}
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Expected bearer token, got %q", r.Header.Get("Authorization"))
+		}
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("Unexpected error decoding body: %v", err)
+		}
+		requests = append(requests, request{r.Method, r.URL.Path, r.Header.Get("Content-Type"), body})
+
+		if r.Method == http.MethodPatch && r.URL.Path == "/api/v1/namespaces/media/secrets/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &KubeClient{BaseURL: server.URL, Token: "token"}
+	config := &Config{Properties: map[string]string{"ApiKey": "abc", "PostgresPassword": "pw"}}
+	targets := []SecretTarget{
+		{Property: "ApiKey", Namespace: "media", Name: "sonarr", Key: "api-key"},
+		{Property: "PostgresPassword", Namespace: "media", Name: "sonarr", Key: "db"},
+		{Property: "ApiKey", Namespace: "media", Name: "missing", Key: "api-key"},
+	}
+
+	if err := PublishSecrets(context.Background(), client, config, targets); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %+v", requests)
+	}
+	patch := request{
+		Method:      http.MethodPatch,
+		Path:        "/api/v1/namespaces/media/secrets/sonarr",
+		ContentType: "application/merge-patch+json",
+		Body:        map[string]any{"data": map[string]any{"api-key": "YWJj", "db": "cHc="}},
+	}
+	if !reflect.DeepEqual(requests[0], patch) {
+		t.Fatalf("Expected %+v, got %+v", patch, requests[0])
+	}
+	if requests[2].Method != http.MethodPost || requests[2].Path != "/api/v1/namespaces/media/secrets" {
+		t.Fatalf("Expected the missing Secret to be created, got %+v", requests[2])
+	}
+
+	t.Run("Missing property", func(t *testing.T) {
+		targets := []SecretTarget{{Property: "Typo", Namespace: "media", Name: "sonarr", Key: "x"}}
+		if err := PublishSecrets(context.Background(), client, config, targets); err == nil {
+			t.Fatal("Expected error for missing property, but got none")
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package configarr
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the files properties can be linked to.
+const (
+	LinkFormatYAML   = "yaml"   // Key is a dotted path, e.g. sonarr.apikey in Bazarr's config.yaml
+	LinkFormatDotenv = "dotenv" // Key is the variable name, e.g. SONARR_API_KEY
+)
+
+// Link names the key of a dependent file a property is copied to, so references between
+// apps, such as the API key of Sonarr in the configuration of Bazarr, stay consistent.
+type Link struct {
+	Property string
+	Format   string
+	Path     string
+	Key      string
+}
+
+// ParseLink parses a link of the form [<property>=]<format>:<path>:<key>, e.g.
+// yaml:/bazarr/config/config.yaml:sonarr.apikey. The property defaults to ApiKey.
+func ParseLink(spec string) (Link, error) {
+	link := Link{Property: "ApiKey"}
+	rest := spec
+	if property, after, found := strings.Cut(rest, "="); found {
+		link.Property, rest = property, after
+	}
+
+	format, rest, _ := strings.Cut(rest, ":")
+	i := strings.LastIndex(rest, ":") // Paths may contain colons, e.g. Windows drive letters
+	if i <= 0 || link.Property == "" || i == len(rest)-1 {
+		return Link{}, fmt.Errorf("invalid link %q: expected [<property>=]<format>:<path>:<key>", spec)
+	}
+	link.Format, link.Path, link.Key = format, rest[:i], rest[i+1:]
+
+	if link.Format != LinkFormatYAML && link.Format != LinkFormatDotenv {
+		return Link{}, fmt.Errorf("invalid link %q: unknown format %q, expected %s or %s", spec, link.Format, LinkFormatYAML, LinkFormatDotenv)
+	}
+	return link, nil
+}
+
+// UpdateLinks copies the values of the linked properties into their files and returns the
+// files that changed. Other content of the files is kept, and files whose linked keys
+// already hold the values are not written. Missing files are created.
+func UpdateLinks(fsys FS, config *Config, links []Link) ([]string, error) {
+	var updated []string
+	for _, link := range links {
+		value, exists := config.Properties[link.Property]
+		if !exists {
+			return updated, fmt.Errorf("cannot link '%s': key not present in configuration file", link.Property)
+		}
+
+		data, err := fs.ReadFile(fsys, link.Path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return updated, fmt.Errorf("error reading file %s: %w", link.Path, err)
+		}
+
+		var linked []byte
+		switch link.Format {
+		case LinkFormatYAML:
+			linked, err = setYAMLKey(data, link.Key, value)
+		case LinkFormatDotenv:
+			linked, err = setDotenvKey(data, link.Key, value)
+		}
+		if err != nil {
+			return updated, fmt.Errorf("error linking '%s' to %s: %w", link.Property, link.Path, err)
+		}
+		if bytes.Equal(linked, data) {
+			continue
+		}
+
+		if err := fsys.WriteFile(link.Path, linked, 0600); err != nil { // Linked values are usually secrets
+			return updated, fmt.Errorf("error writing file %s: %w", link.Path, err)
+		}
+		if !slices.Contains(updated, link.Path) {
+			updated = append(updated, link.Path)
+		}
+	}
+	return updated, nil
+}
+
+// setYAMLKey sets the value at the dotted path of the YAML document, creating missing
+// mappings. Comments and the order of keys are kept; the document is re-indented.
+func setYAMLKey(data []byte, path, value string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing YAML: %w", err)
+	}
+	if doc.Kind == 0 { // Empty or missing file
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	node := doc.Content[0]
+	for _, name := range strings.Split(path, ".") {
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("cannot set %s: %s is not a YAML mapping", path, name)
+		}
+		var child *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == name {
+				child = node.Content[i+1]
+			}
+		}
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, child)
+		}
+		node = child
+	}
+
+	if node.Kind == yaml.ScalarNode && node.Value == value {
+		return data, nil
+	}
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+		return nil, fmt.Errorf("cannot set %s: it holds a YAML mapping", path)
+	}
+	setYAMLScalar(node, value)
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// setDotenvKey sets the variable in the dotenv file, replacing the first assignment of
+// it, with or without export, or appending one.
+func setDotenvKey(data []byte, name, value string) ([]byte, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return nil, errors.New("values with line breaks can't be written to dotenv files")
+	}
+	assignment := name + "=" + dotenvQuote(value)
+
+	var out bytes.Buffer
+	found := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimPrefix(strings.TrimLeft(line, " \t"), "export ")
+		if key, _, ok := strings.Cut(trimmed, "="); ok && !found && strings.TrimSpace(key) == name {
+			found = true
+			line = strings.TrimSuffix(line, trimmed) + assignment
+		}
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading dotenv file: %w", err)
+	}
+	if !found {
+		out.WriteString(assignment + "\n")
+	}
+
+	if found && bytes.Equal(bytes.TrimSuffix(out.Bytes(), []byte("\n")), bytes.TrimSuffix(data, []byte("\n"))) {
+		return data, nil // Keep a missing final newline
+	}
+	return out.Bytes(), nil
+}
+
+// dotenvQuote double-quotes the value unless it only contains safe characters.
+func dotenvQuote(value string) string {
+	if value != "" && strings.Trim(value, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:,@%+") == "" {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(value) + `"`
+}
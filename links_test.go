@@ -0,0 +1,118 @@
+package configarr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestParseLink tests parsing link specs.
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected Link
+		valid    bool
+	}{
+		{"yaml:/bazarr/config.yaml:sonarr.apikey", Link{"ApiKey", LinkFormatYAML, "/bazarr/config.yaml", "sonarr.apikey"}, true},
+		{"Port=dotenv:.env:SONARR_PORT", Link{"Port", LinkFormatDotenv, ".env", "SONARR_PORT"}, true},
+		{`dotenv:C:\stack\.env:SONARR_API_KEY`, Link{"ApiKey", LinkFormatDotenv, `C:\stack\.env`, "SONARR_API_KEY"}, true},
+		{"json:/app/config.json:apikey", Link{}, false},
+		{"yaml:/bazarr/config.yaml", Link{}, false},
+		{"=yaml:/bazarr/config.yaml:sonarr.apikey", Link{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			link, err := ParseLink(tt.spec)
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("Expected error, got link %+v", link)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if link != tt.expected {
+				t.Fatalf("Expected link %+v, got %+v", tt.expected, link)
+			}
+		})
+	}
+}
+
+// TestUpdateLinks tests copying properties into YAML and dotenv files.
+func TestUpdateLinks(t *testing.T) {
+	config := &Config{Properties: map[string]string{"ApiKey": "abc123", "Port": "8990"}}
+
+	t.Run("YAML", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "config.yaml")
+		content := "general:\n  port: 6767 # Bazarr port\nsonarr:\n  apikey: old\n  port: 8989\n"
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		links := []Link{
+			{Property: "ApiKey", Format: LinkFormatYAML, Path: file, Key: "sonarr.apikey"},
+			{Property: "Port", Format: LinkFormatYAML, Path: file, Key: "sonarr.port"},
+			{Property: "ApiKey", Format: LinkFormatYAML, Path: file, Key: "radarr.apikey"},
+		}
+		if _, err := UpdateLinks(OSFS(), config, links); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, _ := os.ReadFile(file)
+		expected := "general:\n  port: 6767 # Bazarr port\nsonarr:\n  apikey: abc123\n  port: 8990\nradarr:\n  apikey: abc123\n"
+		if string(data) != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, data)
+		}
+
+		updated, err := UpdateLinks(OSFS(), config, links)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(updated) != 0 {
+			t.Fatalf("Expected no updates when values are linked, got %v", updated)
+		}
+	})
+
+	t.Run("Dotenv", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), ".env")
+		if err := os.WriteFile(file, []byte("# stack\nexport SONARR_API_KEY=old\nTZ=UTC"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		links := []Link{
+			{Property: "ApiKey", Format: LinkFormatDotenv, Path: file, Key: "SONARR_API_KEY"},
+			{Property: "Port", Format: LinkFormatDotenv, Path: file, Key: "SONARR_PORT"},
+		}
+		updated, err := UpdateLinks(OSFS(), config, links)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(updated, []string{file}) {
+			t.Fatalf("Expected %s to be updated, got %v", file, updated)
+		}
+
+		data, _ := os.ReadFile(file)
+		if expected := "# stack\nexport SONARR_API_KEY=abc123\nTZ=UTC\nSONARR_PORT=8990\n"; string(data) != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, data)
+		}
+	})
+
+	t.Run("Missing property", func(t *testing.T) {
+		links := []Link{{Property: "Missing", Format: LinkFormatDotenv, Path: filepath.Join(t.TempDir(), ".env"), Key: "X"}}
+		if _, err := UpdateLinks(OSFS(), config, links); err == nil {
+			t.Fatal("Expected error for missing property, but got none")
+		}
+	})
+
+	t.Run("Quote dotenv values", func(t *testing.T) {
+		data, err := setDotenvKey(nil, "PASSWORD", `p@ss "word" $HOME`)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := `PASSWORD="p@ss \"word\" \$HOME"` + "\n"; string(data) != expected {
+			t.Fatalf("Expected %q, got %q", expected, data)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package configarr
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SecretMask replaces the values of secret properties in exports and events.
+const SecretMask = "********"
+
+// xmlElementPattern matches an XML element holding text or CDATA sections on a single line,
+// e.g. <ApiKey>abc</ApiKey> or <ApiKey><![CDATA[abc]]></ApiKey>.
+var xmlElementPattern = regexp.MustCompile(`<([A-Za-z_][\w.:-]*)>((?:<!\[CDATA\[.*?\]\]>)+|[^<]+)</([A-Za-z_][\w.:-]*)>`)
+
+// xmlStartTagPattern matches an XML start tag with attributes, also spanning several lines,
+// e.g. <Preferences PlexOnlineToken="abc"/>.
+var xmlStartTagPattern = regexp.MustCompile(`<[A-Za-z_][\w.:-]*\s(?:[^<>"']|"[^"]*"|'[^']*')*>`)
+
+// xmlAttributePattern matches an XML attribute holding a non-empty value, e.g. PlexOnlineToken="abc".
+var xmlAttributePattern = regexp.MustCompile(`([A-Za-z_][\w.:-]*)(\s*=\s*)(?:"[^"]+"|'[^']+')`)
+
+// jsonMemberPattern matches a JSON object member holding a non-empty string, e.g. "apiKey": "abc".
+var jsonMemberPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)"(?:[^"\\]|\\.)+"`)
+
+// yamlEntryPattern matches a YAML mapping entry holding a value on its line, e.g. apikey: abc,
+// optionally preceded by the marker of a diff line.
+var yamlEntryPattern = regexp.MustCompile(`(?m)^([-+ ]?[ \t]*(?:- )?)([\w.-]+)(:[ \t]+)([^\s#].*)$`)
+
+// iniValuePattern matches an INI assignment, e.g. api_key = abc or WebUI\Password=abc,
+// optionally preceded by the marker of a diff line.
+var iniValuePattern = regexp.MustCompile(`(?m)^([-+ ]?[ \t]*)([\w.\\-]+)([ \t]*=[ \t]*)(\S.*)$`)
+
+// secretKeyMarkers are case-insensitive substrings identifying properties holding secrets.
+var secretKeyMarkers = []string{"apikey", "password", "secret", "token"}
+
+// IsSecretKey reports whether the property likely holds a secret such as an API key.
+// Underscores and dashes are ignored, so api_key of INI and YAML files matches as well.
+func IsSecretKey(key string) bool {
+	lower := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	for _, marker := range secretKeyMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskSecretValue returns SecretMask for non-empty values of secret properties
+// and the value itself otherwise.
+func MaskSecretValue(key, value string) string {
+	if IsSecretKey(key) && value != "" {
+		return SecretMask
+	}
+	return value
+}
+
+// MaskSecretElements masks the text of the XML elements and attributes, the strings of
+// the JSON members and the values of the YAML entries and INI assignments of secret
+// properties, e.g. in a diff of a configuration file. CDATA sections are masked within
+// their markers.
+func MaskSecretElements(text string) string {
+	text = xmlElementPattern.ReplaceAllStringFunc(text, func(element string) string {
+		match := xmlElementPattern.FindStringSubmatch(element)
+		if match[1] != match[3] || !IsSecretKey(match[1]) {
+			return element
+		}
+		mask := SecretMask
+		if strings.HasPrefix(match[2], "<![CDATA[") {
+			mask = "<![CDATA[" + SecretMask + "]]>"
+		}
+		return "<" + match[1] + ">" + mask + "</" + match[3] + ">"
+	})
+	text = xmlStartTagPattern.ReplaceAllStringFunc(text, func(tag string) string {
+		return xmlAttributePattern.ReplaceAllStringFunc(tag, func(attr string) string {
+			match := xmlAttributePattern.FindStringSubmatch(attr)
+			if !IsSecretKey(match[1]) {
+				return attr
+			}
+			quote := attr[len(attr)-1:]
+			return match[1] + match[2] + quote + SecretMask + quote
+		})
+	})
+	text = jsonMemberPattern.ReplaceAllStringFunc(text, func(member string) string {
+		match := jsonMemberPattern.FindStringSubmatch(member)
+		if !IsSecretKey(match[1]) {
+			return member
+		}
+		return `"` + match[1] + `"` + match[2] + `"` + SecretMask + `"`
+	})
+	for _, pattern := range []*regexp.Regexp{yamlEntryPattern, iniValuePattern} {
+		text = pattern.ReplaceAllStringFunc(text, func(entry string) string {
+			match := pattern.FindStringSubmatch(entry)
+			if !IsSecretKey(match[2]) || strings.HasPrefix(strings.TrimLeft(match[4], `"'`), SecretMask) { // e.g. attributes on their own line
+				return entry
+			}
+			return match[1] + match[2] + match[3] + SecretMask
+		})
+	}
+	return text
+}
@@ -0,0 +1,370 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notifyTimeout bounds the time spent delivering a single notification.
+const notifyTimeout = 10 * time.Second
+
+// Change is a single property change written to a configuration file.
+type Change struct {
+	Key     string `json:"key"`
+	Old     string `json:"old"`
+	Value   string `json:"value"`
+	Source  string `json:"source,omitempty"` // Source of the override, e.g. "env:CONFIGARR__PORT"
+	Action  string `json:"action"`           // Plan action type, e.g. ActionChange
+	Restart bool   `json:"restart"`          // Whether the change only takes effect after an app restart
+}
+
+// ChangeSet describes the changes written to a configuration file.
+type ChangeSet struct {
+	ConfigPath string   `json:"file"`
+	Changes    []Change `json:"changes"`
+}
+
+// Filter returns the changes whose key matches any of the glob patterns.
+// Without patterns, all changes are kept.
+func (c ChangeSet) Filter(patterns []string) ChangeSet {
+	if len(patterns) == 0 {
+		return c
+	}
+
+	filtered := ChangeSet{ConfigPath: c.ConfigPath}
+	for _, change := range c.Changes {
+		if matchesAny(change.Key, patterns) {
+			filtered.Changes = append(filtered.Changes, change)
+		}
+	}
+	return filtered
+}
+
+// masked returns a copy of the change set with secret values masked.
+func (c ChangeSet) masked() ChangeSet {
+	masked := ChangeSet{ConfigPath: c.ConfigPath, Changes: make([]Change, len(c.Changes))}
+	for i, change := range c.Changes {
+		change.Old = MaskSecretValue(change.Key, change.Old)
+		change.Value = MaskSecretValue(change.Key, change.Value)
+		masked.Changes[i] = change
+	}
+	return masked
+}
+
+// matchesAny reports whether the key matches any of the glob patterns.
+func matchesAny(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier is told about the changes written to a configuration file.
+type Notifier interface {
+	Notify(ctx context.Context, changes ChangeSet) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface.
+type NotifierFunc func(ctx context.Context, changes ChangeSet) error
+
+// Notify calls f(ctx, changes).
+func (f NotifierFunc) Notify(ctx context.Context, changes ChangeSet) error {
+	return f(ctx, changes)
+}
+
+// NotifierFactory creates a notifier for a target, e.g. the URL of a webhook.
+type NotifierFactory func(target string) (Notifier, error)
+
+var (
+	notifierMu        sync.RWMutex
+	notifierFactories = map[string]NotifierFactory{
+		"webhook":  newWebhookNotifier,
+		"prowlarr": newProwlarrNotifier,
+	}
+)
+
+// RegisterNotifier makes a notifier kind available to NewNotifier. Registering
+// an existing kind replaces it.
+func RegisterNotifier(kind string, factory NotifierFactory) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+
+	notifierFactories[kind] = factory
+}
+
+// NotifierKinds returns the registered notifier kinds in sorted order.
+func NotifierKinds() []string {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+
+	kinds := make([]string, 0, len(notifierFactories))
+	for kind := range notifierFactories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// NewNotifier creates a notifier from a spec of the form
+// <kind>:<target>[;keys=<glob>,...][;interval=<duration>]. With keys, the notifier is only
+// told about changes to matching keys; with interval, it is throttled with ThrottleNotifier.
+func NewNotifier(spec string) (Notifier, error) {
+	var patterns []string
+	var interval time.Duration
+options:
+	for i := strings.LastIndex(spec, ";"); i >= 0; i = strings.LastIndex(spec, ";") {
+		name, value, _ := strings.Cut(spec[i+1:], "=")
+		switch name {
+		case "keys":
+			patterns = strings.Split(value, ",")
+		case "interval":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid notifier interval %q", value)
+			}
+			interval = d
+		default:
+			break options // Part of the target
+		}
+		spec = spec[:i]
+	}
+
+	kind, target, found := strings.Cut(spec, ":")
+	if !found || target == "" {
+		return nil, fmt.Errorf("invalid notifier %q: expected <kind>:<target>", spec)
+	}
+
+	notifierMu.RLock()
+	factory, exists := notifierFactories[kind]
+	notifierMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown notifier kind %q: expected one of %s", kind, strings.Join(NotifierKinds(), ", "))
+	}
+
+	notifier, err := factory(target)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s notifier: %w", kind, err)
+	}
+	if len(patterns) > 0 {
+		notifier = FilterNotifier(notifier, patterns...)
+	}
+	if interval > 0 {
+		notifier = ThrottleNotifier(notifier, interval)
+	}
+	return notifier, nil
+}
+
+// FilterNotifier wraps a notifier so it is only told about changes to keys matching
+// any of the glob patterns. Change sets without matching changes are dropped.
+func FilterNotifier(notifier Notifier, patterns ...string) Notifier {
+	return NotifierFunc(func(ctx context.Context, changes ChangeSet) error {
+		filtered := changes.Filter(patterns)
+		if len(filtered.Changes) == 0 {
+			return nil
+		}
+		return notifier.Notify(ctx, filtered)
+	})
+}
+
+// ThrottledNotifier coalesces the change sets told to a notifier, see ThrottleNotifier.
+type ThrottledNotifier struct {
+	notifier Notifier
+	interval time.Duration
+	clock    Clock
+
+	mu        sync.Mutex
+	last      time.Time   // Time of the last delivery
+	delivered *ChangeSet  // Last delivered change set
+	pending   *ChangeSet  // Changes held back since the last delivery
+	timer     *time.Timer // Delivers the pending changes once the interval passed
+	err       error       // Error of the last delivery by the timer
+}
+
+// ThrottleNotifier wraps a notifier so repeated reconciles don't spam it: change sets
+// identical to the last delivered one are dropped, and changes told within interval of
+// the last delivery are held back and delivered, merged with the change sets told
+// meanwhile, once the interval passed. Call Flush to deliver held back changes right
+// away, e.g. on shutdown.
+func ThrottleNotifier(notifier Notifier, interval time.Duration) *ThrottledNotifier {
+	return &ThrottledNotifier{notifier: notifier, interval: interval, clock: SystemClock()}
+}
+
+// WithClock sets the clock the interval is measured with (default: SystemClock()).
+func (t *ThrottledNotifier) WithClock(clock Clock) *ThrottledNotifier {
+	t.clock = clock
+	return t
+}
+
+// Notify delivers, holds back or drops the change set. An error of a delivery of held
+// back changes by the timer is returned by the next call of Notify or Flush.
+func (t *ThrottledNotifier) Notify(ctx context.Context, changes ChangeSet) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	merged := mergeChangeSets(t.pending, changes)
+	if len(merged.Changes) == 0 || (t.delivered != nil && reflect.DeepEqual(merged, *t.delivered)) {
+		t.pending = nil
+		return t.takeErr()
+	}
+	if now := t.clock.Now(); !t.last.IsZero() && now.Sub(t.last) < t.interval {
+		t.pending = &merged
+		if t.timer == nil {
+			ctx := context.WithoutCancel(ctx) // The run telling the changes is over by then
+			t.timer = time.AfterFunc(t.interval-now.Sub(t.last), func() { t.flushPending(ctx) })
+		}
+		return t.takeErr()
+	}
+	return errors.Join(t.takeErr(), t.deliver(ctx, merged))
+}
+
+// Flush delivers the changes held back, if any, regardless of the interval.
+func (t *ThrottledNotifier) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		return t.takeErr()
+	}
+	return errors.Join(t.takeErr(), t.deliver(ctx, *t.pending))
+}
+
+// flushPending delivers the changes held back when the timer fires.
+func (t *ThrottledNotifier) flushPending(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.timer = nil
+	if t.pending != nil {
+		t.err = t.deliver(ctx, *t.pending)
+	}
+}
+
+// takeErr returns and clears the error of the last delivery by the timer. The caller
+// must hold t.mu.
+func (t *ThrottledNotifier) takeErr() error {
+	err := t.err
+	t.err = nil
+	return err
+}
+
+// deliver tells the wrapped notifier about the changes. The caller must hold t.mu.
+func (t *ThrottledNotifier) deliver(ctx context.Context, changes ChangeSet) error {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.pending = nil
+	t.last = t.clock.Now()
+	t.delivered = &changes
+	return t.notifier.Notify(ctx, changes)
+}
+
+// mergeChangeSets appends the changes to the pending ones. A key changed several times
+// keeps its first old value and takes the latest new value; keys changed back to their
+// old value are dropped.
+func mergeChangeSets(pending *ChangeSet, changes ChangeSet) ChangeSet {
+	if pending == nil {
+		return changes
+	}
+
+	merged := ChangeSet{ConfigPath: changes.ConfigPath}
+	index := make(map[string]int)
+	for _, change := range append(append([]Change{}, pending.Changes...), changes.Changes...) {
+		if i, seen := index[change.Key]; seen {
+			change.Old = merged.Changes[i].Old
+			change.Restart = change.Restart || merged.Changes[i].Restart
+			merged.Changes[i] = change
+			continue
+		}
+		index[change.Key] = len(merged.Changes)
+		merged.Changes = append(merged.Changes, change)
+	}
+
+	kept := merged.Changes[:0]
+	for _, change := range merged.Changes {
+		if change.Old != change.Value {
+			kept = append(kept, change)
+		}
+	}
+	merged.Changes = kept
+	return merged
+}
+
+// notify delivers the change set to every notifier. Failures are logged, since
+// the configuration file has already been written.
+func notify(ctx context.Context, notifiers []Notifier, changes ChangeSet, logger *slog.Logger) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, changes); err != nil {
+			logger.Warn(fmt.Sprintf("Error sending notification: %s", err), warningAttr(WarningNotification, ""))
+		}
+	}
+}
+
+// flusher is implemented by notifiers holding back changes, such as ThrottledNotifier.
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// flushNotifiers delivers the changes the notifiers held back, e.g. when Watch stops.
+// Errors are logged as warnings.
+func flushNotifiers(ctx context.Context, notifiers []Notifier, logger *slog.Logger) {
+	for _, notifier := range notifiers {
+		if f, ok := notifier.(flusher); ok {
+			if err := f.Flush(ctx); err != nil {
+				logger.Warn(fmt.Sprintf("Error sending notification: %s", err), warningAttr(WarningNotification, ""))
+			}
+		}
+	}
+}
+
+// webhookNotifier posts change sets as JSON to a URL.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// newWebhookNotifier creates a notifier posting to the URL.
+func newWebhookNotifier(target string) (Notifier, error) {
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		return nil, fmt.Errorf("invalid webhook URL %q", target)
+	}
+	return &webhookNotifier{url: target, client: &http.Client{Timeout: notifyTimeout}}, nil
+}
+
+// Notify posts the change set with secret values masked.
+func (w *webhookNotifier) Notify(ctx context.Context, changes ChangeSet) error {
+	body, err := json.Marshal(changes.masked())
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request for %s: %w", w.url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to %s: %w", w.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("error posting to %s: unexpected status %s", w.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package configarr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestNewNotifier tests creating notifiers from their spec.
+func TestNewNotifier(t *testing.T) {
+	t.Run("Webhook", func(t *testing.T) {
+		if _, err := NewNotifier("webhook:https://example.com/hook"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Unknown kind", func(t *testing.T) {
+		if _, err := NewNotifier("pager:someone"); err == nil {
+			t.Fatal("Expected error for unknown kind, but got none")
+		}
+	})
+
+	t.Run("Missing target", func(t *testing.T) {
+		if _, err := NewNotifier("webhook"); err == nil {
+			t.Fatal("Expected error for missing target, but got none")
+		}
+	})
+
+	t.Run("Registered kind with key filter", func(t *testing.T) {
+		var received []ChangeSet
+		RegisterNotifier("test", func(target string) (Notifier, error) {
+			return NotifierFunc(func(ctx context.Context, changes ChangeSet) error {
+				received = append(received, changes)
+				return nil
+			}), nil
+		})
+		defer func() {
+			notifierMu.Lock()
+			delete(notifierFactories, "test")
+			notifierMu.Unlock()
+		}()
+
+		notifier, err := NewNotifier("test:target;keys=Api*,Port")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		changes := ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "ApiKey", Value: "x"}, {Key: "LogLevel", Value: "debug"}}}
+		if err := notifier.Notify(context.Background(), changes); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := notifier.Notify(context.Background(), ChangeSet{Changes: []Change{{Key: "LogLevel", Value: "debug"}}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := []ChangeSet{{ConfigPath: "config.xml", Changes: []Change{{Key: "ApiKey", Value: "x"}}}}
+		if !reflect.DeepEqual(received, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, received)
+		}
+	})
+}
+
+// TestWebhookNotifier tests posting change sets with masked secrets.
+func TestWebhookNotifier(t *testing.T) {
+	var received ChangeSet
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Unexpected error decoding body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	notifier, err := NewNotifier("webhook:" + server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	changes := ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "ApiKey", Value: "secret"}, {Key: "Port", Value: "9000"}}}
+	if err := notifier.Notify(context.Background(), changes); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "ApiKey", Value: SecretMask}, {Key: "Port", Value: "9000"}}}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, received)
+	}
+}
+
+// TestRun_Notifiers tests that notifiers are told about written changes only.
+func TestRun_Notifiers(t *testing.T) {
+	fsys := mapFS{fstest.MapFS{
+		"config.xml": &fstest.MapFile{Data: []byte("<Config><Port>8989</Port><LogLevel>info</LogLevel></Config>")},
+	}}
+
+	var received []ChangeSet
+	notifier := NotifierFunc(func(ctx context.Context, changes ChangeSet) error {
+		received = append(received, changes)
+		return nil
+	})
+
+	for i := 0; i < 2; i++ { // The second run changes nothing and must not notify
+		_, err := Run(context.Background(),
+			WithFS(fsys),
+			WithConfigPath("config.xml"),
+			WithSources(StaticSource(Override{Key: "Port", Value: "9000", Source: "test"}, Override{Key: "LogLevel", Value: "info"})),
+			WithNotifiers(notifier),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	expected := []ChangeSet{{ConfigPath: "config.xml", Changes: []Change{{Key: "Port", Old: "8989", Value: "9000", Source: "test", Action: ActionChange, Restart: true}}}}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, received)
+	}
+}
+
+// TestThrottleNotifier tests dropping repeated change sets and coalescing changes within the interval.
+func TestThrottleNotifier(t *testing.T) {
+	var received []ChangeSet
+	inner := NotifierFunc(func(ctx context.Context, changes ChangeSet) error {
+		received = append(received, changes)
+		return nil
+	})
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	notifier := ThrottleNotifier(inner, time.Minute).WithClock(ClockFunc(func() time.Time { return now }))
+
+	port := ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "Port", Old: "8989", Value: "9000"}}}
+	notify := func(changes ChangeSet) {
+		t.Helper()
+		if err := notifier.Notify(context.Background(), changes); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	notify(port) // Delivered
+	now = now.Add(2 * time.Minute)
+	notify(port) // Identical to the last delivery
+	notify(ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "LogLevel", Old: "info", Value: "debug"}}})
+	now = now.Add(10 * time.Second)
+	notify(ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "LogLevel", Old: "debug", Value: "trace"}, {Key: "UrlBase", Old: "", Value: "/a"}}})
+	notify(ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "UrlBase", Old: "/a", Value: ""}}})
+
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 deliveries before flushing, got %+v", received)
+	}
+	if err := notifier.Flush(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []ChangeSet{
+		port,
+		{ConfigPath: "config.xml", Changes: []Change{{Key: "LogLevel", Old: "info", Value: "debug"}}},
+		{ConfigPath: "config.xml", Changes: []Change{{Key: "LogLevel", Old: "debug", Value: "trace"}}},
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, received)
+	}
+
+	t.Run("Held back changes are delivered", func(t *testing.T) {
+		delivered := make(chan ChangeSet, 2)
+		inner := NotifierFunc(func(ctx context.Context, changes ChangeSet) error {
+			delivered <- changes
+			return nil
+		})
+		notifier := ThrottleNotifier(inner, 20*time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		for _, changes := range []ChangeSet{port, {ConfigPath: "config.xml", Changes: []Change{{Key: "Port", Old: "9000", Value: "9001"}}}} {
+			if err := notifier.Notify(ctx, changes); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		cancel() // The run that told the changes is over
+		<-delivered
+
+		select {
+		case changes := <-delivered:
+			if expected := (ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "Port", Old: "9000", Value: "9001"}}}); !reflect.DeepEqual(changes, expected) {
+				t.Fatalf("Expected %+v, got %+v", expected, changes)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the held back changes to be delivered after the interval")
+		}
+	})
+
+	t.Run("Interval in spec", func(t *testing.T) {
+		notifier, err := NewNotifier("webhook:https://example.com/hook;keys=Port;interval=5m")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if throttled, ok := notifier.(*ThrottledNotifier); !ok || throttled.interval != 5*time.Minute {
+			t.Fatalf("Expected a throttled notifier, got %T", notifier)
+		}
+		if _, err := NewNotifier("webhook:https://example.com/hook;interval=soon"); err == nil {
+			t.Fatal("Expected error for invalid interval, but got none")
+		}
+	})
+}
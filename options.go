@@ -0,0 +1,346 @@
+package configarr
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Option configures a Run.
+type Option func(*options)
+
+// options holds the settings of a Run.
+type options struct {
+	fs                  FS
+	configPath          string
+	format              Format // Detected from the config path when nil
+	ignoreMissingConfig bool
+	recoverEmpty        bool
+	recoverTemplate     string
+	skipUnwritable      bool
+	sources             []Source
+	onlyKeys            []string
+	skipKeys            []string
+	unmanagedKeys       []string
+	dryRun              bool
+	fidelity            bool
+	patch               bool
+	render              RenderOptions
+	postProcessors      []PostProcessor
+	finalNewline        string
+	verify              bool
+	backups             int
+	conflictRetries     int
+	readRetries         int
+	readRetryDelay      time.Duration
+	writeRetryDelay     time.Duration
+	maxWriteRetryDelay  time.Duration
+	watchDebounce       time.Duration
+	settleDelay         time.Duration
+	settleTimeout       time.Duration
+	requireAppStopped   []string
+	maxValueSize        int64
+	maxFileSize         int64
+	validationMode      string
+	createKeys          string
+	keyGroups           [][]string
+	strictSecrets       bool
+	rules               []Rule
+	clock               Clock
+	random              io.Reader
+	catalog             *Catalog
+	events              *EventWriter
+	notifiers           []Notifier
+	decrypters          map[string]Decrypter
+	stateFile           string
+	logger              *slog.Logger
+	warnings            *warningCollector // Warnings logged through logger
+}
+
+// defaultOptions returns the settings used when no option overrides them.
+func defaultOptions() options {
+	return options{
+		fs:                 OSFS(),
+		configPath:         DefaultConfigPath,
+		render:             RenderOptions{Indent: DefaultIndent},
+		finalNewline:       FinalNewlinePreserve,
+		verify:             true,
+		readRetries:        DefaultReadRetries,
+		readRetryDelay:     DefaultReadRetryDelay,
+		writeRetryDelay:    DefaultWriteRetryDelay,
+		maxWriteRetryDelay: DefaultMaxWriteRetryDelay,
+		settleTimeout:      DefaultSettleTimeout,
+		maxValueSize:       DefaultMaxValueSize,
+		maxFileSize:        DefaultMaxFileSize,
+		validationMode:     ValidationModeError,
+		clock:              SystemClock(),
+		random:             SystemRandom(),
+		logger:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// WithFS sets the filesystem the configuration file is read from and written to (default: OSFS()).
+func WithFS(fsys FS) Option {
+	return func(o *options) { o.fs = fsys }
+}
+
+// WithFormat sets the format of the configuration file (default: detected from the
+// extension of the config path, see DetectFormat).
+func WithFormat(format Format) Option {
+	return func(o *options) { o.format = format }
+}
+
+// configFormat returns the format of the configuration file.
+func (o options) configFormat() Format {
+	if o.format != nil {
+		return o.format
+	}
+	return DetectFormat(o.configPath)
+}
+
+// WithConfigPath sets the configuration file to update (default: DefaultConfigPath).
+func WithConfigPath(path string) Option {
+	return func(o *options) { o.configPath = path }
+}
+
+// WithIgnoreMissingConfig makes a missing configuration file a no-op instead of an error.
+func WithIgnoreMissingConfig() Option {
+	return func(o *options) { o.ignoreMissingConfig = true }
+}
+
+// WithRecoverEmpty seeds a configuration file that is empty but for a byte order mark
+// and whitespace, e.g. after the app crashed while writing it, with the newest backup
+// that isn't empty, else the template, if given, else for XML files the default port
+// of the app from the catalog, instead of failing with ErrEmptyConfig. The overrides are
+// applied on top and the file is written even if none of them changes anything.
+func WithRecoverEmpty(template string) Option {
+	return func(o *options) { o.recoverEmpty, o.recoverTemplate = true, template }
+}
+
+// WithSkipUnwritable skips the run with a warning when the filesystem reports up front
+// that the configuration file can't be written, e.g. because it is immutable, instead of
+// failing. See ReplaceChecker.
+func WithSkipUnwritable() Option {
+	return func(o *options) { o.skipUnwritable = true }
+}
+
+// WithSources adds sources of overrides. Sources are applied in order, so later
+// sources take precedence over earlier ones.
+func WithSources(sources ...Source) Option {
+	return func(o *options) { o.sources = append(o.sources, sources...) }
+}
+
+// WithKeyFilter restricts the overrides that are applied to keys matching any of the
+// only glob patterns (all keys when empty) and none of the skip patterns.
+func WithKeyFilter(only, skip []string) Option {
+	return func(o *options) { o.onlyKeys, o.skipKeys = only, skip }
+}
+
+// WithUnmanagedKeys protects the keys matching the glob patterns, edited by hand, from
+// being changed by any override. Elements can also be marked in the file, see
+// UnmanagedMarker.
+func WithUnmanagedKeys(patterns ...string) Option {
+	return func(o *options) { o.unmanagedKeys = append(o.unmanagedKeys, patterns...) }
+}
+
+// WithDryRun computes the changes without writing the configuration file.
+func WithDryRun() Option {
+	return func(o *options) { o.dryRun = true }
+}
+
+// WithFidelity leaves the file untouched when nothing changes and refuses rewrites
+// that alter anything besides the changed elements.
+func WithFidelity() Option {
+	return func(o *options) { o.fidelity = true }
+}
+
+// WithPatch splices changed values into the original file instead of re-marshalling it.
+func WithPatch() Option {
+	return func(o *options) { o.patch = true }
+}
+
+// WithRenderOptions sets the layout of re-marshalled documents.
+func WithRenderOptions(render RenderOptions) Option {
+	return func(o *options) { o.render = render }
+}
+
+// WithPostProcessors adds post-processors that change the rendered file before it is
+// written, in order. They are not supported with patch and fidelity modes.
+func WithPostProcessors(processors ...PostProcessor) Option {
+	return func(o *options) { o.postProcessors = append(o.postProcessors, processors...) }
+}
+
+// WithFinalNewline sets whether the written file ends with a newline
+// (FinalNewlineAlways, FinalNewlineNever or FinalNewlinePreserve).
+func WithFinalNewline(mode string) Option {
+	return func(o *options) { o.finalNewline = mode }
+}
+
+// WithVerify enables or disables re-reading the file after writing it (default: enabled).
+func WithVerify(verify bool) Option {
+	return func(o *options) { o.verify = verify }
+}
+
+// WithBackups copies the configuration file to config.xml.bak.<time> next to it before
+// it is written with changes, keeping the newest keep backups (e.g. DefaultBackups).
+// Older backups are removed when the filesystem implements RemoveFS. Zero disables backups.
+func WithBackups(keep int) Option {
+	return func(o *options) { o.backups = keep }
+}
+
+// WithConflictRetries sets how often to re-read and re-apply when another process
+// modified the file between reading and writing it.
+func WithConflictRetries(retries int) Option {
+	return func(o *options) { o.conflictRetries = retries }
+}
+
+// WithWatchDebounce sets the window Watch coalesces changes of the file in: a change is
+// only acted on once the file stayed the same for the window, so several rewrites in quick
+// succession cause a single run (default: the interval of Watch).
+func WithWatchDebounce(window time.Duration) Option {
+	return func(o *options) { o.watchDebounce = window }
+}
+
+// WithWriteRetryDelay sets the delay before Watch retries the change sets whose write
+// failed, doubled after every further failure up to max (default: DefaultWriteRetryDelay
+// and DefaultMaxWriteRetryDelay). A zero delay leaves them to the next change of the file.
+func WithWriteRetryDelay(delay, max time.Duration) Option {
+	return func(o *options) {
+		o.writeRetryDelay = delay
+		o.maxWriteRetryDelay = max
+	}
+}
+
+// WithReadRetries sets how often and with which delay to retry reading a file that
+// looks partially written.
+func WithReadRetries(retries int, delay time.Duration) Option {
+	return func(o *options) {
+		o.readRetries = retries
+		o.readRetryDelay = delay
+	}
+}
+
+// WithSettleDelay requires the file to stay unchanged for delay before reading it,
+// giving up after timeout.
+func WithSettleDelay(delay, timeout time.Duration) Option {
+	return func(o *options) {
+		o.settleDelay = delay
+		o.settleTimeout = timeout
+	}
+}
+
+// WithRequireAppStopped refuses to modify the file while the application described by
+// any of the checks is running. See checkAppStopped for the check syntax.
+func WithRequireAppStopped(checks ...string) Option {
+	return func(o *options) { o.requireAppStopped = append(o.requireAppStopped, checks...) }
+}
+
+// WithLimits sets the maximum size in bytes of a value to write and of a configuration
+// file to parse (default: DefaultMaxValueSize and DefaultMaxFileSize). Zero disables a
+// limit. The limits protect against mis-set sources, e.g. a pasted certificate.
+func WithLimits(maxValueSize, maxFileSize int64) Option {
+	return func(o *options) {
+		o.maxValueSize = maxValueSize
+		o.maxFileSize = maxFileSize
+	}
+}
+
+// WithValidationMode sets whether values and files exceeding the limits of WithLimits are
+// refused (ValidationModeError, the default) or only logged as warnings (ValidationModeWarn),
+// so checks can be introduced gradually. Values with characters XML can't represent are
+// refused in any mode.
+func WithValidationMode(mode string) Option {
+	return func(o *options) { o.validationMode = mode }
+}
+
+// WithStrictSecrets refuses to write values of secret properties that look like
+// placeholders or are otherwise weak, e.g. "changeme" or a key of zeros, instead of only
+// logging a warning for them.
+func WithStrictSecrets() Option {
+	return func(o *options) { o.strictSecrets = true }
+}
+
+// WithCreateKeys creates known catalog keys that are missing from the file instead of
+// skipping them, placed after the existing keys in the given order (KeyOrderAppend or
+// KeyOrderCatalog). Unknown keys are never created. Patch mode can't create keys.
+func WithCreateKeys(order string) Option {
+	return func(o *options) { o.createKeys = order }
+}
+
+// WithKeyGroups declares sets of keys that are changed together or not at all, e.g.
+// SslPort, EnableSsl and SslCertPath. When a member can't be applied, the changes of
+// the whole group are skipped with a warning.
+func WithKeyGroups(groups ...[]string) Option {
+	return func(o *options) { o.keyGroups = append(o.keyGroups, groups...) }
+}
+
+// WithRules sets the rules renaming properties and rewriting their values before the
+// overrides are applied, see Rule.
+func WithRules(rules ...Rule) Option {
+	return func(o *options) { o.rules = rules }
+}
+
+// WithCatalog sets the key catalog used to classify skipped overrides (default: embedded catalog).
+func WithCatalog(catalog *Catalog) Option {
+	return func(o *options) { o.catalog = catalog }
+}
+
+// WithEvents streams change and skip events to the writer.
+func WithEvents(events *EventWriter) Option {
+	return func(o *options) { o.events = events }
+}
+
+// WithDecrypter sets the provider decrypting values encrypted with the name for this run,
+// taking precedence over a registered one, see EncryptedValuePrefix.
+func WithDecrypter(name string, decrypter Decrypter) Option {
+	return func(o *options) {
+		if o.decrypters == nil {
+			o.decrypters = make(map[string]Decrypter)
+		}
+		o.decrypters[name] = decrypter
+	}
+}
+
+// WithNotifiers adds notifiers that are told about the changes after the file was written.
+func WithNotifiers(notifiers ...Notifier) Option {
+	return func(o *options) { o.notifiers = append(o.notifiers, notifiers...) }
+}
+
+// WithStateFile records the source of every written change in the state file, see Provenance.
+func WithStateFile(path string) Option {
+	return func(o *options) { o.stateFile = path }
+}
+
+// WithClock sets the clock timestamps and durations are taken from (default: SystemClock()).
+func WithClock(clock Clock) Option {
+	return func(o *options) { o.clock = clock }
+}
+
+// WithRandom sets the random source the key of the state file is generated from
+// (default: SystemRandom()), e.g. FixedRandom for golden tests.
+func WithRandom(random io.Reader) Option {
+	return func(o *options) { o.random = random }
+}
+
+// WithLogger sets the logger (default: discard all logs).
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// validate returns the error of a failed validation. In ValidationModeWarn, each of the
+// joined errors is logged as a warning instead and nil is returned.
+func (o options) validate(err error) error {
+	if err == nil || o.validationMode != ValidationModeWarn {
+		return err
+	}
+
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	for _, err := range errs {
+		o.logger.Warn(fmt.Sprintf("Validation failed: %s", err), warningAttr(WarningValidation, ""))
+	}
+	return nil
+}
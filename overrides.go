@@ -0,0 +1,399 @@
+package configarr
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Override is a single property value requested by a source such as an environment variable.
+type Override struct {
+	Key       string
+	Value     string
+	Source    string // Where the override came from, e.g. "env:CONFIGARR__PORT"
+	Condition string // Only applied when the condition holds, e.g. SslCertPath != ""; see parseCondition
+	Delete    bool   // Remove the property from the file instead of setting it; Value is ignored
+	Create    bool   // Add the property when it is missing from the file, even if the catalog doesn't know it
+}
+
+// UnsetPrefix returns the prefix of the environment variables removing properties for
+// the given prefix, e.g. CONFIGARR_UNSET__ for CONFIGARR__.
+func UnsetPrefix(prefix string) string {
+	return strings.TrimRight(strings.ToUpper(prefix), "_") + "_UNSET__"
+}
+
+// updateConfigWithEnv updates the Config map with values from environment variables
+// that match the given prefix. Returns a map of changed properties.
+func updateConfigWithEnv(environ []string, config *Config, prefix string, logger *slog.Logger) map[string]string {
+	return applyOverrides(config, envOverrides(environ, prefix, EnvOptions{}, logger), logger)
+}
+
+// EnvOptions controls how environment variables are matched and split, see EnvSourceWith.
+type EnvOptions struct {
+	Delimiter  string // Separates the property from the value; DefaultDelimiter when empty
+	IgnoreCase bool   // Match the prefix regardless of case, e.g. configarr__port for CONFIGARR__
+	// AllowKeys are glob patterns of the variable names that are read, e.g. SONARR_*.
+	// Required with an empty prefix, so not every variable of the environment is read.
+	AllowKeys []string
+}
+
+// allowed reports whether the variable name matches any of the allowed patterns, or
+// whether no patterns are set.
+func (o EnvOptions) allowed(name string) bool {
+	if len(o.AllowKeys) == 0 {
+		return true
+	}
+	if !o.IgnoreCase {
+		return matchesAny(name, o.AllowKeys)
+	}
+	for _, pattern := range o.AllowKeys {
+		if matched, _ := path.Match(strings.ToUpper(pattern), strings.ToUpper(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPrefix reports whether the variable name starts with the prefix in any case, the
+// way EnvOptions.IgnoreCase matches variables, so prefix CONFIGARR matches
+// configarr_PORT but not CONFIGARRX_PORT.
+func MatchPrefix(name, prefix string) bool {
+	return matchPrefix(name, strings.ToUpper(prefix), true)
+}
+
+// matchPrefix reports whether the variable name starts with the prefix, followed by an
+// underscore unless the prefix ends with one, so prefix CONFIGARR doesn't match
+// CONFIGARRX_PORT. An empty prefix matches every name. The prefix is upper case; the name
+// is compared as is unless ignoreCase.
+func matchPrefix(name, prefix string, ignoreCase bool) bool {
+	if prefix == "" {
+		return true
+	}
+	if ignoreCase {
+		name = strings.ToUpper(name)
+	}
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	return strings.HasSuffix(prefix, "_") || strings.HasPrefix(name[len(prefix):], "_")
+}
+
+// envOverrides extracts the overrides encoded in environment variables that match the given
+// prefix, following the format <PREFIX><IDENTIFIER>=<PROPERTY><DELIMITER><VALUE>. Variables
+// of the form <UNSET PREFIX><IDENTIFIER>=<PROPERTY> remove the property, see UnsetPrefix;
+// they come first, so a variable setting the same property wins. Variables are processed
+// in byte order, since the order of the environment differs between systems. Variables
+// that nearly match, e.g. with a single underscore or in the wrong case, are logged at
+// debug level. With opts.AllowKeys, only variables with a matching name are read.
+func envOverrides(environ []string, prefix string, opts EnvOptions, logger *slog.Logger) []Override {
+	return parseEnvVars(envCandidates(indexEnv(environ), prefix), prefix, opts, logger)
+}
+
+// parseEnvVars extracts the overrides of the variables, in byte order, like envOverrides.
+func parseEnvVars(vars []envVar, prefix string, opts EnvOptions, logger *slog.Logger) []Override {
+	var overrides, deletes []Override
+	envPrefix, unsetPrefix := strings.ToUpper(prefix), UnsetPrefix(prefix)
+	delimiter := opts.Delimiter
+	if delimiter == "" {
+		delimiter = DefaultDelimiter
+	}
+
+	for _, v := range vars {
+		envVar, name, value, found := v.raw, v.name, v.value, v.found
+		switch {
+		case matchPrefix(name, unsetPrefix, opts.IgnoreCase):
+			if !opts.allowed(name) {
+				logger.Debug(fmt.Sprintf("Ignoring environment variable %s: name is not allowed", name))
+				continue
+			}
+			if value == "" {
+				logger.Warn(fmt.Sprintf("Invalid environment variable format: %s", envVar), warningAttr(WarningInvalidEnv, ""))
+				continue
+			}
+			deletes = append(deletes, Override{Key: value, Delete: true, Source: "env:" + name})
+			continue
+		case !matchPrefix(name, envPrefix, opts.IgnoreCase):
+			if strings.HasPrefix(strings.ToUpper(name), strings.TrimRight(envPrefix, "_")) {
+				logger.Debug(fmt.Sprintf("Ignoring environment variable %s: name is close to, but doesn't match prefix %s", name, envPrefix))
+			}
+			continue
+		case !opts.allowed(name):
+			if envPrefix != "" { // Without a prefix, this is most of the environment
+				logger.Debug(fmt.Sprintf("Ignoring environment variable %s: name is not allowed", name))
+			}
+			continue
+		case !found:
+			logger.Warn(fmt.Sprintf("Invalid environment variable format: %s", envVar), warningAttr(WarningInvalidEnv, ""))
+			continue
+		}
+
+		// Extract the property key and its value from the environment variable
+		envKeyValue := strings.SplitN(value, delimiter, 2)
+		if len(envKeyValue) != 2 {
+			logger.Warn(fmt.Sprintf("Invalid key-value pair in environment variable: %s", envVar), warningAttr(WarningInvalidEnv, ""))
+			continue
+		}
+
+		overrides = append(overrides, Override{Key: envKeyValue[0], Value: envKeyValue[1], Source: "env:" + name})
+	}
+
+	return append(deletes, overrides...)
+}
+
+// envFileSuffix marks variables whose value is read from a file, following the convention
+// of Docker secrets, e.g. CONFIGARR__APIKEY_FILE=ApiKey=/run/secrets/sonarr_api_key.
+const envFileSuffix = "_FILE"
+
+// resolveEnvFiles returns the environment with the values of the variables that match the
+// prefix and end with envFileSuffix, <PROPERTY><DELIMITER><PATH>, replaced by the property
+// and the content of the file, with surrounding whitespace trimmed. The content is used
+// as is, even when it holds the delimiter. Errors name the variable and the file, never
+// the content.
+func resolveEnvFiles(vars []envVar, prefix string, opts EnvOptions) ([]envVar, error) {
+	envPrefix := strings.ToUpper(prefix)
+	delimiter := opts.Delimiter
+	if delimiter == "" {
+		delimiter = DefaultDelimiter
+	}
+
+	resolved := append([]envVar(nil), vars...)
+	for i, v := range vars {
+		name := v.name
+		if !v.found || !strings.HasSuffix(strings.ToUpper(name), envFileSuffix) || !matchPrefix(name, envPrefix, opts.IgnoreCase) || !opts.allowed(name) {
+			continue
+		}
+		property, path, found := strings.Cut(v.value, delimiter)
+		if !found || property == "" || path == "" {
+			return nil, categorize(ErrInvalid, fmt.Errorf("invalid environment variable %s: expected <PROPERTY>%s<PATH>", name, delimiter))
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the value of environment variable %s: %w", name, err)
+		}
+		value := property + delimiter + strings.TrimSpace(string(data))
+		resolved[i] = envVar{raw: name + "=" + value, name: name, value: value, found: true}
+	}
+	return resolved, nil
+}
+
+// applyOverrides updates the Config map with the given overrides. When several overrides
+// target the same property, the last one wins. Returns a map of changed properties.
+func applyOverrides(config *Config, overrides []Override, logger *slog.Logger) map[string]string {
+	changedProperties := make(map[string]string)
+
+	resolved, order := resolveOverrides(overrides)
+	for _, key := range order {
+		override := resolved[key]
+		if override.Delete {
+			continue // Removed by deleteKeys
+		}
+		// Update the config if the requested value is different
+		if currentValue, exists := config.Properties[key]; exists && override.Value != currentValue {
+			config.Properties[key] = override.Value
+			changedProperties[key] = override.Value
+			logger.Debug(fmt.Sprintf("Updated '%s' to '%s' (was '%s'%s)", key, override.Value, currentValue, describeSource(override.Source)))
+		}
+	}
+
+	if len(changedProperties) == 0 {
+		logger.Debug("No updates made to the configuration.")
+	}
+
+	return changedProperties
+}
+
+// createKeys adds the properties the plan creates after the existing ones, in plan order
+// for KeyOrderAppend and in catalog order for KeyOrderCatalog. Returns a map of the
+// created properties.
+func createKeys(config *Config, actions []PlanAction, order string, catalog *Catalog, logger *slog.Logger) map[string]string {
+	var created []PlanAction
+	for _, action := range actions {
+		if action.Type == ActionCreate {
+			created = append(created, action)
+		}
+	}
+	if order == KeyOrderCatalog {
+		sort.SliceStable(created, func(i, j int) bool {
+			return catalog.keyIndex(created[i].Key) < catalog.keyIndex(created[j].Key)
+		})
+	}
+
+	createdProperties := make(map[string]string, len(created))
+	for _, action := range created {
+		config.Keys = append(config.Keys, action.Key)
+		config.Properties[action.Key] = action.Value
+		createdProperties[action.Key] = action.Value
+		logger.Debug(fmt.Sprintf("Created '%s' with '%s'%s", action.Key, action.Value, describeSource(action.Source)))
+	}
+	return createdProperties
+}
+
+// deleteKeys removes the properties the plan deletes. Non-element tokens preceding a
+// removed element move to the element that follows it. Returns a map of the deleted
+// properties with empty values.
+func deleteKeys(config *Config, actions []PlanAction, logger *slog.Logger) map[string]string {
+	deletedProperties := make(map[string]string)
+	for _, action := range actions {
+		if action.Type != ActionDelete {
+			continue
+		}
+
+		var keys []string
+		var tokens []xml.Token // Tokens of the removed element, waiting for the next one
+		for _, key := range config.Keys {
+			if key == action.Key {
+				tokens = append(tokens, config.Tokens[key]...)
+				delete(config.Tokens, key)
+				continue
+			}
+			if len(tokens) > 0 {
+				config.Tokens[key] = append(tokens, config.Tokens[key]...)
+				tokens = nil
+			}
+			keys = append(keys, key)
+		}
+		config.Keys = keys
+		config.TrailingTokens = append(tokens, config.TrailingTokens...)
+		delete(config.Properties, action.Key)
+		delete(config.ElementAttrs, action.Key)
+
+		deletedProperties[action.Key] = ""
+		logger.Debug(fmt.Sprintf("Deleted '%s' (was '%s'%s)", action.Key, action.Current, describeSource(action.Source)))
+	}
+	return deletedProperties
+}
+
+// resolveOverrides resolves the final override per property, keeping the order of first
+// appearance. A property created by an earlier override stays created by later ones, e.g.
+// a renamed key set by a source.
+func resolveOverrides(overrides []Override) (map[string]Override, []string) {
+	resolved := make(map[string]Override, len(overrides))
+	var order []string
+	for _, override := range overrides {
+		previous, seen := resolved[override.Key]
+		if !seen {
+			order = append(order, override.Key)
+		}
+		override.Create = override.Create || previous.Create
+		resolved[override.Key] = override
+	}
+	return resolved, order
+}
+
+// validateOverrideValues checks that the values of the changes can be written to an XML 1.0
+// document, since the apps fail to start with a file they can't parse, and that they don't
+// exceed maxSize bytes unless it is zero. The errors of all invalid values are joined.
+func validateOverrideValues(actions []PlanAction, maxSize int64) error {
+	var errs []error
+	for _, action := range actions {
+		if !action.changes() {
+			continue
+		}
+		if maxSize > 0 && int64(len(action.Value)) > maxSize {
+			errs = append(errs, fmt.Errorf("invalid value for '%s'%s: %d bytes exceed the limit of %d bytes", action.Key, describeSource(action.Source), len(action.Value), maxSize))
+			continue
+		}
+		if err := validateXMLText(action.Value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for '%s'%s: %w", action.Key, describeSource(action.Source), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateXMLText reports the first character of the text that is not allowed in XML 1.0.
+func validateXMLText(text string) error {
+	if !utf8.ValidString(text) {
+		return errors.New("not valid UTF-8")
+	}
+	for i, r := range text {
+		if !isXMLChar(r) {
+			return fmt.Errorf("character %U at byte %d is not allowed in XML", r, i)
+		}
+	}
+	return nil
+}
+
+// isXMLChar reports whether the rune is in the Char production of the XML 1.0 specification.
+func isXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// describeSource formats the source of an override for log messages.
+func describeSource(source string) string {
+	if source == "" {
+		return ""
+	}
+	return ", from " + source
+}
+
+// WithSourceLabel returns a copy of the overrides with the source set to label,
+// e.g. "json:/config/values.json".
+func WithSourceLabel(overrides []Override, label string) []Override {
+	labeled := make([]Override, len(overrides))
+	for i, override := range overrides {
+		override.Source = label
+		labeled[i] = override
+	}
+	return labeled
+}
+
+// Source provides overrides to apply to the configuration.
+type Source interface {
+	Overrides(ctx context.Context, logger *slog.Logger) ([]Override, error)
+}
+
+// SourceFunc adapts a function to the Source interface.
+type SourceFunc func(ctx context.Context, logger *slog.Logger) ([]Override, error)
+
+// Overrides calls f(ctx, logger).
+func (f SourceFunc) Overrides(ctx context.Context, logger *slog.Logger) ([]Override, error) {
+	return f(ctx, logger)
+}
+
+// EnvSource returns a Source reading overrides from environment variables that match
+// the prefix, e.g. EnvSource(os.Environ(), DefaultPrefix).
+func EnvSource(environ []string, prefix string) Source {
+	return EnvSourceWith(environ, prefix, EnvOptions{})
+}
+
+// EnvSourceDelimited is like EnvSource, but separates the property from the value with
+// delimiter instead of DefaultDelimiter, e.g. ":=" for properties containing '='.
+func EnvSourceDelimited(environ []string, prefix, delimiter string) Source {
+	return EnvSourceWith(environ, prefix, EnvOptions{Delimiter: delimiter})
+}
+
+// EnvSourceWith is like EnvSource, with the matching and splitting of the variables
+// controlled by opts. An empty prefix requires opts.AllowKeys. Variables ending with _FILE
+// may name a file holding their value instead, see resolveEnvFiles; the file is read
+// each time the overrides are. The environment is indexed once, and the index shared
+// with the other sources of the same environ slice, which must not be modified.
+func EnvSourceWith(environ []string, prefix string, opts EnvOptions) Source {
+	index := indexEnv(environ)
+	return SourceFunc(func(ctx context.Context, logger *slog.Logger) ([]Override, error) {
+		if prefix == "" && len(opts.AllowKeys) == 0 {
+			return nil, categorize(ErrInvalid, errors.New("an empty prefix requires allowed variable names"))
+		}
+		resolved, err := resolveEnvFiles(envCandidates(index, prefix), prefix, opts)
+		if err != nil {
+			return nil, err
+		}
+		return parseEnvVars(resolved, prefix, opts, logger), nil
+	})
+}
+
+// StaticSource returns a Source providing the given overrides.
+func StaticSource(overrides ...Override) Source {
+	return SourceFunc(func(ctx context.Context, logger *slog.Logger) ([]Override, error) {
+		return overrides, nil
+	})
+}
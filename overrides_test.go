@@ -0,0 +1,231 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestUpdateConfigWithEnv tests updating configuration with environment variables.
+func TestUpdateConfigWithEnv(t *testing.T) {
+	t.Run("Update with Environment Variables", func(t *testing.T) {
+		envVars := []string{
+			"CONFIGARR__LOG=LogLevel=debug",
+			"CONFIGARR__THEME=Theme=light",
+		}
+
+		config := &Config{
+			Properties: map[string]string{
+				"LogLevel": "info",
+				"Theme":    "dark",
+			},
+			Keys: []string{"LogLevel", "Theme"},
+		}
+
+		var stdOut strings.Builder
+		logger := slog.New(slog.NewTextHandler(&stdOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		changed := updateConfigWithEnv(envVars, config, "CONFIGARR__", logger)
+		if len(changed) != 2 || changed["LogLevel"] != "debug" || changed["Theme"] != "light" {
+			t.Fatalf("Expected changes not applied correctly: %v", changed)
+		}
+
+		if !strings.Contains(stdOut.String(), "Updated 'LogLevel' to 'debug'") {
+			t.Fatalf("Expected log entry for LogLevel change, got: %s", stdOut.String())
+		}
+	})
+
+	t.Run("No Changes When Env Vars Unmatched", func(t *testing.T) {
+		envVars := []string{
+			"OTHER_LOG=LogLevel=debug",
+		}
+
+		config := &Config{
+			Properties: map[string]string{
+				"LogLevel": "info",
+			},
+			Keys: []string{"LogLevel"},
+		}
+
+		var stdOut strings.Builder
+		logger := slog.New(slog.NewTextHandler(&stdOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+		changed := updateConfigWithEnv(envVars, config, "CONFIGARR__", logger)
+		if len(changed) != 0 {
+			t.Fatalf("Expected no changes, but got: %v", changed)
+		}
+
+		if !strings.Contains(stdOut.String(), "No updates made to the configuration.") {
+			t.Fatalf("Expected log entry for no updates, got: %s", stdOut.String())
+		}
+	})
+}
+
+// TestEnvOverrides tests that environment overrides record the variable they came from.
+func TestEnvOverrides(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	overrides := envOverrides([]string{"CONFIGARR__LOG=LogLevel=debug", "OTHER=Port=1"}, "configarr__", EnvOptions{}, logger)
+
+	expected := []Override{{Key: "LogLevel", Value: "debug", Source: "env:CONFIGARR__LOG"}}
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+	}
+
+	t.Run("Unset variables", func(t *testing.T) {
+		environ := []string{"CONFIGARR__SSL=SslCertPath=/new.pfx", "CONFIGARR_UNSET__SSL=SslCertPath", "CONFIGARR_UNSET__BASE=UrlBase", "CONFIGARR_UNSET__EMPTY="}
+		overrides := envOverrides(environ, DefaultPrefix, EnvOptions{}, logger)
+
+		expected := []Override{
+			{Key: "UrlBase", Delete: true, Source: "env:CONFIGARR_UNSET__BASE"},
+			{Key: "SslCertPath", Delete: true, Source: "env:CONFIGARR_UNSET__SSL"},
+			{Key: "SslCertPath", Value: "/new.pfx", Source: "env:CONFIGARR__SSL"},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+	})
+
+	t.Run("Prefix matching", func(t *testing.T) {
+		var logs strings.Builder
+		logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		environ := []string{"CONFIGARRX_PORT=Port=1", "CONFIGARR_PORT=Port=2", "configarr__log=LogLevel=debug", "CONFIGARR__BASE=UrlBase=/sonarr"}
+
+		overrides := envOverrides(environ, "CONFIGARR", EnvOptions{}, logger)
+		expected := []Override{{Key: "Port", Value: "2", Source: "env:CONFIGARR_PORT"}, {Key: "UrlBase", Value: "/sonarr", Source: "env:CONFIGARR__BASE"}}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+		if !strings.Contains(logs.String(), "CONFIGARRX_PORT") || strings.Contains(logs.String(), "Port=1") {
+			t.Fatalf("Expected near miss to be logged by name only, got: %s", logs.String())
+		}
+
+		overrides = envOverrides(environ, DefaultPrefix, EnvOptions{IgnoreCase: true}, logger)
+		expected = []Override{{Key: "UrlBase", Value: "/sonarr", Source: "env:CONFIGARR__BASE"}, {Key: "LogLevel", Value: "debug", Source: "env:configarr__log"}}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+	})
+
+	t.Run("Allowed names", func(t *testing.T) {
+		environ := []string{"PATH=/usr/bin", "SONARR_PORT=Port=8989", "SONARR_BASE=UrlBase=/sonarr", "HOME=/root"}
+
+		overrides := envOverrides(environ, "", EnvOptions{AllowKeys: []string{"SONARR_PORT", "sonarr_b*"}, IgnoreCase: true}, logger)
+		expected := []Override{{Key: "UrlBase", Value: "/sonarr", Source: "env:SONARR_BASE"}, {Key: "Port", Value: "8989", Source: "env:SONARR_PORT"}}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+
+		overrides = envOverrides([]string{"CONFIGARR__PORT=Port=1", "CONFIGARR__LOG=LogLevel=debug"}, DefaultPrefix, EnvOptions{AllowKeys: []string{"CONFIGARR__PORT"}}, logger)
+		expected = []Override{{Key: "Port", Value: "1", Source: "env:CONFIGARR__PORT"}}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+
+		if _, err := EnvSourceWith(environ, "", EnvOptions{}).Overrides(context.Background(), logger); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("Expected ErrInvalid for an empty prefix without allowed names, got %v", err)
+		}
+	})
+
+	t.Run("Values from files", func(t *testing.T) {
+		dir := t.TempDir()
+		secret, password := filepath.Join(dir, "sonarr_api_key"), filepath.Join(dir, "password")
+		if err := os.WriteFile(secret, []byte("0123456789abcdef\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := os.WriteFile(password, []byte("a=b=c\n"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		environ := []string{"CONFIGARR__X_FILE=ApiKey=" + secret, "CONFIGARR__PASSWORD_FILE=Password=" + password, "OTHER_FILE=ApiKey=" + filepath.Join(dir, "missing")}
+
+		overrides, err := EnvSource(environ, DefaultPrefix).Overrides(context.Background(), logger)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []Override{
+			{Key: "Password", Value: "a=b=c", Source: "env:CONFIGARR__PASSWORD_FILE"},
+			{Key: "ApiKey", Value: "0123456789abcdef", Source: "env:CONFIGARR__X_FILE"},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+
+		environ = []string{"CONFIGARR__APIKEY_FILE=ApiKey=" + filepath.Join(dir, "missing")}
+		if _, err := EnvSource(environ, DefaultPrefix).Overrides(context.Background(), logger); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("Expected an error for a missing file, got %v", err)
+		}
+
+		for _, value := range []string{secret, "ApiKey=", "=" + secret} {
+			environ = []string{"CONFIGARR__APIKEY_FILE=" + value}
+			if _, err := EnvSource(environ, DefaultPrefix).Overrides(context.Background(), logger); !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Expected ErrInvalid for %q, got %v", value, err)
+			}
+		}
+	})
+
+	t.Run("Unset prefix", func(t *testing.T) {
+		for prefix, expected := range map[string]string{DefaultPrefix: "CONFIGARR_UNSET__", "sonarr_": "SONARR_UNSET__"} {
+			if unset := UnsetPrefix(prefix); unset != expected {
+				t.Fatalf("Expected unset prefix %s for %s, got %s", expected, prefix, unset)
+			}
+		}
+	})
+
+	t.Run("Custom delimiter", func(t *testing.T) {
+		overrides := envOverrides([]string{"CONFIGARR__A=a=b:=c=d", "CONFIGARR__B=Port=1"}, DefaultPrefix, EnvOptions{Delimiter: ":="}, logger)
+
+		expected := []Override{{Key: "a=b", Value: "c=d", Source: "env:CONFIGARR__A"}}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+	})
+}
+
+// TestValidateOverrideValues tests rejecting values that can't be written to XML 1.0.
+func TestValidateOverrideValues(t *testing.T) {
+	tests := []struct {
+		name, value, expected string
+	}{
+		{"Valid text", "tab\there\nnewline ünïcödé 🎬", ""},
+		{"Control character", "debug\x01", "character U+0001 at byte 5 is not allowed in XML"},
+		{"Invalid UTF-8", "abc\xff", "not valid UTF-8"},
+		{"Noncharacter", "\uFFFE", "character U+FFFE at byte 0 is not allowed in XML"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := []PlanAction{{Key: "LogLevel", Type: ActionChange, Value: tt.value, Source: "env:CONFIGARR__LOGLEVEL"}}
+			err := validateOverrideValues(actions, 0)
+			if tt.expected == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expected) || !strings.Contains(err.Error(), "'LogLevel', from env:CONFIGARR__LOGLEVEL") {
+				t.Fatalf("Expected error %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+
+	t.Run("Value size limit", func(t *testing.T) {
+		actions := []PlanAction{{Key: "SslCertPath", Type: ActionChange, Value: strings.Repeat("x", 11)}}
+		if err := validateOverrideValues(actions, 10); err == nil || !strings.Contains(err.Error(), "11 bytes exceed the limit of 10 bytes") {
+			t.Fatalf("Expected size limit error, got: %v", err)
+		}
+		if err := validateOverrideValues(actions, 11); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Skipped actions are not checked", func(t *testing.T) {
+		if err := validateOverrideValues([]PlanAction{{Key: "Missing", Type: ActionSkip, Value: "\x00"}}, 1); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package configarr
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Files of configarr's own state and configuration, below the XDG base directories.
+const (
+	stateFileName   = "state.json"
+	catalogFileName = "catalog.json"
+)
+
+// defaultXDGConfigDirs are the system configuration directories without XDG_CONFIG_DIRS.
+const defaultXDGConfigDirs = "/etc/xdg"
+
+// DefaultConfigPathFor returns the default location of an application's configuration
+// file on the given operating system, without consulting the registry: the ProgramData
+// directory on Windows (e.g. C:\ProgramData\Lidarr\config.xml), ~/.config on macOS and
+// DefaultConfigPath, the location inside the container images, everywhere else.
+// getenv looks up environment variables, usually os.Getenv.
+func DefaultConfigPathFor(app, goos string, getenv func(string) string) string {
+	if app == "" {
+		return DefaultConfigPath
+	}
+	dir := strings.ToUpper(app[:1]) + strings.ToLower(app[1:]) // e.g. lidarr -> Lidarr
+
+	switch goos {
+	case "windows":
+		programData := getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return strings.TrimRight(programData, `\/`) + `\` + dir + `\config.xml`
+	case "darwin":
+		if home := getenv("HOME"); home != "" {
+			return strings.TrimRight(home, "/") + "/.config/" + dir + "/config.xml"
+		}
+	}
+	return DefaultConfigPath
+}
+
+// DefaultStateFile returns the default location of the state file: configarr/state.json
+// below XDG_STATE_HOME, or ~/.local/state without it. Inside containers, where the home
+// directory usually isn't persisted, only XDG_STATE_HOME is used, e.g. pointing to a
+// volume; without it, or without a home directory, the empty string is returned and no
+// state is recorded, so configarr never leaves files in the directory of the app.
+func DefaultStateFile(inContainer bool, getenv func(string) string) string {
+	if dir := xdgDir(getenv, "XDG_STATE_HOME", ".local/state", inContainer); dir != "" {
+		return filepath.Join(dir, "configarr", stateFileName)
+	}
+	return ""
+}
+
+// DefaultCatalogFiles returns the locations of catalog files in the order they are looked
+// up: configarr/catalog.json below XDG_CONFIG_HOME, or ~/.config without it, and below
+// each of XDG_CONFIG_DIRS, or /etc/xdg without it. Inside containers, only the directories
+// set in the variables are used.
+func DefaultCatalogFiles(inContainer bool, getenv func(string) string) []string {
+	var files []string
+	if dir := xdgDir(getenv, "XDG_CONFIG_HOME", ".config", inContainer); dir != "" {
+		files = append(files, filepath.Join(dir, "configarr", catalogFileName))
+	}
+	dirs := getenv("XDG_CONFIG_DIRS")
+	if dirs == "" && !inContainer {
+		dirs = defaultXDGConfigDirs
+	}
+	for _, dir := range filepath.SplitList(dirs) {
+		if filepath.IsAbs(dir) {
+			files = append(files, filepath.Join(dir, "configarr", catalogFileName))
+		}
+	}
+	return files
+}
+
+// xdgDir returns the XDG base directory from the variable, or, outside containers, the
+// fallback below the home directory. Relative paths are ignored, as required by the XDG
+// Base Directory Specification.
+func xdgDir(getenv func(string) string, variable, fallback string, inContainer bool) string {
+	if dir := getenv(variable); filepath.IsAbs(dir) {
+		return dir
+	}
+	if home := getenv("HOME"); !inContainer && filepath.IsAbs(home) && home != "/" {
+		return filepath.Join(home, fallback)
+	}
+	return ""
+}
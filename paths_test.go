@@ -0,0 +1,93 @@
+package configarr
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDefaultConfigPathFor tests the per-OS default configuration file locations.
+func TestDefaultConfigPathFor(t *testing.T) {
+	env := map[string]string{"ProgramData": `D:\ProgramData\`, "HOME": "/Users/me"}
+	getenv := func(key string) string { return env[key] }
+	empty := func(string) string { return "" }
+
+	tests := []struct {
+		name, app, goos string
+		getenv          func(string) string
+		expected        string
+	}{
+		{"Windows default", "lidarr", "windows", empty, `C:\ProgramData\Lidarr\config.xml`},
+		{"Windows ProgramData", "readarr", "windows", getenv, `D:\ProgramData\Readarr\config.xml`},
+		{"macOS", "sonarr", "darwin", getenv, "/Users/me/.config/Sonarr/config.xml"},
+		{"macOS without home", "sonarr", "darwin", empty, DefaultConfigPath},
+		{"Linux", "radarr", "linux", getenv, DefaultConfigPath},
+		{"No app", "", "windows", getenv, DefaultConfigPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if path := DefaultConfigPathFor(tt.app, tt.goos, tt.getenv); path != tt.expected {
+				t.Fatalf("Expected %s, got %s", tt.expected, path)
+			}
+		})
+	}
+}
+
+// TestDefaultStateFile tests the XDG and container locations of the state file.
+func TestDefaultStateFile(t *testing.T) {
+	env := map[string]string{"XDG_STATE_HOME": "/var/lib/me", "HOME": "/home/me"}
+	getenv := func(key string) string { return env[key] }
+	home := func(key string) string {
+		return map[string]string{"HOME": "/home/me", "XDG_STATE_HOME": "relative"}[key]
+	}
+	empty := func(string) string { return "" }
+
+	tests := []struct {
+		name        string
+		inContainer bool
+		getenv      func(string) string
+		expected    string
+	}{
+		{"XDG_STATE_HOME", false, getenv, filepath.Join("/var/lib/me", "configarr", "state.json")},
+		{"Home fallback", false, home, filepath.Join("/home/me", ".local", "state", "configarr", "state.json")},
+		{"Without home", false, empty, ""},
+		{"Container with XDG_STATE_HOME", true, getenv, filepath.Join("/var/lib/me", "configarr", "state.json")},
+		{"Container", true, home, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if path := DefaultStateFile(tt.inContainer, tt.getenv); path != tt.expected {
+				t.Fatalf("Expected %s, got %s", tt.expected, path)
+			}
+		})
+	}
+}
+
+// TestDefaultCatalogFiles tests the XDG locations of catalog files.
+func TestDefaultCatalogFiles(t *testing.T) {
+	home := func(key string) string { return map[string]string{"HOME": "/home/me"}[key] }
+	dirs := func(key string) string {
+		return map[string]string{"HOME": "/home/me", "XDG_CONFIG_HOME": "/data/config", "XDG_CONFIG_DIRS": strings.Join([]string{"/opt/xdg", "relative", "/etc/xdg"}, string(filepath.ListSeparator))}[key]
+	}
+	catalog := func(dir string) string { return filepath.Join(dir, "configarr", "catalog.json") }
+
+	tests := []struct {
+		name        string
+		inContainer bool
+		getenv      func(string) string
+		expected    []string
+	}{
+		{"Home fallback", false, home, []string{catalog("/home/me/.config"), catalog("/etc/xdg")}},
+		{"XDG variables", false, dirs, []string{catalog("/data/config"), catalog("/opt/xdg"), catalog("/etc/xdg")}},
+		{"Container", true, home, nil},
+		{"Container with XDG variables", true, dirs, []string{catalog("/data/config"), catalog("/opt/xdg"), catalog("/etc/xdg")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if files := DefaultCatalogFiles(tt.inContainer, tt.getenv); !reflect.DeepEqual(files, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, files)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package configarr
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Plan action types.
+const (
+	ActionChange = "change"
+	ActionCreate = "create" // Known key missing from the file, added with WithCreateKeys
+	ActionDelete = "delete" // Key removed from the file by an override with Delete set
+	ActionSkip   = "skip"
+)
+
+// Orders of the keys created with WithCreateKeys. Created keys always follow the
+// existing ones, so the files of repeated runs are identical.
+const (
+	KeyOrderAppend  = "append"  // In the order of the overrides
+	KeyOrderCatalog = "catalog" // In the order of the key catalog
+)
+
+// PlanAction is the planned action for a single property.
+type PlanAction struct {
+	Key     string // Property the override targets
+	Type    string // ActionChange, ActionCreate, ActionDelete or ActionSkip
+	Current string // Value currently in the configuration file, empty if the key is missing
+	Value   string // Value requested by the overrides, empty for ActionDelete
+	Reason  string // Why the override is skipped, one of the SkipReason constants
+	Source  string // Source of the winning override
+	Restart bool   // Whether the change only takes effect after an app restart
+}
+
+// changes reports whether the action changes the configuration file.
+func (a PlanAction) changes() bool {
+	return a.Type == ActionChange || a.Type == ActionCreate || a.Type == ActionDelete
+}
+
+// Plan holds the per-key actions computed for a configuration file. A plan can be
+// previewed and later applied with ApplyPlan, which refuses to write when the file
+// changed since the plan was computed, so what was shown is what gets applied.
+type Plan struct {
+	ConfigPath string
+	Actions    []PlanAction
+	Recovered  string // Where the content of an empty file was recovered from, see WithRecoverEmpty
+
+	source []byte // Content the plan was computed from, nil when the file is missing
+	empty  []byte // Content of the file when it was empty and source was recovered
+}
+
+// Changes returns the new values of the properties the plan changes. Deleted properties
+// have empty values.
+func (p *Plan) Changes() map[string]string {
+	changes := make(map[string]string)
+	for _, action := range p.Actions {
+		if action.changes() {
+			changes[action.Key] = action.Value
+		}
+	}
+	return changes
+}
+
+// RestartKeys returns the changed keys that require an app restart, in plan order.
+func (p *Plan) RestartKeys() []string {
+	var keys []string
+	for _, action := range p.Actions {
+		if action.changes() && action.Restart {
+			keys = append(keys, action.Key)
+		}
+	}
+	return keys
+}
+
+// changeSet returns the change set of the changed properties, in plan order.
+func (p *Plan) changeSet(changed map[string]string) ChangeSet {
+	changes := ChangeSet{ConfigPath: p.ConfigPath}
+	for _, action := range p.Actions {
+		if value, found := changed[action.Key]; found {
+			changes.Changes = append(changes.Changes, Change{
+				Key:     action.Key,
+				Old:     action.Current,
+				Value:   value,
+				Source:  action.Source,
+				Action:  action.Type,
+				Restart: action.Restart,
+			})
+		}
+	}
+	return changes
+}
+
+// overrides returns the resolved overrides of the plan that change the configuration, in
+// plan order. Skipped actions are left out whatever their reason, so a filter, condition
+// or incomplete key group never lets a value through.
+func (p *Plan) overrides() []Override {
+	overrides := make([]Override, 0, len(p.Actions))
+	for _, action := range p.Actions {
+		if action.Type == ActionSkip {
+			continue
+		}
+		overrides = append(overrides, Override{Key: action.Key, Value: action.Value, Source: action.Source, Delete: action.Type == ActionDelete, Create: action.Type == ActionCreate})
+	}
+	return overrides
+}
+
+// unmatched returns the overrides of the plan skipped because their key is missing from
+// the configuration, to report them.
+func (p *Plan) unmatched() []Override {
+	var overrides []Override
+	for _, action := range p.Actions {
+		if action.Reason == SkipReasonMissingKey || action.Reason == SkipReasonUnknownKey {
+			overrides = append(overrides, Override{Key: action.Key, Value: action.Value, Source: action.Source})
+		}
+	}
+	return overrides
+}
+
+// Differ computes the actions the overrides would cause on a configuration.
+type Differ struct {
+	Catalog   *Catalog   // Tells missing known keys from unknown ones; may be nil
+	OnlyKeys  []string   // Glob patterns of the keys to apply; all keys when empty
+	SkipKeys  []string   // Glob patterns of the keys never to apply
+	Unmanaged []string   // Glob patterns of the keys edited by hand, see UnmanagedMarker
+	Create    bool       // Whether known keys missing from the file are created
+	Groups    [][]string // Sets of keys that are only changed together
+}
+
+// Diff compares the overrides against the configuration without modifying it.
+// When several overrides target the same property, the last one wins. Conditions are
+// evaluated against the merged state: the file with the unconditional overrides applied
+// that aren't skipped, also for an incomplete key group, and the conditional ones that
+// held, in plan order. Key groups are resolved again once the conditions are evaluated.
+func (d Differ) Diff(config *Config, overrides []Override) []PlanAction {
+	resolved, order := resolveOverrides(overrides)
+
+	state := make(map[string]string, len(config.Properties)+len(order))
+	for key, value := range config.Properties {
+		state[key] = value
+	}
+	actions := make([]PlanAction, len(order))
+	pending := make(map[string]bool) // Keys of the conditional overrides
+	for i, key := range order {
+		if override := resolved[key]; override.Condition == "" {
+			actions[i] = d.action(config, key, override, state)
+		} else {
+			pending[key] = true
+		}
+	}
+	d.applyGroups(config, actions, pending)
+	for _, action := range actions {
+		mergeAction(state, action)
+	}
+
+	for i, key := range order {
+		if pending[key] {
+			actions[i] = d.action(config, key, resolved[key], state)
+			mergeAction(state, actions[i])
+		}
+	}
+	d.applyGroups(config, actions, nil)
+	return actions
+}
+
+// action computes the action of the override for the key, evaluating its condition
+// against the merged state.
+func (d Differ) action(config *Config, key string, override Override, state map[string]string) PlanAction {
+	action := PlanAction{Key: key, Value: override.Value, Source: override.Source, Type: ActionSkip}
+	current, exists := config.Properties[key]
+	action.Current = current
+	switch {
+	case !d.allows(key):
+		action.Reason = SkipReasonFiltered
+	case d.unmanaged(config, key):
+		action.Reason = SkipReasonUnmanaged
+	case override.Condition != "" && !conditionHolds(override.Condition, state, &action):
+		// Skipped, with the reason recorded by conditionHolds
+	case override.Delete && !exists:
+		action.Reason = SkipReasonUnchanged // Already absent
+	case override.Delete:
+		action.Type = ActionDelete
+		action.Restart = d.Catalog.RequiresRestart(key)
+	case !exists && (override.Create || d.Create && d.Catalog.IsKnownKey(key)):
+		action.Type = ActionCreate
+		action.Restart = d.Catalog.RequiresRestart(key)
+	case !exists:
+		action.Reason = skipReason(key, config, d.Catalog)
+	case current == action.Value:
+		action.Reason = SkipReasonUnchanged
+	default:
+		action.Type = ActionChange
+		action.Restart = d.Catalog.RequiresRestart(key)
+	}
+	return action
+}
+
+// mergeAction records the outcome of an action in the merged state; skipped actions
+// leave it alone.
+func mergeAction(state map[string]string, action PlanAction) {
+	switch action.Type {
+	case ActionChange, ActionCreate:
+		state[action.Key] = action.Value
+	case ActionDelete:
+		delete(state, action.Key)
+	}
+}
+
+// applyGroups skips every change of a key group unless all of its members can be
+// applied: their overrides must not be skipped for any reason other than an unchanged
+// value, and members without an override must exist in the file. Pending members, whose
+// actions aren't computed yet, are left out.
+func (d Differ) applyGroups(config *Config, actions []PlanAction, pending map[string]bool) {
+	index := make(map[string]int, len(actions))
+	for i, action := range actions {
+		index[action.Key] = i
+	}
+
+	for _, group := range d.Groups {
+		changed := false
+		problem := ""
+		for _, member := range group {
+			i, targeted := index[member]
+			_, exists := config.Properties[member]
+			switch {
+			case pending[member]:
+				// Resolved again once its action is computed
+			case targeted && actions[i].changes():
+				changed = true
+			case targeted && actions[i].Reason != SkipReasonUnchanged && problem == "":
+				problem = fmt.Sprintf("%s: %s", member, actions[i].Reason)
+			case !targeted && !exists && problem == "":
+				problem = fmt.Sprintf("%s: %s", member, SkipReasonMissingKey)
+			}
+		}
+		if !changed || problem == "" {
+			continue
+		}
+
+		for _, member := range group {
+			if i, targeted := index[member]; targeted && actions[i].changes() {
+				actions[i].Type = ActionSkip
+				actions[i].Restart = false
+				actions[i].Reason = fmt.Sprintf("%s (%s)", SkipReasonGroup, problem)
+			}
+		}
+	}
+}
+
+// conditionHolds evaluates the condition of an override, recording in the action why it
+// is skipped otherwise.
+func conditionHolds(expr string, state map[string]string, action *PlanAction) bool {
+	c, err := parseCondition(expr)
+	if err != nil {
+		action.Reason = SkipReasonCondition + ": " + err.Error()
+		return false
+	}
+	if !c.holds(state) {
+		action.Reason = SkipReasonCondition + ": " + expr
+		return false
+	}
+	return true
+}
+
+// allows reports whether the key passes the include and exclude filters.
+func (d Differ) allows(key string) bool {
+	if len(d.OnlyKeys) > 0 && !matchesAny(key, d.OnlyKeys) {
+		return false
+	}
+	return !matchesAny(key, d.SkipKeys)
+}
+
+// UnmanagedMarker marks the element of an XML configuration file a comment holding only
+// it precedes, e.g. <!-- configarr:unmanaged -->, as edited by hand: no override changes
+// it, or any element below it.
+const UnmanagedMarker = "configarr:unmanaged"
+
+// unmanaged reports whether the key is edited by hand: it matches one of the Unmanaged
+// patterns, or its element or one of its parents is marked with UnmanagedMarker.
+func (d Differ) unmanaged(config *Config, key string) bool {
+	if matchesAny(key, d.Unmanaged) {
+		return true
+	}
+	path := config.elementPath(key)
+	for depth := 1; depth <= len(path); depth++ {
+		for _, token := range config.Tokens[strings.Join(path[:depth], ".")] {
+			if comment, ok := token.(xml.Comment); ok && strings.TrimSpace(string(comment)) == UnmanagedMarker {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewPlan reads the configuration file and the sources and computes the plan
+// without writing anything.
+func NewPlan(ctx context.Context, opts ...Option) (*Plan, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := readSources(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	return newPlan(ctx, overrides, o)
+}
+
+// ApplyPlan applies a plan computed by NewPlan. It fails with ErrConflict when the
+// configuration file changed since the plan was computed. The config path option
+// is ignored in favor of the plan's.
+func ApplyPlan(ctx context.Context, plan *Plan, opts ...Option) (Result, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return Result{ConfigPath: plan.ConfigPath}, err
+	}
+	o.configPath = plan.ConfigPath
+	return applyPlan(ctx, plan, o)
+}
@@ -0,0 +1,338 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDiffer_Diff tests computing per-key actions without modifying the configuration.
+func TestDiffer_Diff(t *testing.T) {
+	config := &Config{Properties: map[string]string{"Port": "8989", "LogLevel": "info"}}
+	catalog := &Catalog{Apps: map[string]CatalogApp{"sonarr": {Keys: []CatalogKey{{Name: "ApiKey"}}}}}
+	overrides := []Override{
+		{Key: "Port", Value: "9000"},
+		{Key: "LogLevel", Value: "info"},
+		{Key: "ApiKey", Value: "secret"},
+		{Key: "Typo", Value: "x"},
+		{Key: "Port", Value: "9001"},
+	}
+
+	actions := Differ{Catalog: catalog}.Diff(config, overrides)
+
+	expected := []PlanAction{
+		{Key: "Port", Type: ActionChange, Current: "8989", Value: "9001"},
+		{Key: "LogLevel", Type: ActionSkip, Current: "info", Value: "info", Reason: SkipReasonUnchanged},
+		{Key: "ApiKey", Type: ActionSkip, Value: "secret", Reason: SkipReasonMissingKey},
+		{Key: "Typo", Type: ActionSkip, Value: "x", Reason: SkipReasonUnknownKey},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("Expected actions %+v, got %+v", expected, actions)
+	}
+	if config.Properties["Port"] != "8989" {
+		t.Fatalf("Expected configuration to be unmodified, got Port '%s'", config.Properties["Port"])
+	}
+}
+
+// TestDiffer_Create tests planning the creation of known keys missing from the file.
+func TestDiffer_Create(t *testing.T) {
+	config := &Config{Properties: map[string]string{"Port": "8989"}}
+	catalog := &Catalog{Apps: map[string]CatalogApp{"sonarr": {Keys: []CatalogKey{{Name: "SslPort", Restart: true}}}}}
+	overrides := []Override{{Key: "SslPort", Value: "9898"}, {Key: "Typo", Value: "x"}}
+
+	actions := Differ{Catalog: catalog, Create: true}.Diff(config, overrides)
+
+	expected := []PlanAction{
+		{Key: "SslPort", Type: ActionCreate, Value: "9898", Restart: true},
+		{Key: "Typo", Type: ActionSkip, Value: "x", Reason: SkipReasonUnknownKey},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("Expected actions %+v, got %+v", expected, actions)
+	}
+}
+
+// TestDiffer_Conditions tests skipping overrides whose condition doesn't hold in the merged state.
+func TestDiffer_Conditions(t *testing.T) {
+	config := &Config{Properties: map[string]string{"EnableSsl": "False", "SslPort": "9898", "SslCertPath": ""}}
+	overrides := []Override{
+		{Key: "EnableSsl", Value: "True", Condition: `SslCertPath != ""`},
+		{Key: "SslPort", Value: "443", Condition: "SslCertPath"},
+		{Key: "SslCertPath", Value: "/certs/tls.pfx"},
+	}
+
+	t.Run("Merged state", func(t *testing.T) {
+		actions := Differ{}.Diff(config, overrides)
+		for _, action := range actions {
+			if action.Type != ActionChange {
+				t.Fatalf("Expected %s to change, got %+v", action.Key, action)
+			}
+		}
+	})
+
+	t.Run("Condition not met", func(t *testing.T) {
+		actions := Differ{}.Diff(config, overrides[:2])
+
+		expected := []PlanAction{
+			{Key: "EnableSsl", Type: ActionSkip, Current: "False", Value: "True", Reason: SkipReasonCondition + `: SslCertPath != ""`},
+			{Key: "SslPort", Type: ActionSkip, Current: "9898", Value: "443", Reason: SkipReasonCondition + ": SslCertPath"},
+		}
+		if !reflect.DeepEqual(actions, expected) {
+			t.Fatalf("Expected actions %+v, got %+v", expected, actions)
+		}
+
+		plan := &Plan{Actions: actions}
+		if len(plan.overrides()) != 0 {
+			t.Fatalf("Expected skipped conditional overrides not to be applied, got %+v", plan.overrides())
+		}
+	})
+
+	t.Run("Seeding override skipped", func(t *testing.T) {
+		for name, differ := range map[string]Differ{
+			"Filtered":  {SkipKeys: []string{"SslCertPath"}},
+			"Unmanaged": {Unmanaged: []string{"SslCertPath"}},
+		} {
+			actions := differ.Diff(config, overrides)
+			for _, action := range actions[:2] {
+				if action.Type != ActionSkip || !strings.HasPrefix(action.Reason, SkipReasonCondition) {
+					t.Fatalf("%s: expected %s to be skipped by its condition, got %+v", name, action.Key, action)
+				}
+			}
+		}
+
+		missing := &Config{Properties: map[string]string{"EnableSsl": "False", "SslPort": "9898"}}
+		actions := Differ{}.Diff(missing, overrides)
+		if actions[0].Type != ActionSkip || actions[2].Reason != SkipReasonUnknownKey {
+			t.Fatalf("Expected a key missing from the file not to satisfy conditions, got %+v", actions)
+		}
+	})
+}
+
+// TestDiffer_Groups tests that the members of a key group are only changed together.
+func TestDiffer_Groups(t *testing.T) {
+	groups := [][]string{{"SslPort", "EnableSsl", "SslCertPath"}}
+
+	t.Run("Complete group", func(t *testing.T) {
+		config := &Config{Properties: map[string]string{"SslPort": "9898", "EnableSsl": "False", "SslCertPath": "/certs/tls.pfx"}}
+		actions := Differ{Groups: groups}.Diff(config, []Override{{Key: "EnableSsl", Value: "True"}, {Key: "SslPort", Value: "9898"}})
+
+		if actions[0].Type != ActionChange || actions[1].Reason != SkipReasonUnchanged {
+			t.Fatalf("Expected EnableSsl to change, got %+v", actions)
+		}
+	})
+
+	t.Run("Member missing from the file", func(t *testing.T) {
+		config := &Config{Properties: map[string]string{"SslPort": "9898", "EnableSsl": "False"}}
+		actions := Differ{Groups: groups}.Diff(config, []Override{{Key: "EnableSsl", Value: "True"}, {Key: "SslPort", Value: "443"}})
+
+		reason := SkipReasonGroup + " (SslCertPath: " + SkipReasonMissingKey + ")"
+		expected := []PlanAction{
+			{Key: "EnableSsl", Type: ActionSkip, Current: "False", Value: "True", Reason: reason},
+			{Key: "SslPort", Type: ActionSkip, Current: "9898", Value: "443", Reason: reason},
+		}
+		if !reflect.DeepEqual(actions, expected) {
+			t.Fatalf("Expected actions %+v, got %+v", expected, actions)
+		}
+	})
+
+	t.Run("Member skipped", func(t *testing.T) {
+		config := &Config{Properties: map[string]string{"SslPort": "9898", "EnableSsl": "False", "SslCertPath": ""}}
+		overrides := []Override{{Key: "EnableSsl", Value: "True"}, {Key: "SslCertPath", Value: "/certs/tls.pfx", Condition: "Missing"}}
+		actions := Differ{Groups: groups}.Diff(config, overrides)
+
+		if actions[0].Type != ActionSkip || !strings.Contains(actions[0].Reason, "SslCertPath: "+SkipReasonCondition) {
+			t.Fatalf("Expected EnableSsl to be skipped for the group, got %+v", actions[0])
+		}
+	})
+
+	t.Run("Conditions see skipped members", func(t *testing.T) {
+		config := &Config{Properties: map[string]string{"AuthMethod": "None", "UrlBase": ""}}
+		overrides := []Override{{Key: "AuthMethod", Value: "Forms"}, {Key: "UrlBase", Value: "/x", Condition: "AuthMethod == Forms"}}
+		actions := Differ{Groups: [][]string{{"AuthMethod", "Missing"}}}.Diff(config, overrides)
+
+		if actions[0].Type != ActionSkip || !strings.HasPrefix(actions[0].Reason, SkipReasonGroup) {
+			t.Fatalf("Expected AuthMethod to be skipped for the group, got %+v", actions[0])
+		}
+		if actions[1].Type != ActionSkip || actions[1].Reason != SkipReasonCondition+": AuthMethod == Forms" {
+			t.Fatalf("Expected the condition on the skipped AuthMethod to fail, got %+v", actions[1])
+		}
+	})
+
+	t.Run("Conditional member", func(t *testing.T) {
+		config := &Config{Properties: map[string]string{"SslPort": "9898", "EnableSsl": "False"}}
+		overrides := []Override{{Key: "EnableSsl", Value: "True"}, {Key: "SslCertPath", Value: "/certs/tls.pfx", Condition: "EnableSsl == True", Create: true}}
+		actions := Differ{Groups: groups}.Diff(config, overrides)
+
+		if actions[0].Type != ActionChange || actions[1].Type != ActionCreate {
+			t.Fatalf("Expected the group to change with its conditional member, got %+v", actions)
+		}
+	})
+}
+
+// TestDiffer_KeyFilters tests restricting the applied keys with glob patterns.
+func TestDiffer_KeyFilters(t *testing.T) {
+	config := &Config{Properties: map[string]string{"ApiKey": "a", "UrlBase": "", "Port": "8989"}}
+	overrides := []Override{
+		{Key: "ApiKey", Value: "b"},
+		{Key: "UrlBase", Value: "/sonarr"},
+		{Key: "Port", Value: "9000"},
+	}
+
+	differ := Differ{OnlyKeys: []string{"ApiKey", "Url*"}, SkipKeys: []string{"UrlBase"}}
+	actions := differ.Diff(config, overrides)
+
+	expected := []PlanAction{
+		{Key: "ApiKey", Type: ActionChange, Current: "a", Value: "b"},
+		{Key: "UrlBase", Type: ActionSkip, Value: "/sonarr", Reason: SkipReasonFiltered},
+		{Key: "Port", Type: ActionSkip, Current: "8989", Value: "9000", Reason: SkipReasonFiltered},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("Expected actions %+v, got %+v", expected, actions)
+	}
+
+	plan := &Plan{Actions: actions}
+	if overrides := plan.overrides(); len(overrides) != 1 || overrides[0].Key != "ApiKey" {
+		t.Fatalf("Expected only ApiKey to be applied, got %+v", overrides)
+	}
+}
+
+// TestDiffer_Unmanaged tests that keys matching the unmanaged patterns or marked in the
+// file keep their manual edits.
+func TestDiffer_Unmanaged(t *testing.T) {
+	config, err := ParseConfig([]byte(`<Config>
+  <Port>8989</Port>
+  <!-- configarr:unmanaged -->
+  <UrlBase>/manual</UrlBase>
+  <!--configarr:unmanaged-->
+  <Server><Host>nas</Host></Server>
+  <!-- Not a marker: configarr:unmanaged -->
+  <LogLevel>info</LogLevel>
+  <ApiKey>a</ApiKey>
+</Config>`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	overrides := []Override{
+		{Key: "Port", Value: "9000"},
+		{Key: "UrlBase", Value: "/sonarr"},
+		{Key: "Server.Host", Value: "tv"},
+		{Key: "LogLevel", Value: "debug"},
+		{Key: "ApiKey", Value: "b"},
+	}
+
+	differ := Differ{Unmanaged: []string{"Api*"}}
+	actions := differ.Diff(config, overrides)
+
+	expected := []PlanAction{
+		{Key: "Port", Type: ActionChange, Current: "8989", Value: "9000"},
+		{Key: "UrlBase", Type: ActionSkip, Current: "/manual", Value: "/sonarr", Reason: SkipReasonUnmanaged},
+		{Key: "Server.Host", Type: ActionSkip, Current: "nas", Value: "tv", Reason: SkipReasonUnmanaged},
+		{Key: "LogLevel", Type: ActionChange, Current: "info", Value: "debug"},
+		{Key: "ApiKey", Type: ActionSkip, Current: "a", Value: "b", Reason: SkipReasonUnmanaged},
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Fatalf("Expected actions %+v, got %+v", expected, actions)
+	}
+
+	plan := &Plan{Actions: actions}
+	if overrides := plan.overrides(); len(overrides) != 2 {
+		t.Fatalf("Expected only Port and LogLevel to be applied, got %+v", overrides)
+	}
+}
+
+// TestPlan_RestartKeys tests classifying changes by whether they require an app restart.
+func TestPlan_RestartKeys(t *testing.T) {
+	catalog, err := LoadCatalog("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	config := &Config{Properties: map[string]string{"Port": "8989", "SslPort": "9898", "LogLevel": "info", "UrlBase": ""}}
+	overrides := []Override{
+		{Key: "LogLevel", Value: "debug"},
+		{Key: "Port", Value: "9000"},
+		{Key: "SslPort", Value: "9999"},
+		{Key: "UrlBase", Value: ""},
+	}
+
+	plan := &Plan{Actions: Differ{Catalog: catalog}.Diff(config, overrides)}
+	if keys := plan.RestartKeys(); !reflect.DeepEqual(keys, []string{"Port", "SslPort"}) {
+		t.Fatalf("Expected restart keys [Port SslPort], got %v", keys)
+	}
+}
+
+// TestApplyPlan tests applying a previously computed plan.
+func TestApplyPlan(t *testing.T) {
+	createConfig := func(t *testing.T) string {
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		t.Cleanup(func() { os.Remove(file.Name()) })
+		if _, err := file.WriteString("<Config><Port>8989</Port></Config>"); err != nil {
+			t.Fatalf("Unexpected error writing temp file: %v", err)
+		}
+		file.Close()
+		return file.Name()
+	}
+
+	t.Run("Apply plan", func(t *testing.T) {
+		path := createConfig(t)
+
+		plan, err := NewPlan(context.Background(),
+			WithConfigPath(path),
+			WithSources(StaticSource(Override{Key: "Port", Value: "9000"})),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(plan.Changes(), map[string]string{"Port": "9000"}) {
+			t.Fatalf("Unexpected plan changes: %v", plan.Changes())
+		}
+
+		result, err := ApplyPlan(context.Background(), plan)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !result.Written || result.Changed["Port"] != "9000" {
+			t.Fatalf("Expected Port to be written as '9000', got %+v", result)
+		}
+	})
+
+	t.Run("Stale plan", func(t *testing.T) {
+		path := createConfig(t)
+
+		plan, err := NewPlan(context.Background(),
+			WithConfigPath(path),
+			WithSources(StaticSource(Override{Key: "Port", Value: "9000"})),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte("<Config><Port>7878</Port></Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error modifying file: %v", err)
+		}
+
+		if _, err := ApplyPlan(context.Background(), plan); !errors.Is(err, ErrConflict) {
+			t.Fatalf("Expected conflict error, got %v", err)
+		}
+	})
+
+	t.Run("Missing config ignored", func(t *testing.T) {
+		plan, err := NewPlan(context.Background(), WithConfigPath("nonexistent.xml"), WithIgnoreMissingConfig())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, err := ApplyPlan(context.Background(), plan)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Written {
+			t.Fatal("Expected nothing to be written")
+		}
+	})
+}
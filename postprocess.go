@@ -0,0 +1,273 @@
+package configarr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the version of configarr stamped into files by the header post-processor,
+// set at build time with -ldflags "-X configarr.Version=<version>".
+var Version = "dev"
+
+// Texts of the header post-processor: DefaultHeader without one of its own, and
+// ManagedHeader telling operators that the file is under management.
+const (
+	DefaultHeader = "Generated by configarr {version} on {time}"
+	ManagedHeader = "managed by configarr {version} at {time}; manual edits may be overwritten"
+)
+
+// RenderInfo describes the rendered configuration file to post-processors.
+type RenderInfo struct {
+	Path    string    // Path of the configuration file
+	Format  string    // Name of its format, e.g. FormatXML
+	Indent  string    // Indentation of RenderOptions, empty when compact
+	Time    time.Time // Time of the run, from its clock
+	Changed bool      // Whether the run changed any property
+}
+
+// PostProcessor changes the rendered configuration file just before it is written, e.g.
+// to stamp a header with its provenance into it.
+type PostProcessor interface {
+	PostProcess(output []byte, info RenderInfo) ([]byte, error)
+}
+
+// PostProcessorFunc adapts a function to the PostProcessor interface.
+type PostProcessorFunc func(output []byte, info RenderInfo) ([]byte, error)
+
+// PostProcess calls the function.
+func (f PostProcessorFunc) PostProcess(output []byte, info RenderInfo) ([]byte, error) {
+	return f(output, info)
+}
+
+// PostProcessorFactory creates a post-processor from its argument, empty when it has none.
+type PostProcessorFactory func(arg string) (PostProcessor, error)
+
+var (
+	postProcessorMu        sync.RWMutex
+	postProcessorFactories = map[string]PostProcessorFactory{
+		"header": newHeaderPostProcessor,
+		"indent": newIndentPostProcessor,
+		"sort":   newSortPostProcessor,
+	}
+)
+
+// RegisterPostProcessor makes a post-processor available to NewPostProcessor.
+// Registering an existing name replaces it.
+func RegisterPostProcessor(name string, factory PostProcessorFactory) {
+	postProcessorMu.Lock()
+	defer postProcessorMu.Unlock()
+
+	postProcessorFactories[name] = factory
+}
+
+// PostProcessorNames returns the registered post-processor names in sorted order.
+func PostProcessorNames() []string {
+	postProcessorMu.RLock()
+	defer postProcessorMu.RUnlock()
+
+	names := make([]string, 0, len(postProcessorFactories))
+	for name := range postProcessorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPostProcessor creates a post-processor from a spec of the form <name>[:<arg>], e.g.
+// "header:Managed by Ansible, {time}" or "indent:\t".
+func NewPostProcessor(spec string) (PostProcessor, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	postProcessorMu.RLock()
+	factory, exists := postProcessorFactories[name]
+	postProcessorMu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("unknown post-processor %q: expected one of %s", name, strings.Join(PostProcessorNames(), ", "))
+	}
+	processor, err := factory(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid post-processor %s: %w", spec, err)
+	}
+	return processor, nil
+}
+
+// postProcess applies the post-processors in order.
+func postProcess(output []byte, info RenderInfo, processors []PostProcessor) ([]byte, error) {
+	for _, processor := range processors {
+		var err error
+		if output, err = processor.PostProcess(output, info); err != nil {
+			return nil, fmt.Errorf("error post-processing %s: %w", info.Path, err)
+		}
+	}
+	return output, nil
+}
+
+// newHeaderPostProcessor returns a post-processor putting a comment with the text, or
+// DefaultHeader, at the top of the file, after the XML declaration. {version}, {time} and
+// {path} are replaced with Version, the time of the run in UTC and the path of the file.
+//
+// A header from an earlier run, recognized by the text up to the first placeholder, is
+// replaced when the run changed something and kept as it is otherwise, so the file isn't
+// rewritten only for the timestamp.
+func newHeaderPostProcessor(text string) (PostProcessor, error) {
+	if text == "" {
+		text = DefaultHeader
+	}
+	if strings.ContainsAny(text, "\r\n") {
+		return nil, errors.New("the header must be a single line")
+	}
+	prefix, _, _ := strings.Cut(text, "{")
+	prefix = strings.TrimSpace(prefix)
+
+	return PostProcessorFunc(func(output []byte, info RenderInfo) ([]byte, error) {
+		header := strings.NewReplacer(
+			"{version}", Version,
+			"{time}", info.Time.UTC().Format(time.RFC3339),
+			"{path}", info.Path,
+		).Replace(text)
+
+		var before, after string
+		switch info.Format {
+		case FormatXML, FormatXMLAttributes:
+			if strings.Contains(header, "--") {
+				return nil, errors.New("XML comments can't hold --")
+			}
+			before, after = "<!-- ", " -->"
+		case FormatYAML, FormatINI:
+			before = "# "
+		default:
+			return nil, fmt.Errorf("%s files don't support comments", info.Format)
+		}
+
+		at := 0
+		if bytes.HasPrefix(output, utf8BOM) {
+			at = len(utf8BOM)
+		}
+		if bytes.HasPrefix(output[at:], []byte("<?xml")) {
+			if end := bytes.Index(output[at:], []byte("?>")); end >= 0 {
+				at += end + len("?>")
+				at += len(output[at:]) - len(bytes.TrimLeft(output[at:], "\r\n"))
+				if at == len(output) || output[at-1] != '\n' {
+					output = slices.Insert(bytes.Clone(output), at, '\n')
+					at++
+				}
+			}
+		}
+
+		end := at
+		if prefix != "" {
+			if start, stop, found := findHeader(output, at, before+prefix, strings.TrimSpace(before)); found {
+				if !info.Changed {
+					return output, nil
+				}
+				at, end = start, stop
+			}
+		}
+		stamped := make([]byte, 0, len(output)+len(header)+16)
+		stamped = append(stamped, output[:at]...)
+		stamped = append(stamped, before+header+after+"\n"...)
+		return append(stamped, output[end:]...), nil
+	}), nil
+}
+
+// findHeader returns the range of the line starting with the marker among the comments
+// and blank lines from offset at, including its newline, so a header is updated in
+// place below other leading comments.
+func findHeader(output []byte, at int, marker, comment string) (int, int, bool) {
+	for start := at; start < len(output); {
+		end := len(output)
+		if newline := bytes.IndexByte(output[start:], '\n'); newline >= 0 {
+			end = start + newline + 1
+		}
+		line := bytes.TrimSpace(output[start:end])
+		switch {
+		case bytes.HasPrefix(line, []byte(marker)):
+			return start, end, true
+		case len(line) > 0 && !bytes.HasPrefix(line, []byte(comment)):
+			return 0, 0, false
+		}
+		start = end
+	}
+	return 0, 0, false
+}
+
+// newIndentPostProcessor returns a post-processor re-indenting XML and JSON files with
+// the indentation, or the one of RenderInfo. XML documents are re-marshalled as with
+// RenderOptions.Reformat.
+func newIndentPostProcessor(indent string) (PostProcessor, error) {
+	if strings.Trim(indent, " \t") != "" {
+		return nil, fmt.Errorf("indentation %q holds other characters than spaces and tabs", indent)
+	}
+	return PostProcessorFunc(func(output []byte, info RenderInfo) ([]byte, error) {
+		indent := indent
+		if indent == "" {
+			indent = info.Indent
+		}
+		return reformatOutput(output, info.Format, indent, false)
+	}), nil
+}
+
+// newSortPostProcessor returns a post-processor sorting the elements of XML files by
+// their key and the members of the objects of JSON files by their name.
+func newSortPostProcessor(arg string) (PostProcessor, error) {
+	if arg != "" {
+		return nil, errors.New("expected no argument")
+	}
+	return PostProcessorFunc(func(output []byte, info RenderInfo) ([]byte, error) {
+		return reformatOutput(output, info.Format, info.Indent, true)
+	}), nil
+}
+
+// reformatOutput parses the rendered output and renders it again with the indentation,
+// optionally sorted.
+func reformatOutput(output []byte, format, indent string, sorted bool) ([]byte, error) {
+	switch format {
+	case FormatXML:
+		config, err := ParseConfig(output)
+		if err != nil {
+			return nil, err
+		}
+		if sorted {
+			sort.Strings(config.Keys)
+		}
+		rendered, err := renderConfig(config, RenderOptions{Indent: indent, Reformat: true, Compact: indent == ""})
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasSuffix(output, []byte("\n")) {
+			rendered = append(rendered, '\n')
+		}
+		return rendered, nil
+	case FormatJSON:
+		config, err := JSONFormat.Parse(output)
+		if err != nil {
+			return nil, err
+		}
+		doc := config.document.(*jsonDocument)
+		reformatted := &jsonDocument{roots: doc.roots, indent: indent}
+		if sorted {
+			for _, root := range doc.roots {
+				sortJSONNode(root)
+			}
+		}
+		config.document = reformatted
+		return JSONFormat.Render(config, RenderOptions{Compact: indent == ""})
+	}
+	return nil, fmt.Errorf("not supported for %s files", format)
+}
+
+// sortJSONNode sorts the members of the objects of the node and its descendants by name.
+func sortJSONNode(node *jsonNode) {
+	sort.SliceStable(node.members, func(i, j int) bool { return node.members[i].name < node.members[j].name })
+	for _, member := range node.members {
+		sortJSONNode(member.node)
+	}
+	for _, item := range node.items {
+		sortJSONNode(item)
+	}
+}
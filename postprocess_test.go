@@ -0,0 +1,175 @@
+package configarr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestNewPostProcessor tests creating post-processors from their specs.
+func TestNewPostProcessor(t *testing.T) {
+	for _, spec := range []string{"header", "header:Managed by Ansible", "indent", "indent:\t", "sort"} {
+		if _, err := NewPostProcessor(spec); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", spec, err)
+		}
+	}
+
+	for _, spec := range []string{"unknown", "header:two\nlines", "indent:x", "sort:name"} {
+		if _, err := NewPostProcessor(spec); err == nil {
+			t.Fatalf("Expected error for %q, but got none", spec)
+		}
+	}
+
+	t.Run("Registered", func(t *testing.T) {
+		RegisterPostProcessor("upper", func(arg string) (PostProcessor, error) {
+			return PostProcessorFunc(func(output []byte, info RenderInfo) ([]byte, error) {
+				return []byte(strings.ToUpper(string(output))), nil
+			}), nil
+		})
+		defer func() {
+			postProcessorMu.Lock()
+			delete(postProcessorFactories, "upper")
+			postProcessorMu.Unlock()
+		}()
+
+		processor, err := NewPostProcessor("upper")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if output, _ := processor.PostProcess([]byte("<a/>"), RenderInfo{}); string(output) != "<A/>" {
+			t.Fatalf("Expected the registered post-processor, got %q", output)
+		}
+	})
+}
+
+// TestHeaderPostProcessor tests that the header is stamped after the XML declaration and
+// only replaced when the run changed something.
+func TestHeaderPostProcessor(t *testing.T) {
+	processor, err := NewPostProcessor("header")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	info := RenderInfo{Path: "config.xml", Format: FormatXML, Time: now, Changed: true}
+	header := "<!-- Generated by configarr " + Version + " on 2024-05-01T12:00:00Z -->\n"
+
+	for name, tt := range map[string]struct {
+		output, expected string
+	}{
+		"Declaration":         {"<?xml version=\"1.0\"?>\n<Config></Config>", "<?xml version=\"1.0\"?>\n" + header + "<Config></Config>"},
+		"Compact declaration": {"<?xml version=\"1.0\"?><Config/>", "<?xml version=\"1.0\"?>\n" + header + "<Config/>"},
+		"No declaration":      {"<Config></Config>", header + "<Config></Config>"},
+		"Earlier header":      {"<!-- Generated by configarr v1 on 2020-01-01T00:00:00Z -->\n<Config></Config>", header + "<Config></Config>"},
+		"Below comments":      {"<?xml version=\"1.0\"?>\n<!-- License -->\n\n<!-- Generated by configarr v1 on 2020-01-01T00:00:00Z -->\n<Config/>", "<?xml version=\"1.0\"?>\n<!-- License -->\n\n" + header + "<Config/>"},
+	} {
+		output, err := processor.PostProcess([]byte(tt.output), info)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", strings.ToLower(name), err)
+		}
+		if string(output) != tt.expected {
+			t.Fatalf("Expected %q for %s, got %q", tt.expected, strings.ToLower(name), output)
+		}
+	}
+
+	t.Run("Kept without changes", func(t *testing.T) {
+		earlier := "<!-- Generated by configarr v1 on 2020-01-01T00:00:00Z -->\n<Config></Config>"
+		unchanged := info
+		unchanged.Changed = false
+		output, err := processor.PostProcess([]byte(earlier), unchanged)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(output) != earlier {
+			t.Fatalf("Expected the earlier header to be kept, got %q", output)
+		}
+	})
+
+	t.Run("Other formats", func(t *testing.T) {
+		custom, err := NewPostProcessor("header:Managed by Ansible for {path}")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		output, err := custom.PostProcess([]byte("port: 8080\n"), RenderInfo{Path: "config.yaml", Format: FormatYAML})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := "# Managed by Ansible for config.yaml\nport: 8080\n"; string(output) != expected {
+			t.Fatalf("Expected %q, got %q", expected, output)
+		}
+
+		if _, err := custom.PostProcess([]byte("{}"), RenderInfo{Format: FormatJSON}); err == nil {
+			t.Fatal("Expected error for a JSON file, but got none")
+		}
+	})
+}
+
+// TestReformatPostProcessors tests that the indent and sort post-processors re-render
+// XML and JSON files.
+func TestReformatPostProcessors(t *testing.T) {
+	sorter, err := NewPostProcessor("sort")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	indenter, err := NewPostProcessor("indent:\t")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		processor PostProcessor
+		format    string
+		output    string
+		expected  string
+	}{
+		{"Sort XML", sorter, FormatXML, "<Config>\n  <Port>8989</Port>\n  <ApiKey>abc</ApiKey>\n</Config>\n", "<Config>\n  <ApiKey>abc</ApiKey>\n  <Port>8989</Port>\n</Config>\n"},
+		{"Indent XML", indenter, FormatXML, "<Config>\n  <Port>8989</Port>\n</Config>", "<Config>\n\t<Port>8989</Port>\n</Config>"},
+		{"Sort JSON", sorter, FormatJSON, `{"b": 1, "a": {"d": true, "c": null}}`, "{\n  \"a\": {\n    \"c\": null,\n    \"d\": true\n  },\n  \"b\": 1\n}"},
+		{"Indent JSON", indenter, FormatJSON, `{"b": [1, 2]}`, "{\n\t\"b\": [\n\t\t1,\n\t\t2\n\t]\n}"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := tt.processor.PostProcess([]byte(tt.output), RenderInfo{Format: tt.format, Indent: DefaultIndent})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Fatalf("Expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+
+	if _, err := sorter.PostProcess([]byte("a = 1"), RenderInfo{Format: FormatINI}); err == nil {
+		t.Fatal("Expected error for an INI file, but got none")
+	}
+}
+
+// TestRun_PostProcessors tests that post-processors change the written file and are
+// refused with patch mode.
+func TestRun_PostProcessors(t *testing.T) {
+	header, err := NewPostProcessor("header:Provisioned on {time}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte("<Config>\r\n  <Port>8989</Port>\r\n</Config>\r\n")}}}
+	base := []Option{
+		WithFS(fsys),
+		WithConfigPath("config.xml"),
+		WithClock(FixedClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))),
+		WithSources(StaticSource(Override{Key: "Port", Value: "8990"})),
+		WithPostProcessors(header),
+	}
+
+	if _, err := Run(context.Background(), base...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "<!-- Provisioned on 2024-05-01T12:00:00Z -->\r\n<Config>\r\n  <Port>8990</Port>\r\n</Config>\r\n"
+	if written := string(fsys.MapFS["config.xml"].Data); written != expected {
+		t.Fatalf("Expected %q, got %q", expected, written)
+	}
+
+	if _, err := Run(context.Background(), append(base, WithPatch())...); err == nil || !strings.Contains(err.Error(), "post-processors") {
+		t.Fatalf("Expected error with patch mode, got: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package configarr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// presetAppPlaceholder is replaced with the name of the app in preset values.
+const presetAppPlaceholder = "{app}"
+
+// Preset is a named set of properties for a common deployment pattern.
+type Preset struct {
+	Description string
+	Values      []Override // Values may contain {app}, replaced with the name of the app
+}
+
+// presets are the presets shipped with configarr, see ExpandPreset.
+var presets = map[string]Preset{
+	"behind-reverse-proxy": {
+		Description: "Serve below /<app> on all interfaces with mandatory authentication; the proxy terminates TLS",
+		Values: []Override{
+			{Key: "UrlBase", Value: "/" + presetAppPlaceholder},
+			{Key: "BindAddress", Value: "*"},
+			{Key: "EnableSsl", Value: "False"},
+			{Key: "AuthenticationRequired", Value: "Enabled"},
+		},
+	},
+	"external-auth": {
+		Description: "Leave authentication to a proxy such as Authelia or Authentik",
+		Values: []Override{
+			{Key: "AuthenticationMethod", Value: "External"},
+		},
+	},
+	"local-only": {
+		Description: "Listen on localhost only and skip authentication for local addresses",
+		Values: []Override{
+			{Key: "BindAddress", Value: "127.0.0.1"},
+			{Key: "AuthenticationRequired", Value: "DisabledForLocalAddresses"},
+		},
+	},
+	"container": {
+		Description: "Leave updates to the image and don't open a browser or send analytics",
+		Values: []Override{
+			{Key: "UpdateMechanism", Value: "Docker"},
+			{Key: "LaunchBrowser", Value: "False"},
+			{Key: "AnalyticsEnabled", Value: "False"},
+		},
+	},
+}
+
+// PresetNames returns the names of the presets in sorted order.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupPreset returns the preset with the given name.
+func LookupPreset(name string) (Preset, bool) {
+	preset, exists := presets[name]
+	return preset, exists
+}
+
+// ExpandPreset returns the overrides of the named preset for the app, labeled with the
+// source "preset:<name>". The app is required by presets whose values depend on it.
+func ExpandPreset(name, app string) ([]Override, error) {
+	preset, exists := presets[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown preset %q: expected one of %s", name, strings.Join(PresetNames(), ", "))
+	}
+
+	overrides := make([]Override, len(preset.Values))
+	for i, value := range preset.Values {
+		if strings.Contains(value.Value, presetAppPlaceholder) {
+			if app == "" {
+				return nil, fmt.Errorf("preset %s needs the app, e.g. with --app", name)
+			}
+			value.Value = strings.ReplaceAll(value.Value, presetAppPlaceholder, strings.ToLower(app))
+		}
+		value.Source = "preset:" + name
+		overrides[i] = value
+	}
+	return overrides, nil
+}
@@ -0,0 +1,55 @@
+package configarr
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestExpandPreset tests expanding presets into overrides.
+func TestExpandPreset(t *testing.T) {
+	t.Run("Values with app", func(t *testing.T) {
+		overrides, err := ExpandPreset("behind-reverse-proxy", "Sonarr")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []Override{
+			{Key: "UrlBase", Value: "/sonarr", Source: "preset:behind-reverse-proxy"},
+			{Key: "BindAddress", Value: "*", Source: "preset:behind-reverse-proxy"},
+			{Key: "EnableSsl", Value: "False", Source: "preset:behind-reverse-proxy"},
+			{Key: "AuthenticationRequired", Value: "Enabled", Source: "preset:behind-reverse-proxy"},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+	})
+
+	t.Run("App required", func(t *testing.T) {
+		if _, err := ExpandPreset("behind-reverse-proxy", ""); err == nil {
+			t.Fatal("Expected error without app, but got none")
+		}
+		if _, err := ExpandPreset("local-only", ""); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Unknown preset", func(t *testing.T) {
+		if _, err := ExpandPreset("fast", "sonarr"); err == nil {
+			t.Fatal("Expected error for unknown preset, but got none")
+		}
+	})
+
+	t.Run("Presets use catalog keys", func(t *testing.T) {
+		catalog, err := LoadCatalog("", "")
+		if err != nil {
+			t.Fatalf("Unexpected error loading catalog: %v", err)
+		}
+		for _, name := range PresetNames() {
+			preset, _ := LookupPreset(name)
+			for _, value := range preset.Values {
+				if !catalog.IsKnownKey(value.Key) {
+					t.Fatalf("Preset %s sets unknown key %s", name, value.Key)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// prowlarrNotifier propagates ApiKey changes to the matching application entries of
+// a Prowlarr instance, so Prowlarr keeps talking to the app after a key rotation.
+type prowlarrNotifier struct {
+	baseURL     string
+	apiKey      string
+	application string // Name of the entry to update; entries using the old key when empty
+	client      *http.Client
+}
+
+// newProwlarrNotifier creates a notifier from a target of the form
+// <url>?apikey=<prowlarr api key>[&application=<name>].
+func newProwlarrNotifier(target string) (Notifier, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Prowlarr URL %q", target)
+	}
+
+	query := u.Query()
+	apiKey := query.Get("apikey")
+	if apiKey == "" {
+		return nil, errors.New("missing apikey parameter with the API key of Prowlarr")
+	}
+	u.RawQuery = ""
+
+	return &prowlarrNotifier{
+		baseURL:     strings.TrimSuffix(u.String(), "/"),
+		apiKey:      apiKey,
+		application: query.Get("application"),
+		client:      &http.Client{Timeout: notifyTimeout},
+	}, nil
+}
+
+// Notify updates the apiKey field of the matching application entries when the ApiKey changed.
+func (p *prowlarrNotifier) Notify(ctx context.Context, changes ChangeSet) error {
+	var change *Change
+	for i := range changes.Changes {
+		if changes.Changes[i].Key == "ApiKey" {
+			change = &changes.Changes[i]
+		}
+	}
+	if change == nil {
+		return nil
+	}
+
+	var applications []map[string]any
+	if err := p.do(ctx, http.MethodGet, "/api/v1/applications", nil, &applications); err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, application := range applications {
+		name, _ := application["name"].(string)
+		if p.application != "" && !strings.EqualFold(name, p.application) {
+			continue
+		}
+		field := applicationField(application, "apiKey")
+		if field == nil || (p.application == "" && field["value"] != change.Old) {
+			continue
+		}
+
+		field["value"] = change.Value
+		path := fmt.Sprintf("/api/v1/applications/%v", application["id"])
+		if err := p.do(ctx, http.MethodPut, path, application, nil); err != nil {
+			return fmt.Errorf("error updating Prowlarr application %s: %w", name, err)
+		}
+		updated++
+	}
+
+	if p.application != "" && updated == 0 {
+		return fmt.Errorf("no Prowlarr application named %s with an apiKey field", p.application)
+	}
+	return nil
+}
+
+// applicationField returns the field with the given name of a Prowlarr application entry.
+func applicationField(application map[string]any, name string) map[string]any {
+	fields, _ := application["fields"].([]any)
+	for _, f := range fields {
+		if field, ok := f.(map[string]any); ok && field["name"] == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// do sends a request to the Prowlarr API and decodes the JSON response into out, if given.
+func (p *prowlarrNotifier) do(ctx context.Context, method, path string, body, out any) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return fmt.Errorf("error encoding request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, &payload)
+	if err != nil {
+		return fmt.Errorf("error creating request for %s: %w", path, err)
+	}
+	req.Header.Set("X-Api-Key", p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("error sending %s %s: unexpected status %s", method, path, resp.Status)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding response of %s: %w", path, err)
+		}
+	}
+	return nil
+}
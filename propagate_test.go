@@ -0,0 +1,103 @@
+package configarr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestProwlarrNotifier tests propagating ApiKey changes to Prowlarr application entries.
+func TestProwlarrNotifier(t *testing.T) {
+	newServer := func(t *testing.T, updated map[string]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Api-Key") != "prowlarr-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				_, _ = w.Write([]byte(`[
+					{"id": 1, "name": "Sonarr", "fields": [{"name": "baseUrl", "value": "http://sonarr:8989"}, {"name": "apiKey", "value": "old"}]},
+					{"id": 2, "name": "Radarr", "fields": [{"name": "baseUrl", "value": "http://radarr:7878"}, {"name": "apiKey", "value": "other"}]}
+				]`))
+			case http.MethodPut:
+				var application map[string]any
+				if err := json.NewDecoder(r.Body).Decode(&application); err != nil {
+					t.Errorf("Unexpected error decoding body: %v", err)
+				}
+				updated[r.URL.Path] = applicationField(application, "apiKey")["value"].(string)
+				if application["name"] == nil || len(application["fields"].([]any)) == 0 {
+					t.Errorf("Expected the entry to be sent back in full, got %v", application)
+				}
+			}
+		}))
+	}
+	changes := ChangeSet{Changes: []Change{{Key: "ApiKey", Old: "old", Value: "new", Action: ActionChange}}}
+
+	t.Run("Entries using the old key", func(t *testing.T) {
+		updated := map[string]string{}
+		server := newServer(t, updated)
+		defer server.Close()
+
+		notifier, err := NewNotifier("prowlarr:" + server.URL + "?apikey=prowlarr-key")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := notifier.Notify(context.Background(), changes); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(updated) != 1 || updated["/api/v1/applications/1"] != "new" {
+			t.Fatalf("Expected only the Sonarr entry to be updated, got %v", updated)
+		}
+	})
+
+	t.Run("Named entry", func(t *testing.T) {
+		updated := map[string]string{}
+		server := newServer(t, updated)
+		defer server.Close()
+
+		notifier, err := NewNotifier("prowlarr:" + server.URL + "?apikey=prowlarr-key&application=radarr")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := notifier.Notify(context.Background(), changes); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(updated) != 1 || updated["/api/v1/applications/2"] != "new" {
+			t.Fatalf("Expected only the Radarr entry to be updated, got %v", updated)
+		}
+	})
+
+	t.Run("Unknown named entry", func(t *testing.T) {
+		server := newServer(t, map[string]string{})
+		defer server.Close()
+
+		notifier, err := NewNotifier("prowlarr:" + server.URL + "?apikey=prowlarr-key&application=lidarr")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := notifier.Notify(context.Background(), changes); err == nil {
+			t.Fatal("Expected error for unknown application, but got none")
+		}
+	})
+
+	t.Run("Other changes are ignored", func(t *testing.T) {
+		notifier, err := NewNotifier("prowlarr:http://127.0.0.1:0?apikey=prowlarr-key")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := notifier.Notify(context.Background(), ChangeSet{Changes: []Change{{Key: "Port", Value: "9000"}}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Missing API key", func(t *testing.T) {
+		if _, err := NewNotifier("prowlarr:http://prowlarr:9696"); err == nil {
+			t.Fatal("Expected error for missing apikey, but got none")
+		}
+	})
+}
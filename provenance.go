@@ -0,0 +1,156 @@
+package configarr
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SourceFile is the source reported for values that configarr did not write, or
+// that were changed by someone else since.
+const SourceFile = "file"
+
+// provenanceKeySuffix is appended to the name of the state file to name the file holding
+// the key of the value hashes, see ProvenanceEntry.
+const provenanceKeySuffix = ".key"
+
+// Provenance records which source last set each key of the configuration files,
+// so the origin of the current values can be shown later.
+type Provenance struct {
+	Files map[string]map[string]ProvenanceEntry `json:"files"` // Keyed by cleaned configuration file path, then property
+
+	key    []byte // Key of the value hashes
+	newKey bool   // Whether the key was generated and still has to be saved
+}
+
+// ProvenanceEntry records a single value written by configarr.
+type ProvenanceEntry struct {
+	Source string    `json:"source"`
+	Hash   string    `json:"hash"` // HMAC-SHA-256 of the written value, see hashValue
+	Time   time.Time `json:"time"`
+}
+
+// LoadProvenance reads the state file and the key of its value hashes, which is kept in
+// the file of the same name with .key appended, readable by its owner only. A missing
+// file yields an empty provenance; a missing key is generated and saved with the state.
+func LoadProvenance(stateFile string) (*Provenance, error) {
+	provenance := &Provenance{Files: make(map[string]map[string]ProvenanceEntry)}
+
+	keyFile := stateFile + provenanceKeySuffix
+	if data, err := os.ReadFile(keyFile); err == nil {
+		if provenance.key, err = hex.DecodeString(string(bytes.TrimSpace(data))); err != nil || len(provenance.key) == 0 {
+			return nil, fmt.Errorf("invalid key in %s: expected hex", keyFile)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading key of state file %s: %w", keyFile, err)
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return provenance, nil
+		}
+		return nil, fmt.Errorf("error reading state file %s: %w", stateFile, err)
+	}
+
+	if err := json.Unmarshal(data, provenance); err != nil {
+		return nil, fmt.Errorf("error parsing state file %s: %w", stateFile, err)
+	}
+	if provenance.Files == nil {
+		provenance.Files = make(map[string]map[string]ProvenanceEntry)
+	}
+	return provenance, nil
+}
+
+// Save writes the state file, and its key if it was generated, creating their directory
+// if needed.
+func (p *Provenance) Save(stateFile string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0755); err != nil {
+		return fmt.Errorf("error creating directory of state file %s: %w", stateFile, err)
+	}
+	if p.newKey {
+		keyFile := stateFile + provenanceKeySuffix
+		if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(p.key)+"\n"), 0600); err != nil {
+			return fmt.Errorf("error writing key of state file %s: %w", keyFile, err)
+		}
+		p.newKey = false
+	}
+	if err := os.WriteFile(stateFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing state file %s: %w", stateFile, err)
+	}
+	return nil
+}
+
+// Record stores the sources of the changes written to a configuration file at the given
+// time. Without a key, one is read from the random source first, e.g. SystemRandom().
+func (p *Provenance) Record(changes ChangeSet, now time.Time, random io.Reader) error {
+	if len(changes.Changes) == 0 {
+		return nil
+	}
+
+	if p.key == nil {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(random, key); err != nil {
+			return fmt.Errorf("error generating key of state file: %w", err)
+		}
+		p.key, p.newKey = key, true
+	}
+
+	configPath := filepath.Clean(changes.ConfigPath)
+	entries := p.Files[configPath]
+	if entries == nil {
+		entries = make(map[string]ProvenanceEntry)
+		p.Files[configPath] = entries
+	}
+	for _, change := range changes.Changes {
+		entries[change.Key] = ProvenanceEntry{Source: change.Source, Hash: p.hashValue(change.Value), Time: now.UTC()}
+	}
+	return nil
+}
+
+// SourceOf returns the recorded source of a property's current value, or SourceFile
+// when configarr didn't write it or the value was changed since.
+func (p *Provenance) SourceOf(configPath, key, value string) string {
+	entry, exists := p.Files[filepath.Clean(configPath)][key]
+	if !exists || entry.Hash == "" || entry.Hash != p.hashValue(value) || entry.Source == "" {
+		return SourceFile
+	}
+	return entry.Source
+}
+
+// hashValue returns the hex-encoded HMAC-SHA-256 of the value with the key of the state
+// file, or the empty string without a key. Unlike a plain hash, it can't be used to
+// guess secrets, e.g. short passwords, without the key.
+func (p *Provenance) hashValue(value string) string {
+	if p.key == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordProvenance adds the changes written at the given time to the state file.
+func recordProvenance(stateFile string, changes ChangeSet, now time.Time, random io.Reader) error {
+	provenance, err := LoadProvenance(stateFile)
+	if err != nil {
+		return err
+	}
+	if err := provenance.Record(changes, now, random); err != nil {
+		return err
+	}
+	return provenance.Save(stateFile)
+}
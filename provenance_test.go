@@ -0,0 +1,132 @@
+package configarr
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// TestProvenance tests recording and looking up the sources of written values.
+func TestProvenance(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	provenance, err := LoadProvenance(stateFile)
+	if err != nil {
+		t.Fatalf("Unexpected error loading missing state file: %v", err)
+	}
+	err = provenance.Record(ChangeSet{ConfigPath: "config.xml", Changes: []Change{
+		{Key: "Port", Value: "9000", Source: "env:CONFIGARR__PORT"},
+		{Key: "ApiKey", Value: "secret", Source: "yaml:values.yaml"},
+	}}, time.Now(), SystemRandom())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := provenance.Save(stateFile); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Fatalf("Expected values not to be stored, got %s", data)
+	}
+
+	loaded, err := LoadProvenance(stateFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		key, value, expected string
+	}{
+		{"Port", "9000", "env:CONFIGARR__PORT"},
+		{"ApiKey", "secret", "yaml:values.yaml"},
+		{"Port", "9001", SourceFile}, // Changed by someone else since
+		{"LogLevel", "info", SourceFile},
+	}
+	for _, tt := range tests {
+		if source := loaded.SourceOf("config.xml", tt.key, tt.value); source != tt.expected {
+			t.Fatalf("Expected source of %s=%s to be %s, got %s", tt.key, tt.value, tt.expected, source)
+		}
+	}
+
+	t.Run("Keyed hashes", func(t *testing.T) {
+		sum := sha256.Sum256([]byte("secret"))
+		if strings.Contains(string(data), hex.EncodeToString(sum[:])) {
+			t.Fatalf("Expected no plain hash of the secret, got %s", data)
+		}
+		info, err := os.Stat(stateFile + provenanceKeySuffix)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+			t.Fatalf("Expected the key to be readable by its owner only, got %v", info.Mode().Perm())
+		}
+	})
+
+	t.Run("Missing key", func(t *testing.T) {
+		if err := os.Remove(stateFile + provenanceKeySuffix); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		loaded, err := LoadProvenance(stateFile)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if source := loaded.SourceOf("config.xml", "Port", "9000"); source != SourceFile {
+			t.Fatalf("Expected values hashed with another key to come from %s, got %s", SourceFile, source)
+		}
+	})
+
+	t.Run("Failing random source", func(t *testing.T) {
+		provenance := &Provenance{Files: make(map[string]map[string]ProvenanceEntry)}
+		changes := ChangeSet{ConfigPath: "config.xml", Changes: []Change{{Key: "Port", Value: "9000", Source: "env:CONFIGARR__PORT"}}}
+		if err := provenance.Record(changes, time.Now(), iotest.ErrReader(errors.New("no entropy"))); err == nil || !strings.Contains(err.Error(), "no entropy") {
+			t.Fatalf("Expected the error of the random source, got %v", err)
+		}
+		if len(provenance.Files) != 0 {
+			t.Fatalf("Expected nothing to be recorded without a key, got %v", provenance.Files)
+		}
+	})
+}
+
+// TestRun_StateFile tests that Run records the sources of written changes, with the key
+// from the random source.
+func TestRun_StateFile(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.xml")
+	stateFile := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(configFile, []byte("<Config><Port>8989</Port></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	_, err := Run(context.Background(),
+		WithConfigPath(configFile),
+		WithSources(EnvSource([]string{"CONFIGARR__PORT=Port=9000"}, DefaultPrefix)),
+		WithStateFile(stateFile),
+		WithRandom(FixedRandom([]byte{7})),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(stateFile + provenanceKeySuffix); string(data) != strings.Repeat("07", 32)+"\n" {
+		t.Fatalf("Expected the key from the random source, got %q", data)
+	}
+
+	provenance, err := LoadProvenance(stateFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if source := provenance.SourceOf(configFile, "Port", "9000"); source != "env:CONFIGARR__PORT" {
+		t.Fatalf("Expected source env:CONFIGARR__PORT, got %s", source)
+	}
+}
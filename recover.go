@@ -0,0 +1,73 @@
+package configarr
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// isEmptyDocument reports whether the content is empty but for a byte order mark and
+// whitespace, as left by an app that crashed while writing its configuration file.
+func isEmptyDocument(data []byte) bool {
+	return len(bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM))) == 0
+}
+
+// describeEmpty describes what an empty document holds, e.g. "0 bytes".
+func describeEmpty(data []byte) string {
+	switch {
+	case len(data) == 0:
+		return "0 bytes"
+	case bytes.HasPrefix(data, utf8BOM) && len(data) == len(utf8BOM):
+		return "only a byte order mark"
+	}
+	return fmt.Sprintf("%d bytes of whitespace", len(data))
+}
+
+// recoverEmptyConfig handles a configuration file that is empty, see isEmptyDocument.
+// Without WithRecoverEmpty, it fails with ErrEmptyConfig. Otherwise it returns the
+// configuration to seed the file with, and where it came from: the newest backup that
+// isn't empty, see WithBackups, the template, or for XML files a document with the
+// default port of the app from the catalog, see DetectApp.
+func recoverEmptyConfig(data []byte, o options) (*Config, string, error) {
+	if !o.recoverEmpty {
+		return nil, "", categorize(ErrParse, fmt.Errorf("%w: %s holds %s, e.g. after the app crashed while writing it", ErrEmptyConfig, o.configPath, describeEmpty(data)))
+	}
+	format := o.configFormat()
+
+	backups, _ := listBackups(o.fs, o.configPath) // Recovery goes on without backups
+	// Newest first
+	for i := len(backups) - 1; i >= 0; i-- {
+		backup := backups[i]
+		content, err := fs.ReadFile(o.fs, backup)
+		if err != nil || isEmptyDocument(content) {
+			continue
+		}
+		if config, err := format.Parse(content); err == nil {
+			return config, "backup " + backup, nil
+		}
+	}
+
+	if o.recoverTemplate != "" {
+		content, err := os.ReadFile(o.recoverTemplate)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading template %s: %w", o.recoverTemplate, err)
+		}
+		config, err := format.Parse(content)
+		if err != nil {
+			return nil, "", fmt.Errorf("error parsing template %s: %w", o.recoverTemplate, err)
+		}
+		return config, "template " + o.recoverTemplate, nil
+	}
+
+	if format != XMLFormat {
+		return nil, "", categorize(ErrParse, fmt.Errorf("%w: %s holds %s and there is neither a backup nor a template to recover it from", ErrEmptyConfig, o.configPath, describeEmpty(data)))
+	}
+	content, from := "<Config>\n</Config>\n", "an empty document"
+	if app := DetectApp(o.configPath, &Config{Properties: map[string]string{}}, o.catalog); app != "" && o.catalog.Apps[app].DefaultPort > 0 {
+		content = fmt.Sprintf("<Config>\n  <Port>%d</Port>\n</Config>\n", o.catalog.Apps[app].DefaultPort)
+		from = "the catalog defaults of " + app
+	}
+	config, err := ParseConfig([]byte(content))
+	return config, from, err
+}
@@ -0,0 +1,81 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestRun_RecoverEmpty tests that empty configuration files are refused, or seeded from
+// a backup, a template or the catalog defaults with recovery.
+func TestRun_RecoverEmpty(t *testing.T) {
+	env := WithSources(StaticSource(Override{Key: "LogLevel", Value: "debug", Create: true}))
+
+	t.Run("Refused without recovery", func(t *testing.T) {
+		fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: utf8BOM}}}
+		_, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithReadRetries(0, 0), env)
+		if !errors.Is(err, ErrEmptyConfig) || !errors.Is(err, ErrParse) || !strings.Contains(err.Error(), "only a byte order mark") {
+			t.Fatalf("Expected an empty configuration error, got: %v", err)
+		}
+		if string(fsys.MapFS["config.xml"].Data) != string(utf8BOM) {
+			t.Fatalf("Expected the file to be left alone, got %q", fsys.MapFS["config.xml"].Data)
+		}
+	})
+
+	t.Run("Newest backup that isn't empty", func(t *testing.T) {
+		fsys := mapFS{fstest.MapFS{
+			"config.xml":                          &fstest.MapFile{},
+			"config.xml.bak.20240101T000000.000Z": &fstest.MapFile{Data: []byte("<Config><Port>8990</Port></Config>")},
+			"config.xml.bak.20240102T000000.000Z": &fstest.MapFile{Data: []byte("\n")},
+		}}
+		result, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithReadRetries(0, 0), WithRecoverEmpty(""), env)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Recovered != "backup config.xml.bak.20240101T000000.000Z" || len(result.Warnings) != 1 || result.Warnings[0].Code != WarningRecovered {
+			t.Fatalf("Expected recovery from the older backup with a warning, got %q and %+v", result.Recovered, result.Warnings)
+		}
+		written := string(fsys.MapFS["config.xml"].Data)
+		if !strings.Contains(written, "<Port>8990</Port>") || !strings.Contains(written, "<LogLevel>debug</LogLevel>") {
+			t.Fatalf("Expected the backup with the override, got: %s", written)
+		}
+	})
+
+	t.Run("Template", func(t *testing.T) {
+		template := filepath.Join(t.TempDir(), "template.xml")
+		if err := os.WriteFile(template, []byte("<Config><Port>7878</Port></Config>"), 0600); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{}}}
+		result, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithReadRetries(0, 0), WithRecoverEmpty(template))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Recovered != "template "+template || string(fsys.MapFS["config.xml"].Data) != "<Config><Port>7878</Port></Config>" {
+			t.Fatalf("Expected the template to be written unchanged, got %q from %q", fsys.MapFS["config.xml"].Data, result.Recovered)
+		}
+	})
+
+	t.Run("Catalog defaults", func(t *testing.T) {
+		fsys := mapFS{fstest.MapFS{"sonarr/config.xml": &fstest.MapFile{Data: []byte(" \n")}}}
+		result, err := Run(context.Background(), WithFS(fsys), WithConfigPath("sonarr/config.xml"), WithReadRetries(0, 0), WithRecoverEmpty(""), env)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := "<Config>\n  <Port>8989</Port>\n  <LogLevel>debug</LogLevel>\n</Config>\n"; result.Recovered != "the catalog defaults of sonarr" || string(fsys.MapFS["sonarr/config.xml"].Data) != expected {
+			t.Fatalf("Expected %q from the catalog defaults, got %q from %q", expected, fsys.MapFS["sonarr/config.xml"].Data, result.Recovered)
+		}
+	})
+
+	t.Run("Nothing to recover other formats from", func(t *testing.T) {
+		fsys := mapFS{fstest.MapFS{"settings.json": &fstest.MapFile{}}}
+		_, err := Run(context.Background(), WithFS(fsys), WithConfigPath("settings.json"), WithReadRetries(0, 0), WithRecoverEmpty(""))
+		if !errors.Is(err, ErrEmptyConfig) {
+			t.Fatalf("Expected an empty configuration error, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,392 @@
+package configarr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RenderOptions controls the layout of rendered documents.
+type RenderOptions struct {
+	Compact  bool   // Emit the whole document on a single line
+	Indent   string // Indentation per nesting level when not compact
+	Reformat bool   // Re-marshal XML documents with Indent instead of only changing the modified lines
+	CDATA    bool   // Write XML values holding markup characters (<, > or &) as CDATA sections
+}
+
+// withRenderOptions returns a shallow copy of the configuration rendering its values as
+// selected by the options.
+func (c *Config) withRenderOptions(opts RenderOptions) *Config {
+	rendered := *c
+	rendered.cdata = opts.CDATA
+	return &rendered
+}
+
+// preserveSource renders the XML configuration by splicing the changes into its original
+// document, so comments, processing instructions and the whitespace around untouched
+// elements are kept. Documents without a source, and compact or reformatted output, are
+// re-marshalled.
+func preserveSource(config *Config, opts RenderOptions) ([]byte, error) {
+	config = config.withRenderOptions(opts)
+	if config.source == nil || opts.Compact || opts.Reformat || bytes.HasSuffix(config.source[:config.opening], []byte("/>")) {
+		return renderConfig(config, opts) // No source, or a self-closing root element
+	}
+	changed, err := sourceChanges(config)
+	if err != nil {
+		return nil, err
+	}
+	return patchConfig(config, changed)
+}
+
+// sourceChanges returns the properties created, changed or deleted since the
+// configuration was parsed from its source, with their new values.
+func sourceChanges(config *Config) (map[string]string, error) {
+	var original Config
+	if err := parseXML(config.source, &original); err != nil {
+		return nil, fmt.Errorf("error parsing original document: %w", err)
+	}
+	changed := make(map[string]string)
+	for key, value := range config.Properties {
+		if current, exists := original.Properties[key]; !exists || current != value {
+			changed[key] = value
+		}
+	}
+	for key := range original.Properties {
+		if _, exists := config.Properties[key]; !exists {
+			changed[key] = ""
+		}
+	}
+	return changed, nil
+}
+
+// renderConfig renders the Config, including its prolog and epilog, as an XML document.
+func renderConfig(config *Config, opts RenderOptions) ([]byte, error) {
+	config = config.withRenderOptions(opts)
+	indent, separator := opts.Indent, "\n"
+	if opts.Compact {
+		indent, separator = "", ""
+	}
+
+	var output bytes.Buffer
+	for _, token := range config.Prolog {
+		if err := writeToken(&output, token); err != nil {
+			return nil, fmt.Errorf("error marshalling XML: %w", err)
+		}
+		output.WriteString(separator)
+	}
+
+	var body []byte
+	var err error
+	if indent == "" {
+		body, err = xml.Marshal(config)
+	} else {
+		body, err = xml.MarshalIndent(config, "", indent)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling XML: %w", err)
+	}
+	output.Write(body)
+
+	for _, token := range config.Epilog {
+		output.WriteString(separator)
+		if err := writeToken(&output, token); err != nil {
+			return nil, fmt.Errorf("error marshalling XML: %w", err)
+		}
+	}
+
+	return output.Bytes(), nil
+}
+
+// Final newline modes controlling whether written files end with a newline.
+const (
+	FinalNewlineAlways   = "always"
+	FinalNewlineNever    = "never"
+	FinalNewlinePreserve = "preserve"
+)
+
+// applyFinalNewline adds or strips the trailing newline of output according to mode.
+// In preserve mode the convention of the original document is kept.
+func applyFinalNewline(output, source []byte, mode string) []byte {
+	if mode == FinalNewlinePreserve {
+		mode = FinalNewlineNever
+		if bytes.HasSuffix(source, []byte("\n")) {
+			mode = FinalNewlineAlways
+		}
+	}
+
+	switch mode {
+	case FinalNewlineAlways:
+		if !bytes.HasSuffix(output, []byte("\n")) {
+			output = append(output, '\n')
+		}
+	case FinalNewlineNever:
+		output = bytes.TrimRight(output, "\r\n")
+	}
+	return output
+}
+
+// utf8BOM is the byte order mark some apps, e.g. those built on .NET, write at the start
+// of their files.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// applySourceConventions gives output the byte order mark and the CRLF line endings of
+// the source, if it has them, so a rewrite only differs from it in the changed lines.
+func applySourceConventions(output, source []byte) []byte {
+	if bytes.HasPrefix(source, utf8BOM) && !bytes.HasPrefix(output, utf8BOM) {
+		output = append(bytes.Clone(utf8BOM), output...)
+	}
+	if newline := bytes.IndexByte(source, '\n'); newline > 0 && source[newline-1] == '\r' {
+		output = bytes.ReplaceAll(bytes.ReplaceAll(output, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+	return output
+}
+
+// verifyFidelity ensures that output differs from source only inside the elements
+// listed in changed. Everything else, including whitespace, must be byte-identical.
+func verifyFidelity(source, output []byte, changed map[string]string) error {
+	before, err := untouchedContent(source, changed)
+	if err != nil {
+		return fmt.Errorf("error parsing original document: %w", err)
+	}
+	after, err := untouchedContent(output, changed)
+	if err != nil {
+		return fmt.Errorf("error parsing rendered document: %w", err)
+	}
+
+	if !bytes.Equal(before, after) {
+		return fmt.Errorf("rewrite would modify content outside of the changed elements")
+	}
+	return nil
+}
+
+// untouchedContent returns data with the byte ranges of the changed elements cut out.
+func untouchedContent(data []byte, changed map[string]string) ([]byte, error) {
+	var cfg Config
+	if err := parseXML(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	var removed []span
+	for key := range changed {
+		removed = append(removed, cfg.spans[key]...)
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].start < removed[j].start })
+
+	var content bytes.Buffer
+	var last int64
+	for _, s := range removed {
+		content.Write(data[last:lineStart(data, s.start)])
+		last = s.end
+	}
+	content.Write(data[last:])
+
+	return content.Bytes(), nil
+}
+
+// lineStart returns the start of the line of the element starting at start when only
+// indentation precedes it, so removing the element doesn't leave an empty line behind.
+func lineStart(data []byte, start int64) int64 {
+	i := start
+	for i > 0 && (data[i-1] == ' ' || data[i-1] == '\t') {
+		i--
+	}
+	if i == 0 || data[i-1] != '\n' {
+		return start
+	}
+	i--
+	if i > 0 && data[i-1] == '\r' {
+		i--
+	}
+	return i
+}
+
+// patchConfig splices the new values of the changed elements into the original
+// document instead of re-marshalling it, so every other byte stays untouched.
+// Elements of deleted properties are cut out together with their line; elements of
+// created properties are added after the last element, indented like it.
+func patchConfig(config *Config, changed map[string]string) ([]byte, error) {
+	type patch struct {
+		key string
+		span
+	}
+
+	var patches []patch
+	for key := range changed {
+		spans := config.spans[key]
+		if _, created := config.Properties[key]; created && len(spans) == 0 {
+			continue // Added by createdElements
+		}
+		if len(spans) == 0 {
+			return nil, fmt.Errorf("cannot patch %s: element not found in original document", key)
+		}
+		for _, s := range spans {
+			patches = append(patches, patch{key: key, span: s})
+		}
+	}
+	sort.Slice(patches, func(i, j int) bool { return patches[i].start < patches[j].start })
+
+	insertions, err := createdElements(config, changed)
+	if err != nil {
+		return nil, err
+	}
+
+	source := config.source
+	var output bytes.Buffer
+	var last int64
+	insert := func(until int64) {
+		for len(insertions) > 0 && insertions[0].at <= until {
+			output.Write(source[last:insertions[0].at])
+			output.Write(insertions[0].text)
+			last, insertions = insertions[0].at, insertions[1:]
+		}
+	}
+	for _, p := range patches {
+		insert(p.start)
+		if _, kept := config.Properties[p.key]; !kept { // Deleted property
+			output.Write(source[last:max(last, lineStart(source, p.start))])
+			last = p.end
+			continue
+		}
+
+		value, err := config.encodeValue(p.key)
+		if err != nil {
+			return nil, err
+		}
+
+		element := source[p.start:p.end]
+		if p.content == p.end { // Self-closing element such as <UrlBase />
+			startTag := bytes.TrimSuffix(bytes.TrimRight(element, " \t\r\n"), []byte("/>"))
+			output.Write(source[last:p.start])
+			output.Write(bytes.TrimRight(startTag, " \t\r\n"))
+			output.WriteByte('>')
+			output.Write(value)
+			output.WriteString("</" + elementName(config.elementPath(p.key)) + ">")
+		} else {
+			endTag := p.start + int64(bytes.LastIndexByte(element, '<'))
+			output.Write(source[last:p.content])
+			output.Write(value)
+			output.Write(source[endTag:p.end])
+		}
+		last = p.end
+	}
+
+	insert(int64(len(source)))
+	output.Write(source[last:])
+
+	return output.Bytes(), nil
+}
+
+// insertion is content added to the original document at an offset.
+type insertion struct {
+	at   int64
+	text []byte
+}
+
+// createdElements encodes the elements of the changed properties missing from the
+// original document. They go after the last element of their deepest existing parent, or
+// of the root element, in the order of the keys, each on a line of its own with the
+// indentation of that element; parents missing as well are created.
+func createdElements(config *Config, changed map[string]string) ([]insertion, error) {
+	type group struct {
+		parent string
+		depth  int // Number of elements in the path of the parent
+		keys   []string
+	}
+	var groups []*group
+	for _, key := range config.Keys {
+		_, exists := config.Properties[key]
+		if _, change := changed[key]; !change || !exists || len(config.spans[key]) > 0 {
+			continue
+		}
+		parent, depth := config.existingParent(key)
+		i := slices.IndexFunc(groups, func(g *group) bool { return g.parent == parent })
+		if i < 0 {
+			groups = append(groups, &group{parent: parent, depth: depth})
+			i = len(groups) - 1
+		}
+		groups[i].keys = append(groups[i].keys, key)
+	}
+
+	_, unit := config.insertionPoint("")
+	var insertions []insertion
+	for _, g := range groups {
+		at, indent := config.insertionPoint(g.parent)
+		var output bytes.Buffer
+		output.WriteString("\n")
+		e := xml.NewEncoder(&output)
+		e.Indent(indent, unit)
+		if err := config.encodeElements(e, config.elementTree(g.keys, g.depth), g.parent, make(map[string]bool)); err != nil {
+			return nil, err
+		}
+		if err := e.Flush(); err != nil {
+			return nil, fmt.Errorf("error encoding XML element: %w", err)
+		}
+		if g.parent == "" && at == config.opening && !bytes.ContainsRune(config.source[config.opening:config.closing], '\n') {
+			output.WriteString("\n") // Keep the end tag of the root element on a line of its own
+		}
+		insertions = append(insertions, insertion{at: at, text: output.Bytes()})
+	}
+	sort.Slice(insertions, func(i, j int) bool { return insertions[i].at < insertions[j].at })
+	return insertions, nil
+}
+
+// existingParent returns the path of the deepest parent of the key in the original
+// document and the number of elements in it, or an empty path for the root element.
+func (c *Config) existingParent(key string) (string, int) {
+	path := c.elementPath(key)
+	for depth := len(path) - 1; depth > 0; depth-- {
+		if parent := strings.Join(path[:depth], "."); len(c.parents[parent]) > 0 {
+			return parent, depth
+		}
+	}
+	return "", 0
+}
+
+// insertionPoint returns the end of the last element in the parent, the root element
+// for an empty path, and the indentation of its line, or a tab when there is none.
+func (c *Config) insertionPoint(parent string) (int64, string) {
+	start, end := c.opening, c.closing
+	if parent != "" {
+		s := c.parents[parent][len(c.parents[parent])-1]
+		start, end = s.content, s.end
+	}
+
+	after := start
+	for _, elements := range []map[string][]span{c.spans, c.parents} {
+		for _, spans := range elements {
+			for _, s := range spans {
+				if s.start >= start && s.end <= end {
+					after = max(after, s.end)
+				}
+			}
+		}
+	}
+	if after == start {
+		return after, "\t"
+	}
+	line := c.source[:after]
+	line = line[bytes.LastIndexByte(line, '\n')+1:]
+	return after, string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// writeConfigToFile writes the updated Config map back to the XML file.
+func writeConfigToFile(config *Config, xmlFile string) error {
+	output, err := renderConfig(config, RenderOptions{Indent: DefaultIndent})
+	if err != nil {
+		return err
+	}
+
+	return writeOutputToFile(OSFS(), output, xmlFile)
+}
+
+// writeOutputToFile writes a rendered document to the configuration file.
+func writeOutputToFile(fsys FS, output []byte, xmlFile string) error {
+	if err := fsys.WriteFile(xmlFile, output, 0644); err != nil {
+		return fmt.Errorf("error writing file %s: %w", xmlFile, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,334 @@
+package configarr
+
+import (
+	"encoding/xml"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestWriteConfigToFile tests writing the configuration back to the XML file.
+func TestWriteConfigToFile(t *testing.T) {
+	t.Run("Write to XML File", func(t *testing.T) {
+		config := &Config{
+			Properties: map[string]string{
+				"Theme":    "dark",
+				"LogLevel": "info",
+			},
+			Keys: []string{"Theme", "LogLevel"},
+		}
+
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if err := writeConfigToFile(config, file.Name()); err != nil {
+			t.Fatalf("Unexpected error writing to XML file: %v", err)
+		}
+
+		content, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading written file: %v", err)
+		}
+
+		expectedXML := `<Config>
+  <Theme>dark</Theme>
+  <LogLevel>info</LogLevel>
+</Config>`
+		if string(content) != expectedXML {
+			t.Fatalf("Expected XML %s, got %s", expectedXML, string(content))
+		}
+	})
+}
+
+// TestWriteConfigToFile_KeepsTokens tests that non-element tokens are written back verbatim.
+func TestWriteConfigToFile_KeepsTokens(t *testing.T) {
+	t.Run("Round-trip XML declaration, DOCTYPE and processing instructions", func(t *testing.T) {
+		content := `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE Config>
+<Config>
+  <?app-hint keep?><LogLevel>info</LogLevel><?trailing pi?>
+</Config>
+<?after root?>`
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatalf("Unexpected error writing to temp file: %v", err)
+		}
+		file.Close()
+
+		config, err := ReadConfigFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading XML: %v", err)
+		}
+
+		if err := writeConfigToFile(config, file.Name()); err != nil {
+			t.Fatalf("Unexpected error writing to XML file: %v", err)
+		}
+
+		written, err := os.ReadFile(file.Name())
+		if err != nil {
+			t.Fatalf("Unexpected error reading written file: %v", err)
+		}
+
+		expectedXML := `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE Config>
+<Config><?app-hint keep?>
+  <LogLevel>info</LogLevel><?trailing pi?>
+</Config>
+<?after root?>`
+		if string(written) != expectedXML {
+			t.Fatalf("Expected XML %s, got %s", expectedXML, string(written))
+		}
+	})
+}
+
+// TestRenderConfig tests the compact and pretty output layouts.
+func TestRenderConfig(t *testing.T) {
+	config := &Config{
+		Properties: map[string]string{"LogLevel": "info", "Theme": "dark"},
+		Keys:       []string{"LogLevel", "Theme"},
+		Prolog:     []xml.Token{xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0"`)}},
+	}
+
+	tests := []struct {
+		name     string
+		opts     RenderOptions
+		expected string
+	}{
+		{"Compact", RenderOptions{Compact: true, Indent: "  "}, `<?xml version="1.0"?><Config><LogLevel>info</LogLevel><Theme>dark</Theme></Config>`},
+		{"Pretty with tabs", RenderOptions{Indent: "\t"}, "<?xml version=\"1.0\"?>\n<Config>\n\t<LogLevel>info</LogLevel>\n\t<Theme>dark</Theme>\n</Config>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := renderConfig(config, tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Fatalf("Expected %q, got %q", tt.expected, string(output))
+			}
+		})
+	}
+}
+
+// TestApplyFinalNewline tests adding, stripping and preserving the trailing newline.
+func TestApplyFinalNewline(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		source   string
+		mode     string
+		expected string
+	}{
+		{"Always adds newline", "<Config/>", "<Config/>", FinalNewlineAlways, "<Config/>\n"},
+		{"Always keeps newline", "<Config/>\n", "<Config/>", FinalNewlineAlways, "<Config/>\n"},
+		{"Never strips newline", "<Config/>\r\n", "<Config/>\n", FinalNewlineNever, "<Config/>"},
+		{"Preserve without newline", "<Config/>\n", "<Config/>", FinalNewlinePreserve, "<Config/>"},
+		{"Preserve with newline", "<Config/>", "<Config/>\n", FinalNewlinePreserve, "<Config/>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := applyFinalNewline([]byte(tt.output), []byte(tt.source), tt.mode)
+			if string(output) != tt.expected {
+				t.Fatalf("Expected %q, got %q", tt.expected, string(output))
+			}
+		})
+	}
+}
+
+// TestApplySourceConventions tests that the byte order mark and CRLF line endings of the
+// source are kept.
+func TestApplySourceConventions(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		source   string
+		expected string
+	}{
+		{"Plain source", "<Config>\n</Config>\n", "<Config>\n</Config>\n", "<Config>\n</Config>\n"},
+		{"Byte order mark", "<?xml version=\"1.0\"?>\n<Config/>", "\xef\xbb\xbf<?xml version=\"1.0\"?>\n<Config/>", "\xef\xbb\xbf<?xml version=\"1.0\"?>\n<Config/>"},
+		{"CRLF line endings", "<Config>\n  <Port>1</Port>\n</Config>\n", "<Config>\r\n</Config>\r\n", "<Config>\r\n  <Port>1</Port>\r\n</Config>\r\n"},
+		{"Already converted", "\xef\xbb\xbf<Config>\r\n</Config>", "\xef\xbb\xbf<Config>\r\n</Config>", "\xef\xbb\xbf<Config>\r\n</Config>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := applySourceConventions([]byte(tt.output), []byte(tt.source))
+			if string(output) != tt.expected {
+				t.Fatalf("Expected %q, got %q", tt.expected, string(output))
+			}
+		})
+	}
+}
+
+// TestVerifyFidelity tests that only changed elements may differ between source and output.
+func TestVerifyFidelity(t *testing.T) {
+	source := []byte("<Config>\n  <LogLevel>info</LogLevel>\n  <Theme>dark</Theme>\n</Config>")
+
+	t.Run("Only changed element differs", func(t *testing.T) {
+		output := []byte("<Config>\n  <LogLevel>debug</LogLevel>\n  <Theme>dark</Theme>\n</Config>")
+		if err := verifyFidelity(source, output, map[string]string{"LogLevel": "debug"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Untouched content differs", func(t *testing.T) {
+		output := []byte("<Config>\n\t<LogLevel>debug</LogLevel>\n\t<Theme>dark</Theme>\n</Config>")
+		if err := verifyFidelity(source, output, map[string]string{"LogLevel": "debug"}); err == nil {
+			t.Fatal("Expected error for modified whitespace, but got none")
+		}
+	})
+}
+
+// TestPatchConfig tests splicing changed values into the original document.
+func TestPatchConfig(t *testing.T) {
+	t.Run("Patch values and keep formatting", func(t *testing.T) {
+		source := "<?xml version=\"1.0\"?>\r\n<Config>\r\n\t<LogLevel >info</LogLevel >\r\n\t<UrlBase />\r\n\t<Theme>dark</Theme>\r\n</Config>"
+		var config Config
+		if err := parseXML([]byte(source), &config); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		config.source = []byte(source)
+		config.Properties["LogLevel"] = "debug"
+		config.Properties["UrlBase"] = "/a&b"
+
+		output, err := patchConfig(&config, map[string]string{"LogLevel": "debug", "UrlBase": "/a&b"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := "<?xml version=\"1.0\"?>\r\n<Config>\r\n\t<LogLevel >debug</LogLevel >\r\n\t<UrlBase>/a&amp;b</UrlBase>\r\n\t<Theme>dark</Theme>\r\n</Config>"
+		if string(output) != expected {
+			t.Fatalf("Expected %q, got %q", expected, string(output))
+		}
+	})
+
+	t.Run("Error on unknown element", func(t *testing.T) {
+		var config Config
+		if err := parseXML([]byte("<Config><LogLevel>info</LogLevel></Config>"), &config); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if _, err := patchConfig(&config, map[string]string{"Missing": "x"}); err == nil {
+			t.Fatal("Expected error for unknown element, but got none")
+		}
+	})
+}
+
+// TestRender_CDATA tests that values holding markup round-trip escaped or as CDATA
+// sections, which are kept from the original document.
+func TestRender_CDATA(t *testing.T) {
+	source := "<Config>\n  <Password><![CDATA[p<w]]></Password>\n  <ConnectionString>a</ConnectionString>\n  <UrlBase>/</UrlBase>\n</Config>\n"
+	values := map[string]string{
+		"Password":         "n&w]]>pw",
+		"ConnectionString": "Host=db;Password=<x>&y",
+		"UrlBase":          "/a\r\nb",
+		"Created":          "line 1\nline 2 & more",
+	}
+
+	for _, tt := range []struct {
+		name     string
+		opts     RenderOptions
+		expected string
+	}{
+		{
+			name:     "Escaped",
+			expected: "<Config>\n  <Password><![CDATA[n&w]]]]><![CDATA[>pw]]></Password>\n  <ConnectionString>Host=db;Password=&lt;x&gt;&amp;y</ConnectionString>\n  <UrlBase>/a&#xD;&#xA;b</UrlBase>\n  <Created>line 1&#xA;line 2 &amp; more</Created>\n</Config>\n",
+		},
+		{
+			name:     "CDATA",
+			opts:     RenderOptions{CDATA: true},
+			expected: "<Config>\n  <Password><![CDATA[n&w]]]]><![CDATA[>pw]]></Password>\n  <ConnectionString><![CDATA[Host=db;Password=<x>&y]]></ConnectionString>\n  <UrlBase>/a&#xD;&#xA;b</UrlBase>\n  <Created><![CDATA[line 1\nline 2 & more]]></Created>\n</Config>\n",
+		},
+		{
+			name:     "Reformat",
+			opts:     RenderOptions{Reformat: true, Indent: "  "},
+			expected: "<Config>\n  <Password><![CDATA[n&w]]]]><![CDATA[>pw]]></Password>\n  <ConnectionString>Host=db;Password=&lt;x&gt;&amp;y</ConnectionString>\n  <UrlBase>/a&#xD;&#xA;b</UrlBase>\n  <Created>line 1&#xA;line 2 &amp; more</Created>\n</Config>",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(source))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for key, value := range values {
+				config.Properties[key] = value
+			}
+			config.Keys = append(config.Keys, "Created")
+
+			output, err := preserveSource(config, tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Fatalf("Expected %q, got %q", tt.expected, output)
+			}
+
+			parsed, err := ParseConfig(output)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(parsed.Properties, values) {
+				t.Fatalf("Expected values %q to round-trip, got %q", values, parsed.Properties)
+			}
+		})
+	}
+}
+
+// TestPreserveSource tests that rendering keeps comments, processing instructions and the
+// whitespace around untouched elements of the original document.
+func TestPreserveSource(t *testing.T) {
+	source := "<?xml version=\"1.0\"?>\n<!-- Managed by hand -->\n<Config>\n    <!-- Keep in sync with the proxy -->\n    <Port>8989</Port>\n\n    <LogLevel>info</LogLevel>\n    <?app hint?>\n    <UrlBase></UrlBase>\n</Config>\n"
+	config, err := ParseConfig([]byte(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config.Properties["Port"] = "8990"
+	delete(config.Properties, "UrlBase")
+	config.Keys = append(config.Keys, "Theme")
+	config.Properties["Theme"] = "dark"
+
+	output, err := preserveSource(config, RenderOptions{Indent: DefaultIndent})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "<?xml version=\"1.0\"?>\n<!-- Managed by hand -->\n<Config>\n    <!-- Keep in sync with the proxy -->\n    <Port>8990</Port>\n\n    <LogLevel>info</LogLevel>\n    <?app hint?>\n    <Theme>dark</Theme>\n</Config>\n"
+	if string(output) != expected {
+		t.Fatalf("Expected %q, got %q", expected, string(output))
+	}
+
+	t.Run("Reformat", func(t *testing.T) {
+		output, err := preserveSource(config, RenderOptions{Indent: DefaultIndent, Reformat: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, fragment := range []string{"<!-- Managed by hand -->", "<!-- Keep in sync with the proxy -->", "\n  <Port>8990</Port>\n  <LogLevel>"} {
+			if !strings.Contains(string(output), fragment) {
+				t.Fatalf("Expected %q in reformatted output, got %q", fragment, string(output))
+			}
+		}
+	})
+
+	t.Run("Empty root element", func(t *testing.T) {
+		config, err := ParseConfig([]byte("<Config></Config>"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		config.Keys, config.Properties["Port"] = []string{"Port"}, "8989"
+
+		output, err := preserveSource(config, RenderOptions{Indent: DefaultIndent})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := "<Config>\n\t<Port>8989</Port>\n</Config>"; string(output) != expected {
+			t.Fatalf("Expected %q, got %q", expected, string(output))
+		}
+	})
+}
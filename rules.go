@@ -0,0 +1,179 @@
+package configarr
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule renames properties of the configuration file or rewrites their values, e.g. to
+// migrate custom keys when an app changes its schema. Rules are applied in order, each
+// to the properties as left by the previous ones, before the overrides of the sources,
+// which take precedence.
+type Rule struct {
+	Key     string // Regular expression matching the whole keys the rule applies to
+	Rename  string // New key, with $1 etc. for the groups of Key; empty keeps the key
+	Match   string // Regular expression of the values to rewrite; empty keeps the value
+	Replace string // New value, with $1 etc. for the groups of Match
+	Source  string // Where the rule came from, e.g. "rules:/config/rules.yaml"; "rule:<index>" when empty
+}
+
+// compiledRule is a Rule with its regular expressions compiled.
+type compiledRule struct {
+	Rule
+	key, match *regexp.Regexp
+}
+
+// compile compiles the regular expressions of the rule. The key expression is anchored,
+// so it has to match the whole key.
+func (r Rule) compile() (compiledRule, error) {
+	compiled := compiledRule{Rule: r}
+	if r.Rename == "" && r.Match == "" {
+		return compiled, errors.New("expected rename or match")
+	}
+	var err error
+	if compiled.key, err = regexp.Compile("^(?:" + r.Key + ")$"); err != nil {
+		return compiled, fmt.Errorf("invalid key: %w", err)
+	}
+	if r.Match != "" {
+		if compiled.match, err = regexp.Compile(r.Match); err != nil {
+			return compiled, fmt.Errorf("invalid match: %w", err)
+		}
+	}
+	return compiled, nil
+}
+
+// ParseRules parses a YAML sequence of mappings with the fields of the rules in lower
+// case, keeping the document order, e.g. "[{key: 'Custom(\w+)', rename: 'Legacy${1}'}]".
+func ParseRules(data []byte) ([]Rule, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil // Empty document
+	}
+
+	items := doc.Content[0]
+	if items.Kind != yaml.SequenceNode {
+		return nil, errors.New("expected a YAML sequence of rules")
+	}
+
+	var rules []Rule
+	for i, item := range items.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("rule %d: expected a YAML mapping", i+1)
+		}
+		var rule Rule
+		fields := make(map[string]bool)
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			field, value := item.Content[j].Value, item.Content[j+1]
+			if value.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("rule %d: %s must be a scalar", i+1, field)
+			}
+			switch field {
+			case "key":
+				rule.Key = value.Value
+			case "rename":
+				rule.Rename = value.Value
+			case "match":
+				rule.Match = value.Value
+			case "replace":
+				rule.Replace = value.Value
+			default:
+				return nil, fmt.Errorf("rule %d: unknown field %s, expected key, rename, match and replace", i+1, field)
+			}
+			fields[field] = true
+		}
+		switch {
+		case !fields["key"]:
+			return nil, fmt.Errorf("rule %d: key is missing", i+1)
+		case fields["match"] != fields["replace"]:
+			return nil, fmt.Errorf("rule %d: match and replace must be set together", i+1)
+		}
+		if _, err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ruleOverrides returns the overrides applying the rules to the configuration: renamed
+// properties are created under their new key, even when the catalog doesn't know it, and
+// deleted under the old one. Renames to a key that already exists are skipped with a
+// warning.
+func ruleOverrides(config *Config, rules []Rule, logger *slog.Logger) ([]Override, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	keys := append([]string(nil), config.Keys...)
+	state := make(map[string]string, len(config.Properties))
+	for key, value := range config.Properties {
+		state[key] = value
+	}
+	sources := make(map[string]string) // Rule that last changed a key
+
+	for i, rule := range rules {
+		compiled, err := rule.compile()
+		if err != nil {
+			return nil, categorize(ErrInvalid, fmt.Errorf("rule %d: %w", i+1, err))
+		}
+		source := rule.Source
+		if source == "" {
+			source = "rule:" + strconv.Itoa(i+1)
+		}
+
+		for k, key := range keys {
+			value, exists := state[key]
+			if !exists || !compiled.key.MatchString(key) {
+				continue
+			}
+			newKey := key
+			if rule.Rename != "" {
+				newKey = compiled.key.ReplaceAllString(key, rule.Rename)
+			}
+			if compiled.match != nil {
+				value = compiled.match.ReplaceAllString(value, rule.Replace)
+			}
+
+			if newKey != key {
+				if _, taken := state[newKey]; taken {
+					logger.Warn(fmt.Sprintf("Skipping rename of '%s' to '%s': key already exists%s", key, newKey, describeSource(source)), warningAttr(WarningRenameConflict, key))
+					continue
+				}
+				delete(state, key)
+				keys[k] = newKey
+				sources[key] = source
+			}
+			if newKey != key || value != state[newKey] {
+				state[newKey] = value
+				sources[newKey] = source
+			}
+		}
+	}
+
+	var overrides []Override
+	for _, key := range config.Keys {
+		if _, exists := state[key]; !exists {
+			overrides = append(overrides, Override{Key: key, Delete: true, Source: sources[key]})
+		}
+	}
+	for _, key := range keys {
+		value, exists := state[key]
+		if !exists {
+			continue
+		}
+		current, existed := config.Properties[key]
+		if existed && current == value {
+			continue
+		}
+		overrides = append(overrides, Override{Key: key, Value: value, Source: sources[key], Create: !existed})
+	}
+	return overrides, nil
+}
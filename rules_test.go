@@ -0,0 +1,110 @@
+package configarr
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestParseRules tests parsing rules files.
+func TestParseRules(t *testing.T) {
+	data := `
+- key: Custom(\w+)
+  rename: Legacy${1}
+- key: .*Url
+  match: ^http://(.*)
+  replace: https://$1
+`
+	rules, err := ParseRules([]byte(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Rule{
+		{Key: `Custom(\w+)`, Rename: "Legacy${1}"},
+		{Key: ".*Url", Match: "^http://(.*)", Replace: "https://$1"},
+	}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("Expected rules %+v, got %+v", expected, rules)
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		for name, data := range map[string]string{
+			"Not a sequence":           "key: Port",
+			"Missing key":              "- rename: Port",
+			"Neither rename nor match": "- key: Port",
+			"Match without replace":    "- key: Port\n  match: x",
+			"Unknown field":            "- key: Port\n  rename: SslPort\n  to: x",
+			"Invalid expression":       "- key: Port(\n  rename: x",
+		} {
+			if _, err := ParseRules([]byte(data)); err == nil {
+				t.Fatalf("Expected error for %s, but got none", strings.ToLower(name))
+			}
+		}
+	})
+}
+
+// TestRuleOverrides tests that rules rename properties and rewrite their values, with the
+// overrides of the sources taking precedence.
+func TestRuleOverrides(t *testing.T) {
+	original := "<Config><CustomPort>8989</CustomPort><CustomHost>nas</CustomHost><AuthUrl>http://auth.local</AuthUrl><SslPort>9898</SslPort></Config>"
+	rules := []Rule{
+		{Key: `Custom(\w+)`, Rename: "Legacy${1}", Source: "rules:rules.yaml"},
+		{Key: "LegacyHost", Match: "^nas$", Replace: "nas.local"},
+		{Key: ".*Url", Match: "^http://(.*)", Replace: "https://$1"},
+		{Key: "LegacyPort", Rename: "SslPort"},
+	}
+	fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte(original)}}}
+
+	var logs strings.Builder
+	result, err := Run(context.Background(),
+		WithFS(fsys),
+		WithConfigPath("config.xml"),
+		WithRules(rules...),
+		WithSources(StaticSource(Override{Key: "LegacyHost", Value: "tv.local"})),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	written := string(fsys.MapFS["config.xml"].Data)
+	for _, fragment := range []string{"<AuthUrl>https://auth.local</AuthUrl>", "<SslPort>9898</SslPort>", "<LegacyPort>8989</LegacyPort>", "<LegacyHost>tv.local</LegacyHost>"} {
+		if !strings.Contains(written, fragment) {
+			t.Fatalf("Expected %s in written file, got: %s", fragment, written)
+		}
+	}
+	if strings.Contains(written, "Custom") {
+		t.Fatalf("Expected the old keys to be removed, got: %s", written)
+	}
+	if result.Changed["LegacyPort"] != "8989" {
+		t.Fatalf("Expected LegacyPort to be created, got changes %v", result.Changed)
+	}
+	if !strings.Contains(logs.String(), "Skipping rename of 'LegacyPort' to 'SslPort'") {
+		t.Fatalf("Expected a warning for the rename to an existing key, got: %s", logs.String())
+	}
+
+	t.Run("Sources", func(t *testing.T) {
+		config, err := ParseConfig([]byte(original))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		overrides, err := ruleOverrides(config, rules[:3], slog.New(slog.NewTextHandler(io.Discard, nil)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := []Override{
+			{Key: "CustomPort", Delete: true, Source: "rules:rules.yaml"},
+			{Key: "CustomHost", Delete: true, Source: "rules:rules.yaml"},
+			{Key: "LegacyPort", Value: "8989", Source: "rules:rules.yaml", Create: true},
+			{Key: "LegacyHost", Value: "nas.local", Source: "rule:2", Create: true},
+			{Key: "AuthUrl", Value: "https://auth.local", Source: "rule:3"},
+		}
+		if !reflect.DeepEqual(overrides, expected) {
+			t.Fatalf("Expected overrides %+v, got %+v", expected, overrides)
+		}
+	})
+}
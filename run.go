@@ -0,0 +1,493 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Result describes the outcome of a Run.
+type Result struct {
+	ConfigPath string            // Configuration file that was processed
+	Changed    map[string]string // New values of the changed properties
+	ChangeSet  ChangeSet         // Changed properties with their old values and sources
+	Written    bool              // Whether the configuration file was written
+	Backup     string            // Backup of the original content written before, if any
+	Original   []byte            // Content of the configuration file before the run
+	Rendered   []byte            // Content written, or that would have been written in a dry run
+	Summary    Summary           // Counts of the planned actions and the duration of the run
+	Warnings   []Warning         // Warnings logged during the run, e.g. for invalid environment variables
+	Recovered  string            // Where the content of an empty configuration file was recovered from, if it was
+	Queued     int               // Change sets Watch retries after failed writes, see WithWriteRetryDelay
+}
+
+// Summary counts what a run did with the overrides.
+type Summary struct {
+	Applied   int // Overrides that changed a property
+	Skipped   int // Overrides skipped for any reason other than an unchanged value
+	Unchanged int // Overrides whose value was already set
+	Duration  time.Duration
+}
+
+// summarize counts the actions of the plan. Changes only count as applied when they
+// made it into the result.
+func summarize(plan *Plan, result Result, duration time.Duration) Summary {
+	summary := Summary{Applied: len(result.Changed), Duration: duration}
+	if plan == nil {
+		return summary
+	}
+	for _, action := range plan.Actions {
+		switch {
+		case action.changes(): // Counted from the result
+		case action.Reason == SkipReasonUnchanged:
+			summary.Unchanged++
+		default:
+			summary.Skipped++
+		}
+	}
+	return summary
+}
+
+// String formats the summary as a single line, e.g.
+// "applied=3 skipped=2 unchanged=14 duration=41ms file=/config/config.xml".
+func (r Result) String() string {
+	return fmt.Sprintf("applied=%d skipped=%d unchanged=%d duration=%s file=%s",
+		r.Summary.Applied, r.Summary.Skipped, r.Summary.Unchanged, r.Summary.Duration.Round(time.Millisecond), r.ConfigPath)
+}
+
+// Run reads the configuration file, applies the overrides of all sources and writes
+// the result, unless a dry run was requested or nothing changed in fidelity mode.
+// A one-line summary of the run is logged at the end.
+func Run(ctx context.Context, opts ...Option) (Result, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return Result{}, err
+	}
+	start := o.clock.Now()
+
+	// Files that can't be written are refused before sources run commands or decrypt values
+	if !o.dryRun {
+		if err := checkReplaceable(o.fs, o.configPath); err != nil {
+			if o.skipUnwritable {
+				o.logger.Warn(fmt.Sprintf("Skipping %s: %s", o.configPath, err), warningAttr(WarningUnwritable, ""))
+				return Result{ConfigPath: o.configPath, Warnings: o.warnings.take()}, nil
+			}
+			return Result{ConfigPath: o.configPath}, categorize(ErrWrite, fmt.Errorf("refusing to modify %s: %w", o.configPath, err))
+		}
+	}
+
+	// Sources are read once up front, since e.g. stdin can't be read again on retries
+	overrides, err := readSources(ctx, o)
+	if err != nil {
+		return Result{}, err
+	}
+	return run(ctx, overrides, o, start)
+}
+
+// run applies the overrides, retrying on conflicts, and logs the summary of the run
+// that started at start.
+func run(ctx context.Context, overrides []Override, o options, start time.Time) (Result, error) {
+	for attempt := 1; ; attempt++ {
+		plan, err := newPlan(ctx, overrides, o)
+		if err != nil {
+			return Result{ConfigPath: o.configPath}, err
+		}
+
+		result, err := applyPlan(ctx, plan, o)
+		if errors.Is(err, ErrConflict) && attempt <= o.conflictRetries {
+			o.logger.Warn(fmt.Sprintf("Configuration file changed while updating. Retrying (%d/%d).", attempt, o.conflictRetries), warningAttr(WarningConflict, ""))
+			continue
+		}
+		result.Summary = summarize(plan, result, o.clock.Now().Sub(start))
+		o.logger.Info(result.String())
+		result.Warnings = o.warnings.take()
+		return result, err
+	}
+}
+
+// newOptions applies the options on top of the defaults, loading the embedded
+// catalog when none was given. The warnings logged are collected for the result.
+func newOptions(opts []Option) (options, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.warnings = &warningCollector{}
+	o.logger = collectWarnings(o.logger, o.warnings)
+
+	if o.catalog == nil {
+		catalog, err := LoadCatalog("", "")
+		if err != nil {
+			return o, err
+		}
+		o.catalog = catalog
+	}
+	return o, nil
+}
+
+// readSources collects the overrides of all sources in order.
+func readSources(ctx context.Context, o options) ([]Override, error) {
+	var overrides []Override
+	for _, source := range o.sources {
+		sourceOverrides, err := source.Overrides(ctx, o.logger)
+		if err != nil {
+			return nil, err
+		}
+		if sourceOverrides, err = decryptOverrides(ctx, sourceOverrides, o); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, sourceOverrides...)
+	}
+	return overrides, nil
+}
+
+// newPlan reads the configuration file and computes the actions of the overrides.
+func newPlan(ctx context.Context, overrides []Override, o options) (*Plan, error) {
+	plan := &Plan{ConfigPath: o.configPath}
+
+	if o.settleDelay > 0 {
+		if err := waitForStableFile(ctx, o.fs, o.configPath, o.settleDelay, o.settleTimeout, o.clock, o.logger); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := o.validate(checkFileSize(o.fs, o.configPath, o.maxFileSize)); err != nil {
+		return nil, categorize(ErrInvalid, err)
+	}
+
+	// Attempt to read and parse the XML configuration file
+	config, err := readConfigFileWithRetry(ctx, o.fs, o.configPath, o.configFormat(), o.readRetries, o.readRetryDelay, o.logger)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && o.ignoreMissingConfig {
+			o.logger.Debug("No configuration file found. Skipping update.")
+			return plan, nil
+		}
+		if data, readErr := fs.ReadFile(o.fs, o.configPath); readErr == nil && isEmptyDocument(data) {
+			if config, plan.Recovered, err = recoverEmptyConfig(data, o); err != nil {
+				return nil, err
+			}
+			plan.empty = data
+			o.logger.Warn(fmt.Sprintf("Configuration file %s holds %s, e.g. after the app crashed while writing it. Seeding it from %s.", o.configPath, describeEmpty(data), plan.Recovered),
+				warningAttr(WarningRecovered, ""))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration file: %w", err)
+	}
+
+	plan.source = config.source
+	renames, err := ruleOverrides(config, o.rules, o.logger)
+	if err != nil {
+		return nil, err
+	}
+	overrides = append(renames, overrides...) // The sources take precedence over the rules
+	differ := Differ{Catalog: o.catalog, OnlyKeys: o.onlyKeys, SkipKeys: o.skipKeys, Unmanaged: o.unmanagedKeys, Create: o.createKeys != "", Groups: o.keyGroups}
+	plan.Actions = differ.Diff(config, overrides)
+	for _, action := range plan.Actions {
+		switch {
+		case action.Reason == SkipReasonFiltered:
+			o.logger.Debug(fmt.Sprintf("Skipping '%s': excluded by key filter", action.Key))
+		case action.Reason == SkipReasonUnmanaged && action.Value != action.Current:
+			o.logger.Info(fmt.Sprintf("Skipping '%s': unmanaged, keeping its manual edits", action.Key))
+		case strings.HasPrefix(action.Reason, SkipReasonGroup):
+			o.logger.Warn(fmt.Sprintf("Skipping '%s': %s", action.Key, action.Reason), warningAttr(WarningSkippedGroup, action.Key))
+		}
+	}
+	return plan, nil
+}
+
+// applyPlan applies the plan to the content it was computed from and writes the result.
+func applyPlan(ctx context.Context, plan *Plan, o options) (Result, error) {
+	result := Result{ConfigPath: o.configPath}
+	logger := o.logger
+
+	if plan.source == nil {
+		return result, nil // Missing configuration file, ignored while planning
+	}
+
+	if err := checkAppStopped(o.requireAppStopped); err != nil {
+		return result, fmt.Errorf("refusing to modify %s: %w", o.configPath, err)
+	}
+
+	// Characters XML can't represent are refused in any validation mode, since the written
+	// file would differ from the requested values
+	err := validateOverrideValues(plan.Actions, 0)
+	if err == nil {
+		err = o.validate(validateOverrideValues(plan.Actions, o.maxValueSize))
+	}
+	if err != nil {
+		return result, categorize(ErrInvalid, fmt.Errorf("refusing to modify %s: %w", o.configPath, err))
+	}
+	if err := checkSecretValues(plan.Actions); err != nil {
+		if o.strictSecrets {
+			return result, categorize(ErrInvalid, fmt.Errorf("refusing to modify %s: %w", o.configPath, err))
+		}
+		logger.Warn(fmt.Sprintf("Writing weak secrets: %s", strings.ReplaceAll(err.Error(), "\n", "; ")), warningAttr(WarningWeakSecret, ""))
+	}
+
+	format := o.configFormat()
+	if format != XMLFormat && (o.patch || o.fidelity) {
+		return result, categorize(ErrInvalid, fmt.Errorf("patch and fidelity modes are not supported for %s files", format.Name()))
+	}
+	if len(o.postProcessors) > 0 && (o.patch || o.fidelity) {
+		return result, categorize(ErrInvalid, errors.New("post-processors are not supported with patch and fidelity modes"))
+	}
+
+	config, err := format.Parse(plan.source)
+	if err != nil {
+		return result, fmt.Errorf("error reading configuration file: %w", err)
+	}
+	result.Original, result.Rendered = plan.source, plan.source
+	current := config.source // Content of the file, to detect concurrent changes
+	if plan.Recovered != "" {
+		result.Original, result.Recovered, current = plan.empty, plan.Recovered, plan.empty
+	}
+	overrides := plan.overrides()
+
+	changed := applyOverrides(config, overrides, logger)
+	for key, value := range createKeys(config, plan.Actions, o.createKeys, o.catalog, logger) {
+		changed[key] = value
+	}
+	deleted := deleteKeys(config, plan.Actions, logger)
+	for key, value := range deleted {
+		changed[key] = value
+	}
+	result.Changed = changed
+	result.ChangeSet = plan.changeSet(changed)
+	reportUnmatchedOverrides(plan.unmatched(), config, o.catalog, logger)
+	if err := emitPlanEvents(o.events, o.configPath, plan.Actions, o.clock); err != nil {
+		return result, err
+	}
+
+	if o.fidelity && len(changed) == 0 && plan.Recovered == "" {
+		logger.Debug("Fidelity mode: leaving configuration file untouched.")
+		return result, nil
+	}
+	if format != XMLFormat && len(changed) == 0 && plan.Recovered == "" {
+		logger.Debug("No changes: leaving configuration file untouched.")
+		return result, nil
+	}
+
+	var rendered []byte
+	if o.patch {
+		rendered, err = patchConfig(config.withRenderOptions(o.render), changed)
+	} else {
+		rendered, err = format.Render(config, o.render)
+	}
+	if err != nil {
+		return result, fmt.Errorf("error rendering updated configuration: %w", err)
+	}
+	info := RenderInfo{Path: o.configPath, Format: format.Name(), Time: o.clock.Now(), Changed: len(changed) > 0}
+	if !o.render.Compact {
+		info.Indent = o.render.Indent
+	}
+	if rendered, err = postProcess(rendered, info, o.postProcessors); err != nil {
+		return result, err
+	}
+	rendered = applySourceConventions(applyFinalNewline(rendered, config.source, o.finalNewline), config.source)
+	result.Rendered = rendered
+
+	if o.fidelity {
+		if err := verifyFidelity(config.source, rendered, changed); err != nil {
+			return result, fmt.Errorf("fidelity check failed: %w", err)
+		}
+	}
+
+	if len(changed) > 0 {
+		logRestartImpact(plan.RestartKeys(), logger)
+	}
+
+	if o.dryRun {
+		logger.Debug("Dry run: not writing configuration file.")
+		return result, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	if err := checkUnchanged(o.fs, o.configPath, current); err != nil {
+		return result, categorize(ErrWrite, fmt.Errorf("refusing to write %s: %w", o.configPath, err))
+	}
+
+	if o.backups > 0 && len(changed) > 0 && plan.Recovered == "" { // Empty files aren't worth a backup
+		backup, err := backupConfig(o.fs, o.configPath, config.source, o.clock.Now(), o.backups, logger)
+		if err != nil {
+			return result, categorize(ErrWrite, fmt.Errorf("refusing to write %s: %w", o.configPath, err))
+		}
+		result.Backup = backup
+		logger.Info(fmt.Sprintf("Backed up %s to %s", o.configPath, backup))
+	}
+
+	if err := writeOutputToFile(o.fs, rendered, o.configPath); err != nil {
+		return result, categorize(ErrWrite, fmt.Errorf("error writing updated configuration file: %w", err))
+	}
+	result.Written = true
+
+	if o.verify {
+		if err := verifyWrittenConfig(o.fs, o.configPath, format, changed, deleted); err != nil {
+			if restoreErr := writeOutputToFile(o.fs, config.source, o.configPath); restoreErr != nil {
+				return result, categorize(ErrWrite, fmt.Errorf("verification of written file failed: %w; restoring original content failed: %v", err, restoreErr))
+			}
+			return result, categorize(ErrWrite, fmt.Errorf("verification of written file failed, original content restored: %w", err))
+		}
+		logger.Debug("Verified written configuration file.")
+	}
+
+	if len(changed) > 0 && o.stateFile != "" {
+		if err := recordProvenance(o.stateFile, result.ChangeSet, o.clock.Now(), o.random); err != nil {
+			logger.Warn(fmt.Sprintf("Error recording provenance: %s", err), warningAttr(WarningProvenance, ""))
+		}
+	}
+
+	if len(changed) > 0 {
+		notify(ctx, o.notifiers, result.ChangeSet, logger)
+	}
+
+	return result, nil
+}
+
+// checkFileSize refuses files larger than maxSize bytes unless it is zero. Missing files
+// are left to the reader, so they are reported the usual way.
+func checkFileSize(fsys fs.StatFS, xmlFile string, maxSize int64) error {
+	if maxSize <= 0 {
+		return nil
+	}
+	info, err := fsys.Stat(xmlFile)
+	if err != nil {
+		return nil
+	}
+	if info.Size() > maxSize {
+		return fmt.Errorf("refusing to parse %s: %d bytes exceed the limit of %d bytes", xmlFile, info.Size(), maxSize)
+	}
+	return nil
+}
+
+// logRestartImpact tells whether the changes require an app restart to take effect.
+func logRestartImpact(restartKeys []string, logger *slog.Logger) {
+	if len(restartKeys) == 0 {
+		logger.Info("Restart required: no")
+		return
+	}
+	logger.Info(fmt.Sprintf("Restart required: yes (%s)", strings.Join(restartKeys, ", ")))
+}
+
+// Categories of the errors returned by Run, so callers can tell them apart with errors.Is
+// without matching messages. Other errors, e.g. a missing file, have no category.
+var (
+	ErrInvalid = errors.New("invalid input") // Values or files refused by validation, e.g. size limits
+	ErrParse   = errors.New("parse error")   // The configuration file is malformed in its format, e.g. not well-formed XML
+	ErrWrite   = errors.New("write error")   // Writing or verifying the configuration file failed, including ErrConflict
+)
+
+// categorizedError marks an error with one of the categories without changing its message.
+type categorizedError struct {
+	category error
+	err      error
+}
+
+// Error returns the message of the wrapped error.
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the category and the wrapped error.
+func (e *categorizedError) Unwrap() []error {
+	return []error{e.category, e.err}
+}
+
+// categorize marks err with the category.
+func categorize(category, err error) error {
+	return &categorizedError{category: category, err: err}
+}
+
+// ErrConflict is returned when the configuration file was modified by another process
+// between reading and writing it, or since a plan was computed.
+var ErrConflict = errors.New("configuration file was modified by another process since it was read")
+
+// ErrEmptyConfig is returned when the configuration file is empty but for a byte order
+// mark and whitespace, unless WithRecoverEmpty seeds it.
+var ErrEmptyConfig = errors.New("configuration file is empty")
+
+// checkUnchanged verifies that the file still holds the content it had when it was read.
+func checkUnchanged(fsys fs.FS, xmlFile string, source []byte) error {
+	current, err := fs.ReadFile(fsys, xmlFile)
+	if err != nil {
+		return fmt.Errorf("error re-reading file %s: %w", xmlFile, err)
+	}
+
+	if !bytes.Equal(current, source) {
+		return ErrConflict
+	}
+	return nil
+}
+
+// verifyWrittenConfig re-reads the written file and checks that it parses and
+// contains every intended change, and none of the deleted properties.
+func verifyWrittenConfig(fsys fs.FS, xmlFile string, format Format, changed, deleted map[string]string) error {
+	written, err := readConfigFS(fsys, xmlFile, format)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range changed {
+		current, exists := written.Properties[key]
+		if _, removed := deleted[key]; removed {
+			if exists {
+				return fmt.Errorf("expected '%s' to be removed, found '%s'", key, current)
+			}
+			continue
+		}
+		if !exists || current != value {
+			return fmt.Errorf("expected '%s' to be '%s', found '%s'", key, value, current)
+		}
+	}
+	return nil
+}
+
+// waitForStableFile blocks until the file's modification time and size have stayed
+// the same for the settle delay, so we don't race the application's own writes.
+// A missing file is considered stable and left to the caller to handle.
+func waitForStableFile(ctx context.Context, fsys fs.StatFS, xmlFile string, settle, timeout time.Duration, clock Clock, logger *slog.Logger) error {
+	deadline := clock.Now().Add(timeout)
+	last, err := fsys.Stat(xmlFile)
+	if err != nil {
+		return nil
+	}
+
+	for {
+		if err := sleep(ctx, settle); err != nil {
+			return err
+		}
+		current, err := fsys.Stat(xmlFile)
+		if err != nil {
+			return nil
+		}
+		if current.ModTime().Equal(last.ModTime()) && current.Size() == last.Size() {
+			return nil
+		}
+		if clock.Now().After(deadline) {
+			return fmt.Errorf("file %s did not settle within %s", xmlFile, timeout)
+		}
+		logger.Debug(fmt.Sprintf("Configuration file changed during settle delay of %s. Waiting.", settle))
+		last = current
+	}
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
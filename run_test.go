@@ -0,0 +1,480 @@
+package configarr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestWaitForStableFile tests waiting for the file to stop changing before reading it.
+func TestWaitForStableFile(t *testing.T) {
+	var stdOut strings.Builder
+	logger := slog.New(slog.NewTextHandler(&stdOut, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	t.Run("Stable file", func(t *testing.T) {
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+		file.Close()
+
+		if err := waitForStableFile(context.Background(), OSFS(), file.Name(), time.Millisecond, time.Second, SystemClock(), logger); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		if err := waitForStableFile(context.Background(), OSFS(), "nonexistent.xml", time.Millisecond, time.Second, SystemClock(), logger); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("File keeps changing", func(t *testing.T) {
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		defer os.Remove(file.Name())
+		file.Close()
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+					_ = os.WriteFile(file.Name(), bytes.Repeat([]byte("x"), i%100), 0644)
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}()
+
+		if err := waitForStableFile(context.Background(), OSFS(), file.Name(), 20*time.Millisecond, 50*time.Millisecond, SystemClock(), logger); err == nil {
+			t.Fatal("Expected error for unsettled file, but got none")
+		}
+	})
+}
+
+// TestCheckUnchanged tests detection of concurrent modifications between read and write.
+func TestCheckUnchanged(t *testing.T) {
+	file, err := os.CreateTemp("", "config*.xml")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	source := []byte("<Config><LogLevel>info</LogLevel></Config>")
+	if _, err := file.Write(source); err != nil {
+		t.Fatalf("Unexpected error writing to temp file: %v", err)
+	}
+	file.Close()
+
+	t.Run("File unchanged", func(t *testing.T) {
+		if err := checkUnchanged(OSFS(), file.Name(), source); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("File modified by another process", func(t *testing.T) {
+		if err := os.WriteFile(file.Name(), []byte("<Config><LogLevel>trace</LogLevel></Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error modifying file: %v", err)
+		}
+
+		if err := checkUnchanged(OSFS(), file.Name(), source); !errors.Is(err, ErrConflict) {
+			t.Fatalf("Expected conflict error, got: %v", err)
+		}
+	})
+}
+
+// TestVerifyWrittenConfig tests the post-write verification of the configuration file.
+func TestVerifyWrittenConfig(t *testing.T) {
+	file, err := os.CreateTemp("", "config*.xml")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write([]byte("<Config><LogLevel>debug</LogLevel></Config>")); err != nil {
+		t.Fatalf("Unexpected error writing to temp file: %v", err)
+	}
+	file.Close()
+
+	t.Run("Changes present", func(t *testing.T) {
+		if err := verifyWrittenConfig(OSFS(), file.Name(), XMLFormat, map[string]string{"LogLevel": "debug"}, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Changes missing", func(t *testing.T) {
+		if err := verifyWrittenConfig(OSFS(), file.Name(), XMLFormat, map[string]string{"LogLevel": "trace"}, nil); err == nil {
+			t.Fatal("Expected error for missing change, but got none")
+		}
+	})
+
+	t.Run("Invalid document", func(t *testing.T) {
+		if err := os.WriteFile(file.Name(), []byte("<Config><LogLevel>debug</Log"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		if err := verifyWrittenConfig(OSFS(), file.Name(), XMLFormat, map[string]string{"LogLevel": "debug"}, nil); err == nil {
+			t.Fatal("Expected error for invalid document, but got none")
+		}
+	})
+}
+
+// TestRun tests the library entry point with different options.
+func TestRun(t *testing.T) {
+	createConfig := func(t *testing.T) string {
+		file, err := os.CreateTemp("", "test*.xml")
+		if err != nil {
+			t.Fatalf("Unexpected error creating temp file: %v", err)
+		}
+		t.Cleanup(func() { os.Remove(file.Name()) })
+		if _, err := file.WriteString("<Config><Port>8989</Port><UrlBase></UrlBase></Config>"); err != nil {
+			t.Fatalf("Unexpected error writing temp file: %v", err)
+		}
+		file.Close()
+		return file.Name()
+	}
+
+	t.Run("Keep the conventions of the file", func(t *testing.T) {
+		fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte("\xef\xbb\xbf<?xml version=\"1.0\" encoding=\"utf-8\"?>\r\n<Config>\r\n  <Port>8989</Port>\r\n</Config>\r\n")}}}
+		if _, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"),
+			WithSources(StaticSource(Override{Key: "Port", Value: "9000"}))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := "\xef\xbb\xbf<?xml version=\"1.0\" encoding=\"utf-8\"?>\r\n<Config>\r\n  <Port>9000</Port>\r\n</Config>\r\n"
+		if written := string(fsys.MapFS["config.xml"].Data); written != expected {
+			t.Fatalf("Expected %q, got %q", expected, written)
+		}
+	})
+
+	t.Run("Write changes", func(t *testing.T) {
+		path := createConfig(t)
+
+		result, err := Run(context.Background(),
+			WithConfigPath(path),
+			WithSources(EnvSource([]string{"CONFIGARR__PORT=Port=9000"}, DefaultPrefix)),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !result.Written {
+			t.Fatal("Expected the configuration file to be written")
+		}
+		if result.Changed["Port"] != "9000" {
+			t.Fatalf("Expected Port to be changed to '9000', got %v", result.Changed)
+		}
+
+		config, err := ReadConfigFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Properties["Port"] != "9000" {
+			t.Fatalf("Expected Port to be '9000', got '%s'", config.Properties["Port"])
+		}
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		path := createConfig(t)
+		before, _ := os.ReadFile(path)
+
+		result, err := Run(context.Background(),
+			WithConfigPath(path),
+			WithSources(StaticSource(Override{Key: "Port", Value: "9000"})),
+			WithDryRun(),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Written {
+			t.Fatal("Expected the configuration file not to be written")
+		}
+		if result.Changed["Port"] != "9000" {
+			t.Fatalf("Expected Port to be reported as changed, got %v", result.Changed)
+		}
+		if !bytes.Equal(result.Original, before) || !bytes.Contains(result.Rendered, []byte("<Port>9000</Port>")) {
+			t.Fatalf("Expected original and rendered content, got %q and %q", result.Original, result.Rendered)
+		}
+
+		after, _ := os.ReadFile(path)
+		if !bytes.Equal(before, after) {
+			t.Fatalf("Expected file to be unchanged, got %q", after)
+		}
+	})
+
+	t.Run("Summary", func(t *testing.T) {
+		path := createConfig(t)
+		var stdOut bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&stdOut, nil))
+
+		result, err := Run(context.Background(),
+			WithConfigPath(path),
+			WithSources(StaticSource(
+				Override{Key: "Port", Value: "9000"},
+				Override{Key: "UrlBase", Value: ""},
+				Override{Key: "Missing", Value: "x"},
+			)),
+			WithLogger(logger),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if result.Summary.Applied != 1 || result.Summary.Skipped != 1 || result.Summary.Unchanged != 1 {
+			t.Fatalf("Unexpected summary %+v", result.Summary)
+		}
+		expected := "applied=1 skipped=1 unchanged=1 duration="
+		if !strings.HasPrefix(result.String(), expected) || !strings.HasSuffix(result.String(), " file="+path) {
+			t.Fatalf("Unexpected summary line %q", result.String())
+		}
+		if !strings.Contains(stdOut.String(), expected) {
+			t.Fatalf("Expected summary in log output, got %q", stdOut.String())
+		}
+	})
+
+	t.Run("File size limit", func(t *testing.T) {
+		path := createConfig(t)
+		opts := []Option{WithConfigPath(path), WithSources(StaticSource(Override{Key: "Port", Value: "9000"})), WithDryRun()}
+
+		if _, err := Run(context.Background(), append(opts, WithLimits(0, 10))...); err == nil || !strings.Contains(err.Error(), "exceed the limit of 10 bytes") || !errors.Is(err, ErrInvalid) {
+			t.Fatalf("Expected file size limit error, got: %v", err)
+		}
+		if _, err := Run(context.Background(), append(opts, WithLimits(0, 0))...); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Validation mode", func(t *testing.T) {
+		path := createConfig(t)
+		var logs bytes.Buffer
+		opts := []Option{
+			WithConfigPath(path),
+			WithSources(StaticSource(Override{Key: "UrlBase", Value: "/sonarr"})),
+			WithLimits(5, 0),
+			WithDryRun(),
+			WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		}
+
+		if _, err := Run(context.Background(), opts...); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("Expected validation error, got: %v", err)
+		}
+
+		result, err := Run(context.Background(), append(opts, WithValidationMode(ValidationModeWarn))...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Changed["UrlBase"] != "/sonarr" {
+			t.Fatalf("Expected UrlBase to be changed, got %v", result.Changed)
+		}
+		if !strings.Contains(logs.String(), "Validation failed: invalid value for 'UrlBase'") {
+			t.Fatalf("Expected validation warning, got logs:\n%s", logs.String())
+		}
+
+		opts[1] = WithSources(StaticSource(Override{Key: "UrlBase", Value: "\x00"}))
+		if _, err := Run(context.Background(), append(opts, WithValidationMode(ValidationModeWarn))...); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("Expected characters not allowed in XML to be refused, got: %v", err)
+		}
+	})
+
+	t.Run("Later sources win", func(t *testing.T) {
+		path := createConfig(t)
+
+		result, err := Run(context.Background(),
+			WithConfigPath(path),
+			WithSources(
+				EnvSource([]string{"CONFIGARR__URLBASE=UrlBase=/env"}, DefaultPrefix),
+				StaticSource(Override{Key: "UrlBase", Value: "/static"}),
+			),
+			WithDryRun(),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Changed["UrlBase"] != "/static" {
+			t.Fatalf("Expected UrlBase to be '/static', got %v", result.Changed)
+		}
+	})
+
+	t.Run("Missing config ignored", func(t *testing.T) {
+		result, err := Run(context.Background(),
+			WithConfigPath("nonexistent.xml"),
+			WithIgnoreMissingConfig(),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Written {
+			t.Fatal("Expected nothing to be written")
+		}
+	})
+
+	t.Run("Missing config", func(t *testing.T) {
+		if _, err := Run(context.Background(), WithConfigPath("nonexistent.xml")); err == nil {
+			t.Fatal("Expected error for missing config, but got none")
+		}
+	})
+
+	t.Run("Error categories", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "config.xml")
+		if err := os.WriteFile(invalid, []byte("<Config><Port>8989</Config>"), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		if _, err := Run(context.Background(), WithConfigPath(invalid)); !errors.Is(err, ErrParse) {
+			t.Fatalf("Expected parse error, got: %v", err)
+		}
+
+		path := createConfig(t)
+		_, err := Run(context.Background(),
+			WithConfigPath(path),
+			WithSources(StaticSource(Override{Key: "Port", Value: "9000\x00"})),
+		)
+		if !errors.Is(err, ErrInvalid) || errors.Is(err, ErrParse) {
+			t.Fatalf("Expected validation error, got: %v", err)
+		}
+	})
+}
+
+// TestRun_CreateKeys tests that created keys are written in a deterministic order,
+// comparing the output with golden files.
+func TestRun_CreateKeys(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("testdata", "create-keys", "input.xml"))
+	if err != nil {
+		t.Fatalf("Unexpected error reading input: %v", err)
+	}
+	overrides := []Override{
+		{Key: "UrlBase", Value: "/sonarr"},
+		{Key: "Port", Value: "9000"},
+		{Key: "BindAddress", Value: "*"},
+		{Key: "Typo", Value: "x"},
+	}
+
+	for _, order := range []string{KeyOrderAppend, KeyOrderCatalog} {
+		t.Run(order, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", "create-keys", order+".xml"))
+			if err != nil {
+				t.Fatalf("Unexpected error reading golden file: %v", err)
+			}
+
+			for run := 0; run < 3; run++ { // Repeated runs must produce identical files
+				path := filepath.Join(t.TempDir(), "config.xml")
+				if err := os.WriteFile(path, input, 0644); err != nil {
+					t.Fatalf("Unexpected error writing file: %v", err)
+				}
+
+				result, err := Run(context.Background(),
+					WithConfigPath(path),
+					WithSources(StaticSource(overrides...)),
+					WithCreateKeys(order),
+				)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if result.Summary.Applied != 3 || result.Summary.Skipped != 1 {
+					t.Fatalf("Unexpected summary %+v", result.Summary)
+				}
+
+				output, _ := os.ReadFile(path)
+				if !bytes.Equal(output, golden) {
+					t.Fatalf("Expected output to match golden file %s.xml, got:\n%s", order, output)
+				}
+			}
+		})
+	}
+}
+
+// TestRun_DeleteKeys tests removing properties from the configuration file.
+func TestRun_DeleteKeys(t *testing.T) {
+	input := "<Config>\n  <Port>8989</Port>\n  <SslCertPath>/old.pfx</SslCertPath>\n  <UrlBase></UrlBase>\n</Config>\n"
+	overrides := []Override{{Key: "SslCertPath", Delete: true}, {Key: "Missing", Delete: true}}
+
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Render", nil},
+		{"Patch", []Option{WithPatch(), WithFidelity()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.xml")
+			if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+				t.Fatalf("Unexpected error writing file: %v", err)
+			}
+
+			opts := append([]Option{WithConfigPath(path), WithSources(StaticSource(overrides...)), WithVerify(true)}, tt.opts...)
+			result, err := Run(context.Background(), opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Summary.Applied != 1 || result.Summary.Unchanged != 1 {
+				t.Fatalf("Unexpected summary %+v", result.Summary)
+			}
+			if len(result.ChangeSet.Changes) != 1 || result.ChangeSet.Changes[0].Action != ActionDelete || result.ChangeSet.Changes[0].Old != "/old.pfx" {
+				t.Fatalf("Unexpected change set %+v", result.ChangeSet)
+			}
+
+			expected := "<Config>\n  <Port>8989</Port>\n  <UrlBase></UrlBase>\n</Config>\n"
+			if output, _ := os.ReadFile(path); string(output) != expected {
+				t.Fatalf("Expected output:\n%s\ngot:\n%s", expected, output)
+			}
+		})
+	}
+
+	t.Run("Processing instructions are kept", func(t *testing.T) {
+		config, err := ParseConfig([]byte("<Config><?keep?><A>1</A><B>2</B></Config>"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		deleteKeys(config, []PlanAction{{Key: "A", Type: ActionDelete}}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+		output, err := renderConfig(config, RenderOptions{Compact: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := "<Config><?keep?><B>2</B></Config>"; string(output) != expected {
+			t.Fatalf("Expected %s, got %s", expected, output)
+		}
+	})
+}
+
+// TestRun_KeyGroups tests that an incomplete key group leaves the file untouched.
+func TestRun_KeyGroups(t *testing.T) {
+	input := []byte("<Config>\n  <EnableSsl>False</EnableSsl>\n  <SslPort>9898</SslPort>\n</Config>\n")
+	path := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(path, input, 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	environ := []string{
+		"CONFIGARR__A=EnableSsl=True",
+		"CONFIGARR__B=SslPort=443",
+		"CONFIGARR__C=SslCertPath=/x",
+	}
+
+	result, err := Run(context.Background(),
+		WithConfigPath(path),
+		WithSources(EnvSource(environ, "CONFIGARR__")),
+		WithKeyGroups([]string{"SslPort", "EnableSsl", "SslCertPath"}),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Changed) != 0 {
+		t.Fatalf("Expected no changes, got %v", result.Changed)
+	}
+
+	output, _ := os.ReadFile(path)
+	if !bytes.Equal(output, input) {
+		t.Fatalf("Expected the file to be unchanged, got:\n%s", output)
+	}
+}
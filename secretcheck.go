@@ -0,0 +1,77 @@
+package configarr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// MinSecretLength is the length below which values of secret properties are considered
+// weak. The API keys the apps generate have 32 characters.
+const MinSecretLength = 12
+
+// minSecretEntropy is the Shannon entropy in bits per character below which values of
+// secret properties are considered weak, e.g. abababababab. Random hex keys have about 4.
+const minSecretEntropy = 2.0
+
+// secretPlaceholders are values left from templates and examples, compared in lower case
+// without separators.
+var secretPlaceholders = []string{
+	"changeme", "changeit", "replaceme", "placeholder", "example", "default", "secret",
+	"password", "apikey", "yourapikey", "token", "todo", "fixme", "test", "admin",
+}
+
+// weakSecretReason returns why the value is too weak for a secret, or an empty string
+// when it isn't. Empty values, e.g. to let an app generate a new key, are not weak.
+func weakSecretReason(value string) string {
+	normalized := strings.NewReplacer("_", "", "-", "", " ", "", ".", "").Replace(strings.ToLower(value))
+	firstChar, _ := utf8.DecodeRuneInString(value)
+	switch {
+	case value == "":
+		return ""
+	case slices.Contains(secretPlaceholders, normalized):
+		return "it is a placeholder"
+	case strings.Trim(value, string(firstChar)) == "":
+		return "it repeats a single character"
+	case len(value) < MinSecretLength:
+		return fmt.Sprintf("it is shorter than %d characters", MinSecretLength)
+	case shannonEntropy(value) < minSecretEntropy:
+		return "it is too predictable"
+	}
+	return ""
+}
+
+// shannonEntropy returns the entropy of the characters of the text in bits per character.
+func shannonEntropy(text string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range text {
+		counts[r]++
+		total++
+	}
+	var entropy float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// checkSecretValues reports the changes setting secret properties, see IsSecretKey, to
+// weak values, e.g. "changeme" or "00000000000000000000000000000000" left from a template.
+// The errors of all weak values are joined; they never include the values.
+func checkSecretValues(actions []PlanAction) error {
+	var errs []error
+	for _, action := range actions {
+		if !action.changes() || action.Type == ActionDelete || !IsSecretKey(action.Key) {
+			continue
+		}
+		if reason := weakSecretReason(action.Value); reason != "" {
+			errs = append(errs, fmt.Errorf("weak value for '%s'%s: %s", action.Key, describeSource(action.Source), reason))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestWeakSecretReason tests recognizing placeholder and weak values of secrets.
+func TestWeakSecretReason(t *testing.T) {
+	tests := []struct {
+		value string
+		weak  bool
+	}{
+		{"", false},
+		{"8f2a71c4e5b94d0e9a3c6b1f7d2e4a90", false},
+		{"changeme", true},
+		{"CHANGE_ME", true},
+		{"your-api-key", true},
+		{"00000000000000000000000000000000", true},
+		{"abc123", true},
+		{"abababababababab", true},
+		{"correct-horse-battery", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if reason := weakSecretReason(tt.value); (reason != "") != tt.weak {
+				t.Fatalf("Expected weak %v for %q, got reason %q", tt.weak, tt.value, reason)
+			}
+		})
+	}
+}
+
+// TestCheckSecretValues tests that weak secrets are logged, or refused with WithStrictSecrets.
+func TestCheckSecretValues(t *testing.T) {
+	original := "<Config><ApiKey>8f2a71c4e5b94d0e9a3c6b1f7d2e4a90</ApiKey><LogLevel>info</LogLevel></Config>"
+	run := func(opts ...Option) (mapFS, string, error) {
+		fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte(original)}}}
+		var logs strings.Builder
+		opts = append([]Option{
+			WithFS(fsys),
+			WithConfigPath("config.xml"),
+			WithSources(StaticSource(Override{Key: "ApiKey", Value: "changeme", Source: "env:CONFIGARR__APIKEY"}, Override{Key: "LogLevel", Value: "test"})),
+			WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		}, opts...)
+		_, err := Run(context.Background(), opts...)
+		return fsys, logs.String(), err
+	}
+
+	fsys, logs, err := run()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(logs, "weak value for 'ApiKey', from env:CONFIGARR__APIKEY: it is a placeholder") || strings.Contains(logs, "LogLevel'") {
+		t.Fatalf("Expected a warning for the API key only, got: %s", logs)
+	}
+	if !strings.Contains(string(fsys.MapFS["config.xml"].Data), "changeme") {
+		t.Fatalf("Expected the weak value to be written, got: %s", fsys.MapFS["config.xml"].Data)
+	}
+
+	t.Run("Strict", func(t *testing.T) {
+		fsys, _, err := run(WithStrictSecrets())
+		if !errors.Is(err, ErrInvalid) || strings.Contains(err.Error(), "changeme") {
+			t.Fatalf("Expected ErrInvalid without the value, got: %v", err)
+		}
+		if string(fsys.MapFS["config.xml"].Data) != original {
+			t.Fatalf("Expected file to be untouched, got: %s", fsys.MapFS["config.xml"].Data)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package configarr
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Store holds a configuration shared between goroutines, e.g. the handlers of a
+// long-running server. The stored configuration is never modified in place:
+// Apply swaps in an updated copy, so readers always see a consistent snapshot.
+type Store struct {
+	mu     sync.RWMutex
+	config *Config
+}
+
+// NewStore returns a Store holding a copy of the configuration.
+func NewStore(config *Config) *Store {
+	return &Store{config: config.Clone()}
+}
+
+// Get returns the value of a property and whether it exists.
+func (s *Store) Get(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, exists := s.config.Properties[key]
+	return value, exists
+}
+
+// Snapshot returns a copy of the current configuration.
+func (s *Store) Snapshot() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.config.Clone()
+}
+
+// Diff computes the actions the overrides would cause on the current configuration.
+func (s *Store) Diff(overrides []Override, catalog *Catalog) []PlanAction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return Differ{Catalog: catalog}.Diff(s.config, overrides)
+}
+
+// Apply applies the overrides to a copy of the current configuration and stores
+// the result. Concurrent calls are serialized. Returns a map of changed properties.
+func (s *Store) Apply(overrides []Override, logger *slog.Logger) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := s.config.Clone()
+	changed := applyOverrides(updated, overrides, logger)
+	s.config = updated
+	return changed
+}
@@ -0,0 +1,43 @@
+package configarr
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// TestStore tests concurrent reads and updates of a shared configuration.
+// Run with -race to detect unsynchronized access.
+func TestStore(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	config := &Config{Properties: map[string]string{"Port": "8989"}, Keys: []string{"Port"}}
+	store := NewStore(config)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			store.Apply([]Override{{Key: "Port", Value: fmt.Sprint(9000 + i)}}, logger)
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, exists := store.Get("Port"); !exists {
+				t.Error("Expected Port to exist")
+			}
+			snapshot := store.Snapshot()
+			snapshot.Properties["Port"] = "1"
+			_ = store.Diff([]Override{{Key: "Port", Value: "1"}}, nil)
+		}()
+	}
+	wg.Wait()
+
+	if config.Properties["Port"] != "8989" {
+		t.Fatalf("Expected the original configuration to be unmodified, got '%s'", config.Properties["Port"])
+	}
+	if value, _ := store.Get("Port"); value == "1" || value == "8989" {
+		t.Fatalf("Expected Port to hold one of the applied values, got '%s'", value)
+	}
+}
@@ -0,0 +1,126 @@
+package configarr
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// WarningCode identifies the kind of a Warning, so callers can act on warnings without
+// parsing log messages.
+type WarningCode string
+
+// Codes of the warnings of a run.
+const (
+	WarningInvalidEnv     WarningCode = "invalid-env"     // Environment variable that isn't KEY=VALUE after the prefix
+	WarningUnknownKey     WarningCode = "unknown-key"     // Override of a key neither in the file nor in the catalog
+	WarningSkippedGroup   WarningCode = "skipped-group"   // Override skipped with the rest of its key group
+	WarningRenameConflict WarningCode = "rename-conflict" // Rename by a rule to a key that already exists
+	WarningUnwritable     WarningCode = "unwritable"      // Configuration file skipped since it can't be written
+	WarningConflict       WarningCode = "conflict"        // Configuration file changed while updating, retried
+	WarningWeakSecret     WarningCode = "weak-secret"     // Secret property written with a weak value
+	WarningValidation     WarningCode = "validation"      // Failed validation in ValidationModeWarn
+	WarningBackup         WarningCode = "backup"          // Old backups that couldn't be listed or removed
+	WarningNotification   WarningCode = "notification"    // Notification that couldn't be sent
+	WarningProvenance     WarningCode = "provenance"      // Changes that couldn't be recorded in the state file
+	WarningRecovered      WarningCode = "recovered"       // Empty configuration file seeded, see WithRecoverEmpty
+	WarningWriteRetry     WarningCode = "write-retry"     // Change set queued by Watch after a failed write
+	WarningOther          WarningCode = "other"           // Warning without a code, e.g. logged by a custom Source
+)
+
+// Warning is a warning logged during a run, see Result.Warnings.
+type Warning struct {
+	Code    WarningCode
+	Key     string // Property the warning is about, if any
+	Message string // Message as logged
+}
+
+// warningAttrKey is the key of the attribute tagging warnings with their code and key. It
+// is removed before the warning reaches the handler of the logger.
+const warningAttrKey = "configarr.warning"
+
+// warningAttr returns the attribute tagging a logged warning with its code and the
+// property it is about, if any.
+func warningAttr(code WarningCode, key string) slog.Attr {
+	return slog.Group(warningAttrKey, "code", string(code), "key", key)
+}
+
+// warningCollector collects the warnings logged through the loggers of its handlers.
+type warningCollector struct {
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+// take returns the warnings collected since the last call.
+func (c *warningCollector) take() []Warning {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	warnings := c.warnings
+	c.warnings = nil
+	return warnings
+}
+
+// collectWarnings returns a logger passing the records to the handler of logger, which
+// also adds the warnings to the collector.
+func collectWarnings(logger *slog.Logger, collector *warningCollector) *slog.Logger {
+	return slog.New(warningHandler{Handler: logger.Handler(), collector: collector})
+}
+
+// warningHandler is a slog.Handler adding the warnings to a collector before passing
+// them on without their warningAttr.
+type warningHandler struct {
+	slog.Handler
+	collector *warningCollector
+}
+
+// Enabled reports whether the handler handles records of the level. Warnings are always
+// collected, even when the wrapped handler drops them.
+func (h warningHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.Handler.Enabled(ctx, level)
+}
+
+// Handle collects warnings and passes the record on.
+func (h warningHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level < slog.LevelWarn {
+		return h.Handler.Handle(ctx, record)
+	}
+
+	warning := Warning{Code: WarningOther, Message: record.Message}
+	stripped := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key != warningAttrKey {
+			stripped.AddAttrs(attr)
+			return true
+		}
+		for _, field := range attr.Value.Group() {
+			switch field.Key {
+			case "code":
+				warning.Code = WarningCode(field.Value.String())
+			case "key":
+				warning.Key = field.Value.String()
+			}
+		}
+		return true
+	})
+	h.collector.mu.Lock()
+	h.collector.warnings = append(h.collector.warnings, warning)
+	h.collector.mu.Unlock()
+
+	if !h.Handler.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, stripped)
+}
+
+// WithAttrs returns a handler with the attributes that collects into the same collector.
+func (h warningHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return warningHandler{Handler: h.Handler.WithAttrs(attrs), collector: h.collector}
+}
+
+// WithGroup returns a handler with the group that collects into the same collector.
+func (h warningHandler) WithGroup(name string) slog.Handler {
+	return warningHandler{Handler: h.Handler.WithGroup(name), collector: h.collector}
+}
@@ -0,0 +1,53 @@
+package configarr
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestRun_Warnings tests that the warnings of a run are returned with their codes, while
+// the log messages stay the same.
+func TestRun_Warnings(t *testing.T) {
+	fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte("<Config><Port>8989</Port></Config>")}}}
+	environ := []string{"CONFIGARR__PORT=Port=8990", "CONFIGARR__BROKEN=Port", "CONFIGARR__TYPO=Prot=1"}
+
+	var logs strings.Builder
+	result, err := Run(context.Background(),
+		WithFS(fsys),
+		WithConfigPath("config.xml"),
+		WithSources(EnvSource(environ, "CONFIGARR__")),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []Warning{
+		{Code: WarningInvalidEnv, Message: "Invalid key-value pair in environment variable: CONFIGARR__BROKEN=Port"},
+		{Code: WarningUnknownKey, Key: "Prot", Message: "Skipping 'Prot': unknown key, not present in the configuration file or catalog"},
+	}
+	if !reflect.DeepEqual(result.Warnings, expected) {
+		t.Fatalf("Expected warnings %+v, got %+v", expected, result.Warnings)
+	}
+	if !strings.Contains(logs.String(), "Skipping 'Prot'") || strings.Contains(logs.String(), warningAttrKey) {
+		t.Fatalf("Expected the warnings to be logged without their codes, got: %s", logs.String())
+	}
+
+	t.Run("Warnings without code", func(t *testing.T) {
+		source := SourceFunc(func(ctx context.Context, logger *slog.Logger) ([]Override, error) {
+			logger.Warn("Custom warning")
+			return nil, nil
+		})
+		result, err := Run(context.Background(), WithFS(fsys), WithConfigPath("config.xml"), WithSources(source))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := []Warning{{Code: WarningOther, Message: "Custom warning"}}; !reflect.DeepEqual(result.Warnings, expected) {
+			t.Fatalf("Expected warnings %+v, got %+v", expected, result.Warnings)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// DefaultWatchInterval is the default interval Watch polls the configuration file with.
+const DefaultWatchInterval = 2 * time.Second
+
+// Default delays of Watch before retrying change sets whose write failed, see
+// WithWriteRetryDelay.
+const (
+	DefaultWriteRetryDelay    = time.Second
+	DefaultMaxWriteRetryDelay = 5 * time.Minute
+)
+
+// Watch applies the overrides like Run, then keeps re-applying them whenever the
+// configuration file changes, e.g. when the app rewrites it after a settings change, until
+// the context is done. The file is polled every interval and a change is only acted on
+// once the file stayed the same for the debounce window, another interval by default (see
+// WithWatchDebounce), so a rewrite in progress is not read and rewrites in quick
+// succession cause a single run. Writes of Watch itself don't trigger a run. Sources are read once, and the result
+// of every run is passed to handle, if given.
+//
+// When writing fails, e.g. since the file is locked or on a transient I/O error, the change
+// set of the run is queued and retried with a delay doubling after every failure (see
+// WithWriteRetryDelay), without waiting for the file to change again. A successful run
+// applies all queued change sets, since they come from the same overrides. Result.Queued
+// reports how many are waiting. Other failed runs are retried on the next change. Watch
+// returns nil when the context is done, after delivering the changes notifiers such as
+// ThrottledNotifier held back.
+func Watch(ctx context.Context, interval time.Duration, handle func(Result, error), opts ...Option) error {
+	o, err := newOptions(opts)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	debounce := o.watchDebounce
+	if debounce <= 0 {
+		debounce = interval
+	}
+
+	overrides, err := readSources(ctx, o)
+	if err != nil {
+		return err
+	}
+	defer flushNotifiers(context.WithoutCancel(ctx), o.notifiers, o.logger) // Held back changes aren't lost on shutdown
+
+	var queue []ChangeSet
+	var delay time.Duration // Until the queue is retried, zero without a retry
+	retrying := false
+	for {
+		result, err := run(ctx, overrides, o, o.clock.Now())
+		if ctx.Err() != nil {
+			return nil
+		}
+		switch {
+		case err == nil:
+			if len(queue) > 0 {
+				o.logger.Info(fmt.Sprintf("Applied %d queued change sets of %s.", len(queue), o.configPath))
+			}
+			queue, delay = nil, 0
+		case errors.Is(err, ErrWrite) && o.writeRetryDelay > 0:
+			if !retrying && len(result.ChangeSet.Changes) > 0 {
+				queue = append(queue, result.ChangeSet)
+			}
+			if len(queue) > 0 {
+				delay = nextRetryDelay(delay, o.writeRetryDelay, o.maxWriteRetryDelay)
+				o.logger.Warn(fmt.Sprintf("Writing %s failed. Retrying %d queued change sets in %s.", o.configPath, len(queue), delay), warningAttr(WarningWriteRetry, ""))
+			}
+		}
+		result.Queued = len(queue)
+		if handle != nil {
+			handle(result, err)
+		}
+
+		last := statFile(o.fs, o.configPath)
+		retrying = false
+		for waited := time.Duration(0); ; {
+			step := interval
+			if delay > 0 && delay-waited < step {
+				step = delay - waited
+			}
+			if sleep(ctx, step) != nil {
+				return nil
+			}
+			waited += step
+			if current := statFile(o.fs, o.configPath); !current.equal(last) {
+				break
+			}
+			if delay > 0 && waited >= delay {
+				retrying = true
+				break
+			}
+		}
+		if retrying {
+			continue // The file didn't change, so it needn't settle
+		}
+
+		o.logger.Info(fmt.Sprintf("Configuration file %s changed. Re-applying overrides.", o.configPath))
+		if err := waitForStableFile(ctx, o.fs, o.configPath, debounce, o.settleTimeout, o.clock, o.logger); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			o.logger.Warn(err.Error()) // Applied anyway, the next change is caught as usual
+		}
+	}
+}
+
+// nextRetryDelay returns the delay before the next retry: initial for the first one, then
+// twice the previous delay, up to max, if set.
+func nextRetryDelay(previous, initial, max time.Duration) time.Duration {
+	delay := initial
+	if previous > 0 {
+		delay = 2 * previous
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// fileStamp identifies a version of a file by its modification time and size.
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// statFile returns the stamp of the file. Files that can't be stat'ed, e.g. because
+// they don't exist, get the zero stamp.
+func statFile(fsys fs.StatFS, name string) fileStamp {
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, modTime: info.ModTime(), size: info.Size()}
+}
+
+// equal reports whether both stamps identify the same version of the file.
+func (s fileStamp) equal(other fileStamp) bool {
+	return s.exists == other.exists && s.modTime.Equal(other.modTime) && s.size == other.size
+}
@@ -0,0 +1,192 @@
+package configarr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// TestWatch tests re-applying the overrides when the app rewrites the configuration file.
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(path, []byte("<Config><Port>8990</Port></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan Result)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, 10*time.Millisecond, func(result Result, err error) {
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			results <- result
+		},
+			WithConfigPath(path),
+			WithSources(StaticSource(Override{Key: "Port", Value: "8989"})),
+			WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		)
+	}()
+
+	receive := func() Result {
+		select {
+		case result := <-results:
+			return result
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a run")
+			return Result{}
+		}
+	}
+
+	if result := receive(); result.Changed["Port"] != "8989" {
+		t.Fatalf("Expected Port to be changed by the first run, got %+v", result.Changed)
+	}
+
+	// The app reverts the value while rewriting its file
+	if err := os.WriteFile(path, []byte("<Config><Port>8990</Port><LogLevel>info</LogLevel></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+	if result := receive(); result.Changed["Port"] != "8989" {
+		t.Fatalf("Expected Port to be changed again after the rewrite, got %+v", result.Changed)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "<Port>8989</Port>") {
+		t.Fatalf("Expected the override to be re-applied, got:\n%s", data)
+	}
+
+	select {
+	case result := <-results:
+		t.Fatalf("Unexpected run after writing the file itself: %+v", result)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// TestWatch_Debounce tests that rewrites within the debounce window cause a single run.
+func TestWatch_Debounce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(path, []byte("<Config><Port>8990</Port></Config>"), 0644); err != nil {
+		t.Fatalf("Unexpected error writing file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan Result, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, 10*time.Millisecond, func(result Result, err error) {
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			results <- result
+		},
+			WithConfigPath(path),
+			WithSources(StaticSource(Override{Key: "Port", Value: "8989"})),
+			WithWatchDebounce(200*time.Millisecond),
+			WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		)
+	}()
+
+	select {
+	case <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the first run")
+	}
+
+	// The app rewrites its file several times in quick succession
+	for i := 1; i <= 5; i++ {
+		content := "<Config><Port>8990</Port><LogLevel>" + strings.Repeat("x", i) + "</LogLevel></Config>"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+
+	select {
+	case result := <-results:
+		if result.Changed["Port"] != "8989" {
+			t.Fatalf("Expected Port to be changed again after the rewrites, got %+v", result.Changed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a run")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "<Config><Port>8989</Port><LogLevel>xxxxx</LogLevel></Config>" {
+		t.Fatalf("Expected the override applied to the last rewrite, got:\n%s", data)
+	}
+
+	select {
+	case result := <-results:
+		t.Fatalf("Expected the rewrites to be coalesced into one run, got another: %+v", result)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// TestWatch_WriteRetries tests that change sets whose write failed are retried with a
+// growing delay without waiting for the file to change.
+func TestWatch_WriteRetries(t *testing.T) {
+	fsys := mapFS{fstest.MapFS{"config.xml": &fstest.MapFile{Data: []byte("<Config><Port>8990</Port></Config>")}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type run struct {
+		result Result
+		err    error
+	}
+	runs := make(chan run)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, time.Hour, func(result Result, err error) {
+			runs <- run{result, err}
+		},
+			WithFS(FaultFS(fsys, Faults{WriteFailures: 2})),
+			WithConfigPath("config.xml"),
+			WithWriteRetryDelay(10*time.Millisecond, 15*time.Millisecond),
+			WithSources(StaticSource(Override{Key: "Port", Value: "8989"})),
+		)
+	}()
+
+	for i, expected := range []int{1, 1, 0} {
+		select {
+		case run := <-runs:
+			if (run.err != nil) != (expected > 0) || run.result.Queued != expected {
+				t.Fatalf("Expected %d queued change sets on run %d, got %d (error: %v)", expected, i+1, run.result.Queued, run.err)
+			}
+			if expected > 0 && !errors.Is(run.err, ErrWrite) {
+				t.Fatalf("Expected a write error on run %d, got: %v", i+1, run.err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for run %d", i+1)
+		}
+	}
+	if written := string(fsys.MapFS["config.xml"].Data); !strings.Contains(written, "<Port>8989</Port>") {
+		t.Fatalf("Expected the queued change to be written, got: %s", written)
+	}
+
+	if delay := nextRetryDelay(10*time.Millisecond, 10*time.Millisecond, 15*time.Millisecond); delay != 15*time.Millisecond {
+		t.Fatalf("Expected the delay to be capped, got %s", delay)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
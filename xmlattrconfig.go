@@ -0,0 +1,191 @@
+package configarr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// defaultAttrRoot is the name of the root element of attribute documents written from
+// scratch, as in Plex's Preferences.xml.
+const defaultAttrRoot = "Preferences"
+
+// xmlAttr is an attribute of the root element of an attribute document. The offsets are
+// relative to the start of the document.
+type xmlAttr struct {
+	key        string
+	value      string // Value as parsed, with entities resolved
+	start      int    // Start of the whitespace before the name
+	valueStart int    // Start of the value, after the opening quote
+	valueEnd   int    // End of the value, before the closing quote
+}
+
+// xmlAttrDocument is a parsed attribute document: the source and the attributes of its
+// root element in document order.
+type xmlAttrDocument struct {
+	source []byte
+	root   string
+	attrs  []xmlAttr
+	insert int // End of the last attribute, or of the root name, where created ones go
+}
+
+// xmlAttrFormat is the format of XML files keeping their settings as attributes of the
+// root element, e.g. Plex's Preferences.xml. The attributes are addressed by their name,
+// e.g. ManualPortMappingPort, and child elements are kept as they are.
+type xmlAttrFormat struct{}
+
+// Name returns FormatXMLAttributes.
+func (xmlAttrFormat) Name() string {
+	return FormatXMLAttributes
+}
+
+// Parse parses the document into a Config with a property per attribute of the root
+// element.
+func (xmlAttrFormat) Parse(data []byte) (*Config, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	doc := &xmlAttrDocument{source: data}
+	var start int64
+	var depth int
+	for {
+		offset := d.InputOffset()
+		token, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			if doc.root == "" {
+				doc.root, start = rawName(token.Name), offset
+				if err := doc.scanAttrs(int(start), int(d.InputOffset()), token.Attr); err != nil {
+					return nil, err
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if doc.root == "" {
+		return nil, errors.New("no root element")
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("element <%s> is not closed", doc.root)
+	}
+
+	cfg := &Config{Properties: make(map[string]string), Keys: []string{}, source: data, document: doc}
+	for _, attr := range doc.attrs {
+		if _, exists := cfg.Properties[attr.key]; !exists {
+			cfg.Keys = append(cfg.Keys, attr.key)
+		}
+		cfg.Properties[attr.key] = attr.value
+	}
+	return cfg, nil
+}
+
+// scanAttrs records where the attributes of the start tag in data[start:end] are. The
+// decoder already checked the syntax, so the tag is only split at its quotes.
+func (d *xmlAttrDocument) scanAttrs(start, end int, attrs []xml.Attr) error {
+	tag := d.source[start:end]
+	pos := 1 + len(d.root) // After "<" and the name
+	d.insert = start + pos
+	for _, attr := range attrs {
+		equals := bytes.IndexByte(tag[pos:], '=')
+		if equals < 0 {
+			return fmt.Errorf("malformed attribute %s", rawName(attr.Name))
+		}
+		open := pos + equals + 1 + bytes.IndexAny(tag[pos+equals+1:], `"'`)
+		closing := bytes.IndexByte(tag[open+1:], tag[open])
+		if closing < 0 {
+			return fmt.Errorf("malformed attribute %s", rawName(attr.Name))
+		}
+		d.attrs = append(d.attrs, xmlAttr{
+			key:        rawName(attr.Name),
+			value:      attr.Value,
+			start:      start + pos,
+			valueStart: start + open + 1,
+			valueEnd:   start + open + 1 + closing,
+		})
+		pos = open + 1 + closing + 1
+		d.insert = start + pos
+	}
+	return nil
+}
+
+// rawName returns the name as written, with its namespace prefix, if any.
+func rawName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// Render renders the Config as the original document with only the start tag of the
+// root element changed: changed values are replaced within their quotes, deleted
+// attributes are left out with the whitespace before them, and created ones go after
+// the last attribute. Without an original document, a self-closing <Preferences/>
+// element is written. opts.Compact and opts.Reformat don't apply.
+func (xmlAttrFormat) Render(config *Config, _ RenderOptions) ([]byte, error) {
+	doc, _ := config.document.(*xmlAttrDocument)
+	if doc == nil { // e.g. a Config built in code
+		source := []byte(xml.Header + "<" + defaultAttrRoot + "/>\n")
+		doc = &xmlAttrDocument{source: source, root: defaultAttrRoot, insert: len(xml.Header) + 1 + len(defaultAttrRoot)}
+	}
+
+	var output bytes.Buffer
+	pos := 0
+	seen := make(map[string]bool)
+	for _, attr := range doc.attrs {
+		seen[attr.key] = true
+		value, exists := config.Properties[attr.key]
+		switch {
+		case !exists:
+			output.Write(doc.source[pos:attr.start])
+			pos = attr.valueEnd + 1 // After the closing quote
+		case value != attr.value:
+			output.Write(doc.source[pos:attr.valueStart])
+			output.WriteString(escapeAttr(value))
+			pos = attr.valueEnd
+		}
+	}
+	output.Write(doc.source[pos:doc.insert])
+	for _, key := range config.Keys {
+		value, exists := config.Properties[key]
+		if seen[key] || !exists {
+			continue
+		}
+		if !isXMLName(key) {
+			return nil, fmt.Errorf("cannot create %s: not a valid attribute name", key)
+		}
+		seen[key] = true
+		fmt.Fprintf(&output, ` %s="%s"`, key, escapeAttr(value))
+	}
+	output.Write(doc.source[doc.insert:])
+	return output.Bytes(), nil
+}
+
+// escapeAttr escapes the value for an attribute in double or single quotes.
+func escapeAttr(value string) string {
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(value))
+	return escaped.String()
+}
+
+// isXMLName reports whether the key can be written as an attribute name: a letter or
+// underscore followed by letters, digits, underscores, hyphens, dots or colons.
+func isXMLName(key string) bool {
+	for i, r := range key {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		case i > 0 && (r == '-' || r == '.' || r == ':' || r >= '0' && r <= '9'):
+		default:
+			return false
+		}
+	}
+	return key != ""
+}
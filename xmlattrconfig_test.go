@@ -0,0 +1,125 @@
+package configarr
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestXMLAttributesFormat tests parsing and rendering documents keeping their settings as
+// attributes of the root element.
+func TestXMLAttributesFormat(t *testing.T) {
+	plex := `<?xml version="1.0" encoding="utf-8"?>
+<Preferences MachineIdentifier="0a1b2c" FriendlyName="Living &amp; Room"
+  ManualPortMappingMode='1' ManualPortMappingPort="32400" logDebug="0"/>
+`
+
+	t.Run("Parse attributes", func(t *testing.T) {
+		config, err := XMLAttributesFormat.Parse([]byte(plex))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{
+			"MachineIdentifier":     "0a1b2c",
+			"FriendlyName":          "Living & Room",
+			"ManualPortMappingMode": "1",
+			"ManualPortMappingPort": "32400",
+			"logDebug":              "0",
+		}
+		if !reflect.DeepEqual(config.Properties, expected) {
+			t.Fatalf("Expected properties %v, got %v", expected, config.Properties)
+		}
+		if !reflect.DeepEqual(config.Keys, []string{"MachineIdentifier", "FriendlyName", "ManualPortMappingMode", "ManualPortMappingPort", "logDebug"}) {
+			t.Fatalf("Expected keys in document order, got %v", config.Keys)
+		}
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		for _, document := range []string{plex, "<Preferences/>", `<Preferences a="1"><Child b="2"/></Preferences>`} {
+			config, err := XMLAttributesFormat.Parse([]byte(document))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			output, err := XMLAttributesFormat.Render(config, RenderOptions{Reformat: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(output) != document {
+				t.Fatalf("Expected unchanged document:\n%q\ngot:\n%q", document, output)
+			}
+		}
+	})
+
+	t.Run("Render changes", func(t *testing.T) {
+		config, err := XMLAttributesFormat.Parse([]byte(plex))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		config.Properties["FriendlyName"] = `"Den" <4K>`
+		config.Properties["ManualPortMappingMode"] = "0"
+		delete(config.Properties, "ManualPortMappingPort")
+		config.Keys = append(config.Keys, "secureConnections")
+		config.Properties["secureConnections"] = "1"
+
+		output, err := XMLAttributesFormat.Render(config, RenderOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := `<?xml version="1.0" encoding="utf-8"?>
+<Preferences MachineIdentifier="0a1b2c" FriendlyName="&#34;Den&#34; &lt;4K&gt;"
+  ManualPortMappingMode='0' logDebug="0" secureConnections="1"/>
+`
+		if string(output) != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, output)
+		}
+	})
+
+	t.Run("Render without document", func(t *testing.T) {
+		config := &Config{Properties: map[string]string{"FriendlyName": "nas"}, Keys: []string{"FriendlyName"}}
+		output, err := XMLAttributesFormat.Render(config, RenderOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Preferences FriendlyName=\"nas\"/>\n"; string(output) != expected {
+			t.Fatalf("Expected %q, got %q", expected, output)
+		}
+
+		config.Keys, config.Properties["Friendly Name"] = append(config.Keys, "Friendly Name"), "x"
+		if _, err := XMLAttributesFormat.Render(config, RenderOptions{}); err == nil {
+			t.Fatal("Expected error on an invalid attribute name, but got none")
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for name, data := range map[string]string{
+			"No root element":  "<?xml version=\"1.0\"?>",
+			"Unclosed element": "<Preferences a=\"1\">",
+			"Truncated tag":    "<Preferences a=\"1",
+		} {
+			if _, err := XMLAttributesFormat.Parse([]byte(data)); err == nil {
+				t.Fatalf("Expected error for %s, but got none", strings.ToLower(name))
+			}
+		}
+	})
+
+	t.Run("Detected for Preferences.xml", func(t *testing.T) {
+		fsys := mapFS{fstest.MapFS{"Plex Media Server/Preferences.xml": &fstest.MapFile{Data: []byte(plex)}}}
+		result, err := Run(context.Background(),
+			WithFS(fsys),
+			WithConfigPath("Plex Media Server/Preferences.xml"),
+			WithSources(StaticSource(Override{Key: "ManualPortMappingPort", Value: "32401"})),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Changed["ManualPortMappingPort"] != "32401" {
+			t.Fatalf("Expected ManualPortMappingPort to change, got changes %v", result.Changed)
+		}
+		if written := string(fsys.MapFS["Plex Media Server/Preferences.xml"].Data); written != strings.Replace(plex, `"32400"`, `"32401"`, 1) {
+			t.Fatalf("Expected only the attribute to change, got: %s", written)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package configarr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlDocument is a parsed YAML configuration file.
+type yamlDocument struct {
+	root   *yaml.Node // Document node, nil for empty files
+	indent int        // Spaces per nesting level of the original file
+}
+
+// yamlFormat is the format of YAML configuration files, e.g. Bazarr's config.yaml. Like
+// in JSON files, nested values are addressed by their path with dots, e.g. general.port,
+// and items of sequences by their index.
+type yamlFormat struct{}
+
+// Name returns FormatYAML.
+func (yamlFormat) Name() string {
+	return FormatYAML
+}
+
+// Parse parses the first YAML document into a Config with a property per scalar value.
+// Aliases are not followed, so their values can't be overridden.
+func (yamlFormat) Parse(data []byte) (*Config, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, categorize(ErrParse, fmt.Errorf("error parsing YAML: %w", err))
+	}
+
+	doc := &yamlDocument{indent: detectYAMLIndent(data)}
+	if root.Kind == yaml.DocumentNode {
+		doc.root = &root
+	}
+
+	cfg := &Config{Properties: make(map[string]string), Keys: []string{}, source: data, document: doc}
+	if doc.root != nil {
+		flattenYAML(cfg, doc.root.Content[0], "")
+	}
+	return cfg, nil
+}
+
+// flattenYAML adds a property per scalar below the node, keyed by its path.
+func flattenYAML(cfg *Config, node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			flattenYAML(cfg, node.Content[i+1], joinJSONPath(path, node.Content[i].Value))
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			flattenYAML(cfg, item, joinJSONPath(path, strconv.Itoa(i)))
+		}
+	case yaml.ScalarNode:
+		if path == "" {
+			return // Scalar document, nothing to address
+		}
+		if _, exists := cfg.Properties[path]; !exists {
+			cfg.Keys = append(cfg.Keys, path)
+		}
+		cfg.Properties[path] = yamlProperty(node)
+	}
+}
+
+// yamlProperty returns the value of a scalar as a property, with null as the empty string.
+func yamlProperty(node *yaml.Node) string {
+	if node.Tag == "!!null" {
+		return ""
+	}
+	return node.Value
+}
+
+// detectYAMLIndent returns the number of spaces the first indented line is indented
+// with, or 2 when no line is.
+func detectYAMLIndent(data []byte) int {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		content := bytes.TrimLeft(line, " ")
+		if len(content) > 0 && len(content) < len(line) && content[0] != '#' && content[0] != '-' {
+			return len(line) - len(content)
+		}
+	}
+	return 2
+}
+
+// Render renders the Config as a YAML document, keeping the order of keys and the
+// comments of the original file; only the indentation is normalized. Changed values keep
+// the type of the value they replace, created properties are added with mappings as
+// needed, and deleted properties are left out. With opts.Compact, the document is
+// written in flow style on a single line. Files without a document, e.g. only comments,
+// are kept as they are, followed by the created properties.
+func (yamlFormat) Render(config *Config, opts RenderOptions) ([]byte, error) {
+	doc, _ := config.document.(*yamlDocument)
+	root := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	indent := 2
+	if doc != nil && doc.root != nil {
+		root, indent = copyYAMLNode(doc.root), doc.indent
+	}
+	bare := doc == nil || doc.root == nil
+	var head []byte // Content of a file without a document, kept before the created properties
+	if bare && len(config.source) > 0 {
+		head = append(head, config.source...)
+		if !bytes.HasSuffix(head, []byte("\n")) {
+			head = append(head, '\n')
+		}
+	}
+
+	seen := make(map[string]bool)
+	updateYAMLNode(root.Content[0], "", config.Properties, seen)
+	for _, key := range config.Keys {
+		value, exists := config.Properties[key]
+		if seen[key] || !exists {
+			continue
+		}
+		if err := insertYAMLNode(root.Content[0], strings.Split(key, "."), value); err != nil {
+			return nil, fmt.Errorf("cannot create %s: %w", key, err)
+		}
+	}
+	if bare && len(root.Content[0].Content) == 0 {
+		return config.source, nil
+	}
+	if opts.Compact {
+		root.Content[0].Style = yaml.FlowStyle
+	}
+
+	output := bytes.NewBuffer(head)
+	encoder := yaml.NewEncoder(output)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(root); err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("error encoding YAML: %w", err)
+	}
+	return output.Bytes(), nil
+}
+
+// copyYAMLNode returns a deep copy of the node, so rendering leaves the parsed document
+// untouched.
+func copyYAMLNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyYAMLNode(child)
+	}
+	return &copied
+}
+
+// updateYAMLNode sets the values of the properties in the scalars below the node and
+// removes the scalars of deleted properties. Visited paths are recorded in seen. Reports
+// whether the node itself was deleted.
+func updateYAMLNode(node *yaml.Node, path string, properties map[string]string, seen map[string]bool) bool {
+	switch node.Kind {
+	case yaml.MappingNode:
+		kept := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !updateYAMLNode(node.Content[i+1], joinJSONPath(path, node.Content[i].Value), properties, seen) {
+				kept = append(kept, node.Content[i], node.Content[i+1])
+			}
+		}
+		node.Content = kept
+		return false
+	case yaml.SequenceNode:
+		var kept []*yaml.Node
+		for i, item := range node.Content {
+			if !updateYAMLNode(item, joinJSONPath(path, strconv.Itoa(i)), properties, seen) {
+				kept = append(kept, item)
+			}
+		}
+		node.Content = kept
+		return false
+	case yaml.ScalarNode:
+		if path == "" {
+			return false
+		}
+		seen[path] = true
+		value, exists := properties[path]
+		if !exists {
+			return true
+		}
+		if value != yamlProperty(node) {
+			setYAMLScalar(node, value)
+		}
+	}
+	return false
+}
+
+// setYAMLScalar sets the value of the node. Strings and nulls become quoted strings when
+// the value would read as another type; other scalars, e.g. ports, stay plain.
+func setYAMLScalar(node *yaml.Node, value string) {
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!str" || node.Tag == "!!null" {
+		node.Tag = "!!str"
+	} else {
+		node.Tag = ""
+	}
+	node.Kind, node.Value, node.Style = yaml.ScalarNode, value, node.Style&^(yaml.LiteralStyle|yaml.FoldedStyle)
+}
+
+// insertYAMLNode adds the value at the path below the mapping, creating the mappings in
+// between. The value is written plain, so it reads as a number or boolean if it is one.
+func insertYAMLNode(node *yaml.Node, path []string, value string) error {
+	for i, name := range path {
+		if node.Kind != yaml.MappingNode {
+			return errors.New("parent is not a mapping")
+		}
+		var child *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == name {
+				child = node.Content[j+1]
+			}
+		}
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			if i == len(path)-1 {
+				child = &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, child)
+		} else if i == len(path)-1 {
+			return errors.New("value already exists")
+		}
+		node = child
+	}
+	return nil
+}
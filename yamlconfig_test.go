@@ -0,0 +1,162 @@
+package configarr
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestYAMLFormat tests parsing and rendering YAML configuration files.
+func TestYAMLFormat(t *testing.T) {
+	settings := `# Bazarr settings
+general:
+  ip: 0.0.0.0
+  port: 6767 # Web UI
+  base_url: ''
+  debug: false
+sonarr:
+  apikey: null
+  excluded_tags:
+    - anime
+    - kids
+`
+
+	t.Run("Parse nested keys", func(t *testing.T) {
+		config, err := YAMLFormat.Parse([]byte(settings))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := map[string]string{
+			"general.ip":             "0.0.0.0",
+			"general.port":           "6767",
+			"general.base_url":       "",
+			"general.debug":          "false",
+			"sonarr.apikey":          "",
+			"sonarr.excluded_tags.0": "anime",
+			"sonarr.excluded_tags.1": "kids",
+		}
+		if !reflect.DeepEqual(config.Properties, expected) {
+			t.Fatalf("Expected properties %v, got %v", expected, config.Properties)
+		}
+		if config.Keys[0] != "general.ip" || config.Keys[6] != "sonarr.excluded_tags.1" {
+			t.Fatalf("Expected keys in document order, got %v", config.Keys)
+		}
+	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		config, err := YAMLFormat.Parse([]byte(settings))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		output, err := YAMLFormat.Render(config, RenderOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(output) != settings {
+			t.Fatalf("Expected unchanged document:\n%s\ngot:\n%s", settings, output)
+		}
+	})
+
+	t.Run("Render changes", func(t *testing.T) {
+		config, err := YAMLFormat.Parse([]byte(settings))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		config.Properties["general.port"] = "6768"
+		config.Properties["general.base_url"] = "/bazarr"
+		config.Properties["general.debug"] = "true"
+		config.Properties["sonarr.apikey"] = "123"
+		delete(config.Properties, "sonarr.excluded_tags.0")
+		config.Keys = append(config.Keys, "radarr.port")
+		config.Properties["radarr.port"] = "7878"
+
+		output, err := YAMLFormat.Render(config, RenderOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := `# Bazarr settings
+general:
+  ip: 0.0.0.0
+  port: 6768 # Web UI
+  base_url: '/bazarr'
+  debug: true
+sonarr:
+  apikey: "123"
+  excluded_tags:
+    - kids
+radarr:
+  port: 7878
+`
+		if string(output) != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, output)
+		}
+	})
+
+	t.Run("Run with overrides", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(settings), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		environ := []string{"CONFIGARR__PORT=general.port=6768"}
+		if _, err := Run(context.Background(), WithConfigPath(path), WithSources(EnvSource(environ, DefaultPrefix))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		config, err := ReadConfigFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if config.Properties["general.port"] != "6768" || config.Properties["general.ip"] != "0.0.0.0" {
+			t.Fatalf("Unexpected properties %v", config.Properties)
+		}
+	})
+
+	t.Run("Comments only", func(t *testing.T) {
+		comments := "# Bazarr settings\n# port: 6767"
+		config, err := YAMLFormat.Parse([]byte(comments))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		output, err := YAMLFormat.Render(config, RenderOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(output) != comments {
+			t.Fatalf("Expected the comments to be kept, got:\n%s", output)
+		}
+
+		config.Keys = append(config.Keys, "general.port")
+		config.Properties["general.port"] = "6768"
+		output, err = YAMLFormat.Render(config, RenderOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if expected := comments + "\ngeneral:\n  port: 6768\n"; string(output) != expected {
+			t.Fatalf("Expected:\n%s\ngot:\n%s", expected, output)
+		}
+	})
+
+	t.Run("Run without changes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		unformatted := "general:\n    port: 6767\n"
+		if err := os.WriteFile(path, []byte(unformatted), 0644); err != nil {
+			t.Fatalf("Unexpected error writing file: %v", err)
+		}
+
+		environ := []string{"CONFIGARR__PORT=general.port=6767"}
+		result, err := Run(context.Background(), WithConfigPath(path), WithSources(EnvSource(environ, DefaultPrefix)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Written {
+			t.Fatal("Expected the unchanged file not to be written")
+		}
+		if data, _ := os.ReadFile(path); string(data) != unformatted {
+			t.Fatalf("Expected the file to be left alone, got:\n%s", data)
+		}
+	})
+}